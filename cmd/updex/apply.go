@@ -0,0 +1,105 @@
+package updex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/updex/updex"
+	"github.com/spf13/cobra"
+)
+
+var (
+	applyComponent string
+	applyNoVacuum  bool
+)
+
+func newApplyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Install staged updates",
+		Long: `Install the versions staged by 'updex features update --stage'.
+
+A staged update is downloaded and verified but not installed: the sysext
+link still points at the old version, so no refresh, crash or reboot can
+activate it. apply moves each staged image into place, links it, removes
+old versions, and refreshes systemd-sysext once.
+
+With --no-refresh the new versions are linked but merged only by a later
+refresh or reboot. The early-boot unit installed by
+'updex daemon enable --apply-at-boot' runs 'updex apply --no-refresh'
+before systemd-sysext merges, so updates take effect only across a reboot.
+
+OUTPUT COLUMNS:
+  FEATURE    - Feature the component belongs to
+  COMPONENT  - Component applied
+  FROM       - Version current before applying
+  VERSION    - Staged version installed
+  STATUS     - "applied", or the error
+
+Requires root privileges.`,
+		Example: `  # Install everything staged and activate it now
+  sudo updex apply
+
+  # Install staged versions, activate at next boot
+  sudo updex apply --no-refresh
+
+  # Preview what is staged
+  sudo updex --dry-run apply`,
+		Args: cobra.NoArgs,
+		RunE: runApply,
+	}
+
+	cmd.Flags().StringVar(&applyComponent, "component", "", "Scope the operation to a single named systemd-sysupdate component")
+	cmd.Flags().BoolVar(&applyNoVacuum, "no-vacuum", false, "Skip removing old versions after applying")
+
+	return cmd
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+
+	results, err := newClient().Apply(cmd.Context(), updex.ApplyOptions{
+		DryRun:    clix.DryRun,
+		NoRefresh: noRefresh,
+		NoVacuum:  applyNoVacuum,
+		Component: applyComponent,
+	})
+
+	if clix.JSONOutput {
+		if results == nil {
+			results = []updex.ApplyResult{}
+		}
+		_, jsonErr := clix.OutputJSON(results)
+		return errors.Join(err, jsonErr)
+	}
+
+	if len(results) == 0 {
+		fmt.Println("Nothing staged.")
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "FEATURE\tCOMPONENT\tFROM\tVERSION\tSTATUS")
+	for _, r := range results {
+		from := r.FromVersion
+		if from == "" {
+			from = "-"
+		}
+		status := "applied"
+		switch {
+		case r.Error != "":
+			status = r.Error
+		case r.DryRun:
+			status = "would apply"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Feature, r.Component, from, r.Version, status)
+	}
+	_ = w.Flush()
+
+	return err
+}
@@ -0,0 +1,51 @@
+package updex
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/frostyard/clix"
+	"github.com/spf13/cobra"
+)
+
+func TestRunApply_RejectsNonRoot(t *testing.T) {
+	oldGetEUID := getEUID
+	t.Cleanup(func() { getEUID = oldGetEUID })
+	getEUID = func() int { return 1000 }
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(t.Context())
+	if err := runApply(cmd, nil); err == nil || !strings.Contains(err.Error(), "root privileges") {
+		t.Fatalf("expected root-privileges error, got: %v", err)
+	}
+}
+
+// TestRunApply_NothingStaged verifies the text output when no component
+// has a staged update.
+func TestRunApply_NothingStaged(t *testing.T) {
+	configDir := t.TempDir()
+	writeFeatureFile(t, configDir, "testfeature", true)
+	writeFeatureTransferFile(t, configDir, t.TempDir(), "testext", "testfeature", "http://127.0.0.1:0")
+
+	oldDefinitions, oldJSONOutput, oldGetEUID := definitions, clix.JSONOutput, getEUID
+	t.Cleanup(func() {
+		definitions = oldDefinitions
+		clix.JSONOutput = oldJSONOutput
+		getEUID = oldGetEUID
+	})
+	definitions = configDir
+	clix.JSONOutput = false
+	getEUID = func() int { return 0 }
+
+	output, err := captureStdout(t, func() error {
+		cmd := &cobra.Command{}
+		cmd.SetContext(t.Context())
+		return runApply(cmd, nil)
+	})
+	if err != nil {
+		t.Fatalf("runApply failed: %v", err)
+	}
+	if strings.TrimSpace(output) != "Nothing staged." {
+		t.Errorf("runApply output = %q, want %q", output, "Nothing staged.")
+	}
+}
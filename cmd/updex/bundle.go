@@ -0,0 +1,175 @@
+package updex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/updex/updex"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bundleComponent string
+	bundleNoVacuum  bool
+)
+
+func newBundleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Carry updates to offline machines",
+		Long: `Stage updates on a connected machine and install them on disconnected ones.
+
+A bundle is a single tar archive holding, for each transfer of the selected
+features, the image 'features update' would install (the pinned version,
+or the newest phasing offers this machine) together with the signed
+SHA256SUMS and SHA256SUMS.gpg that list it, plus the .feature and .transfer definitions.
+
+'bundle import' verifies every SHA256SUMS against the local keyring and
+installs through the same path as 'features update': hash check, sysext
+link, vacuum. Images are matched to this machine's enabled transfers by
+component name, so the local definitions decide where they go. The
+definitions inside the bundle are carried for reference only and are never
+installed: nothing signs them.
+
+SUBCOMMANDS:
+  export  Write a bundle for enabled (or named) features
+  import  Verify a bundle and install its images`,
+		Example: `  # On a connected machine: bundle every enabled feature
+  updex bundle export updates.tar
+
+  # Bundle two features only
+  updex bundle export updates.tar docker devel
+
+  # On the offline machine: verify and install
+  sudo updex bundle import updates.tar`,
+	}
+
+	cmd.PersistentFlags().StringVar(&bundleComponent, "component", "", "Scope the operation to a single named systemd-sysupdate component")
+
+	cmd.AddCommand(newBundleExportCmd())
+	cmd.AddCommand(newBundleImportCmd())
+
+	return cmd
+}
+
+func newBundleExportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "export FILE [FEATURE...]",
+		Short: "Write an offline bundle",
+		Long: `Write an offline bundle to FILE for the named features, or for every
+enabled feature when none are named.
+
+Each source must publish a SHA256SUMS.gpg that verifies against the local
+keyring, whatever the transfer's Verify= setting: the importing machine
+trusts nothing else in the bundle. OCI sources cannot be bundled.
+
+OUTPUT COLUMNS:
+  COMPONENT  - Transfer the image belongs to
+  VERSION    - Version bundled (the pin, or the newest offered)
+  FILE       - Image file name`,
+		Example: `  # Bundle every enabled feature
+  updex bundle export updates.tar
+
+  # Bundle one feature in JSON format
+  updex bundle export updates.tar docker --json`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runBundleExport,
+	}
+}
+
+func newBundleImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Verify a bundle and install its images",
+		Long: `Verify the offline bundle in FILE against the local keyring and install
+its images for this machine's enabled transfers.
+
+The bundle is unpacked under /var/tmp while it is installed; it may not
+unpack to more than 64 GiB.
+
+OPTIONS:
+  --no-refresh  Skip running systemd-sysext refresh after import
+  --no-vacuum   Skip removing old versions after import
+
+Use --dry-run (global flag) to verify the bundle and preview installs
+without modifying filesystem or sysext state.
+
+Requires root privileges.`,
+		Example: `  # Install a bundle
+  sudo updex bundle import updates.tar
+
+  # Verify it and preview what would change
+  sudo updex --dry-run bundle import updates.tar`,
+		Args: cobra.ExactArgs(1),
+		RunE: runBundleImport,
+	}
+
+	cmd.Flags().BoolVar(&bundleNoVacuum, "no-vacuum", false, "Skip removing old versions after import")
+
+	return cmd
+}
+
+func runBundleExport(cmd *cobra.Command, args []string) error {
+	client := newClient()
+
+	result, err := client.BundleExport(cmd.Context(), args[0], updex.BundleExportOptions{
+		Features:  args[1:],
+		Component: bundleComponent,
+	})
+	if err != nil {
+		return err
+	}
+
+	if clix.JSONOutput {
+		_, err = clix.OutputJSON(result)
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "COMPONENT\tVERSION\tFILE")
+	for _, img := range result.Images {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", img.Component, img.Version, img.File)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func runBundleImport(cmd *cobra.Command, args []string) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+
+	client := newClient()
+
+	results, err := client.BundleImport(cmd.Context(), args[0], updex.BundleImportOptions{
+		DryRun:    clix.DryRun,
+		NoRefresh: noRefresh,
+		NoVacuum:  bundleNoVacuum,
+		Component: bundleComponent,
+	})
+
+	if clix.JSONOutput {
+		// Never emit JSON `null`; see runFeaturesUpdate.
+		if results == nil {
+			results = []updex.UpdateFeaturesResult{}
+		}
+		_, jsonErr := clix.OutputJSON(results)
+		return errors.Join(err, jsonErr)
+	}
+
+	if len(results) == 0 {
+		return err
+	}
+
+	if clix.DryRun {
+		fmt.Println("[DRY RUN] Previewing bundle import.")
+	}
+
+	printUpdateResults(results)
+
+	return err
+}
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/frostyard/clix"
+	"github.com/frostyard/std/reporter"
+	"github.com/frostyard/updex/journal"
 	"github.com/frostyard/updex/sysext"
 	"github.com/frostyard/updex/systemd"
 	"github.com/frostyard/updex/updex"
@@ -24,22 +26,63 @@ var sysextRunner sysext.SysextRunner
 // daemon command tests inject a manager rooted at a temporary unit directory.
 var systemdManager *systemd.Manager
 
+// stateDir is the state directory handed to every CLI-constructed client.
+// It stays empty in production so the SDK uses updex.DefaultStateDir; tests
+// point it at a temporary directory so recorded runs stay out of
+// /var/lib/updex.
+var stateDir string
+
+// lockPath is the lock file handed to every CLI-constructed client. It
+// stays empty in production so the SDK uses updex.DefaultLockPath; tests
+// point it at a temporary directory, since mutating commands fail when they
+// cannot take the lock.
+var lockPath string
+
+// journalSocket is the journal socket the CLI logs to when its stderr is
+// connected to the journal. Tests point it at a local datagram socket.
+var journalSocket = journal.SocketPath
+
 // newClient creates a new updex client with the appropriate progress reporter.
 func newClient() *updex.Client {
-	clientConfig := updex.ClientConfig{
-		Definitions:    definitions,
-		Verify:         verify,
-		Verbose:        clix.Verbose,
-		Progress:       clix.NewReporter(),
-		SysextRunner:   sysextRunner,
-		SystemdManager: systemdManager,
-	}
+	clientConfig := newClientConfig()
 	if !clix.JSONOutput && !clix.Silent {
 		clientConfig.OnDownloadProgress = newProgressBar
 	}
 	return updex.NewClient(clientConfig)
 }
 
+// newClientConfig returns the client configuration the global flags and
+// test seams select, without a download progress bar.
+func newClientConfig() updex.ClientConfig {
+	return updex.ClientConfig{
+		Definitions:       definitions,
+		Verify:            verify,
+		Verbose:           clix.Verbose,
+		Progress:          newReporter(),
+		SysextRunner:      sysextRunner,
+		SystemdManager:    systemdManager,
+		DownloadRateLimit: int64(limitRate),
+		NoLockWait:        noLockWait || !lockWait,
+		Paths:             updex.RuntimePaths{StateDir: stateDir, LockPath: lockPath},
+	}
+}
+
+// newReporter returns the CLI's progress reporter. When systemd connected
+// stderr to the journal, as it does for updex.service, messages are sent to
+// the journal as structured entries instead, with the text reporter as the
+// fallback for any the journal does not take.
+func newReporter() reporter.Reporter {
+	text := clix.NewReporter()
+	if clix.Silent || !journal.IsStream(os.Stderr) {
+		return text
+	}
+	r, err := journal.NewReporter(journalSocket, text)
+	if err != nil {
+		return text
+	}
+	return r
+}
+
 // newProgressBar creates a terminal progress bar for download tracking.
 //
 // In JSON or silent mode stdout must carry only machine-readable data, so the
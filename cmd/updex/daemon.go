@@ -2,12 +2,29 @@ package updex
 
 import (
 	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/frostyard/clix"
 	"github.com/frostyard/updex/updex"
 	"github.com/spf13/cobra"
 )
 
+var (
+	daemonSchedule    string
+	daemonRandomDelay time.Duration
+	daemonOnBoot      time.Duration
+	daemonAccuracy    time.Duration
+	daemonNice        int
+	daemonIOClass     string
+	daemonCPUQuota    int
+	daemonApplyAtBoot bool
+	daemonMetricsFile string
+	daemonLogLimit    int
+)
+
 func newDaemonCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "daemon",
@@ -21,8 +38,10 @@ SUBCOMMANDS:
   enable   Install and start the systemd timer
   disable  Stop and remove the systemd timer
   status   Show current timer state
+  log      Show recent update runs
 
-The timer runs daily by default. Extensions are downloaded but not
+The timer runs daily by default; 'daemon enable' options change the
+schedule and the service's resource use. Extensions are downloaded but not
 activated, allowing safe updates without unexpected system changes.`,
 		Example: `  # Enable automatic updates
   sudo updex daemon enable
@@ -30,6 +49,9 @@ activated, allowing safe updates without unexpected system changes.`,
   # Check if auto-update is running
   updex daemon status
 
+  # Show recent update runs
+  updex daemon log
+
   # Disable automatic updates
   sudo updex daemon disable`,
 	}
@@ -37,12 +59,13 @@ activated, allowing safe updates without unexpected system changes.`,
 	cmd.AddCommand(newDaemonEnableCmd())
 	cmd.AddCommand(newDaemonDisableCmd())
 	cmd.AddCommand(newDaemonStatusCmd())
+	cmd.AddCommand(newDaemonLogCmd())
 
 	return cmd
 }
 
 func newDaemonEnableCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "enable",
 		Short: "Enable automatic updates",
 		Long: `Install and enable the systemd timer for automatic updates.
@@ -56,12 +79,50 @@ WHAT IT DOES:
   2. Enables the timer to start on boot
   3. Starts the timer immediately
 
+With --limit-rate, scheduled downloads are capped at that rate; interactive
+runs are limited only by their own --limit-rate.
+
+With --apply-at-boot, scheduled runs only stage new versions, leaving the
+installed ones linked, and an updex-apply.service that runs early in boot
+applies them before systemd-sysext merges extensions. A refresh or crash
+before the next reboot therefore cannot activate a half-finished update.
+
+With --metrics-file, scheduled runs write Prometheus metrics to that path
+for node_exporter's textfile collector (see 'updex features update --help').
+
+Running enable again reconfigures the installed units in place from the
+options given; options left out return to their defaults. Units edited by
+hand are never replaced: run 'updex daemon disable' first.
+
 Requires root privileges.`,
 		Example: `  # Enable automatic updates
-  sudo updex daemon enable`,
+  sudo updex daemon enable
+
+  # Keep scheduled downloads under 1 MiB/s
+  sudo updex daemon enable --limit-rate 1M
+
+  # Stage updates and activate them only across a reboot
+  sudo updex daemon enable --apply-at-boot
+
+  # Export metrics to node_exporter's textfile collector
+  sudo updex daemon enable --metrics-file /var/lib/node_exporter/textfile_collector/updex.prom
+
+  # Update weekly, also 15 minutes after boot, at low priority
+  sudo updex daemon enable --schedule 'Sun *-*-* 03:00:00' --on-boot 15m --nice 10 --io-scheduling-class idle`,
 		Args: cobra.NoArgs,
 		RunE: runDaemonEnable,
 	}
+
+	cmd.Flags().StringVar(&daemonSchedule, "schedule", "", "When to run updates, as a systemd OnCalendar= expression (default daily)")
+	cmd.Flags().DurationVar(&daemonRandomDelay, "randomized-delay", 0, "Spread each run randomly over this window (default 1h; 0 disables)")
+	cmd.Flags().DurationVar(&daemonOnBoot, "on-boot", 0, "Also run this long after boot")
+	cmd.Flags().DurationVar(&daemonAccuracy, "accuracy", 0, "How far systemd may shift a run to coalesce wakeups (default 1m)")
+	cmd.Flags().IntVar(&daemonNice, "nice", 0, "CPU priority of the update service, -20 to 19")
+	cmd.Flags().StringVar(&daemonIOClass, "io-scheduling-class", "", "I/O scheduling class of the update service: realtime, best-effort or idle")
+	cmd.Flags().IntVar(&daemonCPUQuota, "cpu-quota", 0, "Cap the update service's CPU time at this percentage of one CPU")
+	cmd.Flags().BoolVar(&daemonApplyAtBoot, "apply-at-boot", false, "Only stage updates, and apply them early in the next boot")
+	cmd.Flags().StringVar(&daemonMetricsFile, "metrics-file", "", "Write Prometheus metrics of scheduled runs to this file")
+	return cmd
 }
 
 func runDaemonEnable(cmd *cobra.Command, args []string) error {
@@ -69,7 +130,25 @@ func runDaemonEnable(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	result, err := newClient().EnableDaemon(cmd.Context(), updex.EnableDaemonOptions{})
+	// The SDK reads a zero delay as the default; an explicit
+	// --randomized-delay 0 asks for none.
+	randomDelay := daemonRandomDelay
+	if randomDelay == 0 && cmd.Flags().Changed("randomized-delay") {
+		randomDelay = -1
+	}
+
+	result, err := newClient().EnableDaemon(cmd.Context(), updex.EnableDaemonOptions{
+		DownloadRateLimit: int64(limitRate),
+		Schedule:          daemonSchedule,
+		RandomizedDelay:   randomDelay,
+		OnBoot:            daemonOnBoot,
+		Accuracy:          daemonAccuracy,
+		Nice:              daemonNice,
+		IOSchedulingClass: daemonIOClass,
+		CPUQuota:          daemonCPUQuota,
+		ApplyAtBoot:       daemonApplyAtBoot,
+		MetricsFile:       daemonMetricsFile,
+	})
 	if err != nil {
 		return err
 	}
@@ -79,8 +158,17 @@ func runDaemonEnable(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	fmt.Println("Auto-update daemon enabled.")
-	fmt.Println("Updates will run daily and download new versions.")
+	schedule := daemonSchedule
+	if schedule == "" {
+		schedule = updex.DefaultDaemonSchedule
+	}
+	fmt.Printf("%s.\n", result.Message)
+	if daemonApplyAtBoot {
+		fmt.Printf("Updates will run on schedule %q and stage new versions.\n", schedule)
+		fmt.Println("Staged versions are applied early in the next boot.")
+		return nil
+	}
+	fmt.Printf("Updates will run on schedule %q and download new versions.\n", schedule)
 	fmt.Println("Reboot required to activate downloaded extensions.")
 	return nil
 }
@@ -92,7 +180,8 @@ func newDaemonDisableCmd() *cobra.Command {
 		Long: `Stop and remove the systemd timer for automatic updates.
 
 This stops the timer, disables it, and removes both timer and service
-unit files from /etc/systemd/system/.
+unit files from /etc/systemd/system/, along with updex-apply.service if
+--apply-at-boot installed it. Staged updates stay until 'updex apply'.
 
 WHAT IT DOES:
   1. Stops the running timer
@@ -134,13 +223,20 @@ func newDaemonStatusCmd() *cobra.Command {
 		Long: `Show the current status of the auto-update daemon.
 
 Displays whether the timer is installed, enabled, and active,
-along with the configured schedule.
+along with the settings read from the installed unit files.
 
 OUTPUT:
-  Installed - Whether unit files exist
-  Enabled   - Whether timer starts on boot
-  Active    - Whether timer is currently running
-  Schedule  - When updates run (e.g., daily)`,
+  Installed    - Whether unit files exist
+  Enabled      - Whether timer starts on boot
+  Active       - Whether timer is currently running
+  Schedule     - When updates run (e.g., daily)
+  Next run     - When the timer fires next
+  Last run     - When the last recorded update started, and its outcome
+  Last success - When the last successful update finished
+
+Randomized delay, on-boot delay, accuracy, resource controls, the
+download rate limit and apply-at-boot are shown when set. Units edited outside updex are
+flagged as modified.`,
 		Example: `  # Check daemon status
   updex daemon status
 
@@ -164,6 +260,7 @@ func runDaemonStatus(cmd *cobra.Command, args []string) error {
 
 	if !status.Installed {
 		fmt.Println("Auto-update daemon: not installed")
+		printRunStatus(status)
 		fmt.Println("Run 'updex daemon enable' to enable automatic updates.")
 		return nil
 	}
@@ -172,5 +269,144 @@ func runDaemonStatus(cmd *cobra.Command, args []string) error {
 	fmt.Printf("  Enabled: %v\n", status.Enabled)
 	fmt.Printf("  Active: %v\n", status.Active)
 	fmt.Printf("  Schedule: %s\n", status.Schedule)
+	for _, d := range []struct {
+		label   string
+		seconds int
+	}{
+		{"Randomized delay", status.RandomizedDelaySec},
+		{"On boot", status.OnBootSec},
+		{"Accuracy", status.AccuracySec},
+	} {
+		if d.seconds > 0 {
+			fmt.Printf("  %s: %s\n", d.label, time.Duration(d.seconds)*time.Second)
+		}
+	}
+	if status.Nice != 0 {
+		fmt.Printf("  Nice: %d\n", status.Nice)
+	}
+	if status.IOSchedulingClass != "" {
+		fmt.Printf("  I/O scheduling class: %s\n", status.IOSchedulingClass)
+	}
+	if status.CPUQuota > 0 {
+		fmt.Printf("  CPU quota: %d%%\n", status.CPUQuota)
+	}
+	if status.DownloadRateLimit > 0 {
+		fmt.Printf("  Download rate limit: %d bytes/s\n", status.DownloadRateLimit)
+	}
+	if status.ApplyAtBoot {
+		fmt.Println("  Apply at boot: yes")
+	}
+	if status.MetricsFile != "" {
+		fmt.Printf("  Metrics file: %s\n", status.MetricsFile)
+	}
+	if status.Modified {
+		fmt.Println("  Modified: unit files were edited outside updex")
+	}
+	if !status.NextTrigger.IsZero() {
+		fmt.Printf("  Next run: %s\n", formatRunTime(status.NextTrigger))
+	}
+	printRunStatus(status)
 	return nil
 }
+
+// printRunStatus prints the recorded run lines of daemon status.
+func printRunStatus(status *updex.DaemonStatusResult) {
+	if status.LastRun != nil {
+		fmt.Printf("  Last run: %s (%s)\n", formatRunTime(status.LastRun.StartedAt), runRecordStatus(*status.LastRun))
+	}
+	if !status.LastSuccess.IsZero() {
+		fmt.Printf("  Last success: %s\n", formatRunTime(status.LastSuccess))
+	}
+}
+
+func newDaemonLogCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "log",
+		Short: "Show recent update runs",
+		Long: `Show recent 'features update' runs, newest first.
+
+Every update that is not a dry run records its results in
+/var/lib/updex/runs, whether the timer or an operator started it. The
+last 100 runs are kept, plus the last successful one.
+
+OUTPUT:
+  STARTED  - When the run started
+  DURATION - How long it took
+  CHANGES  - Components moved to a new version, or staged for one
+  STATUS   - "ok", or the run's error
+
+Use --json for the full records, including every component's result.`,
+		Example: `  # Show the last 10 runs
+  updex daemon log
+
+  # Show every kept run as JSON
+  updex daemon log -n 0 --json`,
+		Args: cobra.NoArgs,
+		RunE: runDaemonLog,
+	}
+
+	cmd.Flags().IntVarP(&daemonLogLimit, "lines", "n", 10, "Number of runs to show (0 shows every kept run)")
+	return cmd
+}
+
+func runDaemonLog(cmd *cobra.Command, args []string) error {
+	if daemonLogLimit < 0 {
+		return fmt.Errorf("--lines must not be negative")
+	}
+	records, err := newClient().RunHistory(cmd.Context(), updex.RunHistoryOptions{Limit: daemonLogLimit})
+	if err != nil {
+		return err
+	}
+
+	if clix.JSONOutput {
+		_, err := clix.OutputJSON(records)
+		return err
+	}
+
+	if len(records) == 0 {
+		fmt.Println("No recorded update runs.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "STARTED\tDURATION\tCHANGES\tSTATUS")
+	for _, record := range records {
+		duration := record.FinishedAt.Sub(record.StartedAt).Round(time.Second)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", formatRunTime(record.StartedAt), duration, runRecordChanges(record), runRecordStatus(record))
+	}
+	_ = w.Flush()
+	return nil
+}
+
+// runRecordChanges summarizes the components a run moved or staged.
+func runRecordChanges(record updex.RunRecord) string {
+	var changes []string
+	for _, fr := range record.Results {
+		for _, r := range fr.Results {
+			switch {
+			case r.Error != "":
+			case r.Staged && r.Downloaded:
+				changes = append(changes, r.Component+" "+r.Version+" (staged)")
+			case !r.Staged && (r.Downloaded || r.Relinked):
+				changes = append(changes, r.Component+" "+r.Version)
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return "-"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// runRecordStatus is "ok" or the first line of a run's error.
+func runRecordStatus(record updex.RunRecord) string {
+	if record.Success {
+		return "ok"
+	}
+	line, _, _ := strings.Cut(record.Error, "\n")
+	return line
+}
+
+func formatRunTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05")
+}
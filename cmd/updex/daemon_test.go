@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/frostyard/clix"
 	"github.com/frostyard/updex/systemd"
@@ -32,7 +33,7 @@ func TestDaemonHandlersStayBehindSDKBoundary(t *testing.T) {
 	if strings.Contains(contents, `"github.com/frostyard/updex/systemd"`) {
 		t.Fatal("daemon command must not import systemd directly")
 	}
-	for _, method := range []string{".EnableDaemon(", ".DisableDaemon(", ".DaemonStatus("} {
+	for _, method := range []string{".EnableDaemon(", ".DisableDaemon(", ".DaemonStatus(", ".RunHistory("} {
 		if !strings.Contains(contents, method) {
 			t.Errorf("daemon command does not call SDK method %s", method)
 		}
@@ -42,26 +43,47 @@ func TestDaemonHandlersStayBehindSDKBoundary(t *testing.T) {
 // daemonTestEnv installs injectable seams for the daemon command tests: an
 // in-memory systemd Manager rooted at a temp dir and a single MockSystemctlRunner
 // shared by the manager and the command runner, plus a root-privileged getEUID.
-// It never writes real unit files or invokes systemctl.
+// It never writes real unit files or invokes systemctl, and reads run records
+// from an empty temporary state directory.
 func daemonTestEnv(t *testing.T, mock *systemd.MockSystemctlRunner) (unitDir string) {
 	t.Helper()
 	unitDir = t.TempDir()
 
-	oldManager := systemdManager
+	oldManager, oldStateDir, oldLogLimit := systemdManager, stateDir, daemonLogLimit
 	oldGetEUID, oldJSON := getEUID, clix.JSONOutput
+	oldSchedule, oldRandomDelay, oldOnBoot, oldAccuracy := daemonSchedule, daemonRandomDelay, daemonOnBoot, daemonAccuracy
+	oldNice, oldIOClass, oldCPUQuota, oldApplyAtBoot := daemonNice, daemonIOClass, daemonCPUQuota, daemonApplyAtBoot
 	t.Cleanup(func() {
-		systemdManager = oldManager
+		systemdManager, stateDir, daemonLogLimit = oldManager, oldStateDir, oldLogLimit
 		getEUID = oldGetEUID
 		clix.JSONOutput = oldJSON
+		daemonSchedule, daemonRandomDelay, daemonOnBoot, daemonAccuracy = oldSchedule, oldRandomDelay, oldOnBoot, oldAccuracy
+		daemonNice, daemonIOClass, daemonCPUQuota, daemonApplyAtBoot = oldNice, oldIOClass, oldCPUQuota, oldApplyAtBoot
 	})
 
 	systemdManager = systemd.NewTestManager(unitDir, mock)
+	stateDir = t.TempDir()
+	daemonLogLimit = 10
 	getEUID = func() int { return 0 }
 	clix.JSONOutput = false
 	return unitDir
 }
 
+// seedUnits installs the default daemon units into dir through the SDK,
+// with a runner of its own so the test's mock records no calls.
 func seedUnits(t *testing.T, dir string) {
+	t.Helper()
+	client := sdk.NewClient(sdk.ClientConfig{
+		SystemdManager: systemd.NewTestManager(dir, &systemd.MockSystemctlRunner{}),
+		Paths:          sdk.RuntimePaths{LockPath: lockPath},
+	})
+	if _, err := client.EnableDaemon(t.Context(), sdk.EnableDaemonOptions{}); err != nil {
+		t.Fatalf("failed to seed units: %v", err)
+	}
+}
+
+// seedEditedUnits writes unit files updex did not generate.
+func seedEditedUnits(t *testing.T, dir string) {
 	t.Helper()
 	for _, ext := range []string{".timer", ".service"} {
 		if err := os.WriteFile(filepath.Join(dir, daemonTestUnitName+ext), []byte("stub"), 0644); err != nil {
@@ -93,14 +115,48 @@ func TestRunDaemonDisable_RejectsNonRoot(t *testing.T) {
 func TestRunDaemonEnable_AlreadyInstalled(t *testing.T) {
 	mock := &systemd.MockSystemctlRunner{}
 	dir := daemonTestEnv(t, mock)
-	seedUnits(t, dir)
+	seedEditedUnits(t, dir)
 
 	err := runDaemonEnable(daemonTestCommand(t), nil)
 	if err == nil || !strings.Contains(err.Error(), "already installed") {
 		t.Fatalf("expected already-installed error, got: %v", err)
 	}
 	if mock.EnableCalled || mock.StartCalled {
-		t.Error("enable must not touch systemctl when the timer is already installed")
+		t.Error("enable must not touch systemctl when edited units are installed")
+	}
+}
+
+func TestRunDaemonEnable_FlagsReconfigure(t *testing.T) {
+	mock := &systemd.MockSystemctlRunner{}
+	dir := daemonTestEnv(t, mock)
+	seedUnits(t, dir)
+
+	cmd := newDaemonCmd()
+	cmd.SetArgs([]string{"enable", "--schedule", "weekly", "--randomized-delay", "0", "--on-boot", "15m", "--nice", "10", "--io-scheduling-class", "idle", "--cpu-quota", "50"})
+	out, err := captureStdout(t, cmd.Execute)
+	if err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+	if !strings.Contains(out, "reconfigured") || !strings.Contains(out, `"weekly"`) {
+		t.Errorf("unexpected text output:\n%s", out)
+	}
+
+	timer, err := os.ReadFile(filepath.Join(dir, daemonTestUnitName+".timer"))
+	if err != nil {
+		t.Fatalf("read timer unit: %v", err)
+	}
+	if !strings.Contains(string(timer), "OnCalendar=weekly\nOnBootSec=900s\n") || strings.Contains(string(timer), "RandomizedDelaySec=") {
+		t.Errorf("timer unit does not reflect the flags:\n%s", timer)
+	}
+	service, err := os.ReadFile(filepath.Join(dir, daemonTestUnitName+".service"))
+	if err != nil {
+		t.Fatalf("read service unit: %v", err)
+	}
+	if !strings.Contains(string(service), "Nice=10\nIOSchedulingClass=idle\nCPUQuota=50%\n") {
+		t.Errorf("service unit does not reflect the flags:\n%s", service)
+	}
+	if !mock.StopCalled || !mock.StartCalled {
+		t.Error("expected the timer to be restarted after reconfiguring")
 	}
 }
 
@@ -310,7 +366,77 @@ func TestRunDaemonStatus_TextOutput(t *testing.T) {
 		t.Fatalf("status failed: %v", err)
 	}
 	if !strings.Contains(out, "installed") || !strings.Contains(out, "Enabled: true") ||
-		!strings.Contains(out, "Active: false") || !strings.Contains(out, "Schedule: daily") {
+		!strings.Contains(out, "Active: false") || !strings.Contains(out, "Schedule: daily") ||
+		!strings.Contains(out, "Randomized delay: 1h0m0s") || strings.Contains(out, "Modified") {
 		t.Errorf("unexpected text output:\n%s", out)
 	}
 }
+
+// seedRunRecords writes run records into the test state directory as
+// UpdateFeatures would, oldest first.
+func seedRunRecords(t *testing.T, records ...sdk.RunRecord) {
+	t.Helper()
+	dir := filepath.Join(stateDir, "runs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, record.ID+".json"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunDaemonLog_TextOutput(t *testing.T) {
+	daemonTestEnv(t, &systemd.MockSystemctlRunner{})
+
+	out, err := captureStdout(t, func() error { return runDaemonLog(daemonTestCommand(t), nil) })
+	if err != nil || !strings.Contains(out, "No recorded update runs.") {
+		t.Fatalf("log with no history = %q, %v", out, err)
+	}
+
+	started := time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC)
+	seedRunRecords(t,
+		sdk.RunRecord{
+			ID: "1", StartedAt: started, FinishedAt: started.Add(42 * time.Second), Success: true,
+			Results: []sdk.UpdateFeaturesResult{{Feature: "docker", Results: []sdk.UpdateResult{
+				{Component: "docker", Version: "28.1", Downloaded: true, Installed: true},
+				{Component: "compose", Version: "2.3", Installed: true},
+			}}},
+		},
+		sdk.RunRecord{
+			ID: "2", StartedAt: started.Add(24 * time.Hour), FinishedAt: started.Add(24*time.Hour + time.Second),
+			Error: "one or more components failed to update\nsysext refresh failed",
+		},
+	)
+
+	out, err = captureStdout(t, func() error { return runDaemonLog(daemonTestCommand(t), nil) })
+	if err != nil {
+		t.Fatalf("log failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "STARTED") {
+		t.Fatalf("unexpected log output:\n%s", out)
+	}
+	if !strings.Contains(lines[1], "1s") || !strings.Contains(lines[1], "one or more components failed to update") || strings.Contains(lines[1], "sysext refresh") {
+		t.Errorf("newest run line = %q, want the failed run and its error's first line", lines[1])
+	}
+	if !strings.Contains(lines[2], "42s") || !strings.Contains(lines[2], "docker 28.1") || strings.Contains(lines[2], "compose") || !strings.HasSuffix(lines[2], "ok") {
+		t.Errorf("oldest run line = %q, want the successful run and what it changed", lines[2])
+	}
+
+	daemonLogLimit = 1
+	out, err = captureStdout(t, func() error { return runDaemonLog(daemonTestCommand(t), nil) })
+	if err != nil || strings.Count(strings.TrimSpace(out), "\n") != 1 {
+		t.Errorf("log -n 1 = %q, %v, want a header and one run", out, err)
+	}
+
+	out, err = captureStdout(t, func() error { return runDaemonStatus(daemonTestCommand(t), nil) })
+	if err != nil || !strings.Contains(out, "Last run: ") || !strings.Contains(out, "Last success: ") {
+		t.Errorf("status output = %q, %v, want the last run and last success", out, err)
+	}
+}
@@ -10,6 +10,11 @@ var (
 	featureEnableNow    bool
 	featureUpdateNoVac  bool
 	featureComponent    string
+	featureJobs         int
+	featureVersion      string
+	featureIgnorePhase  bool
+	featureStage        bool
+	featureMetricsFile  string
 )
 
 func newFeaturesCmd() *cobra.Command {
@@ -39,7 +44,11 @@ SUBCOMMANDS:
   enable   Enable a feature (optionally download immediately)
   disable  Disable a feature (optionally remove files)
   update   Download newest versions for all enabled features
-  check    Check for available updates across all enabled features`,
+  check    Check for available updates across all enabled features
+  pin      Hold a feature's extensions at a version
+  unpin    Let a feature's extensions follow the newest version again
+  rollback Switch a feature's extensions back to the previous version
+  channel  Switch a feature to another release channel`,
 		Example: `  # List all features
   updex features list
 
@@ -52,6 +61,15 @@ SUBCOMMANDS:
   # Update all enabled features
   sudo updex features update
 
+  # Hold docker at a known-good version
+  sudo updex features pin docker 27.3.1
+
+  # Go back to the version docker ran before the last update
+  sudo updex features rollback docker
+
+  # Follow docker's beta releases
+  sudo updex features channel docker beta
+
   # Scope an operation to a single component
   updex features list --component=docker`,
 	}
@@ -63,6 +81,10 @@ SUBCOMMANDS:
 	cmd.AddCommand(newFeaturesDisableCmd())
 	cmd.AddCommand(newFeaturesUpdateCmd())
 	cmd.AddCommand(newFeaturesCheckCmd())
+	cmd.AddCommand(newFeaturesPinCmd())
+	cmd.AddCommand(newFeaturesUnpinCmd())
+	cmd.AddCommand(newFeaturesRollbackCmd())
+	cmd.AddCommand(newFeaturesChannelCmd())
 
 	return cmd
 }
@@ -78,6 +100,8 @@ OUTPUT COLUMNS:
   DESCRIPTION  - Human-readable description
   ENABLED      - yes/no/masked
   CATALOG      - Where the feature came from (see below)
+  PINNED       - Version the feature is pinned to, or -
+  CHANNEL      - Release channel the feature selects, or - (stable)
   TRANSFERS    - Associated transfer configurations
 
 CATALOG VALUES:
@@ -110,7 +134,8 @@ legacy default directory (or a -C/--definitions override), or
 discovered under a systemd-sysupdate component.
 
 OPTIONS:
-  --now      Immediately download extensions for this feature
+  --now            Immediately download extensions for this feature
+  --version VER    With --now, install VER instead of the newest version
 
 Use --dry-run (global flag) to preview changes without modifying filesystem.
 
@@ -121,6 +146,9 @@ Requires root privileges.`,
   # Enable and download immediately
   sudo updex features enable docker --now
 
+  # Enable and install a specific version
+  sudo updex features enable docker --now --version 27.3.1
+
   # Preview what would happen
   sudo updex features enable --dry-run docker`,
 		Args: cobra.ExactArgs(1),
@@ -128,6 +156,7 @@ Requires root privileges.`,
 	}
 
 	cmd.Flags().BoolVar(&featureEnableNow, "now", false, "Immediately download extensions")
+	cmd.Flags().StringVar(&featureVersion, "version", "", "Install this version instead of the newest (requires --now)")
 
 	return cmd
 }
@@ -184,6 +213,21 @@ downloading the newest available version for each component.
 OPTIONS:
   --no-refresh  Skip running systemd-sysext refresh after update
   --no-vacuum   Skip removing old versions after update
+  --jobs N      Fetch and download up to N components at once (default 4)
+  --version VER Install VER instead of the newest version (downgrading if
+                need be) for every component in scope; combine with
+                --component to target one. Applies to this run only: use
+                'updex features pin' or MaxVersion= to hold a version.
+  --stage       Download and verify new versions without installing them;
+                'updex apply' installs them later
+  --metrics-file PATH
+                Write Prometheus metrics to PATH when the run finishes, for
+                node_exporter's textfile collector: installed and newest
+                versions, available updates, download bytes and time,
+                retries, verification failures and the last successful run
+
+Output and results keep feature order whatever order components finish in.
+Each run is recorded in /var/lib/updex/runs; 'updex daemon log' lists them.
 
 Use --dry-run (global flag) to preview downloads, installs, refreshes, and
 vacuum removals without modifying filesystem or sysext state.
@@ -198,6 +242,15 @@ Requires root privileges.`,
   # Preview what would be updated
   sudo updex --dry-run features update
 
+  # Move the docker component to 27.3.1 even if a newer one is published
+  sudo updex features update --component=docker --version 27.3.1
+
+  # Take versions a phased rollout is still holding back from this host
+  sudo updex features update --ignore-phasing
+
+  # Download now, activate later with 'updex apply'
+  sudo updex features update --stage
+
   # Update in JSON format
   sudo updex features update --json`,
 		Args: cobra.NoArgs,
@@ -205,12 +258,17 @@ Requires root privileges.`,
 	}
 
 	cmd.Flags().BoolVar(&featureUpdateNoVac, "no-vacuum", false, "Skip removing old versions after update")
+	cmd.Flags().IntVarP(&featureJobs, "jobs", "j", 0, "Number of components to fetch and download at once (0 = default)")
+	cmd.Flags().StringVar(&featureVersion, "version", "", "Install this version instead of the newest")
+	cmd.Flags().BoolVar(&featureIgnorePhase, "ignore-phasing", false, "Install the newest version even if its phased rollout has not reached this host")
+	cmd.Flags().BoolVar(&featureStage, "stage", false, "Download and verify new versions, but leave them staged for 'updex apply'")
+	cmd.Flags().StringVar(&featureMetricsFile, "metrics-file", "", "Write Prometheus metrics to this file when the run finishes")
 
 	return cmd
 }
 
 func newFeaturesCheckCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "check",
 		Short: "Check for available updates",
 		Long: `Check if newer versions are available for all enabled features.
@@ -218,7 +276,15 @@ func newFeaturesCheckCmd() *cobra.Command {
 Iterates over all enabled features and their associated transfers,
 comparing installed versions against the newest available versions.
 
-This is a read-only operation that does not download or install anything.`,
+A newer version that a phased rollout (Phased= in the transfer) has not
+reached this host yet is reported as held back by phasing, not as an update.
+A version staged by 'features update --stage' is still reported as an update
+until 'updex apply' installs it.
+
+This is a read-only operation that does not download or install anything.
+Use --jobs N to check up to N components at once (default 4), and
+--metrics-file PATH to write the result as Prometheus metrics for
+node_exporter's textfile collector.`,
 		Example: `  # Check for updates
   updex features check
 
@@ -227,4 +293,137 @@ This is a read-only operation that does not download or install anything.`,
 		Args: cobra.NoArgs,
 		RunE: runFeaturesCheck,
 	}
+
+	cmd.Flags().IntVarP(&featureJobs, "jobs", "j", 0, "Number of components to check at once (0 = default)")
+	cmd.Flags().StringVar(&featureMetricsFile, "metrics-file", "", "Write Prometheus metrics to this file when the check finishes")
+
+	return cmd
+}
+
+func newFeaturesPinCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "pin FEATURE VERSION",
+		Short: "Pin a feature to a version",
+		Long: `Hold a feature's extensions at VERSION by updating its drop-in configuration file.
+
+This sets PinVersion=VERSION in an [X-Updex] section of the same drop-in
+'updex features enable' writes (an Enabled= already there is kept):
+/etc/sysupdate.d/<feature>.feature.d/00-updex.conf for a feature from the
+legacy default directory (or a -C/--definitions override), or
+/etc/sysupdate.<component>.d/<feature>.feature.d/00-updex.conf for a
+feature discovered under a systemd-sysupdate component.
+
+While pinned, 'updex features update' installs and links VERSION instead of
+the newest version (even if that is a downgrade), 'updex features check'
+compares against it, and vacuum never removes it. Nothing is downloaded until
+the next update.
+
+VERSION may be one 'updex features rollback' skipped: the pin installs it
+anyway and removes it from SkipVersions=, so a later unpin does not skip it
+again.
+
+Use --dry-run (global flag) to preview changes without modifying filesystem.
+
+Requires root privileges.`,
+		Example: `  # Hold docker at a known-good version
+  sudo updex features pin docker 27.3.1
+
+  # Preview what would happen
+  sudo updex features pin --dry-run docker 27.3.1`,
+		Args: cobra.ExactArgs(2),
+		RunE: runFeaturesPin,
+	}
+}
+
+func newFeaturesUnpinCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unpin FEATURE",
+		Short: "Unpin a feature",
+		Long: `Remove the pin 'updex features pin' wrote, so the feature's extensions
+follow the newest version again on the next update.
+
+Only the pin in updex's own 00-updex.conf drop-in is removed (the file
+itself goes when nothing else is left in it); a PinVersion= set by the
+administrator in another drop-in stays in effect.
+
+Use --dry-run (global flag) to preview changes without modifying filesystem.
+
+Requires root privileges.`,
+		Example: `  # Let docker follow the newest version again
+  sudo updex features unpin docker`,
+		Args: cobra.ExactArgs(1),
+		RunE: runFeaturesUnpin,
+	}
+}
+
+func newFeaturesRollbackCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rollback FEATURE",
+		Short: "Roll a feature back to the previous version",
+		Long: `Point each of a feature's extensions back at the newest older version still
+installed (kept under InstancesMax), then run systemd-sysext refresh.
+
+The versions rolled back from are recorded as SkipVersions= in an [X-Updex]
+section of the feature's 00-updex.conf drop-in, so 'updex features update'
+does not reinstall them; the next newer release is installed as usual.
+Rolling back again steps back one more version. To take a skipped version
+back, pin it with 'updex features pin' (and unpin later to follow the newest
+version again).
+
+Nothing is changed unless every extension of the feature has an older
+version installed. A pinned feature cannot be rolled back; pin the version
+you want instead.
+
+Use --dry-run (global flag) to preview changes without modifying filesystem.
+Use --no-refresh to skip the systemd-sysext refresh.
+
+Requires root privileges.`,
+		Example: `  # Go back to the version docker ran before the last update
+  sudo updex features rollback docker
+
+  # Preview what would happen
+  sudo updex features rollback --dry-run docker`,
+		Args: cobra.ExactArgs(1),
+		RunE: runFeaturesRollback,
+	}
+}
+
+func newFeaturesChannelCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "channel FEATURE CHANNEL",
+		Short: "Switch a feature to another release channel",
+		Long: `Switch a feature to the release channel CHANNEL (for example stable, beta or
+nightly) and reconcile its installed extensions with it.
+
+The channel is recorded as Channel= in an [X-Updex] section of the feature's
+00-updex.conf drop-in. Transfers pick it up through the %R specifier in
+their [Source] Path= and Mirrors=, e.g.
+
+  Path=https://example.com/sysexts/%R
+
+A feature that selects no channel follows "stable".
+
+For an enabled feature, each extension is then switched to the newest version
+the new channel offers (or its pinned version), downloading or relinking it
+even when that is older than the current one, and installed versions newer
+than that which the channel does not offer are removed. Nothing is changed
+unless every extension's versions can be listed on the new channel. A
+disabled feature only has its drop-in updated.
+
+Use --dry-run (global flag) to preview changes without modifying filesystem.
+Use --no-refresh to skip the systemd-sysext refresh.
+
+Requires root privileges.`,
+		Example: `  # Follow docker's beta releases
+  sudo updex features channel docker beta
+
+  # Preview going back to stable
+  sudo updex features channel --dry-run docker stable`,
+		Args: cobra.ExactArgs(2),
+		RunE: runFeaturesChannel,
+	}
+
+	cmd.Flags().BoolVar(&featureUpdateNoVac, "no-vacuum", false, "Do not remove old versions after a download")
+
+	return cmd
 }
@@ -32,7 +32,7 @@ func runFeaturesList(cmd *cobra.Command, args []string) error {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	_, _ = fmt.Fprintln(w, "FEATURE\tDESCRIPTION\tENABLED\tCATALOG\tTRANSFERS")
+	_, _ = fmt.Fprintln(w, "FEATURE\tDESCRIPTION\tENABLED\tCATALOG\tPINNED\tCHANNEL\tTRANSFERS")
 	for _, f := range features {
 		status := "no"
 		if f.Masked {
@@ -52,7 +52,17 @@ func runFeaturesList(cmd *cobra.Command, args []string) error {
 			}
 		}
 
-		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.Name, f.Description, status, formatOrigin(f), transfersStr)
+		pinned := f.PinnedVersion
+		if pinned == "" {
+			pinned = "-"
+		}
+
+		channel := f.Channel
+		if channel == "" {
+			channel = "-"
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", f.Name, f.Description, status, formatOrigin(f), pinned, channel, transfersStr)
 	}
 	_ = w.Flush()
 
@@ -89,6 +99,7 @@ func runFeaturesEnable(cmd *cobra.Command, args []string) error {
 		DryRun:    clix.DryRun,
 		NoRefresh: noRefresh,
 		Component: featureComponent,
+		Version:   featureVersion,
 	}
 
 	result, err := client.EnableFeature(cmd.Context(), args[0], opts)
@@ -197,18 +208,153 @@ func runFeaturesDisable(cmd *cobra.Command, args []string) error {
 	return err
 }
 
-func runFeaturesUpdate(cmd *cobra.Command, args []string) error {
+func runFeaturesPin(cmd *cobra.Command, args []string) error {
 	if err := requireRoot(); err != nil {
 		return err
 	}
 
 	client := newClient()
 
-	opts := updex.UpdateFeaturesOptions{
+	result, err := client.PinFeature(cmd.Context(), args[0], args[1], updex.PinFeatureOptions{
+		DryRun:    clix.DryRun,
+		Component: featureComponent,
+	})
+
+	return printPinResult(result, err)
+}
+
+func runFeaturesUnpin(cmd *cobra.Command, args []string) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+
+	client := newClient()
+
+	result, err := client.UnpinFeature(cmd.Context(), args[0], updex.UnpinFeatureOptions{
+		DryRun:    clix.DryRun,
+		Component: featureComponent,
+	})
+
+	return printPinResult(result, err)
+}
+
+// printPinResult reports a pin or unpin result, as JSON or text.
+func printPinResult(result *updex.FeatureActionResult, err error) error {
+	if clix.JSONOutput {
+		_, jsonErr := clix.OutputJSON(result)
+		return errors.Join(err, jsonErr)
+	} else if result != nil {
+		switch {
+		case result.Error != "":
+			fmt.Printf("Error: %s\n", result.Error)
+		case result.DryRun:
+			fmt.Printf("[DRY RUN] %s\n", result.NextActionMessage)
+		default:
+			fmt.Println(result.NextActionMessage)
+		}
+	}
+
+	return err
+}
+
+func runFeaturesRollback(cmd *cobra.Command, args []string) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+
+	client := newClient()
+
+	result, err := client.RollbackFeature(cmd.Context(), args[0], updex.RollbackFeatureOptions{
+		DryRun:    clix.DryRun,
+		NoRefresh: noRefresh,
+		Component: featureComponent,
+	})
+
+	if clix.JSONOutput {
+		_, jsonErr := clix.OutputJSON(result)
+		return errors.Join(err, jsonErr)
+	} else if result != nil {
+		switch {
+		case result.RefreshError != "":
+			printRollbackResults(result.Results)
+			fmt.Printf("Error: %s\n%s\n", result.RefreshError, result.NextActionMessage)
+		case result.Error != "":
+			fmt.Printf("Error: %s\n", result.Error)
+		case result.DryRun:
+			printRollbackResults(result.Results)
+			fmt.Printf("[DRY RUN] %s\n", result.NextActionMessage)
+		default:
+			printRollbackResults(result.Results)
+			fmt.Println(result.NextActionMessage)
+		}
+	}
+
+	return err
+}
+
+// printRollbackResults lists the version each component moved between.
+func printRollbackResults(results []updex.RollbackResult) {
+	for _, r := range results {
+		fmt.Printf("  %s: %s -> %s\n", r.Component, r.FromVersion, r.ToVersion)
+	}
+}
+
+func runFeaturesChannel(cmd *cobra.Command, args []string) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+
+	client := newClient()
+
+	result, err := client.SwitchFeatureChannel(cmd.Context(), args[0], args[1], updex.SwitchFeatureChannelOptions{
 		DryRun:    clix.DryRun,
 		NoRefresh: noRefresh,
 		NoVacuum:  featureUpdateNoVac,
 		Component: featureComponent,
+	})
+
+	if clix.JSONOutput {
+		_, jsonErr := clix.OutputJSON(result)
+		return errors.Join(err, jsonErr)
+	} else if result != nil {
+		// Per-component failures are in the table; only an error before
+		// reconciling started needs printing on its own.
+		if len(result.Results) > 0 {
+			printUpdateResults([]updex.UpdateFeaturesResult{{Feature: result.Feature, Results: result.Results}})
+		}
+		switch {
+		case result.RefreshError != "":
+			fmt.Printf("Error: %s\n%s\n", result.RefreshError, result.NextActionMessage)
+		case result.Error != "":
+			fmt.Printf("Error: %s\n", result.Error)
+		case result.DryRun:
+			fmt.Printf("[DRY RUN] %s\n", result.NextActionMessage)
+		default:
+			fmt.Println(result.NextActionMessage)
+		}
+	}
+
+	return err
+}
+
+func runFeaturesUpdate(cmd *cobra.Command, args []string) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+
+	client := newClient()
+
+	opts := updex.UpdateFeaturesOptions{
+		DryRun:        clix.DryRun,
+		NoRefresh:     noRefresh,
+		NoVacuum:      featureUpdateNoVac,
+		Component:     featureComponent,
+		Workers:       featureJobs,
+		Version:       featureVersion,
+		IgnorePhasing: featureIgnorePhase,
+		Stage:         featureStage,
+		Record:        true,
+		MetricsFile:   featureMetricsFile,
 	}
 
 	results, err := client.UpdateFeatures(cmd.Context(), opts)
@@ -234,6 +380,13 @@ func runFeaturesUpdate(cmd *cobra.Command, args []string) error {
 		fmt.Println("[DRY RUN] Previewing feature updates.")
 	}
 
+	printUpdateResults(results)
+
+	return err
+}
+
+// printUpdateResults prints per-component update results as a table.
+func printUpdateResults(results []updex.UpdateFeaturesResult) {
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 	_, _ = fmt.Fprintln(w, "FEATURE\tCOMPONENT\tVERSION\tSTATUS")
 	for _, fr := range results {
@@ -241,10 +394,20 @@ func runFeaturesUpdate(cmd *cobra.Command, args []string) error {
 			status := "error"
 			if r.Error != "" {
 				status = r.Error
+			} else if r.Staged && r.DryRun {
+				status = "would stage"
+			} else if r.Staged && r.Downloaded {
+				status = "staged"
+			} else if r.Staged {
+				status = "already staged"
 			} else if r.DryRun && r.Downloaded {
 				status = "would download"
 			} else if r.Downloaded {
 				status = "downloaded"
+			} else if r.DryRun && r.Relinked {
+				status = "would switch"
+			} else if r.Relinked {
+				status = "switched"
 			} else if r.Installed {
 				status = "up to date"
 			}
@@ -252,15 +415,15 @@ func runFeaturesUpdate(cmd *cobra.Command, args []string) error {
 		}
 	}
 	_ = w.Flush()
-
-	return err
 }
 
 func runFeaturesCheck(cmd *cobra.Command, args []string) error {
 	client := newClient()
 
 	results, err := client.CheckFeatures(cmd.Context(), updex.CheckFeaturesOptions{
-		Component: featureComponent,
+		Component:   featureComponent,
+		Workers:     featureJobs,
+		MetricsFile: featureMetricsFile,
 	})
 
 	if clix.JSONOutput {
@@ -298,8 +461,12 @@ func runFeaturesCheck(cmd *cobra.Command, args []string) error {
 			switch {
 			case r.Error != "":
 				update = "error"
+			case r.UpdateAvailable && r.StagedVersion != "":
+				update = "staged (" + r.StagedVersion + ")"
 			case r.UpdateAvailable:
 				update = "yes"
+			case r.HeldBackVersion != "":
+				update = "held back by phasing (" + r.HeldBackVersion + ")"
 			}
 			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", fr.Feature, r.Component, current, newest, update)
 		}
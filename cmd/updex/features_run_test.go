@@ -238,13 +238,14 @@ func TestRunFeaturesUpdate_RefreshFailure_JSONEmitsResultsAndErrors(t *testing.T
 
 	oldDefinitions, oldNoRefresh, oldNoVac := definitions, noRefresh, featureUpdateNoVac
 	oldDryRun, oldJSONOutput, oldSilent := clix.DryRun, clix.JSONOutput, clix.Silent
-	oldGetEUID, oldRunner, oldSysextDir := getEUID, sysextRunner, sysext.SysextDir
+	oldGetEUID, oldRunner, oldSysextDir, oldStateDir := getEUID, sysextRunner, sysext.SysextDir, stateDir
 	t.Cleanup(func() {
 		definitions, noRefresh, featureUpdateNoVac = oldDefinitions, oldNoRefresh, oldNoVac
 		clix.DryRun, clix.JSONOutput, clix.Silent = oldDryRun, oldJSONOutput, oldSilent
-		getEUID, sysextRunner, sysext.SysextDir = oldGetEUID, oldRunner, oldSysextDir
+		getEUID, sysextRunner, sysext.SysextDir, stateDir = oldGetEUID, oldRunner, oldSysextDir, oldStateDir
 	})
 	definitions = configDir
+	stateDir = t.TempDir()
 	noRefresh = false
 	featureUpdateNoVac = true
 	clix.DryRun = false
@@ -279,15 +280,16 @@ func TestRunFeaturesUpdate_RefreshFailure_JSONEmitsResultsAndErrors(t *testing.T
 // sets getEUID to root so the requireRoot() guard is not what fails.
 func TestRunFeaturesUpdate_JSONErrorPathEmitsArray(t *testing.T) {
 	oldDefinitions, oldComponent, oldJSONOutput := definitions, featureComponent, clix.JSONOutput
-	oldGetEUID := getEUID
+	oldGetEUID, oldStateDir := getEUID, stateDir
 	t.Cleanup(func() {
 		definitions = oldDefinitions
 		featureComponent = oldComponent
 		clix.JSONOutput = oldJSONOutput
-		getEUID = oldGetEUID
+		getEUID, stateDir = oldGetEUID, oldStateDir
 	})
 
 	definitions = t.TempDir()
+	stateDir = t.TempDir()
 	featureComponent = "somecomponent"
 	clix.JSONOutput = true
 	getEUID = func() int { return 0 }
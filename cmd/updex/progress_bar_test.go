@@ -1,9 +1,15 @@
 package updex
 
 import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
 	"testing"
 
 	"github.com/frostyard/clix"
+	"github.com/frostyard/updex/journal"
 )
 
 // TestNewProgressBarSuppressedForMachineOutput verifies that the download
@@ -45,3 +51,39 @@ func TestNewProgressBarSuppressedForMachineOutput(t *testing.T) {
 		})
 	}
 }
+
+// TestNewReporterLogsToJournalStream verifies that the CLI reports to the
+// journal only when stderr is the stream systemd connected to it.
+func TestNewReporterLogsToJournalStream(t *testing.T) {
+	oldSocket, oldSilent := journalSocket, clix.Silent
+	t.Cleanup(func() {
+		journalSocket, clix.Silent = oldSocket, oldSilent
+	})
+	journalSocket = filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	info, err := os.Stderr.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	t.Setenv("JOURNAL_STREAM", strconv.FormatUint(uint64(st.Dev), 10)+":"+strconv.FormatUint(st.Ino, 10))
+
+	clix.Silent = false
+	if _, ok := newReporter().(*journal.Reporter); !ok {
+		t.Error("newReporter() with stderr on the journal stream did not log to the journal")
+	}
+	clix.Silent = true
+	if _, ok := newReporter().(*journal.Reporter); ok {
+		t.Error("newReporter() in silent mode logs to the journal")
+	}
+	clix.Silent = false
+	t.Setenv("JOURNAL_STREAM", "")
+	if _, ok := newReporter().(*journal.Reporter); ok {
+		t.Error("newReporter() without JOURNAL_STREAM logs to the journal")
+	}
+}
@@ -3,6 +3,8 @@ package updex
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -11,6 +13,9 @@ var (
 	definitions string
 	verify      bool
 	noRefresh   bool
+	limitRate   byteRate
+	lockWait    bool
+	noLockWait  bool
 	getEUID     = os.Geteuid
 )
 
@@ -18,6 +23,50 @@ func registerAppFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVarP(&definitions, "definitions", "C", "", "Path to directory containing .transfer and .feature files")
 	cmd.PersistentFlags().BoolVar(&verify, "verify", false, "Force GPG signature verification on SHA256SUMS")
 	cmd.PersistentFlags().BoolVar(&noRefresh, "no-refresh", false, "Skip running systemd-sysext refresh after install/update")
+	cmd.PersistentFlags().Var(&limitRate, "limit-rate", "Cap image downloads at this many bytes per second (K, M, G suffixes; 0 = unlimited)")
+	cmd.PersistentFlags().BoolVar(&lockWait, "wait", true, "Wait for another running updex operation to finish")
+	cmd.PersistentFlags().BoolVar(&noLockWait, "no-wait", false, "Fail at once if another updex operation is running")
+	cmd.MarkFlagsMutuallyExclusive("wait", "no-wait")
+}
+
+// byteRate is a --limit-rate value: bytes per second, optionally with a K,
+// M, or G suffix for powers of 1024, as wget and curl accept.
+type byteRate int64
+
+func (r *byteRate) String() string { return strconv.FormatInt(int64(*r), 10) }
+
+func (r *byteRate) Type() string { return "rate" }
+
+func (r *byteRate) Set(s string) error {
+	n, err := parseByteRate(s)
+	if err != nil {
+		return err
+	}
+	*r = byteRate(n)
+	return nil
+}
+
+func parseByteRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	multiplier := int64(1)
+	if s != "" {
+		switch strings.ToUpper(s[len(s)-1:]) {
+		case "K":
+			multiplier = 1 << 10
+		case "M":
+			multiplier = 1 << 20
+		case "G":
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rate %q: want a non-negative number of bytes per second, optionally with a K, M, or G suffix", s)
+	}
+	return int64(n * float64(multiplier)), nil
 }
 
 func requireRoot() error {
@@ -54,6 +103,10 @@ default directories:
 	cmd.AddCommand(newDaemonCmd())
 	cmd.AddCommand(newComponentsCmd())
 	cmd.AddCommand(newCatalogCmd())
+	cmd.AddCommand(newBundleCmd())
+	cmd.AddCommand(newStatusCmd())
+	cmd.AddCommand(newApplyCmd())
+	cmd.AddCommand(newServeVarlinkCmd())
 
 	return cmd
 }
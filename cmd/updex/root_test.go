@@ -2,9 +2,23 @@ package updex
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 )
 
+// TestMain gives the package's tests a lock file they can always take,
+// running as root or not.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "updex-lock-")
+	if err != nil {
+		panic(err)
+	}
+	lockPath = filepath.Join(dir, "lock")
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestRequireRoot(t *testing.T) {
 	err := requireRoot()
 	if os.Geteuid() == 0 {
@@ -21,3 +35,33 @@ func TestRequireRoot(t *testing.T) {
 		}
 	}
 }
+
+func TestParseByteRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "2048", want: 2048},
+		{in: "500K", want: 500 << 10},
+		{in: "1.5m", want: 3 << 19},
+		{in: "2G", want: 2 << 30},
+		{in: "", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "fast", wantErr: true},
+		{in: "1T", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteRate(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseByteRate(%q) = %d, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseByteRate(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package updex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/frostyard/clix"
+	"github.com/frostyard/updex/updex"
+	"github.com/spf13/cobra"
+)
+
+var statusComponent string
+
+func newStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Check installed images against their transfers",
+		Long: `List every installed image and check its permission bits and read-only
+state against its transfer's Mode= and ReadOnly= settings.
+
+Images of a transfer with ReadOnly=yes carry the immutable file attribute
+where the filesystem supports it, and otherwise have no write permission
+bits. An image that has lost that marking, or has been given a different
+mode since it was installed, is reported as drifted and the command exits
+non-zero.
+
+OUTPUT COLUMNS:
+  COMPONENT  - Transfer the image belongs to
+  VERSION    - Image version
+  CURRENT    - Whether this version is the active one
+  MODE       - Permission bits
+  READONLY   - Whether the image is immutable or write-protected
+  STATUS     - "ok", or how the image differs from its transfer`,
+		Example: `  # Check every installed image
+  updex status
+
+  # Check in JSON format
+  updex status --json`,
+		Args: cobra.NoArgs,
+		RunE: runStatus,
+	}
+
+	cmd.Flags().StringVar(&statusComponent, "component", "", "Scope the operation to a single named systemd-sysupdate component")
+
+	return cmd
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	client := newClient()
+
+	statuses, err := client.Status(cmd.Context(), updex.StatusOptions{Component: statusComponent})
+	if err != nil {
+		return err
+	}
+
+	var drifted int
+	for _, s := range statuses {
+		if len(s.Drift) > 0 {
+			drifted++
+		}
+	}
+	var driftErr error
+	if drifted > 0 {
+		driftErr = fmt.Errorf("%d image(s) drifted from their transfer", drifted)
+	}
+
+	if clix.JSONOutput {
+		_, err = clix.OutputJSON(statuses)
+		return errors.Join(driftErr, err)
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No installed images found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "COMPONENT\tVERSION\tCURRENT\tMODE\tREADONLY\tSTATUS")
+	for _, s := range statuses {
+		current := ""
+		if s.Current {
+			current = "*"
+		}
+		state := "ok"
+		if len(s.Drift) > 0 {
+			state = strings.Join(s.Drift, "; ")
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\n", s.Component, s.Version, current, s.Mode, s.ReadOnly, state)
+	}
+	_ = w.Flush()
+
+	return driftErr
+}
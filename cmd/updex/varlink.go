@@ -0,0 +1,73 @@
+package updex
+
+import (
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/frostyard/updex/varlink"
+	"github.com/spf13/cobra"
+)
+
+var varlinkSocket string
+
+func newServeVarlinkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve-varlink",
+		Short: "Serve the updex SDK over Varlink",
+		Long: `Answer Varlink calls of the org.frostyard.Updex interface, so programs
+such as desktop frontends can manage features without running updex as
+root themselves.
+
+Started by updex-varlink.socket, it serves the socket systemd passes it on
+` + varlink.SocketPath + `. Started by hand, it listens on --socket.
+It serves until it receives SIGTERM or SIGINT.
+
+Any user may call Features, Components, CheckFeatures and CatalogList.
+UpdateFeatures, EnableFeature, DisableFeature, CatalogAdd and CatalogRemove
+require the caller to be root. Calls that change the system run one at a
+time. The interface description lists every method:
+
+  varlinkctl introspect ` + varlink.SocketPath + `
+
+Requires root privileges.`,
+		Example: `  # Enable the socket-activated service
+  sudo systemctl enable --now updex-varlink.socket
+
+  # List features as an unprivileged user
+  varlinkctl call ` + varlink.SocketPath + ` org.frostyard.Updex.Features '{}'
+
+  # Update with progress notifications
+  sudo varlinkctl call --more ` + varlink.SocketPath + ` org.frostyard.Updex.UpdateFeatures '{}'`,
+		Args: cobra.NoArgs,
+		RunE: runServeVarlink,
+	}
+
+	cmd.Flags().StringVar(&varlinkSocket, "socket", varlink.SocketPath, "Socket to listen on when not socket-activated")
+
+	return cmd
+}
+
+func runServeVarlink(cmd *cobra.Command, args []string) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+
+	l, err := varlink.ActivationListener()
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		if l, err = varlink.Listen(varlinkSocket); err != nil {
+			return fmt.Errorf("listen on %s: %w", varlinkSocket, err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	srv := varlink.NewServer(varlink.Config{
+		Client:  newClientConfig(),
+		Version: cmd.Root().Version,
+	})
+	return srv.Serve(ctx, l)
+}
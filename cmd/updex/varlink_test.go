@@ -0,0 +1,78 @@
+package updex
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestRunServeVarlink_RejectsNonRoot(t *testing.T) {
+	oldGetEUID := getEUID
+	t.Cleanup(func() { getEUID = oldGetEUID })
+	getEUID = func() int { return 1000 }
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(t.Context())
+	if err := runServeVarlink(cmd, nil); err == nil || !strings.Contains(err.Error(), "root privileges") {
+		t.Fatalf("expected root-privileges error, got: %v", err)
+	}
+}
+
+// TestRunServeVarlink_ServesSocket verifies that, without socket
+// activation, the server listens on --socket until its context ends.
+func TestRunServeVarlink_ServesSocket(t *testing.T) {
+	configDir := t.TempDir()
+	writeFeatureFile(t, configDir, "testfeature", true)
+
+	oldDefinitions, oldSocket, oldGetEUID := definitions, varlinkSocket, getEUID
+	t.Cleanup(func() {
+		definitions = oldDefinitions
+		varlinkSocket = oldSocket
+		getEUID = oldGetEUID
+	})
+	definitions = configDir
+	varlinkSocket = filepath.Join(t.TempDir(), "run", "updex.socket")
+	getEUID = func() int { return 0 }
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() {
+		cmd := &cobra.Command{}
+		cmd.SetContext(ctx)
+		done <- runServeVarlink(cmd, nil)
+	}()
+
+	var conn net.Conn
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var err error
+		if conn, err = net.Dial("unix", varlinkSocket); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not listen on %s: %v", varlinkSocket, err)
+		}
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(`{"method":"org.frostyard.Updex.Features"}` + "\x00")); err != nil {
+		t.Fatalf("write call: %v", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		t.Fatalf("read reply: %v", err)
+	}
+	if !strings.Contains(reply, `"name":"testfeature"`) {
+		t.Errorf("Features reply = %q, want testfeature", reply)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("runServeVarlink() error = %v", err)
+	}
+}
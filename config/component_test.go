@@ -322,10 +322,55 @@ func TestIsSysextTransfer(t *testing.T) {
 			want: false,
 		},
 		{
-			name: "non-url-file source",
+			name: "url-tar source into directory target",
+			t:    &Transfer{Source: SourceSection{Type: "url-tar"}, Target: TargetSection{Type: "directory"}},
+			want: true,
+		},
+		{
+			name: "url-tar source into regular-file target",
 			t:    &Transfer{Source: SourceSection{Type: "url-tar"}, Target: TargetSection{Type: "regular-file"}},
 			want: false,
 		},
+		{
+			name: "url-tar source with implicit target type",
+			t:    &Transfer{Source: SourceSection{Type: "url-tar"}, Target: TargetSection{}},
+			want: false,
+		},
+		{
+			name: "url-file source into directory target",
+			t:    &Transfer{Source: SourceSection{Type: "url-file"}, Target: TargetSection{Type: "directory"}},
+			want: false,
+		},
+		{
+			name: "oci registry source",
+			t:    &Transfer{Source: SourceSection{Type: "oci"}, Target: TargetSection{Type: "regular-file"}},
+			want: true,
+		},
+		{
+			name: "oci registry source into directory target",
+			t:    &Transfer{Source: SourceSection{Type: "oci"}, Target: TargetSection{Type: "directory"}},
+			want: false,
+		},
+		{
+			name: "local regular-file source",
+			t:    &Transfer{Source: SourceSection{Type: "regular-file"}, Target: TargetSection{Type: "regular-file"}},
+			want: true,
+		},
+		{
+			name: "local directory source into directory target",
+			t:    &Transfer{Source: SourceSection{Type: "directory"}, Target: TargetSection{Type: "directory"}},
+			want: true,
+		},
+		{
+			name: "local directory source into regular-file target",
+			t:    &Transfer{Source: SourceSection{Type: "directory"}, Target: TargetSection{Type: "regular-file"}},
+			want: false,
+		},
+		{
+			name: "url-tar directory target relative to boot",
+			t:    &Transfer{Source: SourceSection{Type: "url-tar"}, Target: TargetSection{Type: "directory", PathRelativeTo: "boot"}},
+			want: false,
+		},
 	}
 
 	for _, tc := range tests {
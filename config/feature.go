@@ -16,16 +16,26 @@ const featureSuffix = ".feature"
 
 // Feature represents a parsed .feature configuration file
 type Feature struct {
-	Name          string   // Derived from filename (e.g., "devel" from "devel.feature")
-	FilePath      string   // Path to the .feature file
-	Description   string   // Human-readable description
-	Documentation string   // URL to documentation
-	AppStream     string   // URL to AppStream catalog XML
-	Enabled       bool     // Whether the feature is enabled
-	Masked        bool     // Whether the feature is masked (symlink to /dev/null)
-	Transfers     []string // Names of transfers belonging to this feature
+	Name             string   // Derived from filename (e.g., "devel" from "devel.feature")
+	FilePath         string   // Path to the .feature file
+	Description      string   // Human-readable description
+	Documentation    string   // URL to documentation
+	AppStream        string   // URL to AppStream catalog XML
+	Enabled          bool     // Whether the feature is enabled
+	Masked           bool     // Whether the feature is masked (symlink to /dev/null)
+	Transfers        []string // Names of transfers belonging to this feature
+	PinVersion       string   // Version its transfers are held at (PinVersion= in [X-Updex])
+	SkipVersions     []string // <component>/<version> entries rolled back from (SkipVersions= in [X-Updex])
+	Channel          string   // Release channel its transfers follow (Channel= in [X-Updex]); empty selects DefaultChannel
+	HealthCheck      string   // Shell command that must succeed after an update is activated (HealthCheck= in [X-Updex])
+	HealthCheckUnits []string // Units that must be active after an update is activated (HealthCheckUnits= in [X-Updex])
 }
 
+// pinSection is the section holding PinVersion=, SkipVersions=, Channel=
+// and the health check keys. systemd-sysupdate ignores
+// sections named X-*, so the key never trips its unknown-key warning.
+const pinSection = "X-Updex"
+
 // LoadFeaturesIn loads all .feature files from customPath (if non-empty) or
 // from the given roots using their legacy default search paths. This is the
 // explicit-roots variant of LoadFeatures.
@@ -203,6 +213,7 @@ func parseFeatureFile(filePath, name string, searchPaths []string) (*Feature, er
 			f.Enabled = key.MustBool(false)
 		}
 	}
+	applyUpdexSection(f, cfg)
 
 	// Apply drop-ins from all search paths
 	if err := applyFeatureDropIns(f, name, searchPaths); err != nil {
@@ -279,10 +290,195 @@ func applyFeatureDropIn(f *Feature, dropInPath string) error {
 			f.Enabled = key.MustBool(f.Enabled)
 		}
 	}
+	applyUpdexSection(f, cfg)
 
 	return nil
 }
 
+// applyUpdexSection applies the [X-Updex] PinVersion=, SkipVersions=,
+// Channel=, HealthCheck= and HealthCheckUnits= keys. An empty value clears
+// what an earlier file set.
+func applyUpdexSection(f *Feature, cfg *ini.File) {
+	if sec, err := cfg.GetSection(pinSection); err == nil {
+		if key, err := sec.GetKey("PinVersion"); err == nil {
+			f.PinVersion = key.String()
+		}
+		if key, err := sec.GetKey("SkipVersions"); err == nil {
+			f.SkipVersions = strings.Fields(key.String())
+		}
+		if key, err := sec.GetKey("Channel"); err == nil {
+			f.Channel = key.String()
+		}
+		if key, err := sec.GetKey("HealthCheck"); err == nil {
+			f.HealthCheck = key.String()
+		}
+		if key, err := sec.GetKey("HealthCheckUnits"); err == nil {
+			f.HealthCheckUnits = strings.Fields(key.String())
+		}
+	}
+}
+
+// FeatureDropIn is the state a single feature drop-in sets: Enabled is nil
+// when the file has no Enabled= key, PinVersion empty when it has no pin.
+// SkipVersions holds <component>/<version> entries, Channel is empty when
+// the file selects no channel.
+type FeatureDropIn struct {
+	Enabled      *bool
+	PinVersion   string
+	SkipVersions []string
+	Channel      string
+}
+
+// ParseFeatureDropIn reads the Enabled=, PinVersion=, SkipVersions= and
+// Channel= keys of one drop-in file, so a writer can change one of them and
+// carry the others over.
+func ParseFeatureDropIn(dropInPath string) (FeatureDropIn, error) {
+	var d FeatureDropIn
+	cfg, err := ini.Load(dropInPath)
+	if err != nil {
+		return d, fmt.Errorf("failed to load drop-in file: %w", err)
+	}
+	if sec, err := cfg.GetSection("Feature"); err == nil {
+		if key, err := sec.GetKey("Enabled"); err == nil {
+			enabled := key.MustBool(false)
+			d.Enabled = &enabled
+		}
+	}
+	var f Feature
+	applyUpdexSection(&f, cfg)
+	d.PinVersion, d.SkipVersions, d.Channel = f.PinVersion, f.SkipVersions, f.Channel
+	return d, nil
+}
+
+// String renders d in drop-in syntax, omitting unset keys.
+func (d FeatureDropIn) String() string {
+	var b strings.Builder
+	if d.Enabled != nil {
+		fmt.Fprintf(&b, "[Feature]\nEnabled=%v\n", *d.Enabled)
+	}
+	if d.PinVersion != "" || len(d.SkipVersions) > 0 || d.Channel != "" {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n", pinSection)
+		if d.PinVersion != "" {
+			fmt.Fprintf(&b, "PinVersion=%s\n", d.PinVersion)
+		}
+		if len(d.SkipVersions) > 0 {
+			fmt.Fprintf(&b, "SkipVersions=%s\n", strings.Join(d.SkipVersions, " "))
+		}
+		if d.Channel != "" {
+			fmt.Fprintf(&b, "Channel=%s\n", d.Channel)
+		}
+	}
+	return b.String()
+}
+
+// ApplyFeaturePins copies each enabled feature's PinVersion onto its
+// transfers' Transfer.PinVersion. A transfer belonging to enabled features
+// with different pins keeps the first feature's pin, by feature order, and
+// the conflict is reported as a warning string.
+func ApplyFeaturePins(features []*Feature, transfers []*Transfer) []string {
+	var warnings []string
+	pinnedBy := make(map[*Transfer]string)
+	for _, f := range features {
+		if !f.Enabled || f.Masked || f.PinVersion == "" {
+			continue
+		}
+		for _, t := range GetTransfersForFeature(transfers, f.Name) {
+			if by, ok := pinnedBy[t]; ok {
+				if t.Transfer.PinVersion != f.PinVersion {
+					warnings = append(warnings, fmt.Sprintf(
+						"transfer %q is pinned to %s by feature %q and to %s by feature %q; using %s",
+						t.Component, t.Transfer.PinVersion, by, f.PinVersion, f.Name, t.Transfer.PinVersion))
+				}
+				continue
+			}
+			t.Transfer.PinVersion = f.PinVersion
+			pinnedBy[t] = f.Name
+		}
+	}
+	return warnings
+}
+
+// SkipVersionEntry formats the SkipVersions= entry that keeps component
+// from reinstalling v.
+func SkipVersionEntry(component, v string) string {
+	return component + "/" + v
+}
+
+// ApplyFeatureSkips copies each unmasked feature's SkipVersions entries onto
+// Transfer.SkipVersions of the feature's transfer they name. Unlike pins,
+// skips apply whether or not the feature is enabled: a version rolled back
+// from stays bad for every feature sharing the transfer.
+func ApplyFeatureSkips(features []*Feature, transfers []*Transfer) {
+	for _, f := range features {
+		if f.Masked {
+			continue
+		}
+		for _, entry := range f.SkipVersions {
+			component, v, ok := strings.Cut(entry, "/")
+			if !ok || v == "" {
+				continue
+			}
+			for _, t := range GetTransfersForFeature(transfers, f.Name) {
+				if t.Component == component && !slices.Contains(t.Transfer.SkipVersions, v) {
+					t.Transfer.SkipVersions = append(t.Transfer.SkipVersions, v)
+				}
+			}
+		}
+	}
+}
+
+// DefaultChannel is the channel a transfer follows when none of its
+// features selects one.
+const DefaultChannel = "stable"
+
+// ApplyFeatureChannels expands the channel specifier (%R) in each
+// transfer's Source.Path and Mirrors to the Channel of a feature it belongs
+// to, or DefaultChannel, and records the result in Transfer.Channel.
+// Enabled features are considered before disabled ones. A transfer
+// belonging to enabled features with different channels follows the first
+// feature's, by feature order, and the conflict is reported as a warning
+// string.
+func ApplyFeatureChannels(features []*Feature, transfers []*Transfer) []string {
+	var warnings []string
+	channelOf := make(map[*Transfer]string)
+	selectedBy := make(map[*Transfer]string)
+	for _, enabled := range []bool{true, false} {
+		for _, f := range features {
+			if f.Masked || f.Enabled != enabled || f.Channel == "" {
+				continue
+			}
+			for _, t := range GetTransfersForFeature(transfers, f.Name) {
+				if by, ok := selectedBy[t]; ok {
+					if enabled && channelOf[t] != f.Channel {
+						warnings = append(warnings, fmt.Sprintf(
+							"transfer %q follows channel %s of feature %q and %s of feature %q; using %s",
+							t.Component, channelOf[t], by, f.Channel, f.Name, channelOf[t]))
+					}
+					continue
+				}
+				channelOf[t] = f.Channel
+				selectedBy[t] = f.Name
+			}
+		}
+	}
+
+	for _, t := range transfers {
+		channel, ok := channelOf[t]
+		if !ok {
+			channel = DefaultChannel
+		}
+		t.Transfer.Channel = channel
+		t.Source.Path = expandChannel(t.Source.Path, channel)
+		for i, mirror := range t.Source.Mirrors {
+			t.Source.Mirrors[i] = expandChannel(mirror, channel)
+		}
+	}
+	return warnings
+}
+
 // GetEnabledFeatureNames returns a list of enabled feature names
 func GetEnabledFeatureNames(features []*Feature) []string {
 	var enabled []string
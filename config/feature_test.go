@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -127,6 +128,155 @@ Enabled=true
 	}
 }
 
+func TestLoadFeaturesPinDropIn(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.feature"), []byte("[Feature]\nEnabled=true\n"), 0644); err != nil {
+		t.Fatalf("failed to write base feature file: %v", err)
+	}
+	dropInDir := filepath.Join(tmpDir, "test.feature.d")
+	if err := os.MkdirAll(dropInDir, 0755); err != nil {
+		t.Fatalf("failed to create drop-in directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dropInDir, "50-local.conf"), []byte("[X-Updex]\nPinVersion=1.4.2\n"), 0644); err != nil {
+		t.Fatalf("failed to write drop-in file: %v", err)
+	}
+
+	features, err := LoadFeatures(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadFeatures() error = %v", err)
+	}
+	if len(features) != 1 {
+		t.Fatalf("expected 1 feature, got %d", len(features))
+	}
+	if got := features[0].PinVersion; got != "1.4.2" {
+		t.Errorf("PinVersion = %q, want %q (from drop-in)", got, "1.4.2")
+	}
+}
+
+func TestLoadFeaturesHealthCheck(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "[Feature]\nEnabled=true\n\n[X-Updex]\nHealthCheck=curl -fs http://localhost:8080/healthz\nHealthCheckUnits=nginx.service\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.feature"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write base feature file: %v", err)
+	}
+	dropInDir := filepath.Join(tmpDir, "test.feature.d")
+	if err := os.MkdirAll(dropInDir, 0755); err != nil {
+		t.Fatalf("failed to create drop-in directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dropInDir, "50-local.conf"), []byte("[X-Updex]\nHealthCheckUnits=nginx.service php-fpm.service\n"), 0644); err != nil {
+		t.Fatalf("failed to write drop-in file: %v", err)
+	}
+
+	features, err := LoadFeatures(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadFeatures() error = %v", err)
+	}
+	if len(features) != 1 {
+		t.Fatalf("expected 1 feature, got %d", len(features))
+	}
+	if got := features[0].HealthCheck; got != "curl -fs http://localhost:8080/healthz" {
+		t.Errorf("HealthCheck = %q, want the .feature command", got)
+	}
+	if got := strings.Join(features[0].HealthCheckUnits, " "); got != "nginx.service php-fpm.service" {
+		t.Errorf("HealthCheckUnits = %q, want the drop-in's units", got)
+	}
+}
+
+func TestApplyFeaturePins(t *testing.T) {
+	features := []*Feature{
+		{Name: "a", Enabled: true, PinVersion: "1.0"},
+		{Name: "b", Enabled: true, PinVersion: "2.0"},
+		{Name: "off", Enabled: false, PinVersion: "3.0"},
+	}
+	shared := &Transfer{Component: "shared", Transfer: TransferSection{Features: []string{"a", "b"}}}
+	onlyB := &Transfer{Component: "onlyb", Transfer: TransferSection{Features: []string{"b"}, PinVersion: "0.5"}}
+	disabled := &Transfer{Component: "disabled", Transfer: TransferSection{Features: []string{"off"}, PinVersion: "0.5"}}
+
+	warnings := ApplyFeaturePins(features, []*Transfer{shared, onlyB, disabled})
+
+	if shared.Transfer.PinVersion != "1.0" {
+		t.Errorf("shared PinVersion = %q, want the first feature's 1.0", shared.Transfer.PinVersion)
+	}
+	if onlyB.Transfer.PinVersion != "2.0" {
+		t.Errorf("onlyb PinVersion = %q, want the feature's 2.0 over the file's", onlyB.Transfer.PinVersion)
+	}
+	if disabled.Transfer.PinVersion != "0.5" {
+		t.Errorf("disabled PinVersion = %q, want the file's 0.5, none from a disabled feature", disabled.Transfer.PinVersion)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "shared") {
+		t.Errorf("warnings = %v, want one conflict warning for shared", warnings)
+	}
+}
+
+func TestApplyFeatureSkips(t *testing.T) {
+	features := []*Feature{
+		{Name: "a", SkipVersions: []string{"shared/2.0", "onlya/1.0", "malformed"}},
+		{Name: "b", Enabled: true, SkipVersions: []string{"shared/2.0", "shared/1.5"}},
+		{Name: "masked", Masked: true, SkipVersions: []string{"onlya/0.9"}},
+	}
+	shared := &Transfer{Component: "shared", Transfer: TransferSection{Features: []string{"a", "b"}}}
+	onlyA := &Transfer{Component: "onlya", Transfer: TransferSection{Features: []string{"a", "masked"}}}
+
+	ApplyFeatureSkips(features, []*Transfer{shared, onlyA})
+
+	if got := strings.Join(shared.Transfer.SkipVersions, " "); got != "2.0 1.5" {
+		t.Errorf("shared SkipVersions = %q, want \"2.0 1.5\" (deduplicated)", got)
+	}
+	if got := strings.Join(onlyA.Transfer.SkipVersions, " "); got != "1.0" {
+		t.Errorf("onlya SkipVersions = %q, want \"1.0\" (none from a masked feature)", got)
+	}
+}
+
+func TestApplyFeatureChannels(t *testing.T) {
+	features := []*Feature{
+		{Name: "a", Enabled: true, Channel: "beta"},
+		{Name: "b", Enabled: true, Channel: "nightly"},
+		{Name: "c", Channel: "edge"},
+		{Name: "masked", Masked: true, Channel: "masked"},
+	}
+	shared := &Transfer{Component: "shared", Transfer: TransferSection{Features: []string{"a", "b"}},
+		Source: SourceSection{Path: "https://example.com/%R", Mirrors: []string{"https://mirror.example.com/sysexts/%R"}}}
+	disabled := &Transfer{Component: "disabled", Transfer: TransferSection{Features: []string{"c", "masked"}},
+		Source: SourceSection{Path: "/srv/%R/caf%C3%A9/%%R"}}
+	standalone := &Transfer{Component: "standalone", Source: SourceSection{Path: "https://example.com/%R"}}
+
+	warnings := ApplyFeatureChannels(features, []*Transfer{shared, disabled, standalone})
+
+	if shared.Source.Path != "https://example.com/beta" || shared.Source.Mirrors[0] != "https://mirror.example.com/sysexts/beta" {
+		t.Errorf("shared source = %q %q, want the first enabled feature's channel", shared.Source.Path, shared.Source.Mirrors)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "using beta") {
+		t.Errorf("warnings = %q, want one conflict resolved to beta", warnings)
+	}
+	if disabled.Source.Path != "/srv/edge/caf%C3%A9/%%R" || disabled.Transfer.Channel != "edge" {
+		t.Errorf("disabled source = %q (%s), want the disabled feature's channel and other %% left alone", disabled.Source.Path, disabled.Transfer.Channel)
+	}
+	if standalone.Source.Path != "https://example.com/"+DefaultChannel || standalone.Transfer.Channel != DefaultChannel {
+		t.Errorf("standalone source = %q (%s), want the default channel", standalone.Source.Path, standalone.Transfer.Channel)
+	}
+}
+
+func TestFeatureDropInRoundTrip(t *testing.T) {
+	enabled := true
+	d := FeatureDropIn{Enabled: &enabled, PinVersion: "1.2", SkipVersions: []string{"a/2.0", "b/3.0"}, Channel: "beta"}
+	want := "[Feature]\nEnabled=true\n\n[X-Updex]\nPinVersion=1.2\nSkipVersions=a/2.0 b/3.0\nChannel=beta\n"
+	if got := d.String(); got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "00-updex.conf")
+	if err := os.WriteFile(path, []byte(want), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseFeatureDropIn(path)
+	if err != nil {
+		t.Fatalf("ParseFeatureDropIn() error = %v", err)
+	}
+	if got.String() != want {
+		t.Errorf("round trip = %q, want %q", got.String(), want)
+	}
+}
+
 func TestLoadFeaturesMasked(t *testing.T) {
 	tmpDir := t.TempDir()
 
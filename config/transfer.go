@@ -8,6 +8,7 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/frostyard/updex/internal/fileurl"
 	"gopkg.in/ini.v1"
 )
 
@@ -25,17 +26,23 @@ type Transfer struct {
 // TransferSection represents the [Transfer] section of a .transfer file
 type TransferSection struct {
 	MinVersion        string   // Minimum version to consider
+	MaxVersion        string   // Maximum version to consider
 	ProtectVersion    string   // Version to never remove (supports specifiers)
 	Verify            bool     // Verify GPG signatures (default: true)
 	InstancesMax      int      // Maximum number of versions to keep (default: 2)
 	Features          []string // Features this transfer belongs to (OR logic: any enabled activates)
 	RequisiteFeatures []string // All of these features must be enabled (AND logic)
+	PinVersion        string   // Version to hold at; an enabled feature's pin (ApplyFeaturePins) overrides the file's
+	SkipVersions      []string // Versions rolled back from; set by ApplyFeatureSkips, not read from the file
+	Channel           string   // Release channel %R expanded to; set by ApplyFeatureChannels, not read from the file
+	Phased            bool     // Honour the source's ROLLOUT percentages (default: false)
 }
 
 // SourceSection represents the [Source] section of a .transfer file
 type SourceSection struct {
-	Type          string   // Source type (url-file, url-tar, etc.)
-	Path          string   // Base URL or path
+	Type          string   // Source type (url-file, url-tar, regular-file, directory, oci)
+	Path          string   // Base URL, file:// URL, local directory, metalink, or registry/repository
+	Mirrors       []string // Alternate Paths tried in order when Path fails
 	MatchPattern  string   // Primary pattern with @v placeholder for version (first pattern)
 	MatchPatterns []string // All patterns (for matching different compression formats)
 }
@@ -64,6 +71,36 @@ func (s SourceSection) Patterns() []string {
 	return nil
 }
 
+// IsLocal reports whether the source is read from the local filesystem: a
+// regular-file or directory Source.Type (sysupdate.d(5)'s local source
+// types), or any source whose Path is a file:// URL.
+func (s SourceSection) IsLocal() bool {
+	return s.Type == "regular-file" || s.Type == "directory" || fileurl.IsFileURL(s.Path)
+}
+
+// BaseURL returns the URL the SHA256SUMS manifest and images are fetched
+// relative to. A local source's directory path is turned into a file:// URL;
+// every other Path is returned as written.
+func (s SourceSection) BaseURL() string {
+	if s.Type == "regular-file" || s.Type == "directory" {
+		return fileurl.FromPath(s.Path)
+	}
+	return s.Path
+}
+
+// MirrorURLs returns Mirrors converted like BaseURL: a local source's
+// directories become file:// URLs.
+func (s SourceSection) MirrorURLs() []string {
+	if len(s.Mirrors) == 0 {
+		return nil
+	}
+	urls := make([]string, len(s.Mirrors))
+	for i, mirror := range s.Mirrors {
+		urls[i] = SourceSection{Type: s.Type, Path: mirror}.BaseURL()
+	}
+	return urls
+}
+
 // Patterns returns MatchPatterns if non-empty, falling back to
 // []string{MatchPattern} if MatchPattern is set. Returns nil when both are empty.
 func (t TargetSection) Patterns() []string {
@@ -220,17 +257,24 @@ func loadTransfersFromPaths(searchPaths, osReleasePaths []string) ([]*Transfer,
 }
 
 // IsSysextTransfer reports whether t has the shape updex supports: a
-// url-file source downloaded to a regular-file target inside an extensions
-// staging directory. Native OS images share the legacy default sysupdate.d
-// directory with non-sysext transfers — GPT "partition" targets for the A/B
-// root, and a "regular-file" target relative to the ESP for the UKI (see
-// sysupdate.d(5), Target's PathRelativeTo=) — which updex must ignore
-// rather than fail on.
+// url-file (or local regular-file, or oci registry) source downloaded to a
+// regular-file target, or a url-tar (or local directory) source extracted
+// into a directory target, inside an extensions staging directory. Native OS
+// images share the legacy default sysupdate.d directory with non-sysext
+// transfers — GPT "partition" targets for the A/B root, and a "regular-file"
+// target relative to the ESP for the UKI (see sysupdate.d(5), Target's
+// PathRelativeTo=) — which updex must ignore rather than fail on.
 func IsSysextTransfer(t *Transfer) bool {
-	if t.Source.Type != "url-file" {
-		return false
-	}
-	if t.Target.Type != "" && t.Target.Type != "regular-file" {
+	switch t.Source.Type {
+	case "url-file", "regular-file", "oci":
+		if t.Target.Type != "" && t.Target.Type != "regular-file" {
+			return false
+		}
+	case "url-tar", "directory":
+		if t.Target.Type != "directory" {
+			return false
+		}
+	default:
 		return false
 	}
 	if t.Target.PathRelativeTo != "" {
@@ -239,9 +283,16 @@ func IsSysextTransfer(t *Transfer) bool {
 	return true
 }
 
+// IsDirectoryTarget reports whether t installs each version as a directory
+// tree (a url-tar source extracted into a "directory" target) rather than a
+// single image file.
+func IsDirectoryTarget(t *Transfer) bool {
+	return t.Target.Type == "directory"
+}
+
 // FilterSysextTransfers returns the subset of transfers that are
-// sysext-shaped url-file-to-regular-file transfers (see IsSysextTransfer),
-// silently dropping OS transfers such as A/B partition updates or the UKI.
+// sysext-shaped (see IsSysextTransfer), silently dropping OS transfers such
+// as A/B partition updates or the UKI.
 func FilterSysextTransfers(transfers []*Transfer) []*Transfer {
 	var filtered []*Transfer
 	for _, t := range transfers {
@@ -283,12 +334,21 @@ func parseTransferFile(filePath, component string, specCtx *specifierContext) (*
 		if key, err := sec.GetKey("MinVersion"); err == nil {
 			t.Transfer.MinVersion = key.String()
 		}
+		if key, err := sec.GetKey("MaxVersion"); err == nil {
+			t.Transfer.MaxVersion = key.String()
+		}
 		if key, err := sec.GetKey("ProtectVersion"); err == nil {
 			t.Transfer.ProtectVersion = expandSpecifiers(key.String(), specCtx)
 		}
+		if key, err := sec.GetKey("PinVersion"); err == nil {
+			t.Transfer.PinVersion = key.String()
+		}
 		if key, err := sec.GetKey("Verify"); err == nil {
 			t.Transfer.Verify = key.MustBool(true)
 		}
+		if key, err := sec.GetKey("Phased"); err == nil {
+			t.Transfer.Phased = key.MustBool(false)
+		}
 		if key, err := sec.GetKey("InstancesMax"); err == nil {
 			t.Transfer.InstancesMax = key.MustInt(2)
 		}
@@ -308,6 +368,11 @@ func parseTransferFile(filePath, component string, specCtx *specifierContext) (*
 		if key, err := sec.GetKey("Path"); err == nil {
 			t.Source.Path = strings.TrimRight(key.String(), "/")
 		}
+		if key, err := sec.GetKey("Mirrors"); err == nil {
+			for _, mirror := range strings.Fields(key.String()) {
+				t.Source.Mirrors = append(t.Source.Mirrors, strings.TrimRight(mirror, "/"))
+			}
+		}
 		if key, err := sec.GetKey("MatchPattern"); err == nil {
 			// Handle multiple patterns (space-separated alternatives).
 			// Specifiers (%a, %v, %w, …) are expanded before the patterns are used.
@@ -407,7 +472,7 @@ func newSpecifierContextFrom(osReleasePaths []string) *specifierContext {
 		hostname:      hostname,
 		shortHostname: shortHostname,
 		bootID:        readFileOneLine("/proc/sys/kernel/random/boot_id"),
-		machineID:     readFileOneLine("/etc/machine-id"),
+		machineID:     MachineIDFrom(MachineIDPath),
 		kernelRelease: readFileOneLine("/proc/sys/kernel/osrelease"),
 	}
 }
@@ -473,6 +538,35 @@ func expandSpecifiers(s string, ctx *specifierContext) string {
 	return b.String()
 }
 
+// expandChannel replaces the channel specifier %R in a Source.Path or
+// Mirrors entry. Paths get no other specifier expansion, so everything else
+// — URL percent-encoding included — is left as written, and %% is copied
+// as is so that %%R is not expanded.
+func expandChannel(s, channel string) string {
+	if !strings.Contains(s, "%R") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'R':
+				b.WriteString(channel)
+				i++
+				continue
+			case '%':
+				b.WriteString("%%")
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
 // goarchToSystemd maps Go architecture identifiers to systemd's naming convention.
 // See the systemd architecture table in systemd.unit(5).
 var goarchToSystemd = map[string]string{
@@ -515,6 +609,17 @@ func readFileOneLine(path string) string {
 // that have not yet migrated.
 var OSReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
 
+// MachineIDPath is the machine-id file %m expands from and phased rollouts
+// bucket the host by. SDK callers should inject it via updex.RuntimePaths
+// rather than mutating this variable.
+var MachineIDPath = "/etc/machine-id"
+
+// MachineIDFrom returns the machine ID stored at path, or "" when it cannot
+// be read.
+func MachineIDFrom(path string) string {
+	return readFileOneLine(path)
+}
+
 // ImageNameFrom returns an identifier for the OS image this system runs,
 // reading from the given os-release paths (first readable one wins).
 // This is the explicit-paths variant of ImageName.
@@ -528,6 +633,12 @@ func ImageNameFrom(paths []string) string {
 	return ""
 }
 
+// OSReleaseFrom returns the key-value pairs of the first readable file in
+// paths, or an empty map when none is readable.
+func OSReleaseFrom(paths []string) map[string]string {
+	return readOSReleaseFrom(paths)
+}
+
 // ImageName returns an identifier for the OS image this system runs,
 // preferring VARIANT_ID (set by ublue-os images and Fedora variants),
 // then IMAGE_ID (set by frostyard/snosi images), then ID as a last
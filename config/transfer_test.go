@@ -119,7 +119,10 @@ func TestLoadTransfers(t *testing.T) {
 	// Create a valid transfer file
 	validTransfer := `[Transfer]
 MinVersion=1.0.0
+MaxVersion=2.0.0
 InstancesMax=3
+Phased=yes
+PinVersion=1.5.0
 
 [Source]
 Type=url-file
@@ -158,9 +161,18 @@ Mode=0755
 	if tr.Transfer.MinVersion != "1.0.0" {
 		t.Errorf("MinVersion = %q, want %q", tr.Transfer.MinVersion, "1.0.0")
 	}
+	if tr.Transfer.MaxVersion != "2.0.0" {
+		t.Errorf("MaxVersion = %q, want %q", tr.Transfer.MaxVersion, "2.0.0")
+	}
 	if tr.Transfer.InstancesMax != 3 {
 		t.Errorf("InstancesMax = %d, want %d", tr.Transfer.InstancesMax, 3)
 	}
+	if !tr.Transfer.Phased {
+		t.Error("Phased = false, want true")
+	}
+	if tr.Transfer.PinVersion != "1.5.0" {
+		t.Errorf("PinVersion = %q, want %q", tr.Transfer.PinVersion, "1.5.0")
+	}
 
 	// Validate Source section
 	if tr.Source.Type != "url-file" {
@@ -568,6 +580,36 @@ MatchPattern=test_@v.raw
 	}
 }
 
+func TestLoadTransfersMirrors(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	content := `[Source]
+Type=url-file
+Path=https://example.com/releases
+Mirrors=https://mirror-a.example.org/releases/ https://mirror-b.example.org/updex.meta4
+MatchPattern=test_@v.raw
+
+[Target]
+MatchPattern=test_@v.raw
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.transfer"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	transfers, err := LoadTransfers(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadTransfers() error = %v", err)
+	}
+	if len(transfers) != 1 {
+		t.Fatalf("expected 1 transfer, got %d", len(transfers))
+	}
+
+	want := []string{"https://mirror-a.example.org/releases", "https://mirror-b.example.org/updex.meta4"}
+	if !slices.Equal(transfers[0].Source.Mirrors, want) {
+		t.Errorf("Source.Mirrors = %q, want %q", transfers[0].Source.Mirrors, want)
+	}
+}
+
 func TestLoadTransfersVerifyFlag(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -758,6 +800,49 @@ func TestSourceSectionPatterns(t *testing.T) {
 	}
 }
 
+func TestSourceSectionBaseURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       SourceSection
+		want      string
+		wantLocal bool
+	}{
+		{
+			name: "url-file over https",
+			src:  SourceSection{Type: "url-file", Path: "https://example.com/ext"},
+			want: "https://example.com/ext",
+		},
+		{
+			name:      "url-file over file://",
+			src:       SourceSection{Type: "url-file", Path: "file:///srv/mirror"},
+			want:      "file:///srv/mirror",
+			wantLocal: true,
+		},
+		{
+			name:      "regular-file local directory",
+			src:       SourceSection{Type: "regular-file", Path: "/srv/mirror"},
+			want:      "file:///srv/mirror",
+			wantLocal: true,
+		},
+		{
+			name:      "directory source already a file URL",
+			src:       SourceSection{Type: "directory", Path: "file:///srv/mirror"},
+			want:      "file:///srv/mirror",
+			wantLocal: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.src.BaseURL(); got != tt.want {
+				t.Errorf("BaseURL() = %q, want %q", got, tt.want)
+			}
+			if got := tt.src.IsLocal(); got != tt.wantLocal {
+				t.Errorf("IsLocal() = %v, want %v", got, tt.wantLocal)
+			}
+		})
+	}
+}
+
 func TestTargetSectionPatterns(t *testing.T) {
 	tests := []struct {
 		name string
@@ -862,3 +947,20 @@ func TestImageNameNoOSRelease(t *testing.T) {
 		t.Errorf("ImageName() = %q, want empty when os-release is unreadable", got)
 	}
 }
+
+func TestSourceSectionMirrorURLs(t *testing.T) {
+	local := SourceSection{Type: "regular-file", Path: "/srv/a", Mirrors: []string{"/srv/b", "file:///srv/c"}}
+	want := []string{"file:///srv/b", "file:///srv/c"}
+	if got := local.MirrorURLs(); !slices.Equal(got, want) {
+		t.Errorf("MirrorURLs() = %q, want %q", got, want)
+	}
+
+	remote := SourceSection{Type: "url-file", Path: "https://a.example.com", Mirrors: []string{"https://b.example.com"}}
+	if got := remote.MirrorURLs(); !slices.Equal(got, remote.Mirrors) {
+		t.Errorf("MirrorURLs() = %q, want %q", got, remote.Mirrors)
+	}
+
+	if got := (SourceSection{Type: "url-file"}).MirrorURLs(); got != nil {
+		t.Errorf("MirrorURLs() without mirrors = %q, want nil", got)
+	}
+}
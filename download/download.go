@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/frostyard/updex/internal/fileurl"
 	"github.com/frostyard/updex/internal/retry"
 )
 
@@ -19,7 +20,9 @@ import (
 // length (-1 if unknown). It returns an io.Writer that will receive downloaded
 // bytes for progress tracking. Return nil to disable progress tracking.
 // Retries call ProgressFunc once per attempt, so implementations should return
-// a fresh independent writer each time to avoid double-counting progress.
+// a fresh independent writer each time to avoid double-counting progress. A
+// resumed attempt reports the full length and replays the bytes already on
+// disk into the writer before the new ones.
 type ProgressFunc func(contentLength int64) io.Writer
 
 type retrySettings struct {
@@ -27,6 +30,14 @@ type retrySettings struct {
 	notify              retry.Notify
 	maxDecompressedSize int64
 	maxDownloadSize     int64
+	expectedSize        int64
+	filename            string
+	raw                 bool
+	mirrors             []string
+	failover            func(url string, reason error)
+	served              func(url string)
+	received            func(n int64)
+	limiter             *Limiter
 }
 
 // Option configures download behavior.
@@ -88,6 +99,97 @@ func WithMaxDownloadSize(bytes int64) Option {
 	}
 }
 
+// ErrSizeMismatch reports that an image's size differs from the size given
+// with WithExpectedSize.
+var ErrSizeMismatch = errors.New("image size does not match the expected size")
+
+// ErrHashMismatch reports that a payload's SHA256 differs from the
+// expected hash.
+var ErrHashMismatch = errors.New("hash mismatch")
+
+// WithExpectedSize makes Download require an image of exactly bytes bytes
+// after decompression, as a source name's @s placeholder declares. An
+// uncompressed payload is checked before it is hashed: a declared
+// Content-Length that disagrees fails before any byte is written, and no
+// more than bytes+1 bytes are read. A compressed payload is checked as it is
+// decompressed. DownloadTar ignores it.
+func WithExpectedSize(bytes int64) Option {
+	return func(settings *retrySettings) {
+		settings.expectedSize = bytes
+	}
+}
+
+// WithFilename names the payload for compression detection when the URL
+// path does not end in the file's name, as with an OCI blob URL
+// (.../blobs/sha256:<digest>). Without it the suffix of the URL is used.
+func WithFilename(name string) Option {
+	return func(settings *retrySettings) {
+		settings.filename = name
+	}
+}
+
+// WithRaw stores the payload exactly as served, without decompressing it,
+// for callers that pass the verified bytes on rather than install them.
+// DownloadTar ignores it.
+func WithRaw() Option {
+	return func(settings *retrySettings) {
+		settings.raw = true
+	}
+}
+
+// WithMirrors adds URLs serving the same payload that Download tries, in
+// order, when the previous URL fails. Each URL gets the full retry policy
+// before Download moves on; whichever serves the bytes, they must match
+// expectedHash.
+func WithMirrors(urls ...string) Option {
+	return func(settings *retrySettings) {
+		settings.mirrors = append(settings.mirrors, urls...)
+	}
+}
+
+// WithFailoverNotify configures a callback called with a URL and its error
+// when Download gives up on it and moves to the next mirror.
+func WithFailoverNotify(fn func(url string, reason error)) Option {
+	return func(settings *retrySettings) {
+		settings.failover = fn
+	}
+}
+
+// WithServedNotify configures a callback called with the URL whose verified
+// bytes were installed.
+func WithServedNotify(fn func(url string)) Option {
+	return func(settings *retrySettings) {
+		settings.served = fn
+	}
+}
+
+// WithReceivedNotify configures a callback called after every attempt,
+// failed ones included, with the number of bytes it read from the source.
+func WithReceivedNotify(fn func(n int64)) Option {
+	return func(settings *retrySettings) {
+		settings.received = fn
+	}
+}
+
+// WithRateLimit reads the payload through l, so this download counts
+// against l's rate alongside every other download sharing it. A nil l, the
+// default, imposes no limit. file:// URLs are local reads and are never
+// limited.
+func WithRateLimit(l *Limiter) Option {
+	return func(settings *retrySettings) {
+		settings.limiter = l
+	}
+}
+
+// compressionOf returns the compression type of the payload at url, taking
+// the WithFilename name in preference to the URL itself.
+func (rs retrySettings) compressionOf(url string) string {
+	if rs.filename != "" {
+		return detectCompression(rs.filename)
+	}
+	return detectCompression(url)
+}
+
 // syncFile flushes a written file to stable storage. It is a package-level
 // seam so tests can observe which files are synced and inject sync failures.
 var syncFile = func(f *os.File) error { return f.Sync() }
@@ -101,6 +203,7 @@ func resolveRetry(opts ...Option) retrySettings {
 		cfg:                 retry.DefaultConfig,
 		maxDecompressedSize: DefaultMaxDecompressedSize,
 		maxDownloadSize:     DefaultMaxDownloadSize,
+		expectedSize:        -1,
 	}
 	for _, opt := range opts {
 		opt(&settings)
@@ -111,10 +214,15 @@ func resolveRetry(opts ...Option) retrySettings {
 // Download fetches a file from URL, verifies its hash, decompresses if needed,
 // and atomically writes it to the target path. On every path (direct,
 // decompressed, and cross-device copy) the file that ends up at targetPath is
-// fsynced before it is renamed into place. If httpClient is nil, a default
-// client with a 10-minute timeout is used. If onProgress is non-nil, it is
-// called with the content length after the HTTP response is received, and the
-// returned writer receives downloaded bytes for progress tracking.
+// fsynced before it is renamed into place. A file:// URL is read from the
+// local filesystem under the same hash and size checks. URLs added with
+// WithMirrors are tried in order when url fails. An interrupted
+// download is resumed from its partial file, across retries and across calls,
+// when the server validates it with a strong ETag. If httpClient is nil,
+// a default client with a 10-minute timeout is used. If onProgress is
+// non-nil, it is called with the content length after the HTTP response is
+// received, and the returned writer receives downloaded bytes for progress
+// tracking.
 func Download(ctx context.Context, httpClient *http.Client, url, targetPath, expectedHash string, mode uint32, onProgress ProgressFunc, opts ...Option) error {
 	// Create target directory if needed
 	targetDir := filepath.Dir(targetPath)
@@ -122,38 +230,143 @@ func Download(ctx context.Context, httpClient *http.Client, url, targetPath, exp
 		return fmt.Errorf("failed to create target directory: %w", err)
 	}
 
+	rs := resolveRetry(opts...)
+	tmpPath, url, err := fetchMirrored(ctx, httpClient, url, targetDir, expectedHash, onProgress, rs)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	// Determine if decompression is needed and get final path
+	finalPath := targetPath
+	decompressedPath := tmpPath + ".decompressed"
+
+	compressionType := rs.compressionOf(url)
+	if compressionType != "" && !rs.raw {
+		// Decompress to another temp file, stopping one byte past an
+		// expected size so an oversized image is never fully written.
+		limit, capped := rs.maxDecompressedSize, false
+		if rs.expectedSize >= 0 && rs.expectedSize < limit {
+			limit, capped = rs.expectedSize+1, true
+		}
+		if err := decompressFile(tmpPath, decompressedPath, compressionType, limit); err != nil {
+			_ = os.Remove(decompressedPath)
+			if capped && errors.Is(err, ErrDecompressedTooLarge) {
+				return fmt.Errorf("%w: more than %d bytes", ErrSizeMismatch, rs.expectedSize)
+			}
+			return fmt.Errorf("decompression failed: %w", err)
+		}
+		// Remove compressed temp and use decompressed
+		_ = os.Remove(tmpPath)
+		tmpPath = decompressedPath
+
+		if rs.expectedSize >= 0 {
+			info, err := os.Stat(tmpPath)
+			if err != nil {
+				return fmt.Errorf("failed to stat decompressed file: %w", err)
+			}
+			if info.Size() != rs.expectedSize {
+				return fmt.Errorf("%w: got %d bytes, want %d", ErrSizeMismatch, info.Size(), rs.expectedSize)
+			}
+		}
+	}
+
+	// Set file mode
+	if mode == 0 {
+		mode = 0644
+	}
+	if err := os.Chmod(tmpPath, os.FileMode(mode)); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+
+	// Atomic rename to final location
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		// Cross-device link? Try copy instead
+		if err := copyFile(tmpPath, finalPath, os.FileMode(mode)); err != nil {
+			return fmt.Errorf("failed to move file to target: %w", err)
+		}
+		_ = os.Remove(tmpPath)
+	}
+
+	return nil
+}
+
+// fetchMirrored runs fetchVerified against url and then each WithMirrors URL
+// until one yields verified bytes, and returns the temp path with the URL
+// that served it. With no mirrors the error is fetchVerified's own.
+func fetchMirrored(ctx context.Context, httpClient *http.Client, url, targetDir, expectedHash string, onProgress ProgressFunc, rs retrySettings) (string, string, error) {
+	urls := append([]string{url}, rs.mirrors...)
+	var errs []error
+	for i, u := range urls {
+		tmpPath, err := fetchVerified(ctx, httpClient, u, targetDir, expectedHash, onProgress, rs)
+		if err == nil {
+			if rs.served != nil {
+				rs.served(u)
+			}
+			return tmpPath, u, nil
+		}
+		if len(urls) == 1 || ctx.Err() != nil {
+			return "", "", err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", u, err))
+		if i+1 < len(urls) && rs.failover != nil {
+			rs.failover(u, err)
+		}
+	}
+	return "", "", fmt.Errorf("all %d mirrors failed: %w", len(urls), errors.Join(errs...))
+}
+
+// fetchVerified runs the bounded retry loop that streams url into a partial
+// file in targetDir while hashing it, and returns its path once the
+// compressed payload matches expectedHash and has been synced. The caller
+// owns (and must remove) the returned file. Partial bytes that a transient
+// failure leaves behind are resumed with a Range request validated by
+// If-Range, on this call's next attempt or a later call's first.
+func fetchVerified(ctx context.Context, httpClient *http.Client, url, targetDir, expectedHash string, onProgress ProgressFunc, rs retrySettings) (string, error) {
 	if httpClient == nil {
 		httpClient = &http.Client{
 			Timeout: 10 * time.Minute,
 		}
 	}
-	rs := resolveRetry(opts...)
+	httpClient = fileurl.ClientFor(httpClient, url)
 	if rs.maxDecompressedSize <= 0 {
-		return fmt.Errorf("maximum decompressed size must be greater than zero")
+		return "", fmt.Errorf("maximum decompressed size must be greater than zero")
 	}
 	if rs.maxDownloadSize <= 0 {
-		return fmt.Errorf("maximum download size must be greater than zero")
+		return "", fmt.Errorf("maximum download size must be greater than zero")
 	}
 
+	removeStalePartials(targetDir)
+
 	var tmpPath string
-	err := retry.Do(ctx, rs.cfg, rs.notify, func() error {
-		tmpFile, err := os.CreateTemp(targetDir, ".updex-download-*")
+	err := retry.Do(ctx, rs.cfg, rs.notify, func() (err error) {
+		partial, err := openPartial(targetDir, expectedHash)
 		if err != nil {
-			return fmt.Errorf("failed to create temp file: %w", err)
+			return err
 		}
-		attemptPath := tmpFile.Name()
-		keepTemp := false
+		done := false
 		defer func() {
-			_ = tmpFile.Close()
-			if !keepTemp {
-				_ = os.Remove(attemptPath)
+			// Keep resumable bytes for the next attempt (or the next run)
+			// when the failure is one a retry could get past, including
+			// cancellation by a shutting-down caller.
+			if !done {
+				partial.release(retry.IsTransient(err) || ctx.Err() != nil)
 			}
 		}()
 
+		offset, etag, err := partial.resumeOffset()
+		if err != nil {
+			return err
+		}
+
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 		if err != nil {
 			return fmt.Errorf("failed to create request: %w", err)
 		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", etag)
+		}
 
 		resp, err := httpClient.Do(req)
 		if err != nil {
@@ -161,30 +374,85 @@ func Download(ctx context.Context, httpClient *http.Client, url, targetPath, exp
 		}
 		defer func() { _ = resp.Body.Close() }()
 
-		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
 			return retry.Transient(fmt.Errorf("download failed with status: %s", resp.Status))
-		}
-		if resp.StatusCode != http.StatusOK {
+		case resp.StatusCode == http.StatusPartialContent && offset > 0:
+			// The validator still matched: append to the bytes on disk,
+			// provided the server resumed exactly where they end.
+			if start, ok := parseContentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+				_ = partial.restart("")
+				return retry.Transient(fmt.Errorf("download resumed at unexpected range %q", resp.Header.Get("Content-Range")))
+			}
+			if _, err := partial.Seek(offset, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek partial download: %w", err)
+			}
+		case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+			_ = partial.restart("")
+			return retry.Transient(fmt.Errorf("download failed with status: %s", resp.Status))
+		case resp.StatusCode == http.StatusOK:
+			// A full response: either no resume was asked for or the
+			// file changed since the partial was written.
+			offset = 0
+			if err := partial.restart(resp.Header.Get("ETag")); err != nil {
+				return err
+			}
+		default:
 			return fmt.Errorf("download failed with status: %s", resp.Status)
 		}
 
 		// Reject an over-limit payload before streaming when the server
 		// declares its size, so a hostile Content-Length never even starts a
 		// write.
-		if resp.ContentLength > rs.maxDownloadSize {
-			return fmt.Errorf("%w: Content-Length %d exceeds the limit of %d bytes", ErrDownloadTooLarge, resp.ContentLength, rs.maxDownloadSize)
+		if resp.ContentLength > rs.maxDownloadSize-offset {
+			return fmt.Errorf("%w: Content-Length %d exceeds the limit of %d bytes", ErrDownloadTooLarge, offset+resp.ContentLength, rs.maxDownloadSize)
+		}
+		// An uncompressed payload is the image itself, so its expected size
+		// is checked here, ahead of the hash.
+		checkSize := rs.expectedSize >= 0 && rs.compressionOf(url) == ""
+		sizeMismatch := func(got int64) error {
+			mismatch := fmt.Errorf("%w: got %d bytes, want %d", ErrSizeMismatch, got, rs.expectedSize)
+			if offset > 0 {
+				// As for a hash mismatch, the stored prefix may be at fault.
+				_ = partial.restart("")
+				return retry.Transient(mismatch)
+			}
+			return mismatch
+		}
+		if checkSize && resp.ContentLength >= 0 && offset+resp.ContentLength != rs.expectedSize {
+			return sizeMismatch(offset + resp.ContentLength)
 		}
 
-		// Compute hash while downloading
+		// The hash covers the whole payload, so a resumed attempt first
+		// re-reads the bytes already on disk.
 		hasher := sha256.New()
-		reader := io.TeeReader(resp.Body, hasher)
-
-		// Write to temp file with optional progress
-		var dst io.Writer = tmpFile
+		var progress io.Writer
 		if onProgress != nil {
-			if pw := onProgress(resp.ContentLength); pw != nil {
-				dst = io.MultiWriter(tmpFile, pw)
+			total := int64(-1)
+			if resp.ContentLength >= 0 {
+				total = offset + resp.ContentLength
+			}
+			progress = onProgress(total)
+		}
+		if offset > 0 {
+			var prefixDst io.Writer = hasher
+			if progress != nil {
+				prefixDst = io.MultiWriter(hasher, progress)
 			}
+			if _, err := io.Copy(prefixDst, io.NewSectionReader(partial, 0, offset)); err != nil {
+				return fmt.Errorf("failed to read partial download: %w", err)
+			}
+		}
+		var body io.Reader = resp.Body
+		if !fileurl.IsFileURL(url) {
+			body = rs.limiter.reader(ctx, body)
+		}
+		reader := io.TeeReader(body, hasher)
+
+		// Write to temp file with optional progress
+		var dst io.Writer = partial
+		if progress != nil {
+			dst = io.MultiWriter(partial, progress)
 		}
 		// Bound the bytes read from the (untrusted) server: read at most one
 		// byte past the ceiling, so an unbounded or under-declared response
@@ -192,75 +460,58 @@ func Download(ctx context.Context, httpClient *http.Client, url, targetPath, exp
 		// also covers the uncompressed path, where maxDecompressedSize never
 		// applies. ErrDownloadTooLarge is not transient, so the retry loop
 		// stops rather than re-streaming.
-		written, err := io.Copy(dst, io.LimitReader(reader, rs.maxDownloadSize+1))
+		limit := rs.maxDownloadSize
+		if checkSize && rs.expectedSize < limit {
+			limit = rs.expectedSize
+		}
+		written, err := io.Copy(dst, io.LimitReader(reader, limit-offset+1))
+		if rs.received != nil {
+			rs.received(written)
+		}
 		if err != nil {
 			return retry.TransientIfNetwork(fmt.Errorf("failed to write file: %w", err))
 		}
-		if written > rs.maxDownloadSize {
+		if offset+written > rs.maxDownloadSize {
 			return fmt.Errorf("%w of %d bytes", ErrDownloadTooLarge, rs.maxDownloadSize)
 		}
+		if checkSize && offset+written != rs.expectedSize {
+			return sizeMismatch(offset + written)
+		}
 
 		// Verify hash of compressed file
 		actualHash := fmt.Sprintf("%x", hasher.Sum(nil))
 		if actualHash != strings.ToLower(expectedHash) {
-			return fmt.Errorf("hash mismatch: expected %s, got %s", expectedHash, actualHash)
+			mismatch := fmt.Errorf("%w: expected %s, got %s", ErrHashMismatch, expectedHash, actualHash)
+			if offset > 0 {
+				// The stored prefix may be what is wrong; a whole fresh
+				// download is a genuine retry, unlike the same bytes again.
+				_ = partial.restart("")
+				return retry.Transient(mismatch)
+			}
+			return mismatch
 		}
 
 		// Persist the verified bytes before the temp file is closed and
 		// renamed, so a crash after install cannot leave an empty or
 		// partial image behind the sysext link.
-		if err := syncFile(tmpFile); err != nil {
+		if err := syncFile(partial.File); err != nil {
 			return fmt.Errorf("failed to sync temp file: %w", err)
 		}
 
 		// Close temp file before decompression
-		if err := tmpFile.Close(); err != nil {
+		if err := partial.Close(); err != nil {
 			return fmt.Errorf("failed to close temp file: %w", err)
 		}
+		_ = os.Remove(partial.Name() + etagSuffix)
 
-		tmpPath = attemptPath
-		keepTemp = true
+		tmpPath = partial.Name()
+		done = true
 		return nil
 	})
 	if err != nil {
-		return err
-	}
-	defer func() { _ = os.Remove(tmpPath) }()
-
-	// Determine if decompression is needed and get final path
-	finalPath := targetPath
-	decompressedPath := tmpPath + ".decompressed"
-
-	compressionType := detectCompression(url)
-	if compressionType != "" {
-		// Decompress to another temp file
-		if err := decompressFile(tmpPath, decompressedPath, compressionType, rs.maxDecompressedSize); err != nil {
-			_ = os.Remove(decompressedPath)
-			return fmt.Errorf("decompression failed: %w", err)
-		}
-		// Remove compressed temp and use decompressed
-		_ = os.Remove(tmpPath)
-		tmpPath = decompressedPath
-	}
-
-	// Set file mode
-	if mode == 0 {
-		mode = 0644
-	}
-	if err := os.Chmod(tmpPath, os.FileMode(mode)); err != nil {
-		return fmt.Errorf("failed to set file mode: %w", err)
-	}
-
-	// Atomic rename to final location
-	if err := os.Rename(tmpPath, finalPath); err != nil {
-		// Cross-device link? Try copy instead
-		if err := copyFile(tmpPath, finalPath, os.FileMode(mode)); err != nil {
-			return fmt.Errorf("failed to move file to target: %w", err)
-		}
-		_ = os.Remove(tmpPath)
+		return "", err
 	}
-
-	return nil
+	return tmpPath, nil
 }
 
 // detectCompression determines compression type from filename
@@ -603,3 +603,226 @@ func TestDownloadWithinLimitSucceeds(t *testing.T) {
 		t.Fatalf("content = %q, want %q", got, content)
 	}
 }
+
+// TestDownloadFromFileURL covers the local-source path: a file:// URL is read
+// from disk but still hash-verified, size-capped, and decompressed.
+func TestDownloadFromFileURL(t *testing.T) {
+	content := bytes.Repeat([]byte("local image "), 1024)
+	compressed := gzipBytes(t, content)
+	mirror := t.TempDir()
+	if err := os.WriteFile(filepath.Join(mirror, "feature.raw.gz"), compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sourceURL := "file://" + filepath.Join(mirror, "feature.raw.gz")
+
+	t.Run("verifies and decompresses", func(t *testing.T) {
+		targetPath := filepath.Join(t.TempDir(), "feature.raw")
+		var received int64
+		if err := Download(t.Context(), nil, sourceURL, targetPath, hashString(compressed), 0644, nil,
+			WithReceivedNotify(func(n int64) { received += n })); err != nil {
+			t.Fatalf("Download() error = %v", err)
+		}
+		if received != int64(len(compressed)) {
+			t.Errorf("received %d bytes, want the %d compressed bytes", received, len(compressed))
+		}
+		got, err := os.ReadFile(targetPath)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Error("downloaded content differs from decompressed fixture")
+		}
+	})
+
+	t.Run("rejects a hash mismatch", func(t *testing.T) {
+		targetPath := filepath.Join(t.TempDir(), "feature.raw")
+		err := Download(t.Context(), nil, sourceURL, targetPath, hashString([]byte("other")), 0644, nil)
+		if !errors.Is(err, ErrHashMismatch) || !strings.Contains(err.Error(), "hash mismatch: expected") {
+			t.Fatalf("Download() error = %v, want hash mismatch", err)
+		}
+		if _, err := os.Stat(targetPath); !os.IsNotExist(err) {
+			t.Errorf("Stat(target) error = %v, want not-exist", err)
+		}
+	})
+
+	t.Run("enforces the download size cap", func(t *testing.T) {
+		targetPath := filepath.Join(t.TempDir(), "feature.raw")
+		err := Download(t.Context(), nil, sourceURL, targetPath, hashString(compressed), 0644, nil, WithMaxDownloadSize(int64(len(compressed)-1)))
+		if !errors.Is(err, ErrDownloadTooLarge) {
+			t.Fatalf("Download() error = %v, want ErrDownloadTooLarge", err)
+		}
+	})
+
+	t.Run("missing file is not retried", func(t *testing.T) {
+		targetPath := filepath.Join(t.TempDir(), "feature.raw")
+		var retries int
+		err := Download(t.Context(), nil, "file://"+filepath.Join(mirror, "absent.raw"), targetPath, hashString(content), 0644, nil,
+			WithRetryConfig(3, time.Millisecond),
+			WithRetryNotify(func(int, int, error) { retries++ }))
+		if err == nil {
+			t.Fatal("Download() error = nil, want not-found error")
+		}
+		if retries != 0 {
+			t.Errorf("retries = %d, want 0 for a missing local file", retries)
+		}
+	})
+}
+
+// TestDownloadWithFilenameSelectsCompression covers OCI blob URLs, whose path
+// ends in a digest: WithFilename supplies the name compression is detected
+// from.
+func TestDownloadWithFilenameSelectsCompression(t *testing.T) {
+	content := []byte("blob payload")
+	compressed := gzipBytes(t, content)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(compressed)
+	}))
+	defer server.Close()
+
+	blobURL := server.URL + "/v2/ext/blobs/sha256:" + hashString(compressed)
+	targetPath := filepath.Join(t.TempDir(), "ext.raw")
+	if err := Download(t.Context(), server.Client(), blobURL, targetPath, hashString(compressed), 0644, nil, WithFilename("ext_1.0.raw.gz")); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	got, err := os.ReadFile(targetPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("content = %q, want decompressed %q", got, content)
+	}
+}
+
+func TestDownloadWithRawKeepsCompressedBytes(t *testing.T) {
+	compressed := gzipBytes(t, []byte("image payload"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(compressed)
+	}))
+	defer server.Close()
+
+	targetPath := filepath.Join(t.TempDir(), "ext_1.0.raw.gz")
+	if err := Download(t.Context(), server.Client(), server.URL+"/ext_1.0.raw.gz", targetPath, hashString(compressed), 0644, nil, WithRaw()); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	got, err := os.ReadFile(targetPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !bytes.Equal(got, compressed) {
+		t.Error("WithRaw() must store the payload as served, matching its SHA256SUMS hash")
+	}
+}
+
+// TestDownloadWithExpectedSize pins the @s check: the installed image must
+// have exactly the expected size, and an uncompressed payload of the wrong
+// size fails as a size mismatch before its hash is compared.
+func TestDownloadWithExpectedSize(t *testing.T) {
+	content := []byte("image payload")
+	compressed := gzipBytes(t, content)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".gz") {
+			_, _ = w.Write(compressed)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		file     string
+		hash     string
+		size     int64
+		wantErr  bool
+		wantHash bool // the hash mismatch is reported, not the size
+	}{
+		{name: "uncompressed match", file: "ext.raw", hash: hashString(content), size: int64(len(content))},
+		{name: "uncompressed mismatch", file: "ext.raw", hash: hashString([]byte("other")), size: 4, wantErr: true},
+		{name: "compressed match", file: "ext.raw.gz", hash: hashString(compressed), size: int64(len(content))},
+		{name: "compressed too small", file: "ext.raw.gz", hash: hashString(compressed), size: 4, wantErr: true},
+		{name: "compressed too large", file: "ext.raw.gz", hash: hashString(compressed), size: 1 << 20, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targetPath := filepath.Join(t.TempDir(), "ext.raw")
+			err := Download(t.Context(), server.Client(), server.URL+"/"+tt.file, targetPath, tt.hash, 0644, nil,
+				WithRetryConfig(1, time.Millisecond), WithExpectedSize(tt.size))
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Download() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrSizeMismatch) {
+				t.Fatalf("Download() error = %v, want ErrSizeMismatch", err)
+			}
+			if _, statErr := os.Stat(targetPath); !os.IsNotExist(statErr) {
+				t.Errorf("target exists after a size mismatch: %v", statErr)
+			}
+		})
+	}
+}
+
+// TestDownloadFailsOverToMirror pins mirror failover: a URL that fails for
+// good (here a 404, then a mirror serving the wrong bytes) is abandoned for
+// the next, the failover is reported, and the URL that served the verified
+// payload is reported too.
+func TestDownloadFailsOverToMirror(t *testing.T) {
+	content := []byte("mirrored image")
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	tampered := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("tampered image"))
+	}))
+	defer tampered.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	defer good.Close()
+
+	var failed []string
+	var served string
+	targetPath := filepath.Join(t.TempDir(), "feature.raw")
+	err := Download(t.Context(), good.Client(), missing.URL+"/feature.raw", targetPath, hashString(content), 0644, nil,
+		WithRetryConfig(1, time.Millisecond),
+		WithMirrors(tampered.URL+"/feature.raw", good.URL+"/feature.raw"),
+		WithFailoverNotify(func(url string, _ error) { failed = append(failed, url) }),
+		WithServedNotify(func(url string) { served = url }),
+	)
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	got, err := os.ReadFile(targetPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("target content = %q, want %q", got, content)
+	}
+	if want := []string{missing.URL + "/feature.raw", tampered.URL + "/feature.raw"}; fmt.Sprint(failed) != fmt.Sprint(want) {
+		t.Errorf("failover notifications = %q, want %q", failed, want)
+	}
+	if served != good.URL+"/feature.raw" {
+		t.Errorf("served URL = %q, want %q", served, good.URL+"/feature.raw")
+	}
+}
+
+func TestDownloadAllMirrorsFail(t *testing.T) {
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	targetPath := filepath.Join(t.TempDir(), "feature.raw")
+	err := Download(t.Context(), missing.Client(), missing.URL+"/a.raw", targetPath, hashString([]byte("x")), 0644, nil,
+		WithRetryConfig(1, time.Millisecond), WithMirrors(missing.URL+"/b.raw"))
+	if err == nil {
+		t.Fatal("Download() error = nil, want error")
+	}
+	for _, want := range []string{"all 2 mirrors failed", "/a.raw: download failed with status: 404", "/b.raw: download failed with status: 404"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Download() error = %q, want it to contain %q", err, want)
+		}
+	}
+	if _, statErr := os.Stat(targetPath); !os.IsNotExist(statErr) {
+		t.Errorf("Stat(target) error = %v, want not-exist", statErr)
+	}
+}
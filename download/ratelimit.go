@@ -0,0 +1,102 @@
+package download
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// maxLimitedRead bounds a single read through a Limiter, so a slow rate is
+// spent in small steps rather than one long sleep per buffer.
+const maxLimitedRead = 32 << 10
+
+// Limiter caps the rate at which downloads read from the network. One Limiter
+// may be shared by any number of concurrent downloads, and by every retry and
+// mirror attempt of each: together they stay under its rate. A nil *Limiter
+// imposes no limit.
+type Limiter struct {
+	rate float64 // bytes per second
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter allowing bytesPerSecond bytes per second, or
+// nil (no limit) when bytesPerSecond is not positive. It allows a burst of at
+// most one second's worth of bytes after a pause.
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &Limiter{rate: float64(bytesPerSecond), last: time.Now()}
+}
+
+// Rate returns the limit in bytes per second, or zero for a nil Limiter.
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	return int64(l.rate)
+}
+
+// wait accounts for n bytes already read and sleeps for as long as that puts
+// the limiter over its rate. Bytes are charged before the sleep, so
+// concurrent readers queue behind one another instead of all waking at once.
+func (l *Limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reader returns r read through l, or r itself when l is nil.
+func (l *Limiter) reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	chunk := maxLimitedRead
+	if rate := int(l.rate); rate < chunk {
+		chunk = max(rate, 1)
+	}
+	return &limitedReader{ctx: ctx, r: r, l: l, chunk: chunk}
+}
+
+type limitedReader struct {
+	ctx   context.Context
+	r     io.Reader
+	l     *Limiter
+	chunk int
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > lr.chunk {
+		p = p[:lr.chunk]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if werr := lr.l.wait(lr.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,92 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDownloadRateLimitSharedAcrossDownloads pins that one Limiter bounds
+// the combined rate of concurrent downloads, including the bytes of an
+// attempt that was cut short and retried.
+func TestDownloadRateLimitSharedAcrossDownloads(t *testing.T) {
+	const rate = 200 << 10
+	content := bytes.Repeat([]byte("x"), 40<<10)
+	retried := newRangeServer(t, content, `"v1"`, 1)
+	plain := newRangeServer(t, content, "")
+
+	limiter := NewLimiter(rate)
+	// Separate directories, so the downloads of the same bytes do not race
+	// for one partial file and the retried one always resumes.
+	dirs := []string{t.TempDir(), t.TempDir()}
+	start := time.Now()
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, server := range []*rangeServer{retried, plain} {
+		wg.Go(func() {
+			errs[i] = Download(t.Context(), server.Client(), server.URL+"/feature.raw", filepath.Join(dirs[i], "feature.raw"), hashString(content), 0644, nil,
+				WithRetryConfig(2, time.Millisecond), WithRateLimit(limiter))
+		})
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Download() #%d error = %v", i, err)
+		}
+	}
+
+	// The retry resumes the truncated attempt (see resume.go), so 80 KiB
+	// pass the limiter: the plain payload, the cut-short first half and
+	// the resumed second half. The limiter starts empty, so at 200 KiB/s
+	// that takes 400ms; allow for timer slack.
+	if got := retried.requests(); len(got) != 2 || got[1] != fmt.Sprintf("bytes=%d-", len(content)/2) {
+		t.Fatalf("retried server saw Range headers %q, want the second request resuming at %d", got, len(content)/2)
+	}
+	if want := 350 * time.Millisecond; elapsed < want {
+		t.Errorf("downloads took %v, want at least %v under a shared %d B/s limit", elapsed, want, rate)
+	}
+}
+
+func TestDownloadRateLimitSkipsFileURL(t *testing.T) {
+	content := bytes.Repeat([]byte("y"), 64<<10)
+	src := filepath.Join(t.TempDir(), "feature.raw")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	start := time.Now()
+	err := Download(t.Context(), nil, "file://"+src, filepath.Join(t.TempDir(), "feature.raw"), hashString(content), 0644, nil, WithRateLimit(NewLimiter(1<<10)))
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("local read took %v; file:// sources must not be rate limited", elapsed)
+	}
+}
+
+func TestLimiterWaitHonoursContext(t *testing.T) {
+	if NewLimiter(0) != nil || NewLimiter(-1) != nil {
+		t.Fatal("NewLimiter() must return nil (no limit) for a non-positive rate")
+	}
+	if got := (*Limiter)(nil).Rate(); got != 0 {
+		t.Errorf("nil Limiter Rate() = %d, want 0", got)
+	}
+
+	l := NewLimiter(1)
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := l.wait(ctx, 1<<20); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait() error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("wait() returned after %v, want promptly on cancellation", elapsed)
+	}
+}
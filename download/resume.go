@@ -0,0 +1,193 @@
+package download
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// partialPrefix names every staging file fetchVerified writes. A resumable
+// partial is partialPrefix followed by the expected SHA256, so a retry or a
+// later process expecting the same bytes finds it again.
+const partialPrefix = ".updex-download-"
+
+// etagSuffix names the sidecar holding the ETag a partial's bytes were
+// served under; without one a partial cannot be resumed.
+const etagSuffix = ".etag"
+
+// sha256HexLen is the length of a hex-encoded SHA256.
+const sha256HexLen = 64
+
+// partialMaxAge is how long an abandoned partial (for a version no longer
+// being fetched) is kept in the staging directory before the next download
+// there removes it.
+const partialMaxAge = 7 * 24 * time.Hour
+
+// partialFile is the file one download attempt streams into. A resumable
+// partial has a stable, hash-derived name and is locked for the attempt so
+// two concurrent downloads of the same image never interleave writes; a
+// non-resumable one is an ordinary temp file.
+type partialFile struct {
+	*os.File
+	resumable bool
+}
+
+// openPartial opens the staging file for a download of expectedHash into
+// targetDir. When the hash is a well-formed SHA256 and no other download holds
+// the same partial, it opens (or creates) the stable partial; otherwise it
+// falls back to a fresh temp file that is never resumed.
+func openPartial(targetDir, expectedHash string) (*partialFile, error) {
+	if name, ok := partialName(expectedHash); ok {
+		f, err := os.OpenFile(filepath.Join(targetDir, name), os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open partial download: %w", err)
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == nil {
+			return &partialFile{File: f, resumable: true}, nil
+		}
+		_ = f.Close()
+	}
+	f, err := os.CreateTemp(targetDir, partialPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	return &partialFile{File: f}, nil
+}
+
+// partialName returns the stable partial file name for expectedHash, or false
+// when the hash is not 64 hex digits and so cannot name a file safely.
+func partialName(expectedHash string) (string, bool) {
+	if len(expectedHash) != sha256HexLen {
+		return "", false
+	}
+	if _, err := hex.DecodeString(expectedHash); err != nil {
+		return "", false
+	}
+	return partialPrefix + strings.ToLower(expectedHash), true
+}
+
+// resumeOffset returns the number of bytes already on disk that may be
+// resumed, and the ETag they were served under. A partial without a strong
+// ETag, or any non-resumable file, is truncated and reports zero.
+func (p *partialFile) resumeOffset() (int64, string, error) {
+	if p.resumable {
+		info, err := p.Stat()
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to stat partial download: %w", err)
+		}
+		etag, _ := os.ReadFile(p.Name() + etagSuffix)
+		if info.Size() > 0 && isStrongETag(string(etag)) {
+			return info.Size(), string(etag), nil
+		}
+	}
+	if err := p.restart(""); err != nil {
+		return 0, "", err
+	}
+	return 0, "", nil
+}
+
+// restart empties the partial and records etag (or none) as the validator of
+// the bytes about to be written.
+func (p *partialFile) restart(etag string) error {
+	if err := p.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate partial download: %w", err)
+	}
+	if _, err := p.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind partial download: %w", err)
+	}
+	if !p.resumable {
+		return nil
+	}
+	if !isStrongETag(etag) {
+		if err := os.Remove(p.Name() + etagSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove partial download validator: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(p.Name()+etagSuffix, []byte(etag), 0600); err != nil {
+		return fmt.Errorf("failed to record partial download validator: %w", err)
+	}
+	return nil
+}
+
+// release closes the partial, keeping it on disk for a later attempt only
+// when keep is set and it holds resumable bytes; otherwise the file and its
+// sidecar are removed.
+func (p *partialFile) release(keep bool) {
+	path := p.Name()
+	if keep && p.resumable {
+		if info, err := p.Stat(); err == nil && info.Size() > 0 {
+			if _, err := os.Stat(path + etagSuffix); err == nil {
+				_ = p.Close()
+				return
+			}
+		}
+	}
+	p.discard()
+}
+
+// discard closes and removes the partial and its sidecar.
+func (p *partialFile) discard() {
+	path := p.Name()
+	_ = p.Close()
+	_ = os.Remove(path)
+	_ = os.Remove(path + etagSuffix)
+}
+
+// isStrongETag reports whether etag can validate an If-Range request; weak
+// validators (W/"...") cannot (RFC 9110 section 13.1.5).
+func isStrongETag(etag string) bool {
+	return len(etag) >= 2 && strings.HasPrefix(etag, `"`) && strings.HasSuffix(etag, `"`)
+}
+
+// parseContentRangeStart returns the first byte position of a
+// "bytes <first>-<last>/<length>" Content-Range header.
+func parseContentRangeStart(header string) (int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// removeStalePartials deletes resumable partials in dir, and their sidecars,
+// that have not been written for partialMaxAge, so a download abandoned for a
+// version that is never fetched again does not hold disk space forever.
+func removeStalePartials(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-partialMaxAge)
+	for _, entry := range entries {
+		hash, ok := strings.CutPrefix(entry.Name(), partialPrefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if _, ok := partialName(hash); !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		_ = os.Remove(path)
+		_ = os.Remove(path + etagSuffix)
+	}
+}
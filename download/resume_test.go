@@ -0,0 +1,266 @@
+package download
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rangeServer serves content with etag through http.ServeContent, which
+// honours Range and If-Range. Requests listed in truncate (1-based) send half
+// of what they owe under a full Content-Length and then drop the connection.
+// It records every request's Range header.
+type rangeServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	ranges []string
+}
+
+func newRangeServer(t *testing.T, content []byte, etag string, truncate ...int) *rangeServer {
+	t.Helper()
+	rs := &rangeServer{}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.mu.Lock()
+		rs.ranges = append(rs.ranges, r.Header.Get("Range"))
+		n := len(rs.ranges)
+		rs.mu.Unlock()
+
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		for _, cut := range truncate {
+			if n != cut {
+				continue
+			}
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			_, _ = w.Write(content[:len(content)/2])
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func (rs *rangeServer) requests() []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return append([]string(nil), rs.ranges...)
+}
+
+// seedPartial writes prefix and its ETag sidecar as an earlier, interrupted
+// run would have left them.
+func seedPartial(t *testing.T, dir, hash string, prefix []byte, etag string) string {
+	t.Helper()
+	path := filepath.Join(dir, partialPrefix+hash)
+	if err := os.WriteFile(path, prefix, 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(path+etagSuffix, []byte(etag), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestDownloadResumesAfterTruncatedBody(t *testing.T) {
+	content := bytes.Repeat([]byte("resumable image "), 64)
+	server := newRangeServer(t, content, `"v1"`, 1)
+
+	targetDir := t.TempDir()
+	targetPath := filepath.Join(targetDir, "feature.raw")
+	var progressed int64
+	onProgress := func(total int64) io.Writer {
+		progressed = 0
+		return writerFunc(func(p []byte) { progressed += int64(len(p)) })
+	}
+	if err := Download(t.Context(), server.Client(), server.URL+"/feature.raw", targetPath, hashString(content), 0644, onProgress, WithRetryConfig(3, time.Millisecond)); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	got, err := os.ReadFile(targetPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("target content differs from the served content")
+	}
+	want := []string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}
+	if got := server.requests(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Range headers = %q, want %q", got, want)
+	}
+	if progressed != int64(len(content)) {
+		t.Errorf("progress of resumed attempt = %d bytes, want the full %d", progressed, len(content))
+	}
+	entries, err := os.ReadDir(targetDir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("target directory entries = %v, want only the target", entries)
+	}
+}
+
+// TestDownloadResumesPartialFromEarlierRun covers a partial left by a process
+// that exited mid-download: a matching ETag resumes it, a changed one (the
+// file was republished) or a weak one restarts from byte zero, and a stored
+// prefix that fails the whole-file hash is discarded and fetched afresh.
+func TestDownloadResumesPartialFromEarlierRun(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	tests := []struct {
+		name       string
+		prefix     []byte
+		storedETag string
+		serverETag string
+		want       []string
+	}{
+		{
+			name:       "matching etag",
+			prefix:     content[:300],
+			storedETag: `"v1"`,
+			serverETag: `"v1"`,
+			want:       []string{"bytes=300-"},
+		},
+		{
+			name:       "changed etag",
+			prefix:     content[:300],
+			storedETag: `"v0"`,
+			serverETag: `"v1"`,
+			want:       []string{"bytes=300-"},
+		},
+		{
+			name:       "weak etag",
+			prefix:     content[:300],
+			storedETag: `W/"v1"`,
+			serverETag: `W/"v1"`,
+			want:       []string{""},
+		},
+		{
+			name:       "corrupt prefix",
+			prefix:     bytes.Repeat([]byte("x"), 300),
+			storedETag: `"v1"`,
+			serverETag: `"v1"`,
+			want:       []string{"bytes=300-", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRangeServer(t, content, tt.serverETag)
+			targetDir := t.TempDir()
+			targetPath := filepath.Join(targetDir, "feature.raw")
+			seedPartial(t, targetDir, hashString(content), tt.prefix, tt.storedETag)
+
+			if err := Download(t.Context(), server.Client(), server.URL+"/feature.raw", targetPath, hashString(content), 0644, nil, WithRetryConfig(3, time.Millisecond)); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			got, err := os.ReadFile(targetPath)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Fatal("target content differs from the served content")
+			}
+			if got := server.requests(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Range headers = %q, want %q", got, tt.want)
+			}
+			matches, _ := filepath.Glob(filepath.Join(targetDir, partialPrefix+"*"))
+			if len(matches) != 0 {
+				t.Errorf("staging files remain after success: %v", matches)
+			}
+		})
+	}
+}
+
+// TestDownloadKeepsPartialOnlyForTransientFailure pins what survives a failed
+// run: resumable bytes after retries are exhausted on a transient error, and
+// nothing after a permanent one.
+func TestDownloadKeepsPartialOnlyForTransientFailure(t *testing.T) {
+	content := bytes.Repeat([]byte("abcdefgh"), 64)
+
+	t.Run("transient", func(t *testing.T) {
+		server := newRangeServer(t, content, `"v1"`, 1)
+		targetDir := t.TempDir()
+		err := Download(t.Context(), server.Client(), server.URL+"/feature.raw", filepath.Join(targetDir, "feature.raw"), hashString(content), 0644, nil, WithRetryConfig(1, time.Millisecond))
+		if err == nil {
+			t.Fatal("Download() error = nil, want truncated body error")
+		}
+		partial := filepath.Join(targetDir, partialPrefix+hashString(content))
+		info, err := os.Stat(partial)
+		if err != nil {
+			t.Fatalf("partial download was not kept: %v", err)
+		}
+		if info.Size() != int64(len(content)/2) {
+			t.Errorf("partial size = %d, want %d", info.Size(), len(content)/2)
+		}
+		if etag, _ := os.ReadFile(partial + etagSuffix); string(etag) != `"v1"` {
+			t.Errorf("recorded ETag = %q, want %q", etag, `"v1"`)
+		}
+	})
+
+	t.Run("permanent", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			http.NotFound(w, r)
+		}))
+		defer server.Close()
+		targetDir := t.TempDir()
+		seedPartial(t, targetDir, hashString(content), content[:10], `"v1"`)
+
+		if err := Download(t.Context(), server.Client(), server.URL+"/feature.raw", filepath.Join(targetDir, "feature.raw"), hashString(content), 0644, nil); err == nil {
+			t.Fatal("Download() error = nil, want not-found error")
+		}
+		entries, err := os.ReadDir(targetDir)
+		if err != nil {
+			t.Fatalf("ReadDir() error = %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("target directory entries = %v, want none", entries)
+		}
+	})
+}
+
+func TestRemoveStalePartials(t *testing.T) {
+	dir := t.TempDir()
+	hash := strings.Repeat("a", sha256HexLen)
+	stale := seedPartial(t, dir, hash, []byte("old"), `"v1"`)
+	fresh := seedPartial(t, dir, strings.Repeat("b", sha256HexLen), []byte("new"), `"v1"`)
+	other := filepath.Join(dir, partialPrefix+"notahash")
+	if err := os.WriteFile(other, nil, 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	old := time.Now().Add(-partialMaxAge - time.Hour)
+	for _, path := range []string{stale, other} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Chtimes() error = %v", err)
+		}
+	}
+
+	removeStalePartials(dir)
+
+	for path, wantExists := range map[string]bool{
+		stale:              false,
+		stale + etagSuffix: false,
+		fresh:              true,
+		fresh + etagSuffix: true,
+		other:              true,
+	} {
+		_, err := os.Stat(path)
+		if exists := err == nil; exists != wantExists {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(path), exists, wantExists)
+		}
+	}
+}
+
+type writerFunc func(p []byte)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	f(p)
+	return len(p), nil
+}
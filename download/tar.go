@@ -0,0 +1,325 @@
+package download
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrUnsafeTarEntry reports a tar member that would escape the extraction
+// root or write through a symlink created by an earlier member.
+var ErrUnsafeTarEntry = errors.New("unsafe tar entry")
+
+// DownloadTar fetches a (optionally gz/xz/zstd-compressed) tarball from URL,
+// verifies the hash of the payload exactly as Download does, and extracts it
+// into a fresh directory at targetPath. The archive is unpacked into a
+// temporary sibling directory first and renamed into place only after every
+// member has been written and synced, so a failed or interrupted extraction
+// never leaves a partial directory instance behind a sysext link. An existing
+// directory at targetPath is replaced.
+//
+// Members are confined to the extraction root: absolute names and ".."
+// components are re-rooted, and a member whose parent path runs through a
+// symlink is rejected with ErrUnsafeTarEntry. Regular files, directories,
+// symlinks, and hard links are supported; device nodes and FIFOs are
+// rejected. The total size of extracted regular files is bounded by the
+// WithMaxDecompressedSize ceiling.
+func DownloadTar(ctx context.Context, httpClient *http.Client, url, targetPath, expectedHash string, onProgress ProgressFunc, opts ...Option) error {
+	targetDir := filepath.Dir(targetPath)
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	rs := resolveRetry(opts...)
+	tmpPath, url, err := fetchMirrored(ctx, httpClient, url, targetDir, expectedHash, onProgress, rs)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	extractDir, err := os.MkdirTemp(targetDir, ".updex-extract-*")
+	if err != nil {
+		return fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+	keep := false
+	defer func() {
+		if !keep {
+			_ = os.RemoveAll(extractDir)
+		}
+	}()
+	if err := os.Chmod(extractDir, 0755); err != nil {
+		return fmt.Errorf("failed to set directory mode: %w", err)
+	}
+
+	if err := extractTarFile(tmpPath, extractDir, rs.compressionOf(url), rs.maxDecompressedSize); err != nil {
+		return fmt.Errorf("extraction failed: %w", err)
+	}
+
+	if err := replaceDir(extractDir, targetPath); err != nil {
+		return fmt.Errorf("failed to move directory to target: %w", err)
+	}
+	keep = true
+	return nil
+}
+
+// replaceDir renames src over dst. rename(2) refuses to replace a non-empty
+// directory, so an existing dst is first moved aside and removed only after
+// the new tree is in place.
+func replaceDir(src, dst string) error {
+	info, err := os.Lstat(dst)
+	switch {
+	case os.IsNotExist(err):
+		return os.Rename(src, dst)
+	case err != nil:
+		return err
+	case !info.IsDir():
+		return fmt.Errorf("%s exists and is not a directory", dst)
+	}
+
+	// The hidden name keeps the old tree from matching the transfer's
+	// MatchPattern while it is being removed.
+	old := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".updex-old-%s-%d", filepath.Base(dst), time.Now().UnixNano()))
+	if err := os.Rename(dst, old); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		_ = os.Rename(old, dst)
+		return err
+	}
+	_ = os.RemoveAll(old)
+	return nil
+}
+
+// extractTarFile unpacks the archive at srcPath into root, decompressing it
+// with compressionType ("" for a plain tar).
+func extractTarFile(srcPath, root, compressionType string, maxBytes int64) error {
+	if maxBytes <= 0 {
+		return fmt.Errorf("maximum decompressed size must be greater than zero")
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	reader, err := DecompressReader(src, compressionType)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	return extractTar(reader, root, maxBytes)
+}
+
+// dirTimes records a directory's mtime so it can be applied after its
+// children are written (writing a child would otherwise bump it again).
+type dirTimes struct {
+	path  string
+	mtime time.Time
+}
+
+// extractTar writes every member of the tar stream r below root.
+func extractTar(r io.Reader, root string, maxBytes int64) error {
+	tr := tar.NewReader(r)
+	var written int64
+	var dirs []dirTimes
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		rel, ok := tarMemberPath(hdr.Name)
+		if !ok {
+			continue // the archive root itself ("./")
+		}
+		path := filepath.Join(root, rel)
+		if err := checkNoSymlinkParents(root, rel); err != nil {
+			return err
+		}
+
+		mode := os.FileMode(hdr.Mode).Perm() | tarSpecialBits(hdr.Mode)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			info, err := os.Lstat(path)
+			switch {
+			case os.IsNotExist(err):
+				if err := os.Mkdir(path, mode); err != nil {
+					return fmt.Errorf("failed to create directory %s: %w", rel, err)
+				}
+			case err != nil:
+				return fmt.Errorf("failed to inspect %s: %w", rel, err)
+			case !info.IsDir():
+				return fmt.Errorf("%w: %s replaces a non-directory", ErrUnsafeTarEntry, rel)
+			}
+			if err := os.Chmod(path, mode); err != nil {
+				return fmt.Errorf("failed to set mode on %s: %w", rel, err)
+			}
+			dirs = append(dirs, dirTimes{path: path, mtime: hdr.ModTime})
+
+		case tar.TypeReg:
+			if err := removeNonDir(path, rel); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", rel, err)
+			}
+			n, err := io.Copy(f, io.LimitReader(tr, maxBytes-written+1))
+			written += n
+			if err == nil && written > maxBytes {
+				err = fmt.Errorf("%w (%d bytes)", ErrDecompressedTooLarge, maxBytes)
+			}
+			if err == nil {
+				err = syncFile(f)
+			}
+			if closeErr := f.Close(); err == nil && closeErr != nil {
+				err = closeErr
+			}
+			if err != nil {
+				if errors.Is(err, ErrDecompressedTooLarge) {
+					return err
+				}
+				return fmt.Errorf("failed to write %s: %w", rel, err)
+			}
+			// Chmod after writing: the umask applied at create time would
+			// otherwise drop bits the archive asked for.
+			if err := os.Chmod(path, mode); err != nil {
+				return fmt.Errorf("failed to set mode on %s: %w", rel, err)
+			}
+			_ = os.Chtimes(path, hdr.ModTime, hdr.ModTime)
+
+		case tar.TypeSymlink:
+			if err := removeNonDir(path, rel); err != nil {
+				return err
+			}
+			// The link target is stored verbatim: sysext trees routinely
+			// carry absolute links that resolve inside the merged /usr at
+			// runtime. Extraction never follows it (see
+			// checkNoSymlinkParents).
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", rel, err)
+			}
+
+		case tar.TypeLink:
+			linkRel, ok := tarMemberPath(hdr.Linkname)
+			if !ok {
+				return fmt.Errorf("%w: hard link %s has no target", ErrUnsafeTarEntry, rel)
+			}
+			if err := checkNoSymlinkParents(root, linkRel); err != nil {
+				return err
+			}
+			if err := removeNonDir(path, rel); err != nil {
+				return err
+			}
+			if err := os.Link(filepath.Join(root, linkRel), path); err != nil {
+				return fmt.Errorf("failed to create hard link %s: %w", rel, err)
+			}
+
+		default:
+			return fmt.Errorf("%w: %s has unsupported type %q", ErrUnsafeTarEntry, rel, hdr.Typeflag)
+		}
+
+		if os.Geteuid() == 0 {
+			if err := os.Lchown(path, hdr.Uid, hdr.Gid); err != nil {
+				return fmt.Errorf("failed to set owner of %s: %w", rel, err)
+			}
+		}
+	}
+
+	// Apply directory mtimes deepest-first, after all children exist.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Chtimes(dirs[i].path, dirs[i].mtime, dirs[i].mtime)
+	}
+	return nil
+}
+
+// tarMemberPath re-roots a member name below the extraction root: leading
+// "/" and "./" are dropped and ".." can never climb above the root. It
+// returns false for the root itself.
+func tarMemberPath(name string) (string, bool) {
+	rel := strings.TrimPrefix(filepath.Clean("/"+name), "/")
+	if rel == "" {
+		return "", false
+	}
+	return rel, true
+}
+
+// tarSpecialBits maps the setuid, setgid, and sticky bits of a tar header
+// mode onto os.FileMode.
+func tarSpecialBits(mode int64) os.FileMode {
+	var m os.FileMode
+	if mode&04000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// checkNoSymlinkParents refuses a member whose parent directories (relative
+// to root) include a symlink, so a hostile archive cannot plant "usr/bin ->
+// /etc" and then write "usr/bin/passwd" outside the root. Parents that do not
+// exist yet are created as plain directories, matching tar's behaviour for
+// archives that omit directory members.
+func checkNoSymlinkParents(root, rel string) error {
+	dir := root
+	parts := strings.Split(filepath.Dir(rel), string(filepath.Separator))
+	for _, part := range parts {
+		if part == "." || part == "" {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", dir, err)
+			}
+		case err != nil:
+			return fmt.Errorf("failed to inspect %s: %w", dir, err)
+		case info.Mode()&os.ModeSymlink != 0:
+			return fmt.Errorf("%w: %s is below symlink %s", ErrUnsafeTarEntry, rel, part)
+		case !info.IsDir():
+			return fmt.Errorf("%w: %s is below non-directory %s", ErrUnsafeTarEntry, rel, part)
+		}
+	}
+	return nil
+}
+
+// removeNonDir clears a previous member at path so a later member of the
+// same name replaces it, as tar does. A directory is never replaced by a
+// non-directory.
+func removeNonDir(path, rel string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", rel, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w: %s replaces a directory", ErrUnsafeTarEntry, rel)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", rel, err)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package download
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tarEntry describes one member of a test tarball.
+type tarEntry struct {
+	name     string
+	typ      byte
+	body     string
+	linkname string
+	mode     int64
+}
+
+func tarBytes(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+			if e.typ == tar.TypeDir {
+				mode = 0755
+			}
+		}
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typ,
+			Linkname: e.linkname,
+			Mode:     mode,
+			Size:     int64(len(e.body)),
+			ModTime:  time.Unix(1700000000, 0),
+		}
+		if e.typ != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader(%s) error = %v", e.name, err)
+		}
+		if e.typ == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatalf("Write(%s) error = %v", e.name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func serveBytes(t *testing.T, content []byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadTarExtractsTree(t *testing.T) {
+	archive := gzipBytes(t, tarBytes(t, []tarEntry{
+		{name: "./", typ: tar.TypeDir},
+		{name: "./usr/", typ: tar.TypeDir},
+		{name: "./usr/bin/", typ: tar.TypeDir},
+		{name: "./usr/bin/tool", typ: tar.TypeReg, body: "#!/bin/sh\n", mode: 0755},
+		{name: "./usr/lib/extension-release.d/extension-release.myext", typ: tar.TypeReg, body: "ID=_any\n"},
+		{name: "./usr/bin/tool-alias", typ: tar.TypeSymlink, linkname: "tool"},
+		{name: "./usr/bin/tool-hard", typ: tar.TypeLink, linkname: "./usr/bin/tool"},
+	}))
+	server := serveBytes(t, archive)
+
+	targetPath := filepath.Join(t.TempDir(), "myext_1.0.0")
+	if err := DownloadTar(t.Context(), server.Client(), server.URL+"/myext_1.0.0.tar.gz", targetPath, hashString(archive), nil); err != nil {
+		t.Fatalf("DownloadTar() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(targetPath, "usr/bin/tool"))
+	if err != nil {
+		t.Fatalf("ReadFile(tool) error = %v", err)
+	}
+	if string(got) != "#!/bin/sh\n" {
+		t.Errorf("tool content = %q", got)
+	}
+	info, err := os.Stat(filepath.Join(targetPath, "usr/bin/tool"))
+	if err != nil {
+		t.Fatalf("Stat(tool) error = %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("tool mode = %v, want 0755", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("tool mtime = %v, want archive mtime", info.ModTime())
+	}
+	if link, err := os.Readlink(filepath.Join(targetPath, "usr/bin/tool-alias")); err != nil || link != "tool" {
+		t.Errorf("Readlink(tool-alias) = %q, %v; want \"tool\"", link, err)
+	}
+	hard, err := os.Stat(filepath.Join(targetPath, "usr/bin/tool-hard"))
+	if err != nil {
+		t.Fatalf("Stat(tool-hard) error = %v", err)
+	}
+	if !os.SameFile(info, hard) {
+		t.Error("tool-hard is not a hard link to tool")
+	}
+	if _, err := os.Stat(filepath.Join(targetPath, "usr/lib/extension-release.d/extension-release.myext")); err != nil {
+		t.Errorf("extension-release missing: %v", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(targetPath), ".updex-*"))
+	if err != nil {
+		t.Fatalf("Glob() error = %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("temporary entries remain: %v", matches)
+	}
+}
+
+// TestDownloadTarReplacesExistingDirectory covers a re-install of the same
+// version: the old tree is swapped out wholesale, so files that the new
+// archive no longer ships do not linger in the instance.
+func TestDownloadTarReplacesExistingDirectory(t *testing.T) {
+	archive := tarBytes(t, []tarEntry{{name: "usr/new", typ: tar.TypeReg, body: "new"}})
+	server := serveBytes(t, archive)
+
+	targetPath := filepath.Join(t.TempDir(), "myext_1.0.0")
+	if err := os.MkdirAll(filepath.Join(targetPath, "usr"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(targetPath, "usr/stale"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DownloadTar(t.Context(), server.Client(), server.URL+"/myext_1.0.0.tar", targetPath, hashString(archive), nil); err != nil {
+		t.Fatalf("DownloadTar() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(targetPath, "usr/new")); err != nil {
+		t.Errorf("new file missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(targetPath, "usr/stale")); !os.IsNotExist(err) {
+		t.Errorf("stale file still present, stat err = %v", err)
+	}
+}
+
+// TestDownloadTarConfinesMembers proves a hostile archive cannot write
+// outside the instance directory, either by name or through a symlink it
+// planted earlier in the stream, and that a rejected archive leaves neither
+// a target nor temporary directories behind.
+func TestDownloadTarConfinesMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		wantErr error
+		// escaped is a path relative to the test's parent directory that
+		// must not be written.
+		escaped string
+	}{
+		{
+			name:    "symlink parent",
+			entries: []tarEntry{{name: "usr", typ: tar.TypeSymlink, linkname: "../outside"}, {name: "usr/evil", typ: tar.TypeReg, body: "x"}},
+			wantErr: ErrUnsafeTarEntry,
+			escaped: "outside/evil",
+		},
+		{
+			name:    "hard link through symlink",
+			entries: []tarEntry{{name: "up", typ: tar.TypeSymlink, linkname: ".."}, {name: "stolen", typ: tar.TypeLink, linkname: "up/secret"}},
+			wantErr: ErrUnsafeTarEntry,
+		},
+		{
+			name:    "device node",
+			entries: []tarEntry{{name: "dev/null", typ: tar.TypeChar}},
+			wantErr: ErrUnsafeTarEntry,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			archive := tarBytes(t, tc.entries)
+			server := serveBytes(t, archive)
+
+			parent := t.TempDir()
+			if err := os.Mkdir(filepath.Join(parent, "outside"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			stageDir := filepath.Join(parent, "stage")
+			targetPath := filepath.Join(stageDir, "myext_1.0.0")
+
+			err := DownloadTar(t.Context(), server.Client(), server.URL+"/myext_1.0.0.tar", targetPath, hashString(archive), nil)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("DownloadTar() error = %v, want %v", err, tc.wantErr)
+			}
+			if tc.escaped != "" {
+				if _, err := os.Lstat(filepath.Join(parent, tc.escaped)); !os.IsNotExist(err) {
+					t.Errorf("%s was written outside the root, stat err = %v", tc.escaped, err)
+				}
+			}
+			entries, err := os.ReadDir(stageDir)
+			if err != nil {
+				t.Fatalf("ReadDir() error = %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("staging directory not clean after failure: %v", entries)
+			}
+		})
+	}
+}
+
+func TestTarMemberPath(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{in: "./", wantOK: false},
+		{in: "usr/bin/tool", want: "usr/bin/tool", wantOK: true},
+		{in: "./usr/bin/", want: "usr/bin", wantOK: true},
+		{in: "/etc/passwd", want: "etc/passwd", wantOK: true},
+		{in: "../../etc/passwd", want: "etc/passwd", wantOK: true},
+		{in: "usr/../../x", want: "x", wantOK: true},
+	}
+	for _, tc := range tests {
+		got, ok := tarMemberPath(tc.in)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("tarMemberPath(%q) = %q, %v; want %q, %v", tc.in, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestDownloadTarMaxDecompressedSize(t *testing.T) {
+	archive := gzipBytes(t, tarBytes(t, []tarEntry{
+		{name: "a", typ: tar.TypeReg, body: strings.Repeat("a", 600)},
+		{name: "b", typ: tar.TypeReg, body: strings.Repeat("b", 600)},
+	}))
+	server := serveBytes(t, archive)
+
+	t.Run("rejects a tree over the limit", func(t *testing.T) {
+		targetPath := filepath.Join(t.TempDir(), "myext_1.0.0")
+		err := DownloadTar(t.Context(), server.Client(), server.URL+"/myext_1.0.0.tar.gz", targetPath, hashString(archive), nil, WithMaxDecompressedSize(1000))
+		if !errors.Is(err, ErrDecompressedTooLarge) {
+			t.Fatalf("DownloadTar() error = %v, want ErrDecompressedTooLarge", err)
+		}
+		if _, err := os.Stat(targetPath); !os.IsNotExist(err) {
+			t.Errorf("Stat(target) error = %v, want not-exist", err)
+		}
+	})
+
+	t.Run("accepts a tree at the limit", func(t *testing.T) {
+		targetPath := filepath.Join(t.TempDir(), "myext_1.0.0")
+		if err := DownloadTar(t.Context(), server.Client(), server.URL+"/myext_1.0.0.tar.gz", targetPath, hashString(archive), nil, WithMaxDecompressedSize(1200)); err != nil {
+			t.Fatalf("DownloadTar() error = %v", err)
+		}
+	})
+}
+
+func TestDownloadTarChecksumMismatch(t *testing.T) {
+	archive := tarBytes(t, []tarEntry{{name: "usr/x", typ: tar.TypeReg, body: "x"}})
+	server := serveBytes(t, archive)
+
+	targetPath := filepath.Join(t.TempDir(), "myext_1.0.0")
+	err := DownloadTar(t.Context(), server.Client(), server.URL+"/myext_1.0.0.tar", targetPath, hashString([]byte("other")), nil, WithRetryConfig(1, time.Millisecond))
+	if err == nil || !strings.Contains(err.Error(), "hash mismatch") {
+		t.Fatalf("DownloadTar() error = %v, want hash mismatch", err)
+	}
+	if _, err := os.Stat(targetPath); !os.IsNotExist(err) {
+		t.Errorf("Stat(target) error = %v, want not-exist", err)
+	}
+}
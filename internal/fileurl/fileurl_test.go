@@ -0,0 +1,113 @@
+package fileurl
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, rawURL string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, rawURL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest(%q) error = %v", rawURL, err)
+	}
+	return ClientFor(nil, rawURL).Do(req)
+}
+
+func TestTransportServesRegularFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "image v1.raw")
+	if err := os.WriteFile(path, []byte("payload"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := get(t, FromPath(path))
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if resp.ContentLength != int64(len("payload")) {
+		t.Errorf("ContentLength = %d, want %d", resp.ContentLength, len("payload"))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(body) != "payload" {
+		t.Errorf("body = %q, want %q", body, "payload")
+	}
+}
+
+// TestTransportStatusMapping pins the status codes local failures map to, so
+// manifest and download classify them like their HTTP counterparts: missing
+// files and directories are a non-retryable 404.
+func TestTransportStatusMapping(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{name: "missing file", url: FromPath(filepath.Join(dir, "absent")), want: http.StatusNotFound},
+		{name: "directory", url: FromPath(dir), want: http.StatusNotFound},
+		{name: "localhost host", url: "file://localhost" + filepath.Join(dir, "absent"), want: http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := get(t, tc.url)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tc.want {
+				t.Errorf("StatusCode = %d, want %d", resp.StatusCode, tc.want)
+			}
+		})
+	}
+}
+
+func TestTransportRejectsRemoteHost(t *testing.T) {
+	if _, err := get(t, "file://example.com/etc/hostname"); err == nil {
+		t.Fatal("Do() error = nil, want non-local host error")
+	}
+}
+
+func TestClientFor(t *testing.T) {
+	base := &http.Client{Timeout: 42 * time.Second}
+	if got := ClientFor(base, "https://example.com/SHA256SUMS"); got != base {
+		t.Error("ClientFor(https) should return the caller's client unchanged")
+	}
+	got := ClientFor(base, "file:///srv/mirror/SHA256SUMS")
+	if got == base {
+		t.Fatal("ClientFor(file) must not reuse the caller's client")
+	}
+	if _, ok := got.Transport.(Transport); !ok {
+		t.Errorf("ClientFor(file) transport = %T, want Transport", got.Transport)
+	}
+	if got.Timeout != base.Timeout {
+		t.Errorf("ClientFor(file) timeout = %v, want %v", got.Timeout, base.Timeout)
+	}
+	if base.Transport != nil {
+		t.Error("ClientFor modified the caller's client")
+	}
+}
+
+func TestFromPath(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{in: "/srv/mirror", want: "file:///srv/mirror"},
+		{in: "/srv/my mirror", want: "file:///srv/my%20mirror"},
+		{in: "file:///srv/mirror", want: "file:///srv/mirror"},
+	}
+	for _, tc := range tests {
+		if got := FromPath(tc.in); got != tc.want {
+			t.Errorf("FromPath(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package lock
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// procLocks is the kernel's table of file locks, beside the process
+// directories; a test seam.
+var procLocks = "/proc/locks"
+
+// holders returns the processes holding a flock(2) lock on f, read from
+// /proc/locks, or nil when they cannot be told.
+func holders(f *os.File) []Holder {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(f.Fd()), &st); err != nil {
+		return nil
+	}
+	device := fmt.Sprintf("%02x:%02x:%d", unix.Major(st.Dev), unix.Minor(st.Dev), st.Ino)
+
+	locks, err := os.Open(procLocks)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = locks.Close() }()
+
+	// "1: FLOCK  ADVISORY  WRITE 1234 00:19:5678 0 EOF"; a waiter's line
+	// has "->" after the number.
+	var found []Holder
+	seen := make(map[int]bool)
+	scanner := bufio.NewScanner(locks)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[1] != "FLOCK" || fields[5] != device {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[4])
+		if err != nil || seen[pid] {
+			continue
+		}
+		seen[pid] = true
+		found = append(found, Holder{PID: pid, Command: command(pid)})
+	}
+	return found
+}
+
+// command returns the command line of pid with its program's directory
+// dropped, or "" when it cannot be read.
+func command(pid int) string {
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(procLocks), strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return ""
+	}
+	args := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	if args[0] == "" {
+		return ""
+	}
+	args[0] = filepath.Base(args[0])
+	return strings.Join(args, " ")
+}
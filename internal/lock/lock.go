@@ -0,0 +1,132 @@
+// Package lock serializes processes with flock(2) on a lock file: any
+// number of shared holders, or one exclusive holder. A process that cannot
+// take the lock at once either fails with a *BusyError naming the holders
+// or polls until the lock is free or its context is done.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// pollInterval is how often a waiting Acquire retries; a test seam.
+var pollInterval = 100 * time.Millisecond
+
+// Holder is a process holding a lock.
+type Holder struct {
+	PID int
+	// Command is the holder's command line, empty when it cannot be read.
+	Command string
+}
+
+func (h Holder) String() string {
+	if h.Command == "" {
+		return fmt.Sprintf("PID %d", h.PID)
+	}
+	return fmt.Sprintf("PID %d (%s)", h.PID, h.Command)
+}
+
+// BusyError reports a lock held by other processes.
+type BusyError struct {
+	Path string
+	// Holders are the processes holding the lock, when the system tells
+	// (see holders).
+	Holders []Holder
+}
+
+func (e *BusyError) Error() string {
+	if len(e.Holders) == 0 {
+		return fmt.Sprintf("%s is held by another process", e.Path)
+	}
+	held := make([]string, len(e.Holders))
+	for i, h := range e.Holders {
+		held[i] = h.String()
+	}
+	return fmt.Sprintf("%s is held by %s", e.Path, strings.Join(held, ", "))
+}
+
+// Lock is a held lock.
+type Lock struct {
+	f *os.File
+}
+
+// Options configures Acquire.
+type Options struct {
+	// Exclusive takes the lock exclusively rather than shared.
+	Exclusive bool
+	// Wait polls until the lock is free instead of failing at once.
+	Wait bool
+	// OnWait, if set, is called once with the busy lock before waiting.
+	OnWait func(busy *BusyError)
+}
+
+// Acquire takes the lock on the file at path, creating it and its
+// directory as needed. The file is created readable by its owner only, so
+// other users cannot hold it. A shared lock falls back to opening an
+// existing file read-only.
+func Acquire(ctx context.Context, path string, opts Options) (*Lock, error) {
+	f, err := open(path, opts.Exclusive)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if opts.Exclusive {
+		how = syscall.LOCK_EX
+	}
+	var ticker *time.Ticker
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if err == nil {
+			return &Lock{f: f}, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if ticker == nil {
+			busy := &BusyError{Path: path, Holders: holders(f)}
+			if !opts.Wait {
+				_ = f.Close()
+				return nil, busy
+			}
+			if opts.OnWait != nil {
+				opts.OnWait(busy)
+			}
+			ticker = time.NewTicker(pollInterval)
+			defer ticker.Stop()
+		}
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, fmt.Errorf("stopped waiting for %s: %w", path, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func open(path string, exclusive bool) (*os.File, error) {
+	_ = os.MkdirAll(filepath.Dir(path), 0755) // the open reports a failure
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil && !exclusive {
+		if ro, roErr := os.Open(path); roErr == nil {
+			return ro, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	return f, nil
+}
+
+// Release releases the lock. Closing the file would too, as would the
+// process exiting.
+func (l *Lock) Release() error {
+	return l.f.Close()
+}
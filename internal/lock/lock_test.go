@@ -0,0 +1,93 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireExclusiveExcludes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "lock")
+	held, err := Acquire(t.Context(), path, Options{Exclusive: true})
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("lock file = %v, %v, want mode 0600", info, err)
+	}
+
+	for _, exclusive := range []bool{true, false} {
+		_, err := Acquire(t.Context(), path, Options{Exclusive: exclusive})
+		var busy *BusyError
+		if !errors.As(err, &busy) {
+			t.Fatalf("Acquire(exclusive=%v) error = %v, want a BusyError", exclusive, err)
+		}
+		if len(busy.Holders) != 1 || busy.Holders[0].PID != os.Getpid() || !strings.Contains(busy.Error(), "is held by PID ") {
+			t.Errorf("BusyError = %q (%+v), want this process as the holder", busy, busy.Holders)
+		}
+	}
+
+	if err := held.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	again, err := Acquire(t.Context(), path, Options{Exclusive: true})
+	if err != nil {
+		t.Fatalf("Acquire() after Release error = %v", err)
+	}
+	_ = again.Release()
+}
+
+func TestAcquireSharedAllowsShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	first, err := Acquire(t.Context(), path, Options{})
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer func() { _ = first.Release() }()
+	second, err := Acquire(t.Context(), path, Options{})
+	if err != nil {
+		t.Fatalf("second shared Acquire() error = %v", err)
+	}
+	_ = second.Release()
+	if _, err := Acquire(t.Context(), path, Options{Exclusive: true}); err == nil {
+		t.Error("exclusive Acquire() succeeded under a shared lock")
+	}
+}
+
+// TestAcquireWaits verifies that a waiting Acquire is told who holds the
+// lock, takes it once released, and gives up when its context is done.
+func TestAcquireWaits(t *testing.T) {
+	orig := pollInterval
+	pollInterval = time.Millisecond
+	t.Cleanup(func() { pollInterval = orig })
+
+	path := filepath.Join(t.TempDir(), "lock")
+	held, err := Acquire(t.Context(), path, Options{Exclusive: true})
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	var waited *BusyError
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = held.Release()
+	}()
+	l, err := Acquire(t.Context(), path, Options{Exclusive: true, Wait: true, OnWait: func(b *BusyError) { waited = b }})
+	if err != nil {
+		t.Fatalf("waiting Acquire() error = %v", err)
+	}
+	if waited == nil || len(waited.Holders) != 1 {
+		t.Errorf("OnWait got %+v, want the holder", waited)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := Acquire(ctx, path, Options{Wait: true}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() past the deadline error = %v, want DeadlineExceeded", err)
+	}
+	_ = l.Release()
+}
@@ -0,0 +1,133 @@
+package testutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestRegistryImage is one tagged single-layer artifact served by
+// NewTestRegistry, shaped like an `oras push <repo>:<tag> <title>` upload.
+type TestRegistryImage struct {
+	Tag     string
+	Title   string // org.opencontainers.image.title of the layer; "" omits it
+	Content []byte
+}
+
+// TestRegistry configures NewTestRegistry.
+type TestRegistry struct {
+	Repository string
+	Images     []TestRegistryImage
+	// RequireToken makes every /v2/ request answer 401 with a bearer
+	// challenge unless it carries the token served from /token.
+	RequireToken bool
+	// PageSize, when positive, paginates the tags list with Link headers.
+	PageSize int
+}
+
+// TestRegistryToken is the bearer token a RequireToken registry issues.
+const TestRegistryToken = "test-registry-token"
+
+// NewTestRegistry creates an httptest.Server implementing the slice of the
+// OCI distribution API updex reads: tags list (with optional Link
+// pagination), image manifests by tag, blobs by digest, and an anonymous
+// token endpoint.
+func NewTestRegistry(t *testing.T, reg TestRegistry) *httptest.Server {
+	t.Helper()
+
+	blobs := make(map[string][]byte)
+	manifests := make(map[string][]byte)
+	var tags []string
+	for _, img := range reg.Images {
+		sum := sha256.Sum256(img.Content)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		blobs[digest] = img.Content
+		layer := map[string]any{
+			"mediaType": "application/vnd.oci.image.layer.v1.tar",
+			"digest":    digest,
+			"size":      len(img.Content),
+		}
+		if img.Title != "" {
+			layer["annotations"] = map[string]string{"org.opencontainers.image.title": img.Title}
+		}
+		doc, err := json.Marshal(map[string]any{
+			"schemaVersion": 2,
+			"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+			"config": map[string]any{
+				"mediaType": "application/vnd.oci.empty.v1+json",
+				"digest":    "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+				"size":      2,
+			},
+			"layers": []any{layer},
+		})
+		if err != nil {
+			t.Fatalf("failed to encode test manifest: %v", err)
+		}
+		manifests[img.Tag] = doc
+		tags = append(tags, img.Tag)
+	}
+	slices.Sort(tags)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": TestRegistryToken})
+			return
+		}
+
+		prefix := "/v2/" + reg.Repository + "/"
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			http.NotFound(w, r)
+			return
+		}
+		if reg.RequireToken && r.Header.Get("Authorization") != "Bearer "+TestRegistryToken {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:%s:pull"`, server.URL, reg.Repository))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, prefix)
+		switch {
+		case rest == "tags/list":
+			page := tags
+			if reg.PageSize > 0 {
+				start := 0
+				if last := r.URL.Query().Get("last"); last != "" {
+					start = slices.Index(tags, last) + 1
+				}
+				end := min(start+reg.PageSize, len(tags))
+				page = tags[start:end]
+				if end < len(tags) {
+					w.Header().Set("Link", fmt.Sprintf(`<%stags/list?n=%s&last=%s>; rel="next"`, prefix, strconv.Itoa(reg.PageSize), tags[end-1]))
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": reg.Repository, "tags": page})
+		case strings.HasPrefix(rest, "manifests/"):
+			doc, ok := manifests[strings.TrimPrefix(rest, "manifests/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			_, _ = w.Write(doc)
+		case strings.HasPrefix(rest, "blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(rest, "blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(blob)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server
+}
@@ -0,0 +1,165 @@
+// Package journal writes updex output to the systemd journal over its
+// native protocol, keeping the feature, transfer and version a message is
+// about in fields of their own so they can be matched on, as in
+// `journalctl UPDEX_FEATURE=docker`.
+package journal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/frostyard/std/reporter"
+	"github.com/frostyard/updex/updex"
+)
+
+// SocketPath is the journal's native protocol socket.
+const SocketPath = "/run/systemd/journal/socket"
+
+// Fields updex adds to its journal entries, besides MESSAGE, PRIORITY,
+// SYSLOG_IDENTIFIER and, for events, MESSAGE_ID.
+const (
+	FieldEvent    = "UPDEX_EVENT"
+	FieldFeature  = "UPDEX_FEATURE"
+	FieldTransfer = "UPDEX_TRANSFER"
+	FieldVersion  = "UPDEX_VERSION"
+)
+
+// messageIDs are the MESSAGE_IDs of the entries for each event type. They
+// are part of the interface: never change one, only add new ones.
+var messageIDs = map[updex.EventType]string{
+	updex.EventInstalled:     "959ed5e3d38245cd97fd9790926753e3",
+	updex.EventSwitched:      "86a39a9a1e4b404a9902c87392ae9128",
+	updex.EventStaged:        "0ea487f6df21453f815c1ccf28f99f42",
+	updex.EventApplied:       "bdf1d4cafbdc4f78924312da1b32d2eb",
+	updex.EventUpdateFailed:  "285699e0e1ab49c185c706bd3008b433",
+	updex.EventApplyFailed:   "16061f1cf72b44b3873b744ecab03dc2",
+	updex.EventRefreshFailed: "4610b62895f241f0adf30f42310264f2",
+	updex.EventReverted:      "4b3514f6c078428eaded9148333a5cfa",
+}
+
+// MessageID returns the MESSAGE_ID of the journal entries for events of
+// type t, or "" for a type without one.
+func MessageID(t updex.EventType) string {
+	return messageIDs[t]
+}
+
+// syslog priorities (see syslog(3)).
+const (
+	priorityWarning = 4
+	priorityInfo    = 6
+)
+
+const identifier = "updex"
+
+// Reporter is an updex.EventReporter that sends every message to the
+// journal as one entry. An entry the journal does not accept is passed to
+// the fallback reporter instead, so nothing is lost when journald is
+// unavailable.
+type Reporter struct {
+	conn     *net.UnixConn
+	fallback reporter.Reporter
+}
+
+var _ updex.EventReporter = (*Reporter)(nil)
+
+// NewReporter connects to the journal's datagram socket at socketPath
+// (normally SocketPath). fallback receives what cannot be sent; nil drops
+// it.
+func NewReporter(socketPath string, fallback reporter.Reporter) (*Reporter, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("connect to journal: %w", err)
+	}
+	if fallback == nil {
+		fallback = reporter.NoopReporter{}
+	}
+	return &Reporter{conn: conn, fallback: fallback}, nil
+}
+
+// Close closes the connection to the journal.
+func (r *Reporter) Close() error {
+	return r.conn.Close()
+}
+
+func (r *Reporter) Message(format string, args ...any) {
+	r.Event(updex.Event{Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *Reporter) Warning(format string, args ...any) {
+	r.Event(updex.Event{Warning: true, Message: fmt.Sprintf(format, args...)})
+}
+
+// Event sends e as one journal entry with its subject in the UPDEX_*
+// fields.
+func (r *Reporter) Event(e updex.Event) {
+	priority := priorityInfo
+	if e.Warning {
+		priority = priorityWarning
+	}
+	var b []byte
+	b = appendField(b, "MESSAGE", e.Message)
+	b = appendField(b, "PRIORITY", strconv.Itoa(priority))
+	b = appendField(b, "SYSLOG_IDENTIFIER", identifier)
+	if id := MessageID(e.Type); id != "" {
+		b = appendField(b, "MESSAGE_ID", id)
+	}
+	for _, f := range []struct{ key, value string }{
+		{FieldEvent, string(e.Type)},
+		{FieldFeature, e.Feature},
+		{FieldTransfer, e.Transfer},
+		{FieldVersion, e.Version},
+	} {
+		if f.value != "" {
+			b = appendField(b, f.key, f.value)
+		}
+	}
+
+	if _, err := r.conn.Write(b); err != nil {
+		if e.Warning {
+			r.fallback.Warning("%s", e.Message)
+		} else {
+			r.fallback.Message("%s", e.Message)
+		}
+	}
+}
+
+// appendField appends one field in the native protocol's encoding: KEY=value
+// on a line, or, for a value spanning lines, KEY on a line followed by the
+// value's length as a little-endian 64-bit integer, the value and a newline.
+func appendField(b []byte, key, value string) []byte {
+	b = append(b, key...)
+	if !strings.Contains(value, "\n") {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, '\n')
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(value)))
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// IsStream reports whether f is the stream systemd connected to the
+// journal: systemd sets JOURNAL_STREAM to its device and inode numbers for
+// services whose output it logs. A file that merely inherited the variable,
+// such as stderr redirected by a child process, does not match.
+func IsStream(f *os.File) bool {
+	dev, ino, ok := strings.Cut(os.Getenv("JOURNAL_STREAM"), ":")
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	return dev == strconv.FormatUint(uint64(st.Dev), 10) && ino == strconv.FormatUint(st.Ino, 10)
+}
@@ -0,0 +1,169 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/frostyard/std/reporter"
+	"github.com/frostyard/updex/updex"
+)
+
+// listen opens a local datagram socket standing in for journald and
+// returns its path and a function reading the next entry's fields.
+func listen(t *testing.T) (string, func() map[string]string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return path, func() map[string]string {
+		t.Helper()
+		buf := make([]byte, 65536)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read entry: %v", err)
+		}
+		return parseEntry(t, buf[:n])
+	}
+}
+
+// parseEntry decodes a native protocol datagram.
+func parseEntry(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for len(b) > 0 {
+		nl := bytes.IndexByte(b, '\n')
+		if nl < 0 {
+			t.Fatalf("unterminated field %q", b)
+		}
+		line := b[:nl]
+		b = b[nl+1:]
+		if key, value, ok := bytes.Cut(line, []byte("=")); ok {
+			fields[string(key)] = string(value)
+			continue
+		}
+		size := binary.LittleEndian.Uint64(b[:8])
+		fields[string(line)] = string(b[8 : 8+size])
+		if b[8+size] != '\n' {
+			t.Fatalf("binary field %s not terminated by a newline", line)
+		}
+		b = b[8+size+1:]
+	}
+	return fields
+}
+
+func TestReporterSendsStructuredEntries(t *testing.T) {
+	path, next := listen(t)
+	r, err := NewReporter(path, nil)
+	if err != nil {
+		t.Fatalf("NewReporter() error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	r.Message("Processing %s/%s", "docker", "docker-ce")
+	if got := next(); got["MESSAGE"] != "Processing docker/docker-ce" || got["PRIORITY"] != "6" || got["SYSLOG_IDENTIFIER"] != "updex" || got["MESSAGE_ID"] != "" {
+		t.Errorf("message entry = %v", got)
+	}
+
+	r.Warning("vacuum failed: %s", "busy")
+	if got := next(); got["MESSAGE"] != "vacuum failed: busy" || got["PRIORITY"] != "4" {
+		t.Errorf("warning entry = %v", got)
+	}
+
+	r.Event(updex.Event{Type: updex.EventInstalled, Feature: "docker", Transfer: "docker-ce", Version: "28.1", Message: "Installed version 28.1"})
+	want := map[string]string{
+		"MESSAGE":           "Installed version 28.1",
+		"PRIORITY":          "6",
+		"SYSLOG_IDENTIFIER": "updex",
+		"MESSAGE_ID":        MessageID(updex.EventInstalled),
+		FieldEvent:          "installed",
+		FieldFeature:        "docker",
+		FieldTransfer:       "docker-ce",
+		FieldVersion:        "28.1",
+	}
+	if got := next(); !maps.Equal(got, want) {
+		t.Errorf("event entry = %v, want %v", got, want)
+	}
+
+	// A message spanning lines uses the binary field encoding.
+	r.Event(updex.Event{Type: updex.EventUpdateFailed, Warning: true, Message: "one or more components failed\nsysext refresh failed"})
+	if got := next(); got["MESSAGE"] != "one or more components failed\nsysext refresh failed" || got["PRIORITY"] != "4" {
+		t.Errorf("multi-line entry = %v", got)
+	}
+}
+
+func TestEveryEventTypeHasMessageID(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, typ := range []updex.EventType{
+		updex.EventInstalled, updex.EventSwitched, updex.EventStaged, updex.EventApplied,
+		updex.EventUpdateFailed, updex.EventApplyFailed, updex.EventRefreshFailed, updex.EventReverted,
+	} {
+		id := MessageID(typ)
+		if len(id) != 32 || seen[id] {
+			t.Errorf("MessageID(%s) = %q, want a unique 128-bit hex ID", typ, id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestReporterFallsBackWhenJournalIsGone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	var out bytes.Buffer
+	r, err := NewReporter(path, reporter.NewTextReporter(&out))
+	if err != nil {
+		t.Fatalf("NewReporter() error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	_ = conn.Close()
+
+	r.Warning("refresh failed")
+	if out.Len() == 0 {
+		t.Error("a message the journal did not take was not passed to the fallback")
+	}
+
+	if _, err := NewReporter(filepath.Join(t.TempDir(), "missing"), nil); err == nil {
+		t.Error("NewReporter() without a socket succeeded")
+	}
+}
+
+func TestIsStream(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	stream := strconv.FormatUint(uint64(st.Dev), 10) + ":" + strconv.FormatUint(st.Ino, 10)
+
+	for _, tt := range []struct {
+		env  string
+		want bool
+	}{
+		{env: stream, want: true},
+		{env: strconv.FormatUint(uint64(st.Dev), 10) + ":1", want: false},
+		{env: "", want: false},
+		{env: "garbage", want: false},
+	} {
+		t.Setenv("JOURNAL_STREAM", tt.env)
+		if got := IsStream(f); got != tt.want {
+			t.Errorf("IsStream() with JOURNAL_STREAM=%q = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package manifest
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -24,23 +25,28 @@ var keyringPaths = []string{
 // response.
 const maxSigSize = 1 << 20
 
-// verifySignature verifies the GPG signature of the manifest content.
+// ErrInvalidSignature reports a signature that does not verify against the
+// keyring.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// verifySignature verifies the GPG signature of the manifest content and
+// returns the signature it checked.
 //
 // The detached-signature GET and body read run inside the same bounded retry
 // policy as the SHA256SUMS fetch (ADR-0008): transient network errors and
 // 429/5xx responses are retried with rs; other failures return immediately.
 // Keyring loading and signature checking happen after the fetch and are never
 // retried.
-func verifySignature(ctx context.Context, client *http.Client, sigURL string, content []byte, rs retrySettings) error {
+func verifySignature(ctx context.Context, client *http.Client, sigURL string, content []byte, rs retrySettings) ([]byte, error) {
 	sigData, err := fetchSignature(ctx, client, sigURL, rs)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Load keyring
 	keyring, err := loadKeyring()
 	if err != nil {
-		return fmt.Errorf("failed to load keyring: %w", err)
+		return nil, fmt.Errorf("failed to load keyring: %w", err)
 	}
 
 	// Verify signature
@@ -51,10 +57,10 @@ func verifySignature(ctx context.Context, client *http.Client, sigURL string, co
 		nil,
 	)
 	if err != nil {
-		return fmt.Errorf("invalid signature: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
 	}
 
-	return nil
+	return sigData, nil
 }
 
 // fetchSignature downloads the detached signature at sigURL under the bounded
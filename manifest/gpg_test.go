@@ -37,12 +37,12 @@ func TestVerifySignature(t *testing.T) {
 	}))
 	defer server.Close()
 
-	if err := verifySignature(t.Context(), server.Client(), server.URL, content, singleAttempt()); err != nil {
+	if _, err := verifySignature(t.Context(), server.Client(), server.URL, content, singleAttempt()); err != nil {
 		t.Fatalf("verifySignature() error = %v", err)
 	}
 
-	err := verifySignature(t.Context(), server.Client(), server.URL, []byte("tampered manifest"), singleAttempt())
-	if err == nil || !strings.Contains(err.Error(), "invalid signature") {
+	_, err := verifySignature(t.Context(), server.Client(), server.URL, []byte("tampered manifest"), singleAttempt())
+	if !errors.Is(err, ErrInvalidSignature) {
 		t.Fatalf("verifySignature() error = %v, want invalid signature", err)
 	}
 }
@@ -183,7 +183,7 @@ func TestVerifySignatureMissingKeyring(t *testing.T) {
 	}))
 	defer server.Close()
 
-	err := verifySignature(t.Context(), server.Client(), server.URL, []byte("manifest"), singleAttempt())
+	_, err := verifySignature(t.Context(), server.Client(), server.URL, []byte("manifest"), singleAttempt())
 	if err == nil || !strings.Contains(err.Error(), "failed to load keyring") {
 		t.Fatalf("verifySignature() error = %v, want missing keyring error", err)
 	}
@@ -195,7 +195,7 @@ func TestVerifySignatureHTTPFailure(t *testing.T) {
 	}))
 	defer server.Close()
 
-	err := verifySignature(t.Context(), server.Client(), server.URL, []byte("manifest"), singleAttempt())
+	_, err := verifySignature(t.Context(), server.Client(), server.URL, []byte("manifest"), singleAttempt())
 	if err == nil || !strings.Contains(err.Error(), "503 Service Unavailable") {
 		t.Fatalf("verifySignature() error = %v, want HTTP status error", err)
 	}
@@ -205,7 +205,7 @@ func TestVerifySignatureCancellation(t *testing.T) {
 	ctx, cancel := context.WithCancel(t.Context())
 	cancel()
 
-	err := verifySignature(ctx, http.DefaultClient, "http://example.invalid/signature", []byte("manifest"), singleAttempt())
+	_, err := verifySignature(ctx, http.DefaultClient, "http://example.invalid/signature", []byte("manifest"), singleAttempt())
 	if !errors.Is(err, context.Canceled) {
 		t.Fatalf("verifySignature() error = %v, want context.Canceled", err)
 	}
@@ -330,4 +330,55 @@ func TestFetchRecordsVerified(t *testing.T) {
 	if sigRequests.Load() != 1 {
 		t.Fatalf("verify=true fetched the signature %d time(s), want 1", sigRequests.Load())
 	}
+	if !bytes.Equal(verified.Document, content) || !bytes.Equal(verified.Signature, signature) {
+		t.Error("verified manifest must keep the served SHA256SUMS and the signature it checked")
+	}
+	if unverified.Signature != nil {
+		t.Error("unverified manifest must not carry a signature")
+	}
+}
+
+// TestFetchFromFileURL covers a mounted mirror on an air-gapped host: the
+// manifest and its detached signature are read through file:// and go
+// through the same signature check as an HTTP fetch.
+func TestFetchFromFileURL(t *testing.T) {
+	content, signature := signedManifest(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "SHA256SUMS"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	baseURL := "file://" + dir
+
+	t.Run("missing signature fails verification", func(t *testing.T) {
+		_, err := Fetch(t.Context(), nil, baseURL, true, WithRetryConfig(1, time.Millisecond))
+		if err == nil || !strings.Contains(err.Error(), "signature verification failed") {
+			t.Fatalf("Fetch() error = %v, want signature verification failure", err)
+		}
+	})
+
+	if err := os.WriteFile(filepath.Join(dir, "SHA256SUMS.gpg"), signature, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("valid signature verifies", func(t *testing.T) {
+		m, err := Fetch(t.Context(), nil, baseURL, true, WithRetryConfig(1, time.Millisecond))
+		if err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		if !m.Verified {
+			t.Error("Fetch(verify=true) from file:// must report Verified=true")
+		}
+		if len(m.Files) == 0 {
+			t.Error("Fetch() parsed no files from the local manifest")
+		}
+	})
+
+	t.Run("tampered manifest is rejected", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(dir, "SHA256SUMS"), append([]byte("# tampered\n"), content...), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Fetch(t.Context(), nil, baseURL, true, WithRetryConfig(1, time.Millisecond)); err == nil {
+			t.Fatal("Fetch() error = nil, want signature failure for a modified manifest")
+		}
+	})
 }
@@ -4,13 +4,16 @@ import (
 	"bufio"
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/frostyard/updex/internal/fileurl"
 	"github.com/frostyard/updex/internal/retry"
 )
 
@@ -25,11 +28,55 @@ type Manifest struct {
 	// fetches. Callers that cache manifests use it to ensure a transfer that
 	// requires verification never consumes a manifest fetched without it.
 	Verified bool
+	// Mirrors lists the other base URLs the same files can be downloaded
+	// from, in preference order, after URL. It is nil for a single-location
+	// source.
+	Mirrors []string
+	// Locations maps a filename to its absolute download URLs, in preference
+	// order, for sources whose files do not live directly under URL, such as
+	// OCI blobs or files a metalink lists. It is nil for SHA256SUMS manifests
+	// fetched from a directory.
+	Locations map[string][]string
+	// Document is the SHA256SUMS file exactly as served, and Signature the
+	// detached signature checked against it (nil unless Verified), so the
+	// pair can be carried elsewhere and verified again, as bundles do.
+	Document  []byte
+	Signature []byte
+	// Rollout maps a filename to the percentage of hosts it is rolled out
+	// to, as listed by the ROLLOUT sidecar; files it does not list are
+	// fully rolled out. RolloutChecked reports whether the sidecar was
+	// looked for (see WithRollout), so a manifest fetched without it is not
+	// mistaken for one whose source phases nothing.
+	Rollout        map[string]int
+	RolloutChecked bool
+}
+
+// FileURL returns the preferred URL to download filename from; see FileURLs.
+func (m *Manifest) FileURL(filename string) string {
+	return m.FileURLs(filename)[0]
+}
+
+// FileURLs returns every URL filename can be downloaded from, in the order
+// to try them: its Locations entries if it has any, otherwise filename
+// relative to URL and then to each of Mirrors. Whichever URL serves the
+// bytes, they are checked against the hash in Files.
+func (m *Manifest) FileURLs(filename string) []string {
+	if locs := m.Locations[filename]; len(locs) > 0 {
+		return slices.Clone(locs)
+	}
+	urls := make([]string, 0, 1+len(m.Mirrors))
+	for _, base := range append([]string{m.URL}, m.Mirrors...) {
+		urls = append(urls, strings.TrimRight(base, "/")+"/"+filename)
+	}
+	return urls
 }
 
 type retrySettings struct {
-	cfg    retry.Config
-	notify retry.Notify
+	cfg      retry.Config
+	notify   retry.Notify
+	mirrors  []string
+	failover func(location string, reason error)
+	rollout  bool
 }
 
 // Option configures manifest fetch behavior.
@@ -52,6 +99,31 @@ func WithRetryNotify(fn func(attempt, maxAttempts int, reason error)) Option {
 	}
 }
 
+// WithMirrors adds base URLs (or metalink URLs) that Fetch tries, in order,
+// when the previous location fails. Each location gets the full retry policy
+// before Fetch moves on.
+func WithMirrors(locations ...string) Option {
+	return func(settings *retrySettings) {
+		settings.mirrors = append(settings.mirrors, locations...)
+	}
+}
+
+// WithFailoverNotify configures a callback called with a location and its
+// error when Fetch gives up on it and moves to the next mirror.
+func WithFailoverNotify(fn func(location string, reason error)) Option {
+	return func(settings *retrySettings) {
+		settings.failover = fn
+	}
+}
+
+// WithRollout makes Fetch also read the ROLLOUT sidecar beside SHA256SUMS
+// into Manifest.Rollout (see RolloutPercent).
+func WithRollout() Option {
+	return func(settings *retrySettings) {
+		settings.rollout = true
+	}
+}
+
 func resolveRetry(opts ...Option) retrySettings {
 	settings := retrySettings{cfg: retry.DefaultConfig}
 	for _, opt := range opts {
@@ -61,11 +133,16 @@ func resolveRetry(opts ...Option) retrySettings {
 }
 
 // Fetch downloads and parses a SHA256SUMS manifest from the given base URL.
+// baseURL may be a file:// URL, in which case the manifest and signature are
+// read from the local filesystem, or the URL of a metalink document (see
+// IsMetalink), in which case the manifest and files are fetched from the
+// mirrors it lists. Locations added with WithMirrors are tried in order when
+// baseURL fails; the returned Manifest's URL is the location that served it
+// and its Mirrors are the others. A signature is only accepted from the
+// location that served the manifest, so a mirror cannot vouch for another.
 // If httpClient is nil, a default client with a 30-second timeout is used.
 // If verify is true, it will also verify the GPG signature.
 func Fetch(ctx context.Context, httpClient *http.Client, baseURL string, verify bool, opts ...Option) (*Manifest, error) {
-	manifestURL := strings.TrimRight(baseURL, "/") + "/SHA256SUMS"
-
 	if httpClient == nil {
 		httpClient = &http.Client{
 			Timeout: 30 * time.Second,
@@ -73,32 +150,120 @@ func Fetch(ctx context.Context, httpClient *http.Client, baseURL string, verify
 	}
 	rs := resolveRetry(opts...)
 
+	locations := append([]string{baseURL}, rs.mirrors...)
+	var errs []error
+	for i, location := range locations {
+		var m *Manifest
+		var err error
+		if IsMetalink(location) {
+			m, err = fetchMetalink(ctx, httpClient, location, verify, rs)
+		} else {
+			m, err = fetchFrom(ctx, httpClient, strings.TrimRight(location, "/")+"/SHA256SUMS", verify, rs)
+			if err == nil {
+				m.URL = location
+				m.Mirrors = otherDirectories(locations, i)
+			}
+		}
+		if err == nil {
+			return m, nil
+		}
+		if len(locations) == 1 || ctx.Err() != nil {
+			return nil, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", location, err))
+		if i+1 < len(locations) && rs.failover != nil {
+			rs.failover(location, err)
+		}
+	}
+	return nil, fmt.Errorf("all %d mirrors failed: %w", len(locations), errors.Join(errs...))
+}
+
+// otherDirectories returns the non-metalink locations other than
+// locations[served], in order: the mirrors a SHA256SUMS directory's files can
+// also be downloaded from.
+func otherDirectories(locations []string, served int) []string {
+	var dirs []string
+	for i, location := range locations {
+		if i != served && !IsMetalink(location) {
+			dirs = append(dirs, location)
+		}
+	}
+	return dirs
+}
+
+// fetchFrom downloads the SHA256SUMS manifest at manifestURL, verifies the
+// detached signature beside it when verify is set, and parses it.
+func fetchFrom(ctx context.Context, httpClient *http.Client, manifestURL string, verify bool, rs retrySettings) (*Manifest, error) {
+	// A file:// base URL (a mounted mirror on an air-gapped host) is read
+	// from disk; the size cap, signature check, and parsing below still apply.
+	httpClient = fileurl.ClientFor(httpClient, manifestURL)
+
+	content, err := fetchDocument(ctx, httpClient, manifestURL, "manifest", rs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify GPG signature if requested
+	var signature []byte
+	if verify {
+		sigURL := manifestURL + ".gpg"
+		signature, err = verifySignature(ctx, httpClient, sigURL, content, rs)
+		if err != nil {
+			return nil, fmt.Errorf("signature verification failed: %w", err)
+		}
+	}
+
+	// Parse manifest
+	m, err := parseManifest(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	if rs.rollout {
+		m.Rollout, err = fetchRollout(ctx, httpClient, directoryOf(manifestURL)+"/"+rolloutName, verify, rs)
+		if err != nil {
+			return nil, err
+		}
+		m.RolloutChecked = true
+	}
+
+	// verifySignature succeeded above whenever verify was requested, so
+	// Verified mirrors the request: true only after a successful check.
+	m.Verified = verify
+	m.Document = content
+	m.Signature = signature
+	return m, nil
+}
+
+// fetchDocument GETs rawURL under the retry policy rs and returns its body,
+// bounded by maxManifestSize. what names the document in errors.
+func fetchDocument(ctx context.Context, httpClient *http.Client, rawURL, what string, rs retrySettings) ([]byte, error) {
 	var content []byte
 	err := retry.Do(ctx, rs.cfg, rs.notify, func() error {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, manifestURL, nil)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 		if err != nil {
 			return fmt.Errorf("failed to create request: %w", err)
 		}
 
 		resp, err := httpClient.Do(req)
 		if err != nil {
-			return retry.TransientIfNetwork(fmt.Errorf("failed to fetch manifest: %w", err))
+			return retry.TransientIfNetwork(fmt.Errorf("failed to fetch %s: %w", what, err))
 		}
 		defer func() { _ = resp.Body.Close() }()
 
 		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
-			return retry.Transient(fmt.Errorf("manifest fetch failed with status: %s", resp.Status))
+			return retry.Transient(fmt.Errorf("%s fetch failed with status: %s", what, resp.Status))
 		}
 		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("manifest fetch failed with status: %s", resp.Status)
+			return &statusError{what: what, status: resp.Status, code: resp.StatusCode}
 		}
 
 		content, err = io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
 		if err != nil {
-			return retry.TransientIfNetwork(fmt.Errorf("failed to read manifest: %w", err))
+			return retry.TransientIfNetwork(fmt.Errorf("failed to read %s: %w", what, err))
 		}
 		if len(content) > maxManifestSize {
-			return fmt.Errorf("manifest response exceeds maximum allowed size (%d bytes): read %d", maxManifestSize, len(content))
+			return fmt.Errorf("%s response exceeds maximum allowed size (%d bytes): read %d", what, maxManifestSize, len(content))
 		}
 
 		return nil
@@ -106,26 +271,18 @@ func Fetch(ctx context.Context, httpClient *http.Client, baseURL string, verify
 	if err != nil {
 		return nil, err
 	}
+	return content, nil
+}
 
-	// Verify GPG signature if requested
-	if verify {
-		sigURL := manifestURL + ".gpg"
-		if err := verifySignature(ctx, httpClient, sigURL, content, rs); err != nil {
-			return nil, fmt.Errorf("signature verification failed: %w", err)
-		}
-	}
-
-	// Parse manifest
-	m, err := parseManifest(content)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse manifest: %w", err)
-	}
+// statusError is a fetch that failed with a status that is not retried.
+type statusError struct {
+	what   string
+	status string
+	code   int
+}
 
-	m.URL = baseURL
-	// verifySignature returned nil above whenever verify was requested, so
-	// Verified mirrors the request: true only after a successful check.
-	m.Verified = verify
-	return m, nil
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s fetch failed with status: %s", e.what, e.status)
 }
 
 // parseManifest parses SHA256SUMS format content
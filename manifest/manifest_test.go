@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -399,3 +400,22 @@ func validManifestContent() string {
 func testManifestHash() string {
 	return "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
 }
+
+func TestManifestFileURL(t *testing.T) {
+	m := &Manifest{
+		URL:       "https://example.com/ext/",
+		Locations: map[string][]string{"ext_2.raw": {"https://registry.example.com/v2/ext/blobs/sha256:abc"}},
+	}
+	if got, want := m.FileURL("ext_1.raw"), "https://example.com/ext/ext_1.raw"; got != want {
+		t.Errorf("FileURL(ext_1.raw) = %q, want %q", got, want)
+	}
+	if got, want := m.FileURL("ext_2.raw"), "https://registry.example.com/v2/ext/blobs/sha256:abc"; got != want {
+		t.Errorf("FileURL(ext_2.raw) = %q, want %q", got, want)
+	}
+
+	m.Mirrors = []string{"https://mirror.example.org/ext"}
+	want := []string{"https://example.com/ext/ext_1.raw", "https://mirror.example.org/ext/ext_1.raw"}
+	if got := m.FileURLs("ext_1.raw"); !slices.Equal(got, want) {
+		t.Errorf("FileURLs(ext_1.raw) = %q, want %q", got, want)
+	}
+}
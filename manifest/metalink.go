@@ -0,0 +1,170 @@
+package manifest
+
+import (
+	"cmp"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/frostyard/updex/internal/fileurl"
+)
+
+// metalinkSuffix is the file extension RFC 5854 registers for Metalink 4.0
+// documents.
+const metalinkSuffix = ".meta4"
+
+// IsMetalink reports whether location names a Metalink (RFC 5854) document
+// rather than a directory holding SHA256SUMS: its path ends in ".meta4".
+func IsMetalink(location string) bool {
+	u, err := url.Parse(location)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), metalinkSuffix)
+}
+
+// metalinkDoc is the subset of a Metalink 4.0 document Fetch reads: each
+// file's name and mirror URLs. Hashes, sizes, and signatures in the document
+// are ignored; SHA256SUMS (and its detached signature) stays the single
+// source of trust for the files, whichever mirror serves them.
+type metalinkDoc struct {
+	XMLName xml.Name       `xml:"urn:ietf:params:xml:ns:metalink metalink"`
+	Files   []metalinkFile `xml:"file"`
+}
+
+type metalinkFile struct {
+	Name string        `xml:"name,attr"`
+	URLs []metalinkURL `xml:"url"`
+}
+
+type metalinkURL struct {
+	Priority int    `xml:"priority,attr"`
+	URL      string `xml:",chardata"`
+}
+
+// fetchMetalink fetches the metalink at docURL and then SHA256SUMS from the
+// URLs it lists for that name, in priority order, failing over between them.
+// Files the metalink lists get their URLs as Locations; any other file in
+// SHA256SUMS is fetched relative to the directory that served SHA256SUMS, then
+// the directories of the other SHA256SUMS URLs.
+func fetchMetalink(ctx context.Context, httpClient *http.Client, docURL string, verify bool, rs retrySettings) (*Manifest, error) {
+	content, err := fetchDocument(ctx, fileurl.ClientFor(httpClient, docURL), docURL, "metalink", rs)
+	if err != nil {
+		return nil, err
+	}
+	files, err := parseMetalink(docURL, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metalink: %w", err)
+	}
+
+	sums := files["SHA256SUMS"]
+	if len(sums) == 0 {
+		return nil, fmt.Errorf("metalink lists no SHA256SUMS")
+	}
+	var errs []error
+	for i, sumsURL := range sums {
+		m, err := fetchFrom(ctx, httpClient, sumsURL, verify, rs)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", sumsURL, err))
+			if i+1 < len(sums) && rs.failover != nil {
+				rs.failover(sumsURL, err)
+			}
+			continue
+		}
+		m.URL = directoryOf(sumsURL)
+		for j, other := range sums {
+			if j != i {
+				m.Mirrors = append(m.Mirrors, directoryOf(other))
+			}
+		}
+		for name := range m.Files {
+			if urls := files[name]; len(urls) > 0 {
+				if m.Locations == nil {
+					m.Locations = make(map[string][]string)
+				}
+				m.Locations[name] = urls
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("all %d SHA256SUMS mirrors failed: %w", len(sums), errors.Join(errs...))
+}
+
+// parseMetalink maps each file name in a Metalink 4.0 document to its URLs,
+// most preferred first. Relative URLs are resolved against docURL. Only
+// http(s) URLs are kept, plus file:// URLs when the document itself was read
+// from the local filesystem; a remote metalink cannot point updex at local
+// files. Other schemes (ftp, rsync, torrents) are skipped.
+func parseMetalink(docURL string, content []byte) (map[string][]string, error) {
+	base, err := url.Parse(docURL)
+	if err != nil {
+		return nil, err
+	}
+	var doc metalinkDoc
+	if err := xml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]string)
+	for _, f := range doc.Files {
+		// File names in a metalink may carry directories; SHA256SUMS entries
+		// are bare names, so only the base name can match one.
+		name := path.Base(f.Name)
+		if name == "." || name == "/" || name == ".." {
+			continue
+		}
+		urls := slices.Clone(f.URLs)
+		// Lower priority values are preferred; an absent priority sorts last.
+		slices.SortStableFunc(urls, func(a, b metalinkURL) int {
+			return cmp.Compare(effectivePriority(a.Priority), effectivePriority(b.Priority))
+		})
+		for _, u := range urls {
+			resolved, err := base.Parse(strings.TrimSpace(u.URL))
+			if err != nil {
+				continue
+			}
+			switch resolved.Scheme {
+			case "http", "https":
+			case fileurl.Scheme:
+				if base.Scheme != fileurl.Scheme {
+					continue
+				}
+			default:
+				continue
+			}
+			files[name] = append(files[name], resolved.String())
+		}
+	}
+	return files, nil
+}
+
+// effectivePriority orders a metalink URL's priority attribute, treating an
+// absent (zero) priority as the least preferred.
+func effectivePriority(p int) int {
+	if p <= 0 {
+		return math.MaxInt
+	}
+	return p
+}
+
+// directoryOf returns rawURL without its last path element.
+func directoryOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Path = path.Dir(u.Path)
+	u.RawPath = ""
+	u.RawQuery = ""
+	return strings.TrimRight(u.String(), "/")
+}
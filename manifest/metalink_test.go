@@ -0,0 +1,170 @@
+package manifest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsMetalink(t *testing.T) {
+	tests := map[string]bool{
+		"https://example.com/ext/updex.meta4":       true,
+		"https://example.com/ext/UPDEX.META4?x=1":   true,
+		"file:///srv/mirror/ext.meta4":              true,
+		"https://example.com/ext":                   false,
+		"https://example.com/ext.meta4/SHA256SUMS":  false,
+		"https://example.com/ext/updex.metalink":    false,
+		"https://example.com/ext/releases.meta4.gz": false,
+	}
+	for location, want := range tests {
+		if got := IsMetalink(location); got != want {
+			t.Errorf("IsMetalink(%q) = %v, want %v", location, got, want)
+		}
+	}
+}
+
+// TestFetchFailsOverToMirror pins mirror failover for SHA256SUMS directories:
+// a primary that keeps failing is abandoned (and reported) in favour of the
+// next location, and the manifest records which one served it.
+func TestFetchFailsOverToMirror(t *testing.T) {
+	content, signature := signedManifest(t)
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	mirror, _ := signatureServer(t, content, func(w http.ResponseWriter, _ int32) {
+		_, _ = w.Write(signature)
+	})
+	const spare = "https://spare.example.com/ext"
+
+	var failed []string
+	m, err := Fetch(t.Context(), mirror.Client(), down.URL, true,
+		WithRetryConfig(2, time.Millisecond),
+		WithMirrors(mirror.URL, spare),
+		WithFailoverNotify(func(location string, _ error) { failed = append(failed, location) }),
+	)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if !m.Verified {
+		t.Error("manifest served by a mirror must still be signature-verified")
+	}
+	if m.URL != mirror.URL {
+		t.Errorf("URL = %q, want serving mirror %q", m.URL, mirror.URL)
+	}
+	if want := []string{down.URL, spare}; !slices.Equal(m.Mirrors, want) {
+		t.Errorf("Mirrors = %q, want %q", m.Mirrors, want)
+	}
+	if want := []string{down.URL}; !slices.Equal(failed, want) {
+		t.Errorf("failover notifications = %q, want %q", failed, want)
+	}
+	want := []string{mirror.URL + "/file.raw", down.URL + "/file.raw", spare + "/file.raw"}
+	if got := m.FileURLs("file.raw"); !slices.Equal(got, want) {
+		t.Errorf("FileURLs() = %q, want %q", got, want)
+	}
+}
+
+// TestFetchMirrorCannotVouchWithoutSignature pins that trust does not move
+// between mirrors: a mirror serving SHA256SUMS without a valid signature is
+// skipped, and when every mirror fails the error names each of them.
+func TestFetchMirrorCannotVouchWithoutSignature(t *testing.T) {
+	content, _ := signedManifest(t)
+	unsigned, _ := signatureServer(t, content, func(w http.ResponseWriter, _ int32) {
+		_, _ = w.Write([]byte("not a signature"))
+	})
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	_, err := Fetch(t.Context(), unsigned.Client(), unsigned.URL, true, WithRetryConfig(1, time.Millisecond), WithMirrors(missing.URL))
+	if err == nil {
+		t.Fatal("Fetch() error = nil, want every mirror to fail")
+	}
+	for _, want := range []string{"all 2 mirrors failed", unsigned.URL + ": signature verification failed", missing.URL + ": manifest fetch failed with status: 404"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Fetch() error = %q, want it to contain %q", err, want)
+		}
+	}
+}
+
+// TestFetchMetalink serves a metalink whose preferred SHA256SUMS mirror is
+// missing: Fetch must fail over to the next one by priority, take image URLs
+// from the metalink in priority order, and drop URLs it must not follow.
+func TestFetchMetalink(t *testing.T) {
+	content := []byte(validManifestContent())
+	var mirrorURL string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/good/SHA256SUMS", func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write(content) })
+	mux.HandleFunc("/updex.meta4", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="SHA256SUMS">
+    <url>` + mirrorURL + `/good/SHA256SUMS</url>
+    <url priority="1">/gone/SHA256SUMS</url>
+  </file>
+  <file name="file.raw">
+    <hash type="sha-256">ignored</hash>
+    <url priority="2">https://b.example.com/file.raw</url>
+    <url priority="1">https://a.example.com/file.raw</url>
+    <url priority="1">ftp://a.example.com/file.raw</url>
+    <url priority="1">file:///etc/shadow</url>
+  </file>
+</metalink>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mirrorURL = server.URL
+
+	m, err := Fetch(t.Context(), server.Client(), server.URL+"/updex.meta4", false, WithRetryConfig(1, time.Millisecond))
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if m.URL != server.URL+"/good" {
+		t.Errorf("URL = %q, want the directory of the serving SHA256SUMS", m.URL)
+	}
+	if want := []string{server.URL + "/gone"}; !slices.Equal(m.Mirrors, want) {
+		t.Errorf("Mirrors = %q, want %q", m.Mirrors, want)
+	}
+	if m.Files["file.raw"] != testManifestHash() {
+		t.Errorf("Files = %v, want the SHA256SUMS hash, not the metalink's", m.Files)
+	}
+	want := []string{"https://a.example.com/file.raw", "https://b.example.com/file.raw"}
+	if got := m.FileURLs("file.raw"); !slices.Equal(got, want) {
+		t.Errorf("FileURLs() = %q, want %q", got, want)
+	}
+}
+
+func TestFetchMetalinkFromFileURL(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "SHA256SUMS"), []byte(validManifestContent()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	doc := `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="SHA256SUMS"><url>SHA256SUMS</url></file></metalink>`
+	if err := os.WriteFile(filepath.Join(dir, "ext.meta4"), []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Fetch(t.Context(), nil, "file://"+filepath.Join(dir, "ext.meta4"), false)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if got, want := m.FileURL("file.raw"), "file://"+filepath.Join(dir, "file.raw"); got != want {
+		t.Errorf("FileURL() = %q, want %q", got, want)
+	}
+}
+
+func TestFetchMetalinkWithoutSHA256SUMS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="file.raw"><url>https://a.example.com/file.raw</url></file></metalink>`))
+	}))
+	defer server.Close()
+
+	_, err := Fetch(t.Context(), server.Client(), server.URL+"/updex.meta4", false, WithRetryConfig(1, time.Millisecond))
+	if err == nil || !strings.Contains(err.Error(), "lists no SHA256SUMS") {
+		t.Fatalf("Fetch() error = %v, want missing SHA256SUMS error", err)
+	}
+}
@@ -0,0 +1,110 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// rolloutName is the phased-rollout sidecar published beside SHA256SUMS.
+// Each line is "<percent>  <filename>": SHA256SUMS with the percentage of
+// hosts the file is rolled out to, 0 to 100, in place of the hash. When
+// verification is on it must be signed by ROLLOUT.gpg, as SHA256SUMS is by
+// SHA256SUMS.gpg.
+const rolloutName = "ROLLOUT"
+
+// fetchRollout downloads and parses the ROLLOUT sidecar at rolloutURL,
+// verifying its detached signature when verify is set. A source that
+// publishes none phases nothing: the result is nil without an error.
+func fetchRollout(ctx context.Context, httpClient *http.Client, rolloutURL string, verify bool, rs retrySettings) (map[string]int, error) {
+	content, err := fetchDocument(ctx, httpClient, rolloutURL, "rollout", rs)
+	if se := (*statusError)(nil); errors.As(err, &se) && se.code == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The percentages decide what a host installs, so they are trusted no
+	// more than the manifest: an unsigned sidecar fails the fetch rather
+	// than being ignored.
+	if verify {
+		if _, err := verifySignature(ctx, httpClient, rolloutURL+".gpg", content, rs); err != nil {
+			return nil, fmt.Errorf("rollout signature verification failed: %w", err)
+		}
+	}
+
+	rollout, err := parseRollout(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rollout: %w", err)
+	}
+	return rollout, nil
+}
+
+// parseRollout parses ROLLOUT content. Unlike parseManifest it rejects
+// malformed lines: skipping one would roll its file out to every host.
+func parseRollout(content []byte) (map[string]int, error) {
+	rollout := make(map[string]int)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: want \"<percent>  <filename>\"", n)
+		}
+		percent, err := strconv.Atoi(strings.TrimSuffix(parts[0], "%"))
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("line %d: invalid percentage %q", n, parts[0])
+		}
+		rollout[strings.TrimPrefix(parts[1], "*")] = percent
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rollout, nil
+}
+
+// RolloutPercent returns the percentage of hosts filename is rolled out to:
+// its ROLLOUT entry, or 100 when the sidecar does not list it.
+func (m *Manifest) RolloutPercent(filename string) int {
+	if percent, ok := m.Rollout[filename]; ok {
+		return percent
+	}
+	return 100
+}
+
+// RolloutCovers reports whether the host identified by machineID is among
+// those filename is rolled out to. A host's bucket, 0 to 99, is derived
+// from machineID and filename, so it stays the same across runs but is
+// drawn afresh for every release; the file is accepted once its percentage
+// exceeds the bucket. A host without a machine ID has no bucket and only
+// accepts files rolled out to everyone.
+func (m *Manifest) RolloutCovers(machineID, filename string) bool {
+	percent := m.RolloutPercent(filename)
+	if percent >= 100 {
+		return true
+	}
+	if machineID == "" {
+		return false
+	}
+	return rolloutBucket(machineID, filename) < percent
+}
+
+// rolloutBucket hashes machineID and filename into one of 100 buckets.
+func rolloutBucket(machineID, filename string) int {
+	sum := sha256.Sum256([]byte(machineID + "\x00" + filename))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
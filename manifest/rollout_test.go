@@ -0,0 +1,226 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+func TestParseRollout(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]int
+		wantErr string
+	}{
+		{
+			name:    "entries and comments",
+			content: "# staged\n10  ext_1.1.0.raw\n\n100%  *ext_1.0.0.raw\n",
+			want:    map[string]int{"ext_1.1.0.raw": 10, "ext_1.0.0.raw": 100},
+		},
+		{name: "over 100", content: "101  ext_1.1.0.raw\n", wantErr: "line 1: invalid percentage"},
+		{name: "negative", content: "-1  ext_1.1.0.raw\n", wantErr: "invalid percentage"},
+		{name: "missing filename", content: "# c\n50\n", wantErr: "line 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRollout([]byte(tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseRollout() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRollout() error = %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseRollout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchWithRollout(t *testing.T) {
+	hash := strings.Repeat("a", 64)
+	sums := fmt.Sprintf("%s  ext_1.0.0.raw\n%s  ext_1.1.0.raw\n", hash, hash)
+
+	tests := []struct {
+		name       string
+		rollout    int // status the sidecar is served with
+		wantErr    bool
+		wantPhased bool
+	}{
+		{name: "published", rollout: http.StatusOK, wantPhased: true},
+		{name: "not published", rollout: http.StatusNotFound},
+		{name: "forbidden", rollout: http.StatusForbidden, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/SHA256SUMS":
+					_, _ = w.Write([]byte(sums))
+				case "/ROLLOUT":
+					w.WriteHeader(tt.rollout)
+					_, _ = w.Write([]byte("25  ext_1.1.0.raw\n"))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			m, err := Fetch(t.Context(), server.Client(), server.URL, false, WithRollout(), WithRetryConfig(1, time.Millisecond))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Fetch() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+			if !m.RolloutChecked {
+				t.Error("RolloutChecked = false, want true")
+			}
+			wantPercent := 100
+			if tt.wantPhased {
+				wantPercent = 25
+			}
+			if got := m.RolloutPercent("ext_1.1.0.raw"); got != wantPercent {
+				t.Errorf("RolloutPercent(ext_1.1.0.raw) = %d, want %d", got, wantPercent)
+			}
+			if got := m.RolloutPercent("ext_1.0.0.raw"); got != 100 {
+				t.Errorf("RolloutPercent(ext_1.0.0.raw) = %d, want 100", got)
+			}
+		})
+	}
+}
+
+// TestFetchVerifiesRollout verifies that a verified fetch also checks the
+// sidecar's signature: a sidecar that is unsigned, or signed over other
+// content, fails the fetch instead of being ignored.
+func TestFetchVerifiesRollout(t *testing.T) {
+	entity := newTestEntity(t)
+	setTestKeyringPaths(t, writeTestKeyring(t, entity, true))
+	sign := func(content []byte) []byte {
+		var sig bytes.Buffer
+		if err := openpgp.DetachSign(&sig, entity, bytes.NewReader(content), nil); err != nil {
+			t.Fatalf("DetachSign() error = %v", err)
+		}
+		return sig.Bytes()
+	}
+	sums := []byte(validManifestContent())
+	rollout := []byte("25  ext_1.1.0.raw\n")
+
+	tests := []struct {
+		name    string
+		sig     []byte // served as ROLLOUT.gpg; nil for 404
+		wantErr bool
+	}{
+		{name: "signed", sig: sign(rollout)},
+		{name: "unsigned", wantErr: true},
+		{name: "signed over other content", sig: sign([]byte("100  ext_1.1.0.raw\n")), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string][]byte{
+				"/SHA256SUMS":     sums,
+				"/SHA256SUMS.gpg": sign(sums),
+				"/ROLLOUT":        rollout,
+			}
+			if tt.sig != nil {
+				files["/ROLLOUT.gpg"] = tt.sig
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				content, ok := files[r.URL.Path]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				_, _ = w.Write(content)
+			}))
+			defer server.Close()
+
+			m, err := Fetch(t.Context(), server.Client(), server.URL, true, WithRollout(), WithRetryConfig(1, time.Millisecond))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "rollout signature verification failed") {
+					t.Fatalf("Fetch() error = %v, want a rollout signature failure", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+			if got := m.RolloutPercent("ext_1.1.0.raw"); got != 25 {
+				t.Errorf("RolloutPercent(ext_1.1.0.raw) = %d, want 25", got)
+			}
+		})
+	}
+}
+
+func TestFetchWithoutRolloutSkipsSidecar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/SHA256SUMS" {
+			t.Errorf("unexpected request for %s", r.URL.Path)
+		}
+		_, _ = fmt.Fprintf(w, "%s  ext_1.0.0.raw\n", strings.Repeat("a", 64))
+	}))
+	defer server.Close()
+
+	m, err := Fetch(t.Context(), server.Client(), server.URL, false)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if m.RolloutChecked || m.Rollout != nil {
+		t.Errorf("Fetch() without WithRollout read the sidecar: %+v", m)
+	}
+}
+
+func TestRolloutCovers(t *testing.T) {
+	const file = "ext_1.1.0.raw"
+	m := &Manifest{Rollout: map[string]int{file: 50}}
+
+	// Buckets are spread over 0-99: across many hosts, about half are in
+	// a 50% rollout, and each host's answer never changes.
+	covered := 0
+	for i := range 1000 {
+		id := fmt.Sprintf("%032x", i)
+		got := m.RolloutCovers(id, file)
+		if got != m.RolloutCovers(id, file) {
+			t.Fatalf("RolloutCovers(%s) is not stable", id)
+		}
+		if got != (rolloutBucket(id, file) < 50) {
+			t.Fatalf("RolloutCovers(%s) = %v, disagrees with bucket %d", id, got, rolloutBucket(id, file))
+		}
+		if got {
+			covered++
+		}
+	}
+	if covered < 400 || covered > 600 {
+		t.Errorf("%d of 1000 hosts covered by a 50%% rollout, want about 500", covered)
+	}
+
+	if m.RolloutCovers("", file) {
+		t.Error("a host without a machine ID is covered by a partial rollout")
+	}
+	if !m.RolloutCovers("", "ext_1.0.0.raw") {
+		t.Error("a file the sidecar does not list is not covered")
+	}
+	m.Rollout[file] = 0
+	for i := range 100 {
+		if m.RolloutCovers(fmt.Sprintf("%032x", i), file) {
+			t.Fatal("a 0% rollout covers a host")
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// maxTokenSize bounds a token endpoint response.
+const maxTokenSize = 1 << 20
+
+// NewClient returns a client that behaves like httpClient but answers the
+// anonymous bearer-token challenge most registries (ghcr.io, quay.io,
+// Docker Hub) send even for public pulls: on a 401 carrying
+// `WWW-Authenticate: Bearer realm=...`, it fetches a token from the realm
+// and replays the request once with it. Tokens are cached per registry host.
+// Credentials are not supported. httpClient is never modified, and a client
+// already returned by NewClient is returned as is.
+func NewClient(httpClient *http.Client) *http.Client {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	if _, ok := httpClient.Transport.(*authTransport); ok {
+		return httpClient
+	}
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client := *httpClient
+	client.Transport = &authTransport{base: base, tokens: make(map[string]string)}
+	return &client
+}
+
+// authTransport implements the bearer-token handshake of the distribution
+// spec's token authentication.
+type authTransport struct {
+	base http.RoundTripper
+
+	mu     sync.Mutex
+	tokens map[string]string // host -> token
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if token := t.token(host); token != "" && req.Header.Get("Authorization") == "" {
+		req = withToken(req, token)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || req.Method != http.MethodGet {
+		return resp, err
+	}
+	challenge, ok := parseBearerChallenge(resp.Header.Get("WWW-Authenticate"))
+	if !ok {
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+
+	token, err := t.fetchToken(req, challenge)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.tokens[host] = token
+	t.mu.Unlock()
+	return t.base.RoundTrip(withToken(req, token))
+}
+
+func (t *authTransport) token(host string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tokens[host]
+}
+
+func withToken(req *http.Request, token string) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// fetchToken requests an anonymous token for challenge from its realm.
+func (t *authTransport) fetchToken(orig *http.Request, challenge map[string]string) (string, error) {
+	realm, err := url.Parse(challenge["realm"])
+	if err != nil || (realm.Scheme != "https" && realm.Scheme != "http") {
+		return "", fmt.Errorf("registry sent an invalid token realm %q", challenge["realm"])
+	}
+	q := realm.Query()
+	if s := challenge["service"]; s != "" {
+		q.Set("service", s)
+	}
+	if s := challenge["scope"]; s != "" {
+		q.Set("scope", s)
+	}
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(orig.Context(), http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch registry token: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token request failed with status: %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTokenSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read registry token: %w", err)
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return "", fmt.Errorf("failed to parse registry token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("registry token response carried no token")
+}
+
+// parseBearerChallenge parses `Bearer realm="...",service="...",scope="..."`.
+// It reports false for any other scheme or a challenge without a realm.
+func parseBearerChallenge(header string) (map[string]string, bool) {
+	scheme, rest, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, ok = strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(key), ",")))
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return nil, false
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		params[key] = strings.TrimSpace(value)
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	if params["realm"] == "" {
+		return nil, false
+	}
+	return params, true
+}
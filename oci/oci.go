@@ -0,0 +1,326 @@
+// Package oci resolves sysext images published to an OCI distribution
+// registry (for example with `oras push`). A repository's tags list and the
+// image manifest behind each tag stand in for a SHA256SUMS file: every layer
+// carrying an org.opencontainers.image.title annotation becomes a manifest
+// entry whose name is that title and whose hash is the layer's sha256
+// digest, downloadable from the registry's blob endpoint.
+package oci
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/frostyard/updex/internal/retry"
+	"github.com/frostyard/updex/manifest"
+)
+
+// Media types and annotations read from image manifests.
+const (
+	MediaTypeImageManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	AnnotationTitle         = "org.opencontainers.image.title"
+)
+
+// maxDocumentSize bounds a tags list page or an image manifest.
+const maxDocumentSize = 4 << 20
+
+// maxTagPages bounds how many Link-paginated tags list pages Fetch follows.
+const maxTagPages = 100
+
+// ErrNotFound reports a 404 from the registry.
+var ErrNotFound = errors.New("not found")
+
+// Reference is a parsed oci Source.Path: the registry's base URL and the
+// repository name below it.
+type Reference struct {
+	BaseURL    string // scheme://host[:port]
+	Repository string // e.g. "frostyard/sysexts/docker"
+}
+
+// ParseReference parses an oci Source.Path. "oci://host/repo" and a bare
+// "host/repo" use HTTPS; an explicit "https://" or "http://" prefix is kept,
+// the latter for local registries. Tags and digests are not allowed: versions
+// come from the tags list.
+func ParseReference(path string) (Reference, error) {
+	scheme := "https"
+	rest := path
+	if i := strings.Index(path, "://"); i >= 0 {
+		switch s := strings.ToLower(path[:i]); s {
+		case "oci":
+		case "http", "https":
+			scheme = s
+		default:
+			return Reference{}, fmt.Errorf("unsupported oci reference scheme %q", s)
+		}
+		rest = path[i+3:]
+	}
+	rest = strings.Trim(rest, "/")
+	host, repo, ok := strings.Cut(rest, "/")
+	if !ok || host == "" || repo == "" {
+		return Reference{}, fmt.Errorf("oci reference %q must be <registry>/<repository>", path)
+	}
+	if strings.ContainsAny(repo, "@:") {
+		return Reference{}, fmt.Errorf("oci reference %q must not include a tag or digest", path)
+	}
+	return Reference{BaseURL: scheme + "://" + host, Repository: repo}, nil
+}
+
+// String returns the reference's repository URL.
+func (r Reference) String() string {
+	return r.BaseURL + "/v2/" + r.Repository
+}
+
+// TagsURL returns the distribution API tags list endpoint.
+func (r Reference) TagsURL() string {
+	return r.String() + "/tags/list"
+}
+
+// ManifestURL returns the distribution API manifest endpoint for tag.
+func (r Reference) ManifestURL(tag string) string {
+	return r.String() + "/manifests/" + url.PathEscape(tag)
+}
+
+// BlobURL returns the distribution API blob endpoint for digest.
+func (r Reference) BlobURL(digest string) string {
+	return r.String() + "/blobs/" + digest
+}
+
+type retrySettings struct {
+	cfg    retry.Config
+	notify retry.Notify
+}
+
+// Option configures registry fetch behavior.
+type Option func(*retrySettings)
+
+// WithRetryConfig configures bounded retry attempts and base backoff delay.
+func WithRetryConfig(maxAttempts int, baseDelay time.Duration) Option {
+	return func(settings *retrySettings) {
+		settings.cfg = retry.Config{
+			MaxAttempts: maxAttempts,
+			BaseDelay:   baseDelay,
+		}
+	}
+}
+
+// WithRetryNotify configures a callback called before retry backoff sleeps.
+func WithRetryNotify(fn func(attempt, maxAttempts int, reason error)) Option {
+	return func(settings *retrySettings) {
+		settings.notify = retry.Notify(fn)
+	}
+}
+
+func resolveRetry(opts ...Option) retrySettings {
+	settings := retrySettings{cfg: retry.DefaultConfig}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	return settings
+}
+
+type tagList struct {
+	Tags []string `json:"tags"`
+}
+
+type imageManifest struct {
+	MediaType string       `json:"mediaType"`
+	Layers    []descriptor `json:"layers"`
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// Fetch lists the tags of the repository named by path (see ParseReference),
+// reads the image manifest behind each, and returns them as a
+// manifest.Manifest: Files maps every titled layer to the hex sha256 of its
+// digest and Locations maps it to its blob URL. Layers without a title
+// annotation, non-sha256 digests, and image indexes are skipped; a tag that
+// disappears between listing and reading is ignored. The same title under
+// two different digests is an error rather than a silent choice. The result
+// is never Verified — registries publish no detached signature — so callers
+// must not use it for a transfer that requires GPG verification.
+//
+// httpClient is wrapped with NewClient so anonymous bearer-token challenges
+// are answered; if nil, a default client with a 30-second timeout is used.
+// Every request retries transient failures like manifest.Fetch.
+func Fetch(ctx context.Context, httpClient *http.Client, path string, opts ...Option) (*manifest.Manifest, error) {
+	ref, err := ParseReference(path)
+	if err != nil {
+		return nil, err
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	client := NewClient(httpClient)
+	rs := resolveRetry(opts...)
+
+	tags, err := listTags(ctx, client, ref, rs)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &manifest.Manifest{
+		URL:       ref.String(),
+		Files:     make(map[string]string),
+		Locations: make(map[string][]string),
+	}
+	tagOf := make(map[string]string)
+	for _, tag := range tags {
+		var im imageManifest
+		err := getJSON(ctx, client, ref.ManifestURL(tag), MediaTypeImageManifest+", "+MediaTypeDockerManifest, rs, &im)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch manifest for tag %s: %w", tag, err)
+		}
+		if im.MediaType != "" && im.MediaType != MediaTypeImageManifest && im.MediaType != MediaTypeDockerManifest {
+			continue
+		}
+		for _, layer := range im.Layers {
+			name := layer.Annotations[AnnotationTitle]
+			hash, ok := sha256Hex(layer.Digest)
+			if name == "" || !ok {
+				continue
+			}
+			if prev, seen := m.Files[name]; seen {
+				if prev != hash {
+					return nil, fmt.Errorf("%s has different digests in tags %s and %s", name, tagOf[name], tag)
+				}
+				continue
+			}
+			m.Files[name] = hash
+			m.Locations[name] = []string{ref.BlobURL(layer.Digest)}
+			tagOf[name] = tag
+		}
+	}
+	return m, nil
+}
+
+// sha256Hex returns the hex part of a "sha256:<64 hex>" digest.
+func sha256Hex(digest string) (string, bool) {
+	algo, hexPart, ok := strings.Cut(digest, ":")
+	if !ok || algo != "sha256" || len(hexPart) != 64 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hexPart); err != nil {
+		return "", false
+	}
+	return strings.ToLower(hexPart), true
+}
+
+// listTags returns the repository's tags in sorted order, following
+// Link-header pagination.
+func listTags(ctx context.Context, client *http.Client, ref Reference, rs retrySettings) ([]string, error) {
+	var tags []string
+	next := ref.TagsURL()
+	for page := 0; next != ""; page++ {
+		if page == maxTagPages {
+			return nil, fmt.Errorf("tags list for %s exceeds %d pages", ref, maxTagPages)
+		}
+		var list tagList
+		link, err := getJSONLink(ctx, client, next, "application/json", rs, &list)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		tags = append(tags, list.Tags...)
+		next, err = resolveLink(next, link)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tags list link: %w", err)
+		}
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags), nil
+}
+
+// resolveLink resolves a (usually path-only) Link target against the URL of
+// the page that returned it. An empty link yields "".
+func resolveLink(page, link string) (string, error) {
+	if link == "" {
+		return "", nil
+	}
+	base, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+	target, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(target).String(), nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, rawURL, accept string, rs retrySettings, v any) error {
+	_, err := getJSONLink(ctx, client, rawURL, accept, rs, v)
+	return err
+}
+
+// getJSONLink GETs rawURL under the retry policy, decodes the body into v,
+// and returns the target of a rel="next" Link header, if any.
+func getJSONLink(ctx context.Context, client *http.Client, rawURL, accept string, rs retrySettings, v any) (string, error) {
+	var link string
+	err := retry.Do(ctx, rs.cfg, rs.notify, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Accept", accept)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return retry.TransientIfNetwork(fmt.Errorf("registry request failed: %w", err))
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+			return retry.Transient(fmt.Errorf("registry request failed with status: %s", resp.Status))
+		case resp.StatusCode == http.StatusNotFound:
+			return fmt.Errorf("%s: %w", rawURL, ErrNotFound)
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("registry request failed with status: %s", resp.Status)
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize+1))
+		if err != nil {
+			return retry.TransientIfNetwork(fmt.Errorf("failed to read registry response: %w", err))
+		}
+		if len(body) > maxDocumentSize {
+			return fmt.Errorf("registry response exceeds maximum allowed size (%d bytes)", maxDocumentSize)
+		}
+		if err := json.Unmarshal(body, v); err != nil {
+			return fmt.Errorf("failed to parse registry response: %w", err)
+		}
+		link = nextLink(resp.Header.Get("Link"))
+		return nil
+	})
+	return link, err
+}
+
+// nextLink extracts the URL of a `<url>; rel="next"` Link header value.
+func nextLink(header string) string {
+	for part := range strings.SplitSeq(header, ",") {
+		target, params, ok := strings.Cut(part, ";")
+		if !ok || !strings.Contains(strings.ReplaceAll(params, " ", ""), `rel="next"`) {
+			continue
+		}
+		target = strings.TrimSpace(target)
+		if strings.HasPrefix(target, "<") && strings.HasSuffix(target, ">") {
+			return target[1 : len(target)-1]
+		}
+	}
+	return ""
+}
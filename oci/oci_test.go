@@ -0,0 +1,216 @@
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/frostyard/updex/internal/testutil"
+)
+
+func sha(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantBase string
+		wantRepo string
+		wantErr  bool
+	}{
+		{in: "ghcr.io/frostyard/sysexts/docker", wantBase: "https://ghcr.io", wantRepo: "frostyard/sysexts/docker"},
+		{in: "oci://ghcr.io/frostyard/docker", wantBase: "https://ghcr.io", wantRepo: "frostyard/docker"},
+		{in: "http://127.0.0.1:5000/docker/", wantBase: "http://127.0.0.1:5000", wantRepo: "docker"},
+		{in: "ghcr.io", wantErr: true},
+		{in: "ghcr.io/frostyard/docker:1.0", wantErr: true},
+		{in: "ghcr.io/frostyard/docker@sha256:abc", wantErr: true},
+		{in: "ftp://ghcr.io/frostyard/docker", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := ParseReference(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseReference(%q) = %+v, want error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseReference(%q) error = %v", tc.in, err)
+			continue
+		}
+		if got.BaseURL != tc.wantBase || got.Repository != tc.wantRepo {
+			t.Errorf("ParseReference(%q) = %+v, want %s %s", tc.in, got, tc.wantBase, tc.wantRepo)
+		}
+	}
+}
+
+func TestFetchMapsTitledLayers(t *testing.T) {
+	v1 := []byte("docker 1.0 image")
+	v2 := []byte("docker 2.0 image")
+	server := testutil.NewTestRegistry(t, testutil.TestRegistry{
+		Repository: "sysexts/docker",
+		Images: []testutil.TestRegistryImage{
+			{Tag: "1.0", Title: "docker_1.0.raw", Content: v1},
+			{Tag: "2.0", Title: "docker_2.0.raw.zst", Content: v2},
+			{Tag: "latest", Title: "docker_2.0.raw.zst", Content: v2},
+			{Tag: "untitled", Content: []byte("no title")},
+		},
+	})
+	defer server.Close()
+
+	m, err := Fetch(t.Context(), server.Client(), server.URL+"/sysexts/docker")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if len(m.Files) != 2 {
+		t.Fatalf("Files = %v, want 2 titled entries", m.Files)
+	}
+	if m.Files["docker_1.0.raw"] != sha(v1) || m.Files["docker_2.0.raw.zst"] != sha(v2) {
+		t.Errorf("Files = %v, want layer digests", m.Files)
+	}
+	if m.Verified {
+		t.Error("OCI manifests must never report Verified")
+	}
+
+	loc := m.FileURL("docker_2.0.raw.zst")
+	if want := server.URL + "/v2/sysexts/docker/blobs/sha256:" + sha(v2); loc != want {
+		t.Errorf("FileURL() = %q, want %q", loc, want)
+	}
+	resp, err := server.Client().Get(loc)
+	if err != nil {
+		t.Fatalf("GET blob error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != string(v2) {
+		t.Errorf("blob body = %q, want %q", body, v2)
+	}
+}
+
+func TestFetchFollowsTagPagination(t *testing.T) {
+	var images []testutil.TestRegistryImage
+	for _, v := range []string{"1", "2", "3", "4", "5"} {
+		images = append(images, testutil.TestRegistryImage{Tag: v, Title: "ext_" + v + ".raw", Content: []byte(v)})
+	}
+	server := testutil.NewTestRegistry(t, testutil.TestRegistry{Repository: "ext", Images: images, PageSize: 2})
+	defer server.Close()
+
+	m, err := Fetch(t.Context(), server.Client(), server.URL+"/ext")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if len(m.Files) != 5 {
+		t.Errorf("Files = %v, want all 5 tags across pages", m.Files)
+	}
+}
+
+func TestFetchAnswersBearerChallenge(t *testing.T) {
+	content := []byte("private-looking public image")
+	server := testutil.NewTestRegistry(t, testutil.TestRegistry{
+		Repository:   "ext",
+		Images:       []testutil.TestRegistryImage{{Tag: "1.0", Title: "ext_1.0.raw", Content: content}},
+		RequireToken: true,
+	})
+	defer server.Close()
+
+	m, err := Fetch(t.Context(), server.Client(), server.URL+"/ext")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if m.Files["ext_1.0.raw"] != sha(content) {
+		t.Errorf("Files = %v", m.Files)
+	}
+
+	// The blob endpoint needs the token too; a NewClient client answers it.
+	resp, err := NewClient(server.Client()).Get(m.FileURL("ext_1.0.raw"))
+	if err != nil {
+		t.Fatalf("GET blob error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("blob status = %d, want 200", resp.StatusCode)
+	}
+}
+
+// TestFetchRejectsConflictingDigests pins the fail-closed rule: one file name
+// published under two digests is ambiguous, and Fetch refuses to pick one.
+func TestFetchRejectsConflictingDigests(t *testing.T) {
+	server := testutil.NewTestRegistry(t, testutil.TestRegistry{
+		Repository: "ext",
+		Images: []testutil.TestRegistryImage{
+			{Tag: "1.0", Title: "ext_1.0.raw", Content: []byte("original")},
+			{Tag: "1.0-rebuild", Title: "ext_1.0.raw", Content: []byte("rebuilt")},
+		},
+	})
+	defer server.Close()
+
+	_, err := Fetch(t.Context(), server.Client(), server.URL+"/ext")
+	if err == nil || !strings.Contains(err.Error(), "different digests") {
+		t.Fatalf("Fetch() error = %v, want conflicting digest error", err)
+	}
+}
+
+func TestFetchRetriesServerErrorThenSucceeds(t *testing.T) {
+	inner := testutil.NewTestRegistry(t, testutil.TestRegistry{
+		Repository: "ext",
+		Images:     []testutil.TestRegistryImage{{Tag: "1.0", Title: "ext_1.0.raw", Content: []byte("x")}},
+	})
+	defer inner.Close()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		resp, err := inner.Client().Get(inner.URL + r.URL.RequestURI())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	defer server.Close()
+
+	m, err := Fetch(t.Context(), server.Client(), server.URL+"/ext", WithRetryConfig(3, time.Millisecond))
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if len(m.Files) != 1 {
+		t.Errorf("Files = %v, want 1", m.Files)
+	}
+}
+
+func TestFetchMissingRepository(t *testing.T) {
+	server := testutil.NewTestRegistry(t, testutil.TestRegistry{Repository: "ext"})
+	defer server.Close()
+
+	if _, err := Fetch(t.Context(), server.Client(), server.URL+"/other", WithRetryConfig(1, time.Millisecond)); err == nil {
+		t.Fatal("Fetch() error = nil, want not-found error")
+	}
+}
+
+func TestParseBearerChallenge(t *testing.T) {
+	got, ok := parseBearerChallenge(`Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:a/b:pull"`)
+	if !ok {
+		t.Fatal("parseBearerChallenge() ok = false")
+	}
+	if got["realm"] != "https://ghcr.io/token" || got["service"] != "ghcr.io" || got["scope"] != "repository:a/b:pull" {
+		t.Errorf("parseBearerChallenge() = %v", got)
+	}
+	for _, header := range []string{`Basic realm="x"`, `Bearer service="x"`, ""} {
+		if _, ok := parseBearerChallenge(header); ok {
+			t.Errorf("parseBearerChallenge(%q) ok = true, want false", header)
+		}
+	}
+}
@@ -73,6 +73,38 @@ func TestLinkToSysextAt(t *testing.T) {
 			staged:     []string{"myext_1.9.0.raw", "myext_1.10.0.raw", "myext_1.2.0.raw"},
 			wantTarget: "myext_1.10.0.raw",
 		},
+		{
+			name:   "selects the pinned image over a newer one",
+			staged: []string{"myext_1.0.0.raw", "myext_2.0.0.raw"},
+			setup: func(t *testing.T, tr *config.Transfer, _, _ string) {
+				tr.Transfer.PinVersion = "1.0.0"
+			},
+			wantTarget: "myext_1.0.0.raw",
+		},
+		{
+			name:   "falls back to the newest image when the pinned one is not staged",
+			staged: []string{"myext_1.0.0.raw", "myext_2.0.0.raw"},
+			setup: func(t *testing.T, tr *config.Transfer, _, _ string) {
+				tr.Transfer.PinVersion = "1.5.0"
+			},
+			wantTarget: "myext_2.0.0.raw",
+		},
+		{
+			name:   "skips an image rolled back from",
+			staged: []string{"myext_1.0.0.raw", "myext_2.0.0.raw", "myext_3.0.0.raw"},
+			setup: func(t *testing.T, tr *config.Transfer, _, _ string) {
+				tr.Transfer.SkipVersions = []string{"3.0.0"}
+			},
+			wantTarget: "myext_2.0.0.raw",
+		},
+		{
+			name:   "skips images above MaxVersion",
+			staged: []string{"myext_1.0.0.raw", "myext_2.0.0.raw", "myext_3.0.0.raw"},
+			setup: func(t *testing.T, tr *config.Transfer, _, _ string) {
+				tr.Transfer.MaxVersion = "2.0.0"
+			},
+			wantTarget: "myext_2.0.0.raw",
+		},
 		{
 			name:   "creates the sysext directory when it does not exist yet",
 			staged: []string{"myext_1.0.0.raw"},
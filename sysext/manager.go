@@ -42,7 +42,9 @@ func GetInstalledVersions(t *config.Transfer) ([]string, string, error) {
 }
 
 // GetInstalledVersionsAt is GetInstalledVersions with an explicit fallback
-// directory for transfers that omit Target.Path.
+// directory for transfers that omit Target.Path, which also holds the
+// systemd-sysext link. The current version is the one that link points at,
+// which need not be the one it should (see PreferredVersion).
 func GetInstalledVersionsAt(t *config.Transfer, defaultDir string) ([]string, string, error) {
 	patterns, err := parseTargetPatterns(t)
 	if err != nil {
@@ -76,8 +78,8 @@ func GetInstalledVersionsAt(t *config.Transfer, defaultDir string) ([]string, st
 	for _, entry := range entries {
 		name := entry.Name()
 
-		// Skip symlinks when counting versions
-		if entry.Type()&os.ModeSymlink != 0 {
+		// Skip symlinks and entries of the wrong kind when counting versions
+		if !isInstanceEntry(t, entry) {
 			continue
 		}
 
@@ -86,15 +88,53 @@ func GetInstalledVersionsAt(t *config.Transfer, defaultDir string) ([]string, st
 		}
 	}
 
-	// If no current symlink, newest is current
+	// If no current symlink, the version the sysext link points at is
+	// current, and without a link the newest
 	if current == "" && len(versions) > 0 {
-		version.Sort(versions)
-		current = versions[0]
+		if v := linkedVersion(t, patterns, defaultDir); slices.Contains(versions, v) {
+			current = v
+		} else {
+			version.Sort(versions)
+			current = versions[0]
+		}
 	}
 
 	return versions, current, nil
 }
 
+// linkedVersion returns the version of the image the systemd-sysext link
+// for t in sysextDir resolves to, or "" when the link is absent or
+// dangling.
+func linkedVersion(t *config.Transfer, patterns []*version.Pattern, sysextDir string) string {
+	linkName := SysextLinkName(t)
+	if linkName == "" {
+		return ""
+	}
+	linkPath := filepath.Join(sysextDir, linkName)
+	target, err := os.Readlink(linkPath)
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Stat(linkPath); err != nil {
+		return ""
+	}
+	v, _, _ := version.ExtractVersionParsed(filepath.Base(target), patterns)
+	return v
+}
+
+// PreferredVersion returns the version of installed the sysext link is
+// made to point at (see LinkToSysextAt): the pinned version when
+// installed, else the newest not rolled back from nor above MaxVersion.
+// It returns "" when installed is empty.
+func PreferredVersion(t *config.Transfer, installed []string) string {
+	if len(installed) == 0 {
+		return ""
+	}
+	versions := slices.Clone(installed)
+	version.Sort(versions)
+	return versions[preferredIndex(t, versions)]
+}
+
 // GetActiveVersion returns the version currently active in systemd-sysext.
 // It checks the legacy current symlink and the production merged-image
 // directory.
@@ -203,8 +243,8 @@ func planVacuum(t *config.Transfer, activeVersionOverride string, extraVersions
 	for _, entry := range entries {
 		name := entry.Name()
 
-		// Skip symlinks
-		if entry.Type()&os.ModeSymlink != 0 {
+		// Skip symlinks and entries of the wrong kind
+		if !isInstanceEntry(t, entry) {
 			continue
 		}
 
@@ -253,6 +293,7 @@ func planVacuum(t *config.Transfer, activeVersionOverride string, extraVersions
 		}
 	}
 
+	skipped := 0 // rolled-back versions seen so far, which take no slot
 	for i, vf := range installed {
 		v := vf.version
 		fullPath := filepath.Join(targetDir, vf.filename)
@@ -269,15 +310,32 @@ func planVacuum(t *config.Transfer, activeVersionOverride string, extraVersions
 			continue
 		}
 
-		// Keep up to InstancesMax versions
-		if i < instancesMax {
+		// Always keep the pinned version
+		if t.Transfer.PinVersion != "" && v == t.Transfer.PinVersion {
+			kept = append(kept, v)
+			continue
+		}
+
+		// Leave a version above MaxVersion alone, without taking a slot:
+		// it is only held back, and raising MaxVersion again links it.
+		if aboveMaxVersion(t, v) {
+			skipped++
+			kept = append(kept, v)
+			continue
+		}
+
+		// Keep up to InstancesMax versions. A version rolled back from is
+		// never linked again, so it does not take a slot.
+		if excluded(t, v) {
+			skipped++
+		} else if i-skipped < instancesMax {
 			kept = append(kept, v)
 			continue
 		}
 
 		// Remove old version
 		if remove {
-			if err := os.Remove(fullPath); err != nil {
+			if err := removeInstance(t, fullPath); err != nil {
 				return removed, kept, fmt.Errorf("failed to remove %s: %w", vf.filename, err)
 			}
 		}
@@ -345,13 +403,42 @@ func stripCompressionSuffix(name string) string {
 	return name
 }
 
+// isInstanceEntry reports whether a staging-directory entry can be an
+// installed version of t: a directory for directory targets (url-tar
+// transfers), anything but a directory otherwise. Symlinks never are — they
+// are the legacy CurrentSymlink or links managed elsewhere.
+func isInstanceEntry(t *config.Transfer, entry os.DirEntry) bool {
+	if entry.Type()&os.ModeSymlink != 0 {
+		return false
+	}
+	return entry.IsDir() == config.IsDirectoryTarget(t)
+}
+
+// removeInstance deletes one installed version of t. Directory instances are
+// removed recursively. Read-only marking is undone first, whatever
+// Target.ReadOnly says now: it may have been set when the instance was
+// installed.
+func removeInstance(t *config.Transfer, path string) error {
+	if err := ClearReadOnly(path); err != nil {
+		return err
+	}
+	if config.IsDirectoryTarget(t) {
+		return os.RemoveAll(path)
+	}
+	return os.Remove(path)
+}
+
 func installedVersionFilesAt(t *config.Transfer, defaultDir string) ([]versionFile, error) {
+	return versionFilesIn(t, targetDirAt(t, defaultDir))
+}
+
+// versionFilesIn lists the instances of t in dir, newest first.
+func versionFilesIn(t *config.Transfer, dir string) ([]versionFile, error) {
 	patterns, err := parseTargetPatterns(t)
 	if err != nil {
 		return nil, err
 	}
 
-	dir := targetDirAt(t, defaultDir)
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -362,7 +449,7 @@ func installedVersionFilesAt(t *config.Transfer, defaultDir string) ([]versionFi
 
 	var files []versionFile
 	for _, entry := range entries {
-		if entry.Type()&os.ModeSymlink != 0 {
+		if !isInstanceEntry(t, entry) {
 			continue
 		}
 		if v, _, ok := version.ExtractVersionParsed(entry.Name(), patterns); ok {
@@ -406,7 +493,8 @@ func RemoveLegacyCurrentSymlinkAt(t *config.Transfer, defaultDir string) error {
 }
 
 // LinkToSysextAt creates a symlink in sysextDir pointing to the newest
-// installed extension file in the staging directory (e.g., /var/lib/extensions.d/).
+// installed extension file in the staging directory (e.g., /var/lib/extensions.d/),
+// or to the transfer's PinVersion when that version is installed.
 // The explicit sysextDir allows multiple clients to target independent link
 // directories without touching the package-global SysextDir.
 func LinkToSysextAt(t *config.Transfer, sysextDir string) error {
@@ -423,7 +511,7 @@ func LinkToSysextAt(t *config.Transfer, sysextDir string) error {
 		return fmt.Errorf("no installed versions found for %s", t.Component)
 	}
 
-	actualTargetPath := filepath.Join(targetDirAt(t, sysextDir), files[0].filename)
+	actualTargetPath := filepath.Join(targetDirAt(t, sysextDir), linkedFile(t, files).filename)
 	destSymlink := filepath.Join(sysextDir, linkName)
 
 	// Ensure the sysext directory exists
@@ -463,7 +551,8 @@ func LinkToSysextAt(t *config.Transfer, sysextDir string) error {
 var renameLink = os.Rename
 
 // LinkTargetAt returns the path LinkToSysextAt links <sysextDir>/<link name>
-// to: the newest installed image for the transfer in its staging directory.
+// to: the pinned or else the newest installed image for the transfer in its
+// staging directory.
 // It errors when the transfer has no usable target pattern or no installed
 // image.
 func LinkTargetAt(t *config.Transfer, sysextDir string) (string, error) {
@@ -477,7 +566,48 @@ func LinkTargetAt(t *config.Transfer, sysextDir string) (string, error) {
 	if len(files) == 0 {
 		return "", fmt.Errorf("no installed versions found for %s", t.Component)
 	}
-	return filepath.Join(targetDirAt(t, sysextDir), files[0].filename), nil
+	return filepath.Join(targetDirAt(t, sysextDir), linkedFile(t, files).filename), nil
+}
+
+// linkedFile picks the image the sysext link points at from files, newest
+// first (see preferredIndex).
+func linkedFile(t *config.Transfer, files []versionFile) versionFile {
+	versions := make([]string, len(files))
+	for i, f := range files {
+		versions[i] = f.version
+	}
+	return files[preferredIndex(t, versions)]
+}
+
+// preferredIndex returns the index in versions, newest first, of the one
+// the transfer should run: its pinned version when installed, else the
+// newest not excluded, else the newest.
+func preferredIndex(t *config.Transfer, versions []string) int {
+	if pin := t.Transfer.PinVersion; pin != "" {
+		if i := slices.Index(versions, pin); i >= 0 {
+			return i
+		}
+	}
+	for i, v := range versions {
+		if !excluded(t, v) {
+			return i
+		}
+	}
+	return 0
+}
+
+// excluded reports whether the transfer must not run v: it was rolled back
+// from (Transfer.SkipVersions) or is above Transfer.MaxVersion.
+func excluded(t *config.Transfer, v string) bool {
+	if slices.Contains(t.Transfer.SkipVersions, v) {
+		return true
+	}
+	return aboveMaxVersion(t, v)
+}
+
+// aboveMaxVersion reports whether v is above Transfer.MaxVersion.
+func aboveMaxVersion(t *config.Transfer, v string) bool {
+	return t.Transfer.MaxVersion != "" && version.Compare(v, t.Transfer.MaxVersion) > 0
 }
 
 // LinkIsCurrentAt reports whether <sysextDir>/<link name> is a symlink that
@@ -550,6 +680,29 @@ func UnlinkFromSysext(t *config.Transfer) error {
 	return UnlinkFromSysextAt(t, SysextDir)
 }
 
+// RemoveVersionsAt removes the installed instances of t whose version is in
+// versions, with an explicit fallback directory for transfers that omit
+// Target.Path. Links are left alone. Returns the versions removed.
+func RemoveVersionsAt(t *config.Transfer, versions []string, defaultDir string) ([]string, error) {
+	files, err := installedVersionFilesAt(t, defaultDir)
+	if err != nil {
+		return nil, err
+	}
+
+	targetDir := targetDirAt(t, defaultDir)
+	var removed []string
+	for _, vf := range files {
+		if !slices.Contains(versions, vf.version) {
+			continue
+		}
+		if err := removeInstance(t, filepath.Join(targetDir, vf.filename)); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", vf.filename, err)
+		}
+		removed = append(removed, vf.version)
+	}
+	return removed, nil
+}
+
 // RemoveAllVersions removes all versions of a component from the target directory
 // and removes the current symlink if it exists. Returns the list of removed files.
 func RemoveAllVersions(t *config.Transfer) ([]string, error) {
@@ -599,12 +752,18 @@ func RemoveAllVersionsAt(t *config.Transfer, defaultDir string) ([]string, error
 		// Check if this file matches any of the patterns
 		if _, _, ok := version.ExtractVersionParsed(name, patterns); ok {
 			filePath := filepath.Join(targetDir, name)
-			if err := os.Remove(filePath); err != nil {
+			if err := removeInstance(t, filePath); err != nil {
 				return removed, fmt.Errorf("failed to remove %s: %w", filePath, err)
 			}
 			removed = append(removed, filePath)
 		}
 	}
 
+	// Staged images go too: nothing is left to apply for a removed
+	// component.
+	if err := DiscardStagedAt(t, defaultDir); err != nil {
+		return removed, err
+	}
+
 	return removed, nil
 }
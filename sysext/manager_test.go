@@ -204,6 +204,33 @@ func TestRemoveAllVersions(t *testing.T) {
 	}
 }
 
+func TestRemoveVersionsAt(t *testing.T) {
+	stagingDir := t.TempDir()
+	for _, name := range []string{"myext_1.0.0.raw", "myext_2.0.0.raw", "myext_3.0.0.raw"} {
+		if err := os.WriteFile(filepath.Join(stagingDir, name), []byte("test"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+	transfer := &config.Transfer{
+		Target: config.TargetSection{Path: stagingDir, MatchPattern: "myext_@v.raw"},
+	}
+
+	removed, err := RemoveVersionsAt(transfer, []string{"3.0.0", "2.0.0", "9.9.9"}, t.TempDir())
+	if err != nil {
+		t.Fatalf("RemoveVersionsAt() error = %v", err)
+	}
+	if want := []string{"3.0.0", "2.0.0"}; !slices.Equal(removed, want) {
+		t.Errorf("RemoveVersionsAt() removed = %v, want %v", removed, want)
+	}
+	installed, _, err := GetInstalledVersions(transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.0.0"}; !slices.Equal(installed, want) {
+		t.Errorf("installed after removal = %v, want %v", installed, want)
+	}
+}
+
 func TestRemoveAllVersionsAbsentDirectory(t *testing.T) {
 	transfer := &config.Transfer{
 		Target: config.TargetSection{
@@ -324,6 +351,62 @@ func TestVacuumWithDetails(t *testing.T) {
 	}
 }
 
+// TestVacuumWithDetailsDirectoryTarget covers url-tar transfers, whose
+// instances are directory trees: old trees are removed recursively, and a
+// stray regular file that happens to match the pattern is not an instance.
+func TestVacuumWithDetailsDirectoryTarget(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, v := range []string{"1.0.0", "2.0.0", "3.0.0"} {
+		dir := filepath.Join(tmpDir, "myext_"+v, "usr", "lib")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create test tree: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "payload"), []byte(v), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+	stray := filepath.Join(tmpDir, "myext_9.0.0")
+	if err := os.WriteFile(stray, []byte("not an instance"), 0644); err != nil {
+		t.Fatalf("failed to create stray file: %v", err)
+	}
+
+	transfer := &config.Transfer{
+		Transfer: config.TransferSection{InstancesMax: 2},
+		Source:   config.SourceSection{Type: "url-tar"},
+		Target: config.TargetSection{
+			Type:         "directory",
+			Path:         tmpDir,
+			MatchPattern: "myext_@v",
+		},
+	}
+
+	versions, current, err := GetInstalledVersions(transfer)
+	if err != nil {
+		t.Fatalf("GetInstalledVersions() error = %v", err)
+	}
+	if len(versions) != 3 || current != "3.0.0" {
+		t.Errorf("GetInstalledVersions() = %v, %q; want 3 directory versions, current 3.0.0", versions, current)
+	}
+
+	removed, kept, err := VacuumWithDetails(transfer)
+	if err != nil {
+		t.Fatalf("VacuumWithDetails() error = %v", err)
+	}
+	if !slices.Equal(removed, []string{"1.0.0"}) {
+		t.Errorf("removed = %v, want [1.0.0]", removed)
+	}
+	if !slices.Equal(kept, []string{"3.0.0", "2.0.0"}) {
+		t.Errorf("kept = %v, want [3.0.0 2.0.0]", kept)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "myext_1.0.0")); !os.IsNotExist(err) {
+		t.Error("expected myext_1.0.0 tree to be deleted")
+	}
+	if _, err := os.Stat(stray); err != nil {
+		t.Errorf("stray regular file should be left alone: %v", err)
+	}
+}
+
 func TestSysextLinkName(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -781,6 +864,160 @@ func TestVacuumWithDetailsProtectedVersion(t *testing.T) {
 	}
 }
 
+func TestVacuumWithDetailsPinnedVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, f := range []string{"myext_1.0.0.raw", "myext_2.0.0.raw", "myext_3.0.0.raw"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, f), []byte("test"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	transfer := &config.Transfer{
+		Transfer: config.TransferSection{
+			InstancesMax: 1,
+			PinVersion:   "1.0.0",
+		},
+		Target: config.TargetSection{
+			Path:         tmpDir,
+			MatchPattern: "myext_@v.raw",
+		},
+	}
+
+	removed, kept, err := VacuumWithDetails(transfer)
+	if err != nil {
+		t.Fatalf("VacuumWithDetails() error = %v", err)
+	}
+	if !slices.Contains(kept, "1.0.0") {
+		t.Errorf("pinned version 1.0.0 should be kept, kept = %v", kept)
+	}
+	if !slices.Equal(removed, []string{"2.0.0"}) {
+		t.Errorf("removed = %v, want [2.0.0]", removed)
+	}
+
+	// The pinned version is preferred even though a newer one was staged.
+	installed, _, err := GetInstalledVersions(transfer)
+	if err != nil {
+		t.Fatalf("GetInstalledVersions() error = %v", err)
+	}
+	if preferred := PreferredVersion(transfer, append(installed, "2.0.0")); preferred != "1.0.0" {
+		t.Errorf("PreferredVersion() = %q, want the pinned 1.0.0", preferred)
+	}
+}
+
+func TestVacuumWithDetailsSkippedVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, f := range []string{"myext_1.0.0.raw", "myext_2.0.0.raw", "myext_3.0.0.raw", "myext_4.0.0.raw"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, f), []byte("test"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	// 3.0.0 was rolled back from: it is removed and takes none of the
+	// two retention slots, which go to 4.0.0 and 2.0.0.
+	transfer := &config.Transfer{
+		Transfer: config.TransferSection{
+			InstancesMax: 2,
+			SkipVersions: []string{"3.0.0"},
+		},
+		Target: config.TargetSection{
+			Path:         tmpDir,
+			MatchPattern: "myext_@v.raw",
+		},
+	}
+
+	removed, kept, err := VacuumWithDetails(transfer)
+	if err != nil {
+		t.Fatalf("VacuumWithDetails() error = %v", err)
+	}
+	if !slices.Equal(kept, []string{"4.0.0", "2.0.0"}) {
+		t.Errorf("kept = %v, want [4.0.0 2.0.0]", kept)
+	}
+	if !slices.Equal(removed, []string{"3.0.0", "1.0.0"}) {
+		t.Errorf("removed = %v, want [3.0.0 1.0.0]", removed)
+	}
+}
+
+func TestVacuumWithDetailsKeepsVersionsAboveMax(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, f := range []string{"myext_1.0.0.raw", "myext_2.0.0.raw", "myext_3.0.0.raw", "myext_4.0.0.raw"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, f), []byte("test"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	// 3.0.0 and 4.0.0 are only held back by MaxVersion: they stay, and
+	// the two retention slots go to 2.0.0 and 1.0.0.
+	transfer := &config.Transfer{
+		Transfer: config.TransferSection{
+			InstancesMax: 2,
+			MaxVersion:   "2.0.0",
+		},
+		Target: config.TargetSection{
+			Path:         tmpDir,
+			MatchPattern: "myext_@v.raw",
+		},
+	}
+
+	removed, kept, err := VacuumWithDetails(transfer)
+	if err != nil {
+		t.Fatalf("VacuumWithDetails() error = %v", err)
+	}
+	if !slices.Equal(kept, []string{"4.0.0", "3.0.0", "2.0.0", "1.0.0"}) || len(removed) != 0 {
+		t.Errorf("kept = %v, removed = %v, want every version kept", kept, removed)
+	}
+	for _, f := range []string{"myext_3.0.0.raw", "myext_4.0.0.raw"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, f)); err != nil {
+			t.Errorf("%s: %v", f, err)
+		}
+	}
+}
+
+// TestGetInstalledVersionsCurrentIsLinked verifies that the current
+// version is the one the sysext link points at, not the one it should, and
+// that PreferredVersion passes over a version rolled back from.
+func TestGetInstalledVersionsCurrentIsLinked(t *testing.T) {
+	tmpDir := t.TempDir()
+	linkDir := t.TempDir()
+	for _, f := range []string{"myext_1.0.0.raw", "myext_2.0.0.raw"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, f), []byte("test"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+	transfer := &config.Transfer{
+		Component: "myext",
+		Transfer:  config.TransferSection{SkipVersions: []string{"2.0.0"}},
+		Target: config.TargetSection{
+			Path:         tmpDir,
+			MatchPattern: "myext_@v.raw",
+		},
+	}
+
+	// Without a link, the newest is current.
+	installed, current, err := GetInstalledVersionsAt(transfer, linkDir)
+	if err != nil {
+		t.Fatalf("GetInstalledVersionsAt() error = %v", err)
+	}
+	if current != "2.0.0" {
+		t.Errorf("current without a link = %q, want 2.0.0", current)
+	}
+	if preferred := PreferredVersion(transfer, installed); preferred != "1.0.0" {
+		t.Errorf("PreferredVersion() = %q, want 1.0.0 (2.0.0 was rolled back from)", preferred)
+	}
+
+	if err := os.Symlink(filepath.Join(tmpDir, "myext_2.0.0.raw"), filepath.Join(linkDir, "myext.raw")); err != nil {
+		t.Fatal(err)
+	}
+	if _, current, _ := GetInstalledVersionsAt(transfer, linkDir); current != "2.0.0" {
+		t.Errorf("current = %q, want the linked 2.0.0", current)
+	}
+	if err := LinkToSysextAt(transfer, linkDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, current, _ := GetInstalledVersionsAt(transfer, linkDir); current != "1.0.0" {
+		t.Errorf("current after relinking = %q, want 1.0.0", current)
+	}
+}
+
 func TestVacuumWithDetailsEmptyDir(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -0,0 +1,157 @@
+package sysext
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/frostyard/updex/config"
+)
+
+// errAttrUnsupported reports that the immutable file attribute cannot be
+// used on a path: the filesystem lacks it, or the caller lacks the
+// capability to change it.
+var errAttrUnsupported = errors.New("immutable attribute not supported")
+
+// writeBits are the permission bits MarkReadOnly removes when it cannot set
+// the immutable attribute.
+const writeBits os.FileMode = 0222
+
+// MarkReadOnly marks an installed instance read-only, as Target.ReadOnly=yes
+// asks. It sets the immutable file attribute (chattr +i) where the
+// filesystem and the caller's capabilities allow, and otherwise falls back
+// to removing the write permission bits. It reports whether the attribute
+// was set.
+func MarkReadOnly(path string) (immutable bool, err error) {
+	err = setImmutable(path, true)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, errAttrUnsupported) {
+		return false, fmt.Errorf("failed to mark %s read-only: %w", path, err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark %s read-only: %w", path, err)
+	}
+	if err := os.Chmod(path, info.Mode().Perm()&^writeBits); err != nil {
+		return false, fmt.Errorf("failed to mark %s read-only: %w", path, err)
+	}
+	return false, nil
+}
+
+// ClearReadOnly undoes MarkReadOnly ahead of removing or replacing path: it
+// clears the immutable attribute and, for a directory, gives the owner write
+// permission back so its entries can be removed. A missing path is not an
+// error.
+func ClearReadOnly(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	immutable, err := IsImmutable(path)
+	if err != nil {
+		return err
+	}
+	if immutable {
+		if err := setImmutable(path, false); err != nil {
+			return fmt.Errorf("failed to clear immutable attribute on %s: %w", path, err)
+		}
+	}
+	if info.IsDir() && info.Mode().Perm()&0200 == 0 {
+		if err := os.Chmod(path, info.Mode().Perm()|0200); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsImmutable reports whether path carries the immutable file attribute. A
+// filesystem without the attribute reports false.
+func IsImmutable(path string) (bool, error) {
+	immutable, err := getImmutable(path)
+	if errors.Is(err, errAttrUnsupported) {
+		return false, nil
+	}
+	return immutable, err
+}
+
+// InstanceState describes one installed instance of a transfer and how it
+// has drifted from the transfer's Target.Mode and Target.ReadOnly settings.
+type InstanceState struct {
+	Version   string
+	Path      string
+	Mode      os.FileMode // permission bits
+	Immutable bool
+	// ReadOnly reports whether the instance is read-only by either
+	// mechanism MarkReadOnly uses.
+	ReadOnly bool
+	// Drift lists each way the instance differs from its transfer; it is
+	// empty when the instance matches.
+	Drift []string
+}
+
+// InspectInstancesAt reports the state of every installed instance of t,
+// newest first. defaultDir is the fallback directory for transfers that omit
+// Target.Path. Target.Mode is only checked for image files: directory
+// instances keep their tarball's modes.
+func InspectInstancesAt(t *config.Transfer, defaultDir string) ([]InstanceState, error) {
+	files, err := installedVersionFilesAt(t, defaultDir)
+	if err != nil {
+		return nil, err
+	}
+	dir := targetDirAt(t, defaultDir)
+
+	wantMode := os.FileMode(t.Target.Mode).Perm()
+	if wantMode == 0 {
+		wantMode = 0644 // download.Download's default
+	}
+
+	states := make([]InstanceState, 0, len(files))
+	for _, f := range files {
+		path := filepath.Join(dir, f.filename)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s: %w", path, err)
+		}
+		immutable, err := IsImmutable(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s: %w", path, err)
+		}
+		mode := info.Mode().Perm()
+		s := InstanceState{
+			Version:   f.version,
+			Path:      path,
+			Mode:      mode,
+			Immutable: immutable,
+			ReadOnly:  immutable || mode&writeBits == 0,
+		}
+
+		switch {
+		case t.Target.ReadOnly && !s.ReadOnly:
+			s.Drift = append(s.Drift, "not read-only")
+		case !t.Target.ReadOnly && immutable:
+			s.Drift = append(s.Drift, "immutable, but the transfer is not ReadOnly")
+		}
+		if !config.IsDirectoryTarget(t) {
+			// The write-bit fallback is the only change read-only marking
+			// makes to the mode.
+			want := wantMode
+			if t.Target.ReadOnly && !immutable {
+				want &^= writeBits
+			}
+			if mode != want {
+				s.Drift = append(s.Drift, fmt.Sprintf("mode %04o, want %04o", mode, want))
+			}
+		}
+		states = append(states, s)
+	}
+	return states, nil
+}
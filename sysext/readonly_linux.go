@@ -0,0 +1,66 @@
+package sysext
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// fsImmutableFL is FS_IMMUTABLE_FL from linux/fs.h.
+const fsImmutableFL = 0x00000010
+
+func getImmutable(path string) (bool, error) {
+	var immutable bool
+	err := withAttrFD(path, func(fd int) error {
+		flags, err := unix.IoctlGetUint32(fd, unix.FS_IOC_GETFLAGS)
+		if err != nil {
+			return attrError(err)
+		}
+		immutable = flags&fsImmutableFL != 0
+		return nil
+	})
+	return immutable, err
+}
+
+func setImmutable(path string, on bool) error {
+	return withAttrFD(path, func(fd int) error {
+		flags, err := unix.IoctlGetUint32(fd, unix.FS_IOC_GETFLAGS)
+		if err != nil {
+			return attrError(err)
+		}
+		want := flags &^ fsImmutableFL
+		if on {
+			want |= fsImmutableFL
+		}
+		if want == flags {
+			return nil
+		}
+		return attrError(unix.IoctlSetPointerInt(fd, unix.FS_IOC_SETFLAGS, int(want)))
+	})
+}
+
+// withAttrFD calls fn with a read-only descriptor for path, which may be a
+// file or a directory; the attribute ioctls need no write access.
+func withAttrFD(path string, fn func(fd int) error) error {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer func() { _ = unix.Close(fd) }()
+	return fn(fd)
+}
+
+// attrError maps the errors of a filesystem without file attributes, or of
+// a caller without CAP_LINUX_IMMUTABLE, to errAttrUnsupported.
+func attrError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, unix.ENOTTY), errors.Is(err, unix.EOPNOTSUPP), errors.Is(err, unix.EINVAL),
+		errors.Is(err, unix.ENOSYS), errors.Is(err, unix.EPERM), errors.Is(err, unix.EACCES):
+		return errors.Join(errAttrUnsupported, err)
+	default:
+		return err
+	}
+}
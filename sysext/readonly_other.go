@@ -0,0 +1,11 @@
+//go:build !linux
+
+package sysext
+
+func getImmutable(string) (bool, error) {
+	return false, errAttrUnsupported
+}
+
+func setImmutable(string, bool) error {
+	return errAttrUnsupported
+}
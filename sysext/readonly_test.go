@@ -0,0 +1,169 @@
+package sysext
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/frostyard/updex/config"
+)
+
+// markReadOnly marks path read-only and registers a cleanup that undoes it,
+// since t.TempDir cannot remove an immutable file.
+func markReadOnly(t *testing.T, path string) bool {
+	t.Helper()
+	t.Cleanup(func() { _ = ClearReadOnly(path) })
+	immutable, err := MarkReadOnly(path)
+	if err != nil {
+		t.Fatalf("MarkReadOnly() error = %v", err)
+	}
+	return immutable
+}
+
+func TestMarkReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "myext_1.0.0.raw")
+	if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	immutable := markReadOnly(t, path)
+	got, err := IsImmutable(path)
+	if err != nil {
+		t.Fatalf("IsImmutable() error = %v", err)
+	}
+	if got != immutable {
+		t.Errorf("IsImmutable() = %v, MarkReadOnly() reported %v", got, immutable)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fallback drops the write bits; the attribute leaves the mode alone.
+	want := os.FileMode(0644)
+	if !immutable {
+		want = 0444
+	}
+	if info.Mode().Perm() != want {
+		t.Errorf("mode = %04o, want %04o", info.Mode().Perm(), want)
+	}
+
+	if err := ClearReadOnly(path); err != nil {
+		t.Fatalf("ClearReadOnly() error = %v", err)
+	}
+	if got, _ := IsImmutable(path); got {
+		t.Error("immutable attribute still set after ClearReadOnly()")
+	}
+	if err := os.Remove(path); err != nil {
+		t.Errorf("Remove() after ClearReadOnly() error = %v", err)
+	}
+}
+
+func TestClearReadOnlyMissingPath(t *testing.T) {
+	if err := ClearReadOnly(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("ClearReadOnly() error = %v, want nil for a missing path", err)
+	}
+}
+
+// TestRemovalUndoesReadOnly pins that vacuum and RemoveAllVersions can remove
+// instances that an install marked read-only, file and directory alike.
+func TestRemovalUndoesReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"myext_1.0.0.raw", "myext_2.0.0.raw", "myext_3.0.0.raw"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		markReadOnly(t, path)
+	}
+	tree := filepath.Join(dir, "tree_1.0.0")
+	if err := os.MkdirAll(filepath.Join(tree, "usr"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	markReadOnly(t, tree)
+
+	transfer := &config.Transfer{
+		Transfer: config.TransferSection{InstancesMax: 2},
+		Target: config.TargetSection{
+			Path:         dir,
+			MatchPattern: "myext_@v.raw",
+			ReadOnly:     true,
+		},
+	}
+	removed, _, err := VacuumWithDetails(transfer)
+	if err != nil {
+		t.Fatalf("VacuumWithDetails() error = %v", err)
+	}
+	if !slices.Equal(removed, []string{"1.0.0"}) {
+		t.Errorf("VacuumWithDetails() removed = %v, want [1.0.0]", removed)
+	}
+
+	if _, err := RemoveAllVersions(transfer); err != nil {
+		t.Fatalf("RemoveAllVersions() error = %v", err)
+	}
+	treeTransfer := &config.Transfer{
+		Source: config.SourceSection{Type: "url-tar"},
+		Target: config.TargetSection{Type: "directory", Path: dir, MatchPattern: "tree_@v", ReadOnly: true},
+	}
+	if _, err := RemoveAllVersions(treeTransfer); err != nil {
+		t.Fatalf("RemoveAllVersions() directory target error = %v", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("left behind %v, want every instance removed", entries)
+	}
+}
+
+func TestInspectInstancesDrift(t *testing.T) {
+	tests := []struct {
+		name      string
+		readOnly  bool
+		mode      uint32
+		fileMode  os.FileMode
+		mark      bool
+		wantDrift bool
+	}{
+		{name: "default mode matches", fileMode: 0644},
+		{name: "mode drifted", fileMode: 0600, wantDrift: true},
+		{name: "configured mode matches", mode: 0600, fileMode: 0600},
+		{name: "read-only marked", readOnly: true, fileMode: 0644, mark: true},
+		{name: "read-only lost", readOnly: true, fileMode: 0644, wantDrift: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "myext_1.0.0.raw")
+			if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
+				t.Fatalf("failed to create test file: %v", err)
+			}
+			if err := os.Chmod(path, tt.fileMode); err != nil {
+				t.Fatal(err)
+			}
+			if tt.mark {
+				markReadOnly(t, path)
+			}
+
+			transfer := &config.Transfer{
+				Target: config.TargetSection{
+					Path:         dir,
+					MatchPattern: "myext_@v.raw",
+					Mode:         tt.mode,
+					ReadOnly:     tt.readOnly,
+				},
+			}
+			states, err := InspectInstancesAt(transfer, t.TempDir())
+			if err != nil {
+				t.Fatalf("InspectInstancesAt() error = %v", err)
+			}
+			if len(states) != 1 || states[0].Version != "1.0.0" || states[0].Path != path {
+				t.Fatalf("InspectInstancesAt() = %+v, want one instance at %s", states, path)
+			}
+			if got := len(states[0].Drift) > 0; got != tt.wantDrift {
+				t.Errorf("Drift = %q, want drift %v", states[0].Drift, tt.wantDrift)
+			}
+			if states[0].ReadOnly != tt.mark {
+				t.Errorf("ReadOnly = %v, want %v", states[0].ReadOnly, tt.mark)
+			}
+		})
+	}
+}
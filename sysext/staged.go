@@ -0,0 +1,76 @@
+package sysext
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/frostyard/updex/config"
+)
+
+// StagedDirName is the directory, inside a transfer's target directory,
+// holding images a staged update downloaded and verified but did not
+// install. Nothing that lists installed versions, links or vacuums looks
+// in it, and the leading dot keeps systemd-sysext from treating it as an
+// extension when the target directory is also a link directory. Living in
+// the target directory keeps it on the same filesystem, so applying an
+// image is a rename.
+const StagedDirName = ".updex-staged"
+
+// StagedDirAt returns the staging directory for t, with an explicit
+// fallback directory for transfers that omit Target.Path.
+func StagedDirAt(t *config.Transfer, defaultDir string) string {
+	return filepath.Join(targetDirAt(t, defaultDir), StagedDirName)
+}
+
+// StagedVersionAt returns the version and file name of the image staged
+// for t, or empty strings when none is. Should several be staged, the
+// newest wins.
+func StagedVersionAt(t *config.Transfer, defaultDir string) (ver, filename string, err error) {
+	files, err := versionFilesIn(t, StagedDirAt(t, defaultDir))
+	if err != nil || len(files) == 0 {
+		return "", "", err
+	}
+	return files[0].version, files[0].filename, nil
+}
+
+// DiscardStagedAt removes every image staged for t. Other transfers'
+// staged images, and partial downloads, are left alone.
+func DiscardStagedAt(t *config.Transfer, defaultDir string) error {
+	dir := StagedDirAt(t, defaultDir)
+	files, err := versionFilesIn(t, dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := removeInstance(t, filepath.Join(dir, f.filename)); err != nil {
+			return fmt.Errorf("failed to discard staged %s: %w", f.filename, err)
+		}
+	}
+	return nil
+}
+
+// PromoteStagedAt moves the image staged for t into its target directory,
+// replacing an installed copy of the same version, and discards any other
+// staged image. It returns the version and installed path, or empty
+// strings when nothing is staged. The link is left alone.
+func PromoteStagedAt(t *config.Transfer, defaultDir string) (ver, path string, err error) {
+	ver, filename, err := StagedVersionAt(t, defaultDir)
+	if err != nil || ver == "" {
+		return "", "", err
+	}
+
+	path = filepath.Join(targetDirAt(t, defaultDir), filename)
+	if _, err := os.Lstat(path); err == nil {
+		if err := removeInstance(t, path); err != nil {
+			return "", "", fmt.Errorf("failed to replace installed %s: %w", filename, err)
+		}
+	}
+	if err := os.Rename(filepath.Join(StagedDirAt(t, defaultDir), filename), path); err != nil {
+		return "", "", fmt.Errorf("failed to apply staged %s: %w", filename, err)
+	}
+	if err := DiscardStagedAt(t, defaultDir); err != nil {
+		return ver, path, err
+	}
+	return ver, path, nil
+}
@@ -0,0 +1,117 @@
+package sysext
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/frostyard/updex/config"
+)
+
+func TestStagedVersions(t *testing.T) {
+	targetDir := t.TempDir()
+	transfer := &config.Transfer{
+		Target: config.TargetSection{Path: targetDir, MatchPattern: "myext_@v.raw"},
+	}
+	stagedDir := StagedDirAt(transfer, t.TempDir())
+	if want := filepath.Join(targetDir, StagedDirName); stagedDir != want {
+		t.Fatalf("StagedDirAt() = %q, want %q", stagedDir, want)
+	}
+
+	if ver, _, err := StagedVersionAt(transfer, ""); err != nil || ver != "" {
+		t.Fatalf("StagedVersionAt() with no staging dir = %q, %v, want nothing staged", ver, err)
+	}
+
+	if err := os.MkdirAll(stagedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"myext_1.1.0.raw", "myext_1.2.0.raw", "other_9.0.0.raw"} {
+		if err := os.WriteFile(filepath.Join(stagedDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(targetDir, "myext_1.0.0.raw"), []byte("installed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ver, filename, err := StagedVersionAt(transfer, "")
+	if err != nil || ver != "1.2.0" || filename != "myext_1.2.0.raw" {
+		t.Errorf("StagedVersionAt() = %q, %q, %v, want the newest staged image", ver, filename, err)
+	}
+	installed, _, err := GetInstalledVersions(transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.0.0"}; !slices.Equal(installed, want) {
+		t.Errorf("installed versions = %v, want staged images not listed", installed)
+	}
+
+	ver, path, err := PromoteStagedAt(transfer, "")
+	if err != nil || ver != "1.2.0" || path != filepath.Join(targetDir, "myext_1.2.0.raw") {
+		t.Fatalf("PromoteStagedAt() = %q, %q, %v", ver, path, err)
+	}
+	installed, _, err = GetInstalledVersions(transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.2.0", "1.0.0"}; !slices.Equal(installed, want) {
+		t.Errorf("installed versions after promote = %v, want %v", installed, want)
+	}
+	entries, err := os.ReadDir(stagedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "other_9.0.0.raw" {
+		t.Errorf("staging dir after promote = %v, want only the other transfer's image", entries)
+	}
+
+	if ver, _, err := PromoteStagedAt(transfer, ""); err != nil || ver != "" {
+		t.Errorf("PromoteStagedAt() with nothing staged = %q, %v", ver, err)
+	}
+}
+
+func TestPromoteStagedReplacesInstalledCopy(t *testing.T) {
+	targetDir := t.TempDir()
+	transfer := &config.Transfer{
+		Target: config.TargetSection{Path: targetDir, MatchPattern: "myext_@v.raw"},
+	}
+	stagedDir := StagedDirAt(transfer, "")
+	if err := os.MkdirAll(stagedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stagedDir, "myext_1.0.0.raw"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(targetDir, "myext_1.0.0.raw"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := PromoteStagedAt(transfer, ""); err != nil {
+		t.Fatalf("PromoteStagedAt() error = %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(targetDir, "myext_1.0.0.raw")); string(content) != "new" {
+		t.Errorf("installed content = %q, want the staged image", content)
+	}
+}
+
+func TestRemoveAllVersionsDiscardsStaged(t *testing.T) {
+	targetDir := t.TempDir()
+	transfer := &config.Transfer{
+		Target: config.TargetSection{Path: targetDir, MatchPattern: "myext_@v.raw"},
+	}
+	stagedDir := StagedDirAt(transfer, "")
+	if err := os.MkdirAll(stagedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stagedDir, "myext_2.0.0.raw"), []byte("staged"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RemoveAllVersionsAt(transfer, t.TempDir()); err != nil {
+		t.Fatalf("RemoveAllVersionsAt() error = %v", err)
+	}
+	if ver, _, err := StagedVersionAt(transfer, ""); err != nil || ver != "" {
+		t.Errorf("StagedVersionAt() after RemoveAllVersionsAt = %q, %v, want nothing staged", ver, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // Manager handles systemd unit file operations (install, remove, etc.)
@@ -93,8 +94,8 @@ func writeUnitFile(path, content string) (err error) {
 // and calls daemon-reload after installation.
 //
 // Both unit paths are checked with unitFileState before anything is
-// written: an existing regular file is an "already exists" error (reinstall
-// requires an explicit Remove first, see ADR-0007), and a symlink,
+// written: an existing regular file is an "already exists" error (existing
+// units are rewritten with Update, see ADR-0015), and a symlink,
 // directory, or other non-regular entry is refused outright rather than
 // written through (ADR-0005).
 func (m *Manager) Install(timer *TimerConfig, service *ServiceConfig) error {
@@ -141,6 +142,145 @@ func (m *Manager) Install(timer *TimerConfig, service *ServiceConfig) error {
 	return nil
 }
 
+// Units is an installed timer and service pair as read back by Read.
+type Units struct {
+	Timer   *TimerConfig
+	Service *ServiceConfig
+	// Generated reports that both files are exactly what GenerateTimer and
+	// GenerateService produce from Timer and Service: nobody edited them,
+	// so Timer and Service describe everything in them.
+	Generated bool
+}
+
+// Read parses the timer and service unit files installed under name. Both
+// must be regular files (ADR-0005); a missing or non-regular one is an
+// error.
+func (m *Manager) Read(name string) (*Units, error) {
+	timerContent, err := readUnitFile(filepath.Join(m.UnitPath, name+".timer"))
+	if err != nil {
+		return nil, err
+	}
+	serviceContent, err := readUnitFile(filepath.Join(m.UnitPath, name+".service"))
+	if err != nil {
+		return nil, err
+	}
+
+	timer := ParseTimer(timerContent)
+	timer.Name = name
+	service := ParseService(serviceContent)
+	service.Name = name
+	return &Units{
+		Timer:     timer,
+		Service:   service,
+		Generated: GenerateTimer(timer) == timerContent && GenerateService(service) == serviceContent,
+	}, nil
+}
+
+// readUnitFile returns the content of the regular unit file at path.
+func readUnitFile(path string) (string, error) {
+	if exists, err := unitFileState(path); err != nil {
+		return "", err
+	} else if !exists {
+		return "", fmt.Errorf("unit file not found: %s", path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read unit file: %w", err)
+	}
+	return string(content), nil
+}
+
+// Update rewrites installed timer and service unit files from the configs
+// and calls daemon-reload. It is Install for units that already exist:
+// both paths must hold regular files, each is replaced atomically, and if
+// the service write fails the previous timer content is put back.
+// Callers decide whether the installed units may be replaced; Read tells
+// them whether they were edited.
+func (m *Manager) Update(timer *TimerConfig, service *ServiceConfig) error {
+	timerPath := filepath.Join(m.UnitPath, timer.Name+".timer")
+	servicePath := filepath.Join(m.UnitPath, service.Name+".service")
+
+	oldTimer, err := readUnitFile(timerPath)
+	if err != nil {
+		return err
+	}
+	if _, err := readUnitFile(servicePath); err != nil {
+		return err
+	}
+
+	if err := writeUnitFile(timerPath, GenerateTimer(timer)); err != nil {
+		return fmt.Errorf("failed to write timer: %w", err)
+	}
+	if err := writeUnitFile(servicePath, GenerateService(service)); err != nil {
+		var restoreErr error
+		if wErr := writeUnitFile(timerPath, oldTimer); wErr != nil {
+			restoreErr = fmt.Errorf("failed to restore timer file after service write failure: %w", wErr)
+		}
+		return errors.Join(fmt.Errorf("failed to write service: %w", err), restoreErr)
+	}
+
+	if err := m.runner.DaemonReload(); err != nil {
+		return fmt.Errorf("daemon-reload failed: %w", err)
+	}
+	return nil
+}
+
+// ReadService parses a service unit installed on its own, such as one
+// written by WriteService. generated reports that the file is exactly what
+// GenerateService produces from the result. The file must be a regular file
+// (ADR-0005).
+func (m *Manager) ReadService(name string) (cfg *ServiceConfig, generated bool, err error) {
+	content, err := readUnitFile(filepath.Join(m.UnitPath, name+".service"))
+	if err != nil {
+		return nil, false, err
+	}
+	cfg = ParseService(content)
+	cfg.Name = name
+	return cfg, GenerateService(cfg) == content, nil
+}
+
+// WriteService writes a service unit on its own, creating or replacing it,
+// and calls daemon-reload. A path holding anything but a regular file is
+// refused (ADR-0005); whether an existing unit may be replaced is for the
+// caller to decide, with ReadService.
+func (m *Manager) WriteService(cfg *ServiceConfig) error {
+	path := filepath.Join(m.UnitPath, cfg.Name+".service")
+	if _, err := unitFileState(path); err != nil {
+		return err
+	}
+	if err := writeUnitFile(path, GenerateService(cfg)); err != nil {
+		return fmt.Errorf("failed to write service: %w", err)
+	}
+	if err := m.runner.DaemonReload(); err != nil {
+		return fmt.Errorf("daemon-reload failed: %w", err)
+	}
+	return nil
+}
+
+// RemoveService disables a service unit installed on its own, removes its
+// file, and calls daemon-reload. Like Remove it attempts every step and
+// returns all failures together.
+func (m *Manager) RemoveService(name string) error {
+	var errs []error
+	if err := m.runner.Disable(name + ".service"); err != nil {
+		errs = append(errs, fmt.Errorf("disable service: %w", err))
+	}
+	if err := os.Remove(filepath.Join(m.UnitPath, name+".service")); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, fmt.Errorf("remove service: %w", err))
+	}
+	if err := m.runner.DaemonReload(); err != nil {
+		errs = append(errs, fmt.Errorf("daemon-reload: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// ServiceExists reports whether a service unit file is present at UnitPath,
+// counting any non-regular entry as present, as Exists does.
+func (m *Manager) ServiceExists(name string) bool {
+	_, err := os.Lstat(filepath.Join(m.UnitPath, name+".service"))
+	return err == nil || !os.IsNotExist(err)
+}
+
 // Remove stops and disables the timer, removes both unit files, and calls
 // daemon-reload. Every step is attempted, and all failures are returned
 // together.
@@ -207,6 +347,15 @@ func (m *Manager) Start(unit string) error {
 	return m.runner.Start(unit)
 }
 
+// Restart stops and starts a systemd unit through the manager's configured
+// runner, so a timer recomputes its next elapse from rewritten settings.
+func (m *Manager) Restart(unit string) error {
+	if err := m.runner.Stop(unit); err != nil {
+		return err
+	}
+	return m.runner.Start(unit)
+}
+
 // IsEnabled reports whether a systemd unit is enabled through the manager's
 // configured runner.
 func (m *Manager) IsEnabled(unit string) (bool, error) {
@@ -218,3 +367,13 @@ func (m *Manager) IsEnabled(unit string) (bool, error) {
 func (m *Manager) IsActive(unit string) (bool, error) {
 	return m.runner.IsActive(unit)
 }
+
+// NextElapse reports when a timer unit next elapses through the manager's
+// configured runner. It returns the zero time when the runner cannot tell
+// (see TimerRunner) or the timer is not scheduled.
+func (m *Manager) NextElapse(unit string) (time.Time, error) {
+	if runner, ok := m.runner.(TimerRunner); ok {
+		return runner.NextElapse(unit)
+	}
+	return time.Time{}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestInstall(t *testing.T) {
@@ -584,6 +585,181 @@ func TestExists(t *testing.T) {
 	}
 }
 
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewTestManager(dir, &MockSystemctlRunner{})
+	timer, service := testUnitConfigs("example")
+	if err := manager.Install(timer, service); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	units, err := manager.Read("example")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !units.Generated || *units.Timer != *timer || *units.Service != *service {
+		t.Fatalf("Read() = %+v %+v generated=%v, want the installed configs", units.Timer, units.Service, units.Generated)
+	}
+
+	servicePath := filepath.Join(dir, "example.service")
+	f, err := os.OpenFile(servicePath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("Environment=EDITED=1\n")
+	_ = f.Close()
+	if units, err := manager.Read("example"); err != nil || units.Generated {
+		t.Errorf("Read() of an edited service = (generated %v, %v), want not generated", units != nil && units.Generated, err)
+	}
+
+	if err := os.Remove(servicePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/dev/null", servicePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Read("example"); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("Read() through a symlink error = %v, want a non-regular refusal", err)
+	}
+	if _, err := manager.Read("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Read(missing) error = %v, want not found", err)
+	}
+}
+
+func TestWriteService(t *testing.T) {
+	dir := t.TempDir()
+	runner := &MockSystemctlRunner{}
+	manager := NewTestManager(dir, runner)
+	_, service := testUnitConfigs("example")
+	service.WantedBy = "sysinit.target"
+
+	if manager.ServiceExists("example") {
+		t.Fatal("ServiceExists() = true before WriteService")
+	}
+	if err := manager.WriteService(service); err != nil {
+		t.Fatalf("WriteService() error = %v", err)
+	}
+	if !runner.DaemonReloadCalled || !manager.ServiceExists("example") {
+		t.Fatal("WriteService() did not write the unit and reload")
+	}
+	got, generated, err := manager.ReadService("example")
+	if err != nil || !generated || *got != *service {
+		t.Fatalf("ReadService() = %+v, %v, %v, want the written config", got, generated, err)
+	}
+
+	service.Description = "Rewritten"
+	if err := manager.WriteService(service); err != nil {
+		t.Fatalf("WriteService() over an existing unit error = %v", err)
+	}
+	if got, _, _ := manager.ReadService("example"); got.Description != "Rewritten" {
+		t.Errorf("WriteService() did not replace the unit: %+v", got)
+	}
+
+	if err := manager.RemoveService("example"); err != nil {
+		t.Fatalf("RemoveService() error = %v", err)
+	}
+	if runner.DisableUnit != "example.service" || manager.ServiceExists("example") {
+		t.Errorf("RemoveService() left the unit or disabled %q", runner.DisableUnit)
+	}
+
+	path := filepath.Join(dir, "example.service")
+	if err := os.Symlink("/dev/null", path); err != nil {
+		t.Fatal(err)
+	}
+	if !manager.ServiceExists("example") {
+		t.Error("ServiceExists() = false for a symlink")
+	}
+	if err := manager.WriteService(service); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("WriteService() through a symlink error = %v, want a non-regular refusal", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	dir := t.TempDir()
+	runner := &MockSystemctlRunner{}
+	manager := NewTestManager(dir, runner)
+	timer, service := testUnitConfigs("example")
+
+	if err := manager.Update(timer, service); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("Update() without units error = %v, want not found", err)
+	}
+	if runner.DaemonReloadCalled {
+		t.Fatal("Update() reloaded systemd without writing anything")
+	}
+
+	if err := manager.Install(timer, service); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	runner.DaemonReloadCalled = false
+	timer.OnCalendar = "weekly"
+	service.Nice = 10
+	if err := manager.Update(timer, service); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !runner.DaemonReloadCalled {
+		t.Error("Update() did not reload systemd")
+	}
+	units, err := manager.Read("example")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if *units.Timer != *timer || *units.Service != *service {
+		t.Errorf("Read() after Update() = %+v %+v, want %+v %+v", units.Timer, units.Service, timer, service)
+	}
+}
+
+// TestUpdate_ChecksBothUnitsFirst verifies that Update writes nothing when
+// either unit is missing, so the pair is never left half-rewritten.
+func TestUpdate_ChecksBothUnitsFirst(t *testing.T) {
+	dir := t.TempDir()
+	runner := &MockSystemctlRunner{}
+	manager := NewTestManager(dir, runner)
+	timer, service := testUnitConfigs("example")
+	if err := manager.Install(timer, service); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	timerPath := filepath.Join(dir, "example.timer")
+	before, err := os.ReadFile(timerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timer.OnCalendar = "weekly"
+	renamed := *service
+	renamed.Name = "other"
+	if err := manager.Update(timer, &renamed); err == nil {
+		t.Fatal("Update() error = nil, want a missing service error")
+	}
+	after, err := os.ReadFile(timerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("Update() changed the timer despite failing:\n%s", after)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	stopErr := errors.New("stop failed")
+	runner := &MockSystemctlRunner{StopErr: stopErr}
+	manager := NewTestManager(t.TempDir(), runner)
+
+	if err := manager.Restart("example.timer"); !errors.Is(err, stopErr) {
+		t.Fatalf("Restart() error = %v, want %v", err, stopErr)
+	}
+	if runner.StartCalled {
+		t.Fatal("Restart() started the unit after stop failed")
+	}
+
+	runner.StopErr = nil
+	if err := manager.Restart("example.timer"); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	if runner.StopUnit != "example.timer" || runner.StartUnit != "example.timer" {
+		t.Errorf("Restart() calls = stop %q, start %q", runner.StopUnit, runner.StartUnit)
+	}
+}
+
 func TestManagerSystemctlPrimitives(t *testing.T) {
 	enableErr := errors.New("enable failed")
 	startErr := errors.New("start failed")
@@ -630,6 +806,25 @@ func TestManagerSystemctlPrimitives(t *testing.T) {
 	}
 }
 
+func TestManagerNextElapse(t *testing.T) {
+	next := time.Unix(1760601600, 0)
+	runner := &MockSystemctlRunner{NextElapseResult: next}
+	got, err := NewTestManager(t.TempDir(), runner).NextElapse("example.timer")
+	if err != nil || !got.Equal(next) {
+		t.Fatalf("NextElapse() = (%v, %v), want (%v, nil)", got, err, next)
+	}
+	if !runner.NextElapseCalled || runner.NextElapseUnit != "example.timer" {
+		t.Fatalf("NextElapse() call = (%v, %q)", runner.NextElapseCalled, runner.NextElapseUnit)
+	}
+
+	// A runner without TimerRunner cannot tell; that is not an error.
+	plain := struct{ SystemctlRunner }{&MockSystemctlRunner{}}
+	got, err = NewTestManager(t.TempDir(), plain).NextElapse("example.timer")
+	if err != nil || !got.IsZero() {
+		t.Fatalf("NextElapse() without TimerRunner = (%v, %v), want the zero time", got, err)
+	}
+}
+
 func TestNewManager(t *testing.T) {
 	mgr := NewManager()
 
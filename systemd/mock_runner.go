@@ -1,5 +1,7 @@
 package systemd
 
+import "time"
+
 // MockSystemctlRunner is a test double for SystemctlRunner
 type MockSystemctlRunner struct {
 	DaemonReloadCalled bool
@@ -30,6 +32,11 @@ type MockSystemctlRunner struct {
 	IsEnabledUnit   string
 	IsEnabledResult bool
 	IsEnabledErr    error
+
+	NextElapseCalled bool
+	NextElapseUnit   string
+	NextElapseResult time.Time
+	NextElapseErr    error
 }
 
 func (m *MockSystemctlRunner) DaemonReload() error {
@@ -72,3 +79,9 @@ func (m *MockSystemctlRunner) IsEnabled(unit string) (bool, error) {
 	m.IsEnabledUnit = unit
 	return m.IsEnabledResult, m.IsEnabledErr
 }
+
+func (m *MockSystemctlRunner) NextElapse(unit string) (time.Time, error) {
+	m.NextElapseCalled = true
+	m.NextElapseUnit = unit
+	return m.NextElapseResult, m.NextElapseErr
+}
@@ -3,6 +3,9 @@ package systemd
 import (
 	"fmt"
 	"os/exec"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // SystemctlRunner executes systemctl commands
@@ -16,6 +19,14 @@ type SystemctlRunner interface {
 	IsEnabled(unit string) (bool, error)
 }
 
+// TimerRunner optionally lets a runner report when a timer next elapses.
+// Managers use this when available while retaining compatibility with
+// existing SystemctlRunner implementations.
+type TimerRunner interface {
+	SystemctlRunner
+	NextElapse(unit string) (time.Time, error)
+}
+
 // DefaultSystemctlRunner executes real systemctl commands
 type DefaultSystemctlRunner struct{}
 
@@ -69,6 +80,34 @@ func (r *DefaultSystemctlRunner) IsEnabled(unit string) (bool, error) {
 	return true, nil
 }
 
+// NextElapse returns when the timer unit next elapses on the realtime
+// clock, or the zero time when it is not scheduled (stopped, or a
+// monotonic-only timer).
+func (r *DefaultSystemctlRunner) NextElapse(unit string) (time.Time, error) {
+	out, err := exec.Command("systemctl", "show", "--property=NextElapseUSecRealtime", "--value", "--timestamp=unix", unit).Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("systemctl show failed: %w", err)
+	}
+	return parseUnixTimestamp(strings.TrimSpace(string(out)))
+}
+
+// parseUnixTimestamp parses a timestamp as systemctl prints it with
+// --timestamp=unix ("@1760601600"). Empty and "n/a" mean unset.
+func parseUnixTimestamp(value string) (time.Time, error) {
+	if value == "" || value == "n/a" {
+		return time.Time{}, nil
+	}
+	digits, ok := strings.CutPrefix(value, "@")
+	secs, err := strconv.ParseInt(digits, 10, 64)
+	if !ok || err != nil {
+		return time.Time{}, fmt.Errorf("unexpected timestamp %q", value)
+	}
+	if secs == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(secs, 0), nil
+}
+
 // runSystemctl executes a systemctl command with the given arguments
 func runSystemctl(args ...string) error {
 	cmd := exec.Command("systemctl", args...)
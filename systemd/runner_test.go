@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultSystemctlRunnerCommands(t *testing.T) {
@@ -106,6 +107,37 @@ func TestDefaultSystemctlRunnerIsEnabled(t *testing.T) {
 	}
 }
 
+func TestDefaultSystemctlRunnerNextElapse(t *testing.T) {
+	logPath := installFakeSystemctl(t)
+	runner := &DefaultSystemctlRunner{}
+
+	tests := []struct {
+		name    string
+		output  string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "scheduled", output: "@1760601600", want: time.Unix(1760601600, 0)},
+		{name: "not scheduled", output: ""},
+		{name: "not applicable", output: "n/a"},
+		{name: "unexpected format", output: "Thu 2025-10-16 08:00:00 UTC", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("UPDEX_SYSTEMCTL_OUTPUT", tt.output)
+			got, err := runner.NextElapse("updex.timer")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NextElapse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextElapse() = %v, want %v", got, tt.want)
+			}
+			assertSystemctlArgs(t, logPath, "show\n--property=NextElapseUSecRealtime\n--value\n--timestamp=unix\nupdex.timer")
+		})
+	}
+}
+
 func assertSystemctlArgs(t *testing.T, logPath, want string) {
 	t.Helper()
 
@@ -124,7 +156,7 @@ func installFakeSystemctl(t *testing.T) string {
 	dir := t.TempDir()
 	logPath := filepath.Join(dir, "arguments")
 	scriptPath := filepath.Join(dir, "systemctl")
-	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > \"$UPDEX_SYSTEMCTL_LOG\"\nexit \"${UPDEX_SYSTEMCTL_EXIT:-0}\"\n"
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > \"$UPDEX_SYSTEMCTL_LOG\"\nprintf '%s\\n' \"$UPDEX_SYSTEMCTL_OUTPUT\"\nexit \"${UPDEX_SYSTEMCTL_EXIT:-0}\"\n"
 	if err := os.WriteFile(scriptPath, []byte(script), 0o755); err != nil {
 		t.Fatalf("write fake systemctl: %v", err)
 	}
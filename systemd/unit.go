@@ -3,7 +3,10 @@
 package systemd
 
 import (
+	"bufio"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -19,6 +22,12 @@ type TimerConfig struct {
 	Persistent bool
 	// RandomDelaySec randomizes the start time within this window (in seconds)
 	RandomDelaySec int
+	// OnBootSec also runs the timer this long after boot (in seconds); zero
+	// omits OnBootSec=
+	OnBootSec int
+	// AccuracySec is how far systemd may coalesce the start time (in
+	// seconds); zero keeps systemd's default of one minute
+	AccuracySec int
 }
 
 // ServiceConfig represents configuration for a systemd service unit.
@@ -35,6 +44,23 @@ type ServiceConfig struct {
 	// into the [Service] section. The auto-update daemon unit sets it; other
 	// callers keep the minimal unit unless they opt in.
 	Sandbox bool
+	// Nice is the CPU scheduling priority, -20 to 19; zero omits Nice=
+	Nice int
+	// IOSchedulingClass is "realtime", "best-effort" or "idle"; empty omits
+	// IOSchedulingClass=
+	IOSchedulingClass string
+	// CPUQuota caps CPU time as a percentage of one CPU; zero omits CPUQuota=
+	CPUQuota int
+	// NoDefaultDependencies writes DefaultDependencies=no, for units that
+	// run in early boot before basic.target
+	NoDefaultDependencies bool
+	// After and Before are space-separated units for the ordering
+	// directives of the same name; empty omits them
+	After  string
+	Before string
+	// WantedBy is the target that pulls the service in when it is enabled.
+	// Empty omits the [Install] section, for services a timer activates.
+	WantedBy string
 }
 
 // SandboxDirectives are the systemd hardening directives emitted, in this
@@ -44,7 +70,8 @@ type ServiceConfig struct {
 // read-only while leaving /var writable, so the default
 // /var/lib/extensions.d staging directory, the /var/lib/extensions link
 // directory, and hand-written transfers with a Target.Path elsewhere under
-// /var keep working. No CapabilityBoundingSet is set.
+// /var keep working. No CapabilityBoundingSet is set. The hooks updex runs
+// inherit them (ADR-0020).
 var SandboxDirectives = []string{
 	"NoNewPrivileges=yes",
 	"ProtectSystem=full",
@@ -80,12 +107,18 @@ func GenerateTimer(cfg *TimerConfig) string {
 	// [Timer] section
 	b.WriteString("[Timer]\n")
 	fmt.Fprintf(&b, "OnCalendar=%s\n", cfg.OnCalendar)
+	if cfg.OnBootSec > 0 {
+		fmt.Fprintf(&b, "OnBootSec=%ds\n", cfg.OnBootSec)
+	}
 	if cfg.Persistent {
 		b.WriteString("Persistent=true\n")
 	}
 	if cfg.RandomDelaySec > 0 {
 		fmt.Fprintf(&b, "RandomizedDelaySec=%ds\n", cfg.RandomDelaySec)
 	}
+	if cfg.AccuracySec > 0 {
+		fmt.Fprintf(&b, "AccuracySec=%ds\n", cfg.AccuracySec)
+	}
 	b.WriteString("\n")
 
 	// [Install] section
@@ -97,21 +130,40 @@ func GenerateTimer(cfg *TimerConfig) string {
 
 // GenerateService generates a systemd service unit file content from the config.
 // The returned string contains valid systemd unit file syntax with [Unit] and
-// [Service] sections. No [Install] section is generated since the timer
-// handles activation. When cfg.Sandbox is set, SandboxDirectives are appended
-// to the [Service] section after ExecStart.
+// [Service] sections. No [Install] section is generated unless cfg.WantedBy
+// is set, since a timer usually handles activation. Resource controls follow
+// ExecStart, and when cfg.Sandbox is set, SandboxDirectives are appended
+// after them.
 func GenerateService(cfg *ServiceConfig) string {
 	var b strings.Builder
 
 	// [Unit] section
 	b.WriteString("[Unit]\n")
 	fmt.Fprintf(&b, "Description=%s\n", cfg.Description)
+	if cfg.NoDefaultDependencies {
+		b.WriteString("DefaultDependencies=no\n")
+	}
+	if cfg.After != "" {
+		fmt.Fprintf(&b, "After=%s\n", cfg.After)
+	}
+	if cfg.Before != "" {
+		fmt.Fprintf(&b, "Before=%s\n", cfg.Before)
+	}
 	b.WriteString("\n")
 
 	// [Service] section
 	b.WriteString("[Service]\n")
 	fmt.Fprintf(&b, "Type=%s\n", cfg.Type)
 	fmt.Fprintf(&b, "ExecStart=%s\n", cfg.ExecStart)
+	if cfg.Nice != 0 {
+		fmt.Fprintf(&b, "Nice=%d\n", cfg.Nice)
+	}
+	if cfg.IOSchedulingClass != "" {
+		fmt.Fprintf(&b, "IOSchedulingClass=%s\n", cfg.IOSchedulingClass)
+	}
+	if cfg.CPUQuota > 0 {
+		fmt.Fprintf(&b, "CPUQuota=%d%%\n", cfg.CPUQuota)
+	}
 	if cfg.Sandbox {
 		for _, directive := range SandboxDirectives {
 			b.WriteString(directive)
@@ -119,5 +171,125 @@ func GenerateService(cfg *ServiceConfig) string {
 		}
 	}
 
+	// [Install] section
+	if cfg.WantedBy != "" {
+		b.WriteString("\n[Install]\n")
+		fmt.Fprintf(&b, "WantedBy=%s\n", cfg.WantedBy)
+	}
+
 	return b.String()
 }
+
+// ParseTimer reads back the settings GenerateTimer writes from timer unit
+// content. It is lenient: unknown keys and values in a form GenerateTimer
+// never writes are skipped rather than rejected, so callers compare
+// GenerateTimer of the result with content to tell whether the unit was
+// edited. Name is left empty.
+func ParseTimer(content string) *TimerConfig {
+	cfg := &TimerConfig{}
+	for _, e := range unitEntries(content) {
+		value := e.value
+		switch e.section + "." + e.key {
+		case "Unit.Description":
+			cfg.Description = value
+		case "Timer.OnCalendar":
+			cfg.OnCalendar = value
+		case "Timer.OnBootSec":
+			cfg.OnBootSec = parseSeconds(value)
+		case "Timer.Persistent":
+			cfg.Persistent = value == "true"
+		case "Timer.RandomizedDelaySec":
+			cfg.RandomDelaySec = parseSeconds(value)
+		case "Timer.AccuracySec":
+			cfg.AccuracySec = parseSeconds(value)
+		}
+	}
+	return cfg
+}
+
+// ParseService reads back the settings GenerateService writes from service
+// unit content, as ParseTimer does for timers. Sandbox is set when every
+// SandboxDirectives entry is present.
+func ParseService(content string) *ServiceConfig {
+	cfg := &ServiceConfig{}
+	var directives []string
+	for _, e := range unitEntries(content) {
+		value := e.value
+		switch e.section + "." + e.key {
+		case "Unit.Description":
+			cfg.Description = value
+		case "Unit.DefaultDependencies":
+			cfg.NoDefaultDependencies = value == "no"
+		case "Unit.After":
+			cfg.After = value
+		case "Unit.Before":
+			cfg.Before = value
+		case "Install.WantedBy":
+			cfg.WantedBy = value
+		case "Service.Type":
+			cfg.Type = value
+		case "Service.ExecStart":
+			cfg.ExecStart = value
+		case "Service.Nice":
+			cfg.Nice, _ = strconv.Atoi(value)
+		case "Service.IOSchedulingClass":
+			cfg.IOSchedulingClass = value
+		case "Service.CPUQuota":
+			if percent, ok := strings.CutSuffix(value, "%"); ok {
+				cfg.CPUQuota, _ = strconv.Atoi(percent)
+			}
+		}
+		if e.section == "Service" {
+			directives = append(directives, e.key+"="+value)
+		}
+	}
+	cfg.Sandbox = true
+	for _, directive := range SandboxDirectives {
+		if !slices.Contains(directives, directive) {
+			cfg.Sandbox = false
+			break
+		}
+	}
+	return cfg
+}
+
+// unitEntry is one key=value assignment in a unit file.
+type unitEntry struct {
+	section, key, value string
+}
+
+// unitEntries returns every assignment in unit file content in order,
+// skipping blank lines and comments.
+func unitEntries(content string) []unitEntry {
+	var entries []unitEntry
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			entries = append(entries, unitEntry{section, strings.TrimSpace(key), strings.TrimSpace(value)})
+		}
+	}
+	return entries
+}
+
+// parseSeconds parses a duration in the "<n>s" form the generators write,
+// returning zero for any other form.
+func parseSeconds(value string) int {
+	n, ok := strings.CutSuffix(value, "s")
+	if !ok {
+		return 0
+	}
+	seconds, err := strconv.Atoi(n)
+	if err != nil {
+		return 0
+	}
+	return seconds
+}
@@ -93,7 +93,27 @@ func TestGenerateTimer(t *testing.T) {
 				"[Install]",
 				"WantedBy=timers.target",
 			},
-			excludes: []string{},
+			excludes: []string{
+				"OnBootSec=",
+				"AccuracySec=",
+			},
+		},
+		{
+			name: "with boot delay and accuracy",
+			config: &TimerConfig{
+				Name:        "boot-timer",
+				Description: "Timer that also runs after boot",
+				OnCalendar:  "weekly",
+				OnBootSec:   900,
+				AccuracySec: 3600,
+			},
+			contains: []string{
+				"OnCalendar=weekly\nOnBootSec=900s\n",
+				"AccuracySec=3600s\n",
+			},
+			excludes: []string{
+				"RandomizedDelaySec=",
+			},
 		},
 	}
 
@@ -156,6 +176,21 @@ func TestGenerateService(t *testing.T) {
 				"ExecStart=/usr/bin/updex update --quiet",
 			},
 		},
+		{
+			name: "resource controls",
+			config: &ServiceConfig{
+				Name:              "updex-update",
+				Description:       "Automatic sysext update",
+				ExecStart:         "/usr/bin/updex update --quiet",
+				Type:              "oneshot",
+				Nice:              -5,
+				IOSchedulingClass: "idle",
+				CPUQuota:          50,
+			},
+			contains: []string{
+				"ExecStart=/usr/bin/updex update --quiet\nNice=-5\nIOSchedulingClass=idle\nCPUQuota=50%\n",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -301,3 +336,85 @@ func TestGenerateServiceWithoutSandbox(t *testing.T) {
 		}
 	}
 }
+
+// TestParseUnitsRoundTrip pins that ParseTimer and ParseService read back
+// every setting the generators write.
+func TestParseUnitsRoundTrip(t *testing.T) {
+	timer := &TimerConfig{
+		Description:    "Automatic sysext updates",
+		OnCalendar:     "Sun *-*-* 03:00:00",
+		Persistent:     true,
+		RandomDelaySec: 3600,
+		OnBootSec:      900,
+		AccuracySec:    60,
+	}
+	if got := ParseTimer(GenerateTimer(timer)); *got != *timer {
+		t.Errorf("ParseTimer() = %+v, want %+v", got, timer)
+	}
+
+	service := &ServiceConfig{
+		Description:       "Automatic sysext update service",
+		ExecStart:         "/usr/bin/updex features update --no-refresh",
+		Type:              "oneshot",
+		Sandbox:           true,
+		Nice:              10,
+		IOSchedulingClass: "best-effort",
+		CPUQuota:          25,
+	}
+	if got := ParseService(GenerateService(service)); *got != *service {
+		t.Errorf("ParseService() = %+v, want %+v", got, service)
+	}
+
+	boot := &ServiceConfig{
+		Description:           "Apply staged sysext updates",
+		ExecStart:             "/usr/bin/updex apply --no-refresh",
+		Type:                  "oneshot",
+		NoDefaultDependencies: true,
+		After:                 "local-fs.target",
+		Before:                "systemd-sysext.service sysinit.target",
+		WantedBy:              "sysinit.target",
+	}
+	if got := ParseService(GenerateService(boot)); *got != *boot {
+		t.Errorf("ParseService() = %+v, want %+v", got, boot)
+	}
+}
+
+func TestGenerateServiceEarlyBoot(t *testing.T) {
+	got := GenerateService(&ServiceConfig{
+		Name:                  "updex-apply",
+		Description:           "Apply staged sysext updates",
+		ExecStart:             "/usr/bin/updex apply --no-refresh",
+		Type:                  "oneshot",
+		NoDefaultDependencies: true,
+		After:                 "local-fs.target",
+		Before:                "systemd-sysext.service",
+		WantedBy:              "sysinit.target",
+	})
+	want := "[Unit]\n" +
+		"Description=Apply staged sysext updates\n" +
+		"DefaultDependencies=no\n" +
+		"After=local-fs.target\n" +
+		"Before=systemd-sysext.service\n" +
+		"\n" +
+		"[Service]\n" +
+		"Type=oneshot\n" +
+		"ExecStart=/usr/bin/updex apply --no-refresh\n" +
+		"\n" +
+		"[Install]\n" +
+		"WantedBy=sysinit.target\n"
+	if got != want {
+		t.Errorf("GenerateService() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseServiceIsLenient(t *testing.T) {
+	content := "# edited\n[Service]\nExecStart=/bin/true\nCPUQuota=half\nNoNewPrivileges=yes\nnot an assignment\n"
+	got := ParseService(content)
+	want := &ServiceConfig{ExecStart: "/bin/true"}
+	if *got != *want {
+		t.Errorf("ParseService() = %+v, want %+v", got, want)
+	}
+	if GenerateService(got) == content {
+		t.Error("an edited service regenerates to the same content")
+	}
+}
@@ -0,0 +1,143 @@
+package updex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/frostyard/updex/sysext"
+	"github.com/frostyard/updex/version"
+)
+
+// Apply installs the versions staged by UpdateFeatures with Stage set: for
+// every enabled feature's transfer with a staged image, the image is moved
+// into the target directory, marked read-only as the transfer asks, linked
+// and old versions vacuumed, as an update would have. systemd-sysext is
+// refreshed once at the end unless opts.NoRefresh.
+//
+// Only transfers with a staged image are reported. A component that fails
+// keeps its staged image for the next Apply; the others are applied all the
+// same.
+func (c *Client) Apply(ctx context.Context, opts ApplyOptions) ([]ApplyResult, error) {
+	ctx, unlock, err := c.lock(ctx, !opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	features, transfers, err := c.loadDomain(opts.Component)
+	if err != nil {
+		return nil, err
+	}
+
+	// Non-nil so that nothing staged serializes as JSON `[]`.
+	results := make([]ApplyResult, 0)
+	var errs []error
+	for _, job := range enabledTransferJobs(features, transfers) {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		staged, filename, err := sysext.StagedVersionAt(job.transfer, c.paths.sysextLinkDir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", job.transfer.Component, err))
+			results = append(results, ApplyResult{Feature: job.feature, Component: job.transfer.Component, DryRun: opts.DryRun, Error: err.Error()})
+			continue
+		}
+		if staged == "" {
+			continue
+		}
+
+		result, err := c.applyTransfer(ctx, job, staged, filename, opts)
+		if err != nil {
+			result.Error = err.Error()
+			c.event(Event{
+				Type: EventApplyFailed, Warning: true, Feature: job.feature, Transfer: job.transfer.Component, Version: staged,
+				Message: fmt.Sprintf("%s: %s", job.transfer.Component, result.Error),
+			})
+			errs = append(errs, fmt.Errorf("%s: %w", job.transfer.Component, err))
+		}
+		results = append(results, result)
+	}
+
+	var refreshErr error
+	switch {
+	case opts.DryRun || len(results) == len(errs):
+		// Nothing was linked.
+	case opts.NoRefresh:
+		c.msg("Skipping sysext refresh (--no-refresh)")
+	default:
+		if err := c.runner.Refresh(); err != nil {
+			refreshErr = fmt.Errorf("sysext refresh failed: %w", err)
+			c.event(Event{Type: EventRefreshFailed, Warning: true, Message: refreshErr.Error()})
+			break
+		}
+		for i := range results {
+			if r := results[i]; r.Error == "" {
+				_ = c.runHooks(ctx, HookPostRefresh, hookEnv{feature: r.Feature, transfer: r.Component, oldVersion: r.FromVersion, newVersion: r.Version})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return results, errors.Join(fmt.Errorf("one or more components failed to apply"), refreshErr)
+	}
+	return results, refreshErr
+}
+
+// applyTransfer installs version staged, held in the staged file filename,
+// for job's transfer. A pre-update hook that fails leaves it staged.
+func (c *Client) applyTransfer(ctx context.Context, job transferJob, staged, filename string, opts ApplyOptions) (ApplyResult, error) {
+	t := job.transfer
+	result := ApplyResult{
+		Feature:   job.feature,
+		Component: t.Component,
+		Version:   staged,
+		DryRun:    opts.DryRun,
+	}
+
+	_, current, err := sysext.GetInstalledVersionsAt(t, c.paths.sysextLinkDir)
+	if err != nil {
+		return result, fmt.Errorf("failed to inspect installed versions: %w", err)
+	}
+	result.FromVersion = current
+
+	if opts.DryRun {
+		c.msg("Would apply %s %s", t.Component, staged)
+		return result, nil
+	}
+
+	// Read-only marking is deferred from staging to here; the @r field of
+	// the installed name overrides the transfer, as on download.
+	readOnly := t.Target.ReadOnly
+	if patterns, err := version.ParsePatterns(t.Target.Patterns()); len(patterns) > 0 {
+		if fields, ok := version.ExtractFieldsParsed(filename, patterns); ok && fields.HasReadOnly {
+			readOnly = fields.ReadOnly
+		}
+	} else if err != nil {
+		return result, fmt.Errorf("invalid target pattern: %w", err)
+	}
+
+	hook := hookEnv{feature: job.feature, transfer: t.Component, oldVersion: current, newVersion: staged}
+	if err := c.runHooks(ctx, HookPreUpdate, hook); err != nil {
+		return result, err
+	}
+
+	if t.Target.CurrentSymlink != "" {
+		if err := sysext.RemoveLegacyCurrentSymlinkAt(t, c.paths.sysextLinkDir); err != nil {
+			c.warn("failed to remove legacy symlink for %s: %v", t.Component, err)
+		}
+	}
+	_, path, err := sysext.PromoteStagedAt(t, c.paths.sysextLinkDir)
+	if err != nil {
+		return result, err
+	}
+	// Post-refresh hooks run in Apply, after the batched refresh.
+	if _, err := c.activateInstalled(ctx, t, path, readOnly, installTransferOptions{
+		NoRefresh: true, // refresh is batched at the end
+		NoVacuum:  opts.NoVacuum,
+	}, hook); err != nil {
+		return result, err
+	}
+	c.event(Event{Type: EventApplied, Feature: job.feature, Transfer: t.Component, Version: staged, Message: fmt.Sprintf("Applied %s %s", t.Component, staged)})
+	return result, nil
+}
@@ -0,0 +1,144 @@
+package updex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frostyard/updex/internal/testutil"
+	"github.com/frostyard/updex/sysext"
+)
+
+// stagingFixture serves testext 1.0.0 and 1.1.0, defines testfeature
+// (enabled) and installs 1.0.0. It returns the client, the sysext link
+// path, the target directory, and a pointer to the number of refreshes the
+// client has run.
+func stagingFixture(t *testing.T) (client *Client, linkPath, targetDir string, refreshes *int) {
+	t.Helper()
+	root := t.TempDir()
+	defDir := filepath.Join(root, "sysupdate.d")
+	targetDir = t.TempDir()
+	linkDir := t.TempDir()
+
+	v1, v11 := []byte("ext v1.0.0"), []byte("ext v1.1.0")
+	server := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Files:   map[string]string{"testext_1.0.0.raw": hashContent(v1), "testext_1.1.0.raw": hashContent(v11)},
+		Content: map[string][]byte{"testext_1.0.0.raw": v1, "testext_1.1.0.raw": v11},
+	})
+	t.Cleanup(server.Close)
+
+	writeComponentFeature(t, defDir, "testfeature", true)
+	createFeatureTransferFileWithoutCurrentSymlink(t, defDir, "testext", "testfeature", server.URL, targetDir)
+
+	refreshes = new(int)
+	client = NewClient(ClientConfig{
+		Paths: RuntimePaths{
+			DefinitionRoots: []string{root},
+			SysextLinkDir:   linkDir,
+			StateDir:        t.TempDir(),
+		},
+		SysextRunner: &catalogPathRunner{onRefresh: func() { *refreshes++ }},
+	})
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true, Version: "1.0.0"}); err != nil {
+		t.Fatalf("install 1.0.0: %v", err)
+	}
+	return client, filepath.Join(linkDir, "testext.raw"), targetDir, refreshes
+}
+
+// TestStageAndApply verifies that a staged update downloads the new version
+// without installing or linking it, and that Apply installs, links and
+// refreshes it once.
+func TestStageAndApply(t *testing.T) {
+	client, linkPath, targetDir, refreshes := stagingFixture(t)
+	ctx := t.Context()
+
+	results, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{Stage: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures(Stage) failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Version != "1.1.0" || !r.Downloaded || !r.Staged {
+		t.Errorf("staged result = %+v, want 1.1.0 downloaded and staged", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+	if _, err := os.Stat(filepath.Join(targetDir, "testext_1.1.0.raw")); !os.IsNotExist(err) {
+		t.Errorf("staged image installed in the target directory: %v", err)
+	}
+	if *refreshes != 0 {
+		t.Errorf("staging refreshed systemd-sysext %d times", *refreshes)
+	}
+
+	checks, err := client.CheckFeatures(ctx, CheckFeaturesOptions{})
+	if err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	if c := checks[0].Results[0]; c.StagedVersion != "1.1.0" || !c.UpdateAvailable {
+		t.Errorf("CheckFeatures = %+v, want 1.1.0 staged and still an update", c)
+	}
+
+	// Staging again finds the image already staged.
+	results, err = client.UpdateFeatures(ctx, UpdateFeaturesOptions{Stage: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures(Stage) again failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Downloaded || !r.Staged {
+		t.Errorf("second staged result = %+v, want already staged", r)
+	}
+
+	applied, err := client.Apply(ctx, ApplyOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Apply(DryRun) failed: %v", err)
+	}
+	want := ApplyResult{Feature: "testfeature", Component: "testext", FromVersion: "1.0.0", Version: "1.1.0", DryRun: true}
+	if len(applied) != 1 || applied[0] != want {
+		t.Errorf("Apply(DryRun) = %+v, want [%+v]", applied, want)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+
+	applied, err = client.Apply(ctx, ApplyOptions{})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	want.DryRun = false
+	if len(applied) != 1 || applied[0] != want {
+		t.Errorf("Apply = %+v, want [%+v]", applied, want)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.1.0.raw")
+	if *refreshes != 1 {
+		t.Errorf("Apply refreshed systemd-sysext %d times, want 1", *refreshes)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(targetDir, sysext.StagedDirName)); len(entries) != 0 {
+		t.Errorf("staging directory after Apply = %v, want empty", entries)
+	}
+
+	applied, err = client.Apply(ctx, ApplyOptions{})
+	if err != nil || len(applied) != 0 || applied == nil {
+		t.Errorf("Apply with nothing staged = %#v, %v, want an empty non-nil slice", applied, err)
+	}
+	if *refreshes != 1 {
+		t.Error("Apply with nothing staged refreshed systemd-sysext")
+	}
+}
+
+// TestUpdateInstallsStagedImage verifies that a normal update installs a
+// version staged earlier without downloading it again.
+func TestUpdateInstallsStagedImage(t *testing.T) {
+	client, linkPath, _, _ := stagingFixture(t)
+	ctx := t.Context()
+
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{Stage: true}); err != nil {
+		t.Fatalf("UpdateFeatures(Stage) failed: %v", err)
+	}
+	results, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Version != "1.1.0" || r.Downloaded || r.Staged {
+		t.Errorf("update result = %+v, want the staged 1.1.0 installed without a download", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.1.0.raw")
+
+	applied, err := client.Apply(ctx, ApplyOptions{})
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Apply after the update = %+v, %v, want nothing staged", applied, err)
+	}
+}
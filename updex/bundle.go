@@ -0,0 +1,440 @@
+package updex
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/frostyard/updex/config"
+	"github.com/frostyard/updex/download"
+	"github.com/frostyard/updex/internal/fileurl"
+	"github.com/frostyard/updex/manifest"
+	"github.com/frostyard/updex/sysext"
+	"github.com/frostyard/updex/version"
+)
+
+// A bundle is an uncompressed tar archive laid out as
+//
+//	definitions/<feature>.feature
+//	definitions/<component>.transfer
+//	sources/<component>/SHA256SUMS
+//	sources/<component>/SHA256SUMS.gpg
+//	sources/<component>/<image>
+//
+// Each sources/<component> directory is a copy of the transfer's source
+// reduced to the image BundleExport selected, so BundleImport can install
+// from it as from any local mirror. Only the SHA256SUMS signature is
+// trusted: the definitions are carried for reference and are never
+// installed, because nothing signs them.
+const (
+	bundleDefinitionsDir = "definitions"
+	bundleSourcesDir     = "sources"
+)
+
+// bundleExtractDir is where BundleImport unpacks a bundle. Its images can
+// run to gigabytes, more than a tmpfs /tmp may hold, so it is on disk.
+var bundleExtractDir = "/var/tmp"
+
+// maxBundleExtractSize caps the bytes extractBundle writes.
+var maxBundleExtractSize int64 = 64 << 30
+
+// BundleExport writes an offline bundle to path holding, for every transfer
+// of the selected features, the image an update would install (its pin, or
+// the newest its source offers this host) together with the signed
+// SHA256SUMS that lists it, plus the features' and transfers'
+// definition files. Every source must carry a valid detached signature,
+// whatever the transfer's Verify= setting: an importing host trusts nothing
+// else in the bundle. OCI sources publish no signed SHA256SUMS and cannot be
+// bundled. path is replaced atomically.
+func (c *Client) BundleExport(ctx context.Context, path string, opts BundleExportOptions) (*BundleExportResult, error) {
+	ctx, unlock, err := c.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	features, transfers, err := c.loadDomain(opts.Component)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := bundleFeatures(features, opts.Features)
+	if err != nil {
+		return nil, err
+	}
+
+	staging, err := os.MkdirTemp(filepath.Dir(path), ".updex-bundle-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(staging) }()
+
+	result := &BundleExportResult{Path: path, Features: make([]string, 0), Images: make([]BundleImage, 0)}
+	definitions := make(map[string]string) // archive name -> local path
+	manifests := newManifestCache()
+	for _, f := range selected {
+		result.Features = append(result.Features, f.Name)
+		definitions[filepath.Base(f.FilePath)] = f.FilePath
+		for _, t := range config.GetTransfersForFeature(transfers, f.Name) {
+			if _, ok := definitions[filepath.Base(t.FilePath)]; ok {
+				continue // shared with a feature already exported
+			}
+			definitions[filepath.Base(t.FilePath)] = t.FilePath
+
+			c.msg("Exporting %s/%s", f.Name, t.Component)
+			image, err := c.exportTransfer(ctx, t, staging, manifests)
+			if err != nil {
+				return nil, fmt.Errorf("failed to export %s: %w", t.Component, err)
+			}
+			result.Images = append(result.Images, image)
+		}
+	}
+	if len(result.Images) == 0 {
+		return nil, fmt.Errorf("no transfers to bundle")
+	}
+
+	for name, src := range definitions {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read definition: %w", err)
+		}
+		dst := filepath.Join(staging, bundleDefinitionsDir, name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, fmt.Errorf("failed to stage definition: %w", err)
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to stage definition: %w", err)
+		}
+	}
+
+	if err := writeBundle(staging, path); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	c.msg("Wrote %d image(s) to %s", len(result.Images), path)
+
+	return result, nil
+}
+
+// bundleFeatures resolves BundleExportOptions.Features: the named features,
+// or every enabled one when none are named.
+func bundleFeatures(features []*config.Feature, names []string) ([]*config.Feature, error) {
+	if len(names) == 0 {
+		var enabled []*config.Feature
+		for _, f := range features {
+			if f.Enabled && !f.Masked {
+				enabled = append(enabled, f)
+			}
+		}
+		return enabled, nil
+	}
+	var selected []*config.Feature
+	for _, name := range names {
+		f, err := lookupFeature(features, name, "exported")
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(selected, f) {
+			selected = append(selected, f)
+		}
+	}
+	return selected, nil
+}
+
+// exportTransfer stages the image of transfer an update would install (see
+// exportVersion), with the signed SHA256SUMS listing it, under dir's
+// sources/<component>.
+func (c *Client) exportTransfer(ctx context.Context, transfer *config.Transfer, dir string, manifests *manifestCache) (BundleImage, error) {
+	if transfer.Source.Type == "oci" {
+		return BundleImage{}, fmt.Errorf("oci sources publish no signed SHA256SUMS and cannot be bundled")
+	}
+	signed := *transfer
+	signed.Transfer.Verify = true
+	available, m, patterns, err := c.cachedAvailableVersions(ctx, &signed, manifests)
+	if err != nil {
+		return BundleImage{}, fmt.Errorf("failed to get available versions: %w", err)
+	}
+	v, err := c.exportVersion(transfer, m, patterns, available)
+	if err != nil {
+		return BundleImage{}, err
+	}
+
+	sourceFile, expectedHash, err := sourceFileFor(m, patterns, v)
+	if err != nil {
+		return BundleImage{}, err
+	}
+	if !validBundleName(sourceFile) {
+		return BundleImage{}, fmt.Errorf("invalid image file name in manifest: %q", sourceFile)
+	}
+
+	componentDir := filepath.Join(dir, bundleSourcesDir, transfer.Component)
+	if err := os.MkdirAll(componentDir, 0755); err != nil {
+		return BundleImage{}, fmt.Errorf("failed to stage source: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(componentDir, "SHA256SUMS"), m.Document, 0644); err != nil {
+		return BundleImage{}, fmt.Errorf("failed to stage manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(componentDir, "SHA256SUMS.gpg"), m.Signature, 0644); err != nil {
+		return BundleImage{}, fmt.Errorf("failed to stage signature: %w", err)
+	}
+
+	// The image is kept exactly as served so it still matches its
+	// SHA256SUMS line; the importing host decompresses it on install.
+	urls := m.FileURLs(sourceFile)
+	c.debug("downloading %s → bundle", urls[0])
+	err = download.Download(ctx, c.httpClient, urls[0], filepath.Join(componentDir, sourceFile), expectedHash, 0644, c.config.OnDownloadProgress,
+		download.WithRetryNotify(c.retryNotify("download")),
+		download.WithRaw(),
+		download.WithMirrors(urls[1:]...),
+		download.WithFailoverNotify(c.failoverNotify("download")),
+		download.WithRateLimit(c.limiter),
+	)
+	if err != nil {
+		return BundleImage{}, fmt.Errorf("download failed: %w", err)
+	}
+
+	return BundleImage{Component: transfer.Component, Version: v, File: sourceFile}, nil
+}
+
+// exportVersion picks the version of transfer to bundle from available as
+// an update would: its pin, else the newest version phasing offers this
+// host.
+func (c *Client) exportVersion(transfer *config.Transfer, m *manifest.Manifest, patterns []*version.Pattern, available []string) (string, error) {
+	if len(available) == 0 {
+		return "", fmt.Errorf("no versions available")
+	}
+	if pin := transfer.Transfer.PinVersion; pin != "" {
+		if !slices.Contains(available, pin) {
+			return "", fmt.Errorf("pinned version %s is not available", pin)
+		}
+		return pin, nil
+	}
+	installed, _, err := sysext.GetInstalledVersionsAt(transfer, c.paths.sysextLinkDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect installed versions: %w", err)
+	}
+	version.Sort(available)
+	accepted, heldBack := c.phase(transfer, m, patterns, available, installed)
+	if len(accepted) == 0 {
+		return "", fmt.Errorf("no versions available: %s is held back by phasing", heldBack)
+	}
+	if heldBack != "" {
+		c.msg("%s %s is held back by phasing", transfer.Component, heldBack)
+	}
+	return accepted[0], nil
+}
+
+// BundleImport installs the images of an offline bundle written by
+// BundleExport. The bundle's SHA256SUMS signatures are checked against the
+// local keyring, whatever the transfers' Verify= settings, and each image is
+// installed through the same path as UpdateFeatures: hash check, sysext
+// link, vacuum, and one batched refresh at the end. Images are matched to
+// this host's enabled transfers by component name; the host's own
+// definitions decide the target, and images with no enabled transfer here
+// are reported and skipped.
+func (c *Client) BundleImport(ctx context.Context, path string, opts BundleImportOptions) ([]UpdateFeaturesResult, error) {
+	ctx, unlock, err := c.lock(ctx, !opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	features, transfers, err := c.loadDomain(opts.Component)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(bundleExtractDir, "updex-bundle-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	if err := extractBundle(path, dir); err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	sources := filepath.Join(dir, bundleSourcesDir)
+	entries, err := os.ReadDir(sources)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	bundled := make(map[string]bool)
+	for _, e := range entries {
+		bundled[e.Name()] = true
+	}
+
+	var jobs []transferJob
+	matched := make(map[string]bool)
+	for _, job := range enabledTransferJobs(features, transfers) {
+		if !bundled[job.transfer.Component] {
+			continue
+		}
+		matched[job.transfer.Component] = true
+		t := *job.transfer
+		// Read from the extracted copy, never the network, and require
+		// the signature the bundle was exported with.
+		if t.Source.Type == "oci" {
+			t.Source.Type = "url-file"
+		}
+		t.Source.Path = fileurl.FromPath(filepath.Join(sources, t.Component))
+		t.Source.Mirrors = nil
+		t.Transfer.Verify = true
+		jobs = append(jobs, transferJob{feature: job.feature, transfer: &t, def: job.def})
+	}
+	for _, e := range entries {
+		if !matched[e.Name()] {
+			c.warn("bundle image for %s has no enabled transfer here; skipped", e.Name())
+		}
+	}
+	if len(jobs) == 0 {
+		return make([]UpdateFeaturesResult, 0), fmt.Errorf("bundle holds no image for an enabled transfer")
+	}
+
+	return c.updateJobs(ctx, jobs, UpdateFeaturesOptions{
+		DryRun:    opts.DryRun,
+		NoRefresh: opts.NoRefresh,
+		NoVacuum:  opts.NoVacuum,
+	})
+}
+
+// writeBundle archives every file under dir, in lexical order, to a
+// temporary file beside path and renames it into place.
+func writeBundle(dir, path string) (err error) {
+	out, err := os.CreateTemp(filepath.Dir(path), ".updex-bundle-*.tar")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(out.Name())
+		}
+	}()
+
+	tw := tar.NewWriter(out)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     filepath.ToSlash(name),
+			Mode:     0644,
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := out.Chmod(0644); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), path)
+}
+
+// extractBundle unpacks the bundle at path into dir. Only regular files in
+// the bundle layout are accepted, so a crafted archive cannot write outside
+// dir or plant links, and no more than maxBundleExtractSize bytes in all.
+func extractBundle(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	var total int64
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		name, ok := bundleEntryPath(hdr.Name)
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("unexpected bundle entry %q", hdr.Name)
+		}
+		if total += hdr.Size; total > maxBundleExtractSize {
+			return fmt.Errorf("bundle holds more than %d bytes", maxBundleExtractSize)
+		}
+		dst := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(out, tr, hdr.Size)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// bundleEntryPath returns the local relative path for an archive member
+// name, reporting false unless the name is definitions/<file> or
+// sources/<component>/<file>.
+func bundleEntryPath(name string) (string, bool) {
+	parts := strings.Split(name, "/")
+	switch {
+	case len(parts) == 2 && parts[0] == bundleDefinitionsDir:
+	case len(parts) == 3 && parts[0] == bundleSourcesDir:
+	default:
+		return "", false
+	}
+	for _, p := range parts[1:] {
+		if !validBundleName(p) {
+			return "", false
+		}
+	}
+	return filepath.Join(parts...), true
+}
+
+// validBundleName reports whether name can be used as a single path element
+// in a bundle.
+func validBundleName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,268 @@
+package updex
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/updex/internal/testutil"
+	"github.com/frostyard/updex/sysext"
+)
+
+// stageBundle writes files (archive name -> content) into a staging
+// directory and archives them with writeBundle, returning the bundle path.
+func stageBundle(t *testing.T, files map[string]string) string {
+	t.Helper()
+	staging := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(staging, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "bundle.tar")
+	if err := writeBundle(staging, path); err != nil {
+		t.Fatalf("writeBundle() error = %v", err)
+	}
+	return path
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	files := map[string]string{
+		"definitions/devel.feature":        "[Feature]\n",
+		"definitions/tools.transfer":       "[Transfer]\n",
+		"sources/tools/SHA256SUMS":         "sums\n",
+		"sources/tools/SHA256SUMS.gpg":     "sig",
+		"sources/tools/tools_1.0.0.raw.xz": "image",
+	}
+	path := stageBundle(t, files)
+
+	dir := t.TempDir()
+	if err := extractBundle(path, dir); err != nil {
+		t.Fatalf("extractBundle() error = %v", err)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// TestExtractBundleRejectsUnexpectedEntries pins that a crafted archive
+// cannot write outside the extraction directory, plant links, or add files
+// outside the bundle layout.
+func TestExtractBundleRejectsUnexpectedEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		typeflag byte
+	}{
+		{"../escape", tar.TypeReg},
+		{"/etc/passwd", tar.TypeReg},
+		{"sources/tools/../../escape", tar.TypeReg},
+		{"sources/../definitions/x.transfer", tar.TypeReg},
+		{"sources/tools/nested/image.raw", tar.TypeReg},
+		{"other/file", tar.TypeReg},
+		{"sources/tools/image.raw", tar.TypeSymlink},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bundle.tar")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tw := tar.NewWriter(f)
+			hdr := &tar.Header{Typeflag: tt.typeflag, Name: tt.name, Mode: 0644, Linkname: "/etc/shadow"}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			dir := filepath.Join(t.TempDir(), "extract")
+			err = extractBundle(path, dir)
+			if err == nil || !strings.Contains(err.Error(), "unexpected bundle entry") {
+				t.Fatalf("extractBundle() error = %v, want unexpected bundle entry", err)
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape")); !os.IsNotExist(err) {
+				t.Error("entry was written outside the extraction directory")
+			}
+		})
+	}
+}
+
+// TestExtractBundleSizeCap pins that a bundle unpacking to more than
+// maxBundleExtractSize bytes is refused.
+func TestExtractBundleSizeCap(t *testing.T) {
+	path := stageBundle(t, map[string]string{
+		"sources/tools/SHA256SUMS":      "sums\n",
+		"sources/tools/tools_1.0.0.raw": strings.Repeat("x", 64),
+	})
+	defer func(old int64) { maxBundleExtractSize = old }(maxBundleExtractSize)
+	maxBundleExtractSize = 32
+
+	err := extractBundle(path, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "bundle holds more than 32 bytes") {
+		t.Fatalf("extractBundle() error = %v, want the size cap", err)
+	}
+}
+
+// TestExportVersion verifies that an export picks the version an update
+// would: the pin, else the newest version phasing offers this host.
+func TestExportVersion(t *testing.T) {
+	client, _ := phasingFixture(t, "0", "0123456789abcdef0123456789abcdef")
+	_, transfers, err := client.loadDomain("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	available, m, patterns, err := client.getAvailableVersions(t.Context(), transfers[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := client.exportVersion(transfers[0], m, patterns, available); err != nil || v != "1.0.0" {
+		t.Errorf("exportVersion() = %q, %v, want 1.0.0 with 1.1.0 held back", v, err)
+	}
+	pinned := *transfers[0]
+	pinned.Transfer.PinVersion = "1.1.0"
+	if v, err := client.exportVersion(&pinned, m, patterns, available); err != nil || v != "1.1.0" {
+		t.Errorf("exportVersion(pinned) = %q, %v, want the pinned 1.1.0", v, err)
+	}
+	pinned.Transfer.PinVersion = "2.0.0"
+	if _, err := client.exportVersion(&pinned, m, patterns, available); err == nil || !strings.Contains(err.Error(), "pinned version 2.0.0 is not available") {
+		t.Errorf("exportVersion(unavailable pin) error = %v, want it refused", err)
+	}
+}
+
+// TestBundleExport_RequiresSignedSource pins that a bundle is never written
+// from a source without a valid detached signature, even for a transfer
+// with Verify=no: the importing host trusts nothing else in it.
+func TestBundleExport_RequiresSignedSource(t *testing.T) {
+	server := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Content: map[string][]byte{"tools_1.0.0.raw": []byte("image")},
+	})
+	defer server.Close()
+
+	configDir := t.TempDir()
+	createFeatureFile(t, configDir, "devel", true)
+	writeCheckTransfer(t, configDir, "tools", "devel", server.URL, t.TempDir(), false)
+
+	client := NewClient(ClientConfig{Definitions: configDir, SysextRunner: &sysext.MockRunner{}})
+	path := filepath.Join(t.TempDir(), "bundle.tar")
+	_, err := client.BundleExport(t.Context(), path, BundleExportOptions{})
+	if err == nil || !strings.Contains(err.Error(), "signature verification failed") {
+		t.Fatalf("BundleExport() error = %v, want signature verification failure", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("bundle written despite the failure (stat error = %v)", err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 0 {
+		t.Errorf("staging files left behind: %v", entries)
+	}
+}
+
+func TestBundleExport_UnknownFeature(t *testing.T) {
+	configDir := t.TempDir()
+	createFeatureFile(t, configDir, "devel", true)
+
+	client := NewClient(ClientConfig{Definitions: configDir, SysextRunner: &sysext.MockRunner{}})
+	_, err := client.BundleExport(t.Context(), filepath.Join(t.TempDir(), "bundle.tar"), BundleExportOptions{Features: []string{"missing"}})
+	if err == nil || !strings.Contains(err.Error(), "feature 'missing' not found") {
+		t.Fatalf("BundleExport() error = %v, want unknown feature error", err)
+	}
+}
+
+// TestBundleImport_RejectsUnverifiedBundle pins that import checks the
+// bundle's signature against the local keyring even when the host's
+// transfer sets Verify=no, and installs nothing when the check fails.
+func TestBundleImport_RejectsUnverifiedBundle(t *testing.T) {
+	image := "image"
+	path := stageBundle(t, map[string]string{
+		"sources/tools/SHA256SUMS":      fmt.Sprintf("%s  tools_1.0.0.raw\n", hashContent([]byte(image))),
+		"sources/tools/SHA256SUMS.gpg":  "not a signature",
+		"sources/tools/tools_1.0.0.raw": image,
+	})
+
+	configDir := t.TempDir()
+	targetDir := t.TempDir()
+	createFeatureFile(t, configDir, "devel", true)
+	writeCheckTransfer(t, configDir, "tools", "devel", "https://unreachable.invalid", targetDir, false)
+
+	runner := &sysext.MockRunner{}
+	client := NewClient(ClientConfig{
+		Definitions:  configDir,
+		SysextRunner: runner,
+		Paths:        RuntimePaths{DefinitionRoots: []string{t.TempDir()}, SysextLinkDir: t.TempDir()},
+	})
+	results, err := client.BundleImport(t.Context(), path, BundleImportOptions{NoRefresh: true})
+	if err == nil {
+		t.Fatal("BundleImport() error = nil, want failure")
+	}
+	if len(results) != 1 || len(results[0].Results) != 1 {
+		t.Fatalf("results = %+v, want one result for devel/tools", results)
+	}
+	if r := results[0].Results[0]; !strings.Contains(r.Error, "signature verification failed") || r.Installed {
+		t.Errorf("result = %+v, want a signature verification failure", r)
+	}
+	if entries, _ := os.ReadDir(targetDir); len(entries) != 0 {
+		t.Errorf("target has %v, want nothing installed", entries)
+	}
+	if runner.LinkToSysextCalled {
+		t.Error("unverified image was linked")
+	}
+}
+
+// TestBundleImport_ExtractsUnderExtractDir pins that a bundle is unpacked
+// under bundleExtractDir, not $TMPDIR.
+func TestBundleImport_ExtractsUnderExtractDir(t *testing.T) {
+	path := stageBundle(t, map[string]string{"sources/tools/SHA256SUMS": ""})
+	defer func(old string) { bundleExtractDir = old }(bundleExtractDir)
+	bundleExtractDir = filepath.Join(t.TempDir(), "missing")
+
+	configDir := t.TempDir()
+	createFeatureFile(t, configDir, "devel", true)
+	client := NewClient(ClientConfig{Definitions: configDir, SysextRunner: &sysext.MockRunner{}})
+	_, err := client.BundleImport(t.Context(), path, BundleImportOptions{DryRun: true})
+	if err == nil || !strings.Contains(err.Error(), "failed to create extraction directory") || !strings.Contains(err.Error(), bundleExtractDir) {
+		t.Fatalf("BundleImport() error = %v, want extraction under %s", err, bundleExtractDir)
+	}
+}
+
+func TestBundleImport_NoMatchingTransfer(t *testing.T) {
+	path := stageBundle(t, map[string]string{
+		"sources/other/SHA256SUMS":     "",
+		"sources/other/SHA256SUMS.gpg": "",
+	})
+
+	configDir := t.TempDir()
+	createFeatureFile(t, configDir, "devel", true)
+	writeCheckTransfer(t, configDir, "tools", "devel", "https://unreachable.invalid", t.TempDir(), false)
+
+	rec := &recordingReporter{}
+	client := NewClient(ClientConfig{Definitions: configDir, Progress: rec, SysextRunner: &sysext.MockRunner{}})
+	results, err := client.BundleImport(t.Context(), path, BundleImportOptions{})
+	if err == nil || !strings.Contains(err.Error(), "no image for an enabled transfer") {
+		t.Fatalf("BundleImport() error = %v, want no matching transfer error", err)
+	}
+	if results == nil || len(results) != 0 {
+		t.Errorf("results = %#v, want an empty non-nil slice", results)
+	}
+	if !strings.Contains(strings.Join(rec.lines, "\n"), "warning: bundle image for other has no enabled transfer here") {
+		t.Errorf("lines = %q, want a warning for the unmatched image", rec.lines)
+	}
+}
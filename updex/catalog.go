@@ -56,6 +56,12 @@ func (c *Client) catalogRepo(repos []catalog.Repo, name string) (catalog.Repo, e
 // a ListURL are skipped with a warning unless explicitly selected via
 // opts.Repo, in which case the missing ListURL is an error.
 func (c *Client) CatalogList(ctx context.Context, opts CatalogListOptions) ([]CatalogEntry, error) {
+	ctx, unlock, err := c.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	repos, err := c.catalogRepos()
 	if err != nil {
 		return nil, err
@@ -138,6 +144,12 @@ func (c *Client) CatalogList(ctx context.Context, opts CatalogListOptions) ([]Ca
 // then on the sysext is managed by the standard feature operations; only
 // CatalogRemove knows it came from a catalog.
 func (c *Client) CatalogAdd(ctx context.Context, name string, opts CatalogAddOptions) (*CatalogAddResult, error) {
+	ctx, unlock, err := c.lock(ctx, !opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	if err := catalog.ValidateSysextName(name); err != nil {
 		return nil, err
 	}
@@ -402,6 +414,9 @@ type filesystemEntrySnapshot struct {
 	kind       filesystemEntryKind
 	backupPath string
 	linkTarget string
+	// immutable records a staged image marked read-only with the immutable
+	// attribute, which the backup copy does not carry.
+	immutable bool
 }
 
 func snapshotFilesystemEntry(path string) (filesystemEntrySnapshot, error) {
@@ -451,9 +466,14 @@ func snapshotFilesystemEntry(path string) (filesystemEntrySnapshot, error) {
 		if err := backup.Close(); err != nil {
 			return snapshot, err
 		}
+		immutable, err := sysext.IsImmutable(path)
+		if err != nil {
+			return snapshot, err
+		}
 		removeBackup = false
 		snapshot.kind = filesystemEntryRegular
 		snapshot.backupPath = backupPath
+		snapshot.immutable = immutable
 	case info.Mode()&os.ModeSymlink != 0:
 		target, err := os.Readlink(path)
 		if err != nil {
@@ -477,9 +497,17 @@ func (s filesystemEntrySnapshot) restore() error {
 		if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
 			return fmt.Errorf("recreate parent for %s: %w", s.path, err)
 		}
+		if err := sysext.ClearReadOnly(s.path); err != nil {
+			return fmt.Errorf("restore %s: %w", s.path, err)
+		}
 		if err := os.Rename(s.backupPath, s.path); err != nil {
 			return fmt.Errorf("restore %s: %w", s.path, err)
 		}
+		if s.immutable {
+			if _, err := sysext.MarkReadOnly(s.path); err != nil {
+				return fmt.Errorf("restore %s: %w", s.path, err)
+			}
+		}
 	case filesystemEntrySymlink:
 		if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
 			return fmt.Errorf("recreate parent for %s: %w", s.path, err)
@@ -600,6 +628,10 @@ func (s catalogManagedStateSnapshot) restore() error {
 			if !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
 				continue
 			}
+			if err := sysext.ClearReadOnly(path); err != nil {
+				rollbackErrs = append(rollbackErrs, fmt.Errorf("remove newly staged image %s: %w", path, err))
+				continue
+			}
 			if err := os.Remove(path); err != nil {
 				rollbackErrs = append(rollbackErrs, fmt.Errorf("remove newly staged image %s: %w", path, err))
 			}
@@ -650,6 +682,12 @@ func matchesCatalogTarget(name string, patterns []*version.Pattern) bool {
 // .transfer/.feature files and drop-ins from the repo's /etc component
 // directory.
 func (c *Client) CatalogRemove(ctx context.Context, name string, opts CatalogRemoveOptions) (*CatalogRemoveResult, error) {
+	ctx, unlock, err := c.lock(ctx, !opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	if err := catalog.ValidateSysextName(name); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,223 @@
+package updex
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/frostyard/updex/config"
+	"github.com/frostyard/updex/sysext"
+	"github.com/frostyard/updex/version"
+)
+
+// channelPattern is what a channel name may contain. The name is
+// substituted into Source.Path URLs and directories, so it is a single path
+// segment of characters that need no escaping.
+var channelPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// channelPlan is what SwitchFeatureChannel does to one transfer: link
+// target, and remove stale, the images newer than target that the new
+// channel does not offer.
+type channelPlan struct {
+	transfer *config.Transfer
+	target   string
+	stale    []string
+}
+
+// SwitchFeatureChannel moves a feature to another release channel by
+// writing Channel= into the updex-owned drop-in (see
+// config.ApplyFeatureChannels for how transfers use it). An enabled
+// feature's installed versions are then reconciled with the new channel:
+// each transfer is switched to the newest version the channel offers, or
+// its pin, downloading or relinking it even when that is a downgrade, and
+// images newer than that which the channel does not offer are removed so a
+// later update cannot link them again.
+//
+// Every transfer's versions are listed before anything is changed: a
+// channel that cannot be fetched, or offers nothing, leaves the feature as
+// it was. The drop-in is written once every transfer is reconciled, so a
+// switch that fails part way leaves the feature on its previous channel. A
+// disabled feature only has its drop-in written.
+func (c *Client) SwitchFeatureChannel(ctx context.Context, name, channel string, opts SwitchFeatureChannelOptions) (*SwitchFeatureChannelResult, error) {
+	c.msg("Switching %s to channel %s", name, channel)
+
+	result := &SwitchFeatureChannelResult{
+		Feature: name,
+		Channel: channel,
+		DryRun:  opts.DryRun,
+	}
+	fail := func(err error) (*SwitchFeatureChannelResult, error) {
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+
+	if !channelPattern.MatchString(channel) {
+		return fail(fmt.Errorf("invalid channel %q", channel))
+	}
+
+	ctx, unlock, err := c.lock(ctx, !opts.DryRun)
+	if err != nil {
+		return fail(err)
+	}
+	defer unlock()
+
+	// The feature state is applied only once the new channel is set, so
+	// the transfers point at it before (or, in a dry run, without) the
+	// drop-in being written.
+	features, transfers, err := c.loadDefinitions(opts.Component)
+	if err != nil {
+		return fail(err)
+	}
+	f, err := lookupFeature(features, name, "switched")
+	if err != nil {
+		return fail(err)
+	}
+	result.PreviousChannel = cmp.Or(f.Channel, config.DefaultChannel)
+	f.Channel = channel
+	c.applyFeatureState(features, transfers)
+
+	manifests := newManifestCache()
+	var plans []channelPlan
+	if f.Enabled {
+		for _, t := range config.GetTransfersForFeature(transfers, name) {
+			p, err := c.planChannelSwitch(ctx, t, manifests)
+			if err != nil {
+				return fail(err)
+			}
+			plans = append(plans, p)
+		}
+	}
+
+	changed, failed := false, false
+	for _, p := range plans {
+		r, err := c.reconcileChannel(ctx, name, p, opts, manifests)
+		if err != nil {
+			failed = true
+		}
+		changed = changed || r.Downloaded || r.Relinked || len(r.RemovedVersions) > 0
+		result.Results = append(result.Results, r)
+	}
+	if failed {
+		return fail(fmt.Errorf("one or more components failed to switch to channel %s", channel))
+	}
+
+	// Only now is the channel recorded: had a transfer failed above, the
+	// next update would follow the new channel without its stale images
+	// having been removed.
+	dropInFile, err := c.updateFeatureDropIn(f, opts.DryRun, func(d *config.FeatureDropIn) { d.Channel = channel })
+	if err != nil {
+		return fail(err)
+	}
+	if !opts.DryRun {
+		result.DropIn = dropInFile
+	}
+
+	switch {
+	case opts.DryRun:
+		result.Success = true
+		result.NextActionMessage = fmt.Sprintf("Dry run complete. Would switch feature '%s' to channel %s", name, channel)
+		return result, nil
+	case !f.Enabled:
+		result.Success = true
+		result.NextActionMessage = fmt.Sprintf("Feature '%s' switched to channel %s; it takes effect once the feature is enabled.", name, channel)
+		return result, nil
+	}
+
+	if changed && !opts.NoRefresh {
+		c.msg("Refreshing sysext")
+		if err := c.runner.Refresh(); err != nil {
+			err = fmt.Errorf("sysext refresh failed: %w", err)
+			c.warn("%s", err)
+			result.RefreshError = err.Error()
+			result.Error = err.Error()
+			result.NextActionMessage = fmt.Sprintf("Feature '%s' switched to channel %s, but systemd-sysext refresh failed; run 'systemd-sysext refresh' (or reboot) to activate it", name, channel)
+			return result, err
+		}
+	}
+
+	result.Success = true
+	result.NextActionMessage = fmt.Sprintf("Feature '%s' switched to channel %s.", name, channel)
+	return result, nil
+}
+
+// planChannelSwitch lists the versions t's channel offers and picks the one
+// to link: its pin, or the newest.
+func (c *Client) planChannelSwitch(ctx context.Context, t *config.Transfer, manifests *manifestCache) (channelPlan, error) {
+	available, m, patterns, err := c.cachedAvailableVersions(ctx, t, manifests)
+	if err != nil {
+		return channelPlan{}, fmt.Errorf("failed to list versions of %s on channel %s: %w", t.Component, t.Transfer.Channel, err)
+	}
+	installed, _, err := sysext.GetInstalledVersionsAt(t, c.paths.sysextLinkDir)
+	if err != nil {
+		return channelPlan{}, fmt.Errorf("failed to inspect installed versions of %s: %w", t.Component, err)
+	}
+
+	// A version phasing holds back is not offered to this host yet.
+	version.Sort(available)
+	offered := available
+	if t.Transfer.PinVersion == "" {
+		offered, _ = c.phase(t, m, patterns, available, installed)
+	}
+	if len(offered) == 0 {
+		return channelPlan{}, fmt.Errorf("channel %s offers no version of %s", t.Transfer.Channel, t.Component)
+	}
+
+	p := channelPlan{transfer: t, target: offered[0]}
+	if pin := t.Transfer.PinVersion; pin != "" {
+		if !slices.Contains(offered, pin) {
+			return channelPlan{}, fmt.Errorf("pinned version %s of %s is not available on channel %s", pin, t.Component, t.Transfer.Channel)
+		}
+		p.target = pin
+	}
+
+	// Stale means the channel does not list it at all; phasing holding a
+	// version back from this host does not make its image stale.
+	for _, v := range installed {
+		if version.Compare(v, p.target) > 0 && !slices.Contains(available, v) && v != t.Transfer.ProtectVersion {
+			p.stale = append(p.stale, v)
+		}
+	}
+	return p, nil
+}
+
+// reconcileChannel links p.target through the update path and removes the
+// stale images. They are skipped for the install too, so the vacuum after a
+// download neither keeps them nor spends InstancesMax slots on them.
+func (c *Client) reconcileChannel(ctx context.Context, feature string, p channelPlan, opts SwitchFeatureChannelOptions, manifests *manifestCache) (UpdateResult, error) {
+	t := p.transfer
+	t.Transfer.SkipVersions = append(t.Transfer.SkipVersions, p.stale...)
+
+	r, failed := c.updateTransfer(ctx, transferJob{feature: feature, transfer: t}, UpdateFeaturesOptions{
+		DryRun:   opts.DryRun,
+		NoVacuum: opts.NoVacuum,
+		Version:  p.target,
+	}, manifests)
+	if failed {
+		return r, errors.New(r.Error)
+	}
+
+	if !opts.DryRun && len(p.stale) > 0 {
+		if _, err := sysext.RemoveVersionsAt(t, p.stale, c.paths.sysextLinkDir); err != nil {
+			r.Error = fmt.Sprintf("failed to remove images of another channel: %v", err)
+			c.warn("%s", r.Error)
+			return r, err
+		}
+	}
+	for _, v := range p.stale {
+		if !slices.Contains(r.RemovedVersions, v) {
+			r.RemovedVersions = append(r.RemovedVersions, v)
+		}
+	}
+	if len(p.stale) > 0 {
+		if opts.DryRun {
+			c.msg("Would remove %s %v, not offered on channel %s", t.Component, p.stale, t.Transfer.Channel)
+		} else {
+			c.msg("Removed %s %v, not offered on channel %s", t.Component, p.stale, t.Transfer.Channel)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,280 @@
+package updex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/updex/internal/testutil"
+	"github.com/frostyard/updex/sysext"
+)
+
+// channelFixture serves a stable channel with testext 1.0.0 and a beta
+// channel that adds 1.1.0, under /stable and /beta of one server, and
+// defines testfeature (enabled) with a transfer whose Source.Path ends in
+// %R. It returns the client, the definition root, the target directory and
+// the sysext link path.
+func channelFixture(t *testing.T) (client *Client, root, targetDir, linkPath string) {
+	t.Helper()
+	root = t.TempDir()
+	defDir := filepath.Join(root, "sysupdate.d")
+	targetDir = t.TempDir()
+	linkDir := t.TempDir()
+
+	v1, v11 := []byte("ext v1.0.0"), []byte("ext v1.1.0")
+	stable := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Files:   map[string]string{"testext_1.0.0.raw": hashContent(v1)},
+		Content: map[string][]byte{"testext_1.0.0.raw": v1},
+	})
+	t.Cleanup(stable.Close)
+	beta := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Files:   map[string]string{"testext_1.0.0.raw": hashContent(v1), "testext_1.1.0.raw": hashContent(v11)},
+		Content: map[string][]byte{"testext_1.0.0.raw": v1, "testext_1.1.0.raw": v11},
+	})
+	t.Cleanup(beta.Close)
+	mux := http.NewServeMux()
+	mux.Handle("/stable/", http.StripPrefix("/stable", stable.Config.Handler))
+	mux.Handle("/beta/", http.StripPrefix("/beta", beta.Config.Handler))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	writeComponentFeature(t, defDir, "testfeature", true)
+	createFeatureTransferFileWithoutCurrentSymlink(t, defDir, "testext", "testfeature", server.URL+"/%R", targetDir)
+
+	client = NewClient(ClientConfig{
+		Paths:        RuntimePaths{DefinitionRoots: []string{root}, SysextLinkDir: linkDir},
+		SysextRunner: &sysext.DefaultRunner{},
+	})
+	return client, root, targetDir, filepath.Join(linkDir, "testext.raw")
+}
+
+// TestSwitchFeatureChannel_Reconciles verifies that switching channels
+// records the channel, installs the new channel's newest version, and that
+// switching back downgrades by relinking the staged image and removes the
+// one the old channel alone offered.
+func TestSwitchFeatureChannel_Reconciles(t *testing.T) {
+	client, root, targetDir, linkPath := channelFixture(t)
+	ctx := t.Context()
+
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+
+	result, err := client.SwitchFeatureChannel(ctx, "testfeature", "beta", SwitchFeatureChannelOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("SwitchFeatureChannel(beta) failed: %v", err)
+	}
+	if !result.Success || result.PreviousChannel != "stable" || len(result.Results) != 1 {
+		t.Fatalf("SwitchFeatureChannel(beta) = %+v, want success from stable with one result", result)
+	}
+	if r := result.Results[0]; r.Version != "1.1.0" || !r.Downloaded {
+		t.Errorf("beta result = %+v, want 1.1.0 downloaded", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.1.0.raw")
+
+	dropIn := filepath.Join(root, "sysupdate.d", "testfeature.feature.d", updexDropInName)
+	if result.DropIn != dropIn {
+		t.Errorf("DropIn = %q, want %q", result.DropIn, dropIn)
+	}
+	got, err := os.ReadFile(dropIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[X-Updex]\nChannel=beta\n"; string(got) != want {
+		t.Errorf("drop-in = %q, want %q", got, want)
+	}
+	infos, err := client.Features(ctx, FeaturesOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if infos[0].Channel != "beta" {
+		t.Errorf("Features() Channel = %q, want beta", infos[0].Channel)
+	}
+
+	result, err = client.SwitchFeatureChannel(ctx, "testfeature", "stable", SwitchFeatureChannelOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("SwitchFeatureChannel(stable) failed: %v", err)
+	}
+	if r := result.Results[0]; r.Version != "1.0.0" || r.Downloaded || !r.Relinked || !slices.Equal(r.RemovedVersions, []string{"1.1.0"}) {
+		t.Errorf("stable result = %+v, want 1.0.0 relinked and 1.1.0 removed", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+	if _, err := os.Stat(filepath.Join(targetDir, "testext_1.1.0.raw")); !os.IsNotExist(err) {
+		t.Errorf("beta image still staged: %v", err)
+	}
+
+	results, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Version != "1.0.0" || r.Downloaded || r.Relinked {
+		t.Errorf("update on stable = %+v, want 1.0.0 left as it is", r)
+	}
+}
+
+// TestSwitchFeatureChannel_PhasedImageKept verifies that an installed image
+// the new channel offers, but phasing holds back from this host, is not
+// taken for one the channel lacks: it is neither removed nor skipped.
+func TestSwitchFeatureChannel_PhasedImageKept(t *testing.T) {
+	root := t.TempDir()
+	defDir := filepath.Join(root, "sysupdate.d")
+	targetDir := t.TempDir()
+	linkDir := t.TempDir()
+
+	v1, v11 := []byte("ext v1.0.0"), []byte("ext v1.1.0")
+	stable := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Files:   map[string]string{"testext_1.0.0.raw": hashContent(v1)},
+		Content: map[string][]byte{"testext_1.0.0.raw": v1},
+	})
+	t.Cleanup(stable.Close)
+	beta := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Files: map[string]string{"testext_1.0.0.raw": hashContent(v1), "testext_1.1.0.raw": hashContent(v11)},
+		Content: map[string][]byte{
+			"testext_1.0.0.raw": v1,
+			"testext_1.1.0.raw": v11,
+			"ROLLOUT":           []byte("0  testext_1.1.0.raw\n"),
+		},
+	})
+	t.Cleanup(beta.Close)
+	mux := http.NewServeMux()
+	mux.Handle("/stable/", http.StripPrefix("/stable", stable.Config.Handler))
+	mux.Handle("/beta/", http.StripPrefix("/beta", beta.Config.Handler))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	writeComponentFeature(t, defDir, "testfeature", true)
+	createFeatureTransferFileWithoutCurrentSymlink(t, defDir, "testext", "testfeature", server.URL+"/%R", targetDir)
+	transferPath := filepath.Join(defDir, "testext.transfer")
+	data, err := os.ReadFile(transferPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(transferPath, []byte(strings.Replace(string(data), "[Transfer]\n", "[Transfer]\nPhased=yes\n", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(ClientConfig{
+		Paths:        RuntimePaths{DefinitionRoots: []string{root}, SysextLinkDir: linkDir},
+		SysextRunner: &sysext.DefaultRunner{},
+	})
+	ctx := t.Context()
+
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	// An image of the held-back version, left by an earlier install.
+	if err := os.WriteFile(filepath.Join(targetDir, "testext_1.1.0.raw"), v11, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.SwitchFeatureChannel(ctx, "testfeature", "beta", SwitchFeatureChannelOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("SwitchFeatureChannel(beta) failed: %v", err)
+	}
+	if r := result.Results[0]; len(r.RemovedVersions) != 0 || r.Version != "1.1.0" {
+		t.Errorf("beta result = %+v, want the installed 1.1.0 linked and nothing removed", r)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "testext_1.1.0.raw")); err != nil {
+		t.Errorf("held-back image removed: %v", err)
+	}
+	assertLinkedTo(t, filepath.Join(linkDir, "testext.raw"), "testext_1.1.0.raw")
+}
+
+// TestSwitchFeatureChannel_DryRun verifies that a dry run reports the plan
+// without writing the drop-in, downloading, or relinking.
+func TestSwitchFeatureChannel_DryRun(t *testing.T) {
+	client, root, targetDir, linkPath := channelFixture(t)
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+
+	result, err := client.SwitchFeatureChannel(t.Context(), "testfeature", "beta", SwitchFeatureChannelOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("SwitchFeatureChannel failed: %v", err)
+	}
+	if !result.Success || !result.DryRun || result.DropIn != "" || len(result.Results) != 1 {
+		t.Fatalf("dry-run result = %+v, want a plan without a drop-in", result)
+	}
+	if r := result.Results[0]; r.Version != "1.1.0" || !r.Downloaded || r.Installed {
+		t.Errorf("dry-run component = %+v, want 1.1.0 would download", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+	if _, err := os.Stat(filepath.Join(targetDir, "testext_1.1.0.raw")); !os.IsNotExist(err) {
+		t.Errorf("dry run downloaded: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sysupdate.d", "testfeature.feature.d")); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote the drop-in: %v", err)
+	}
+}
+
+// TestSwitchFeatureChannel_FailureKeepsChannel verifies that a switch whose
+// reconcile fails does not record the new channel.
+func TestSwitchFeatureChannel_FailureKeepsChannel(t *testing.T) {
+	client, root, targetDir, linkPath := channelFixture(t)
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	// A directory where the beta image would be stored fails its download.
+	if err := os.Mkdir(filepath.Join(targetDir, "testext_1.1.0.raw"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.SwitchFeatureChannel(t.Context(), "testfeature", "beta", SwitchFeatureChannelOptions{NoRefresh: true})
+	if err == nil || !strings.Contains(err.Error(), "failed to switch to channel beta") {
+		t.Fatalf("SwitchFeatureChannel error = %v, want a failed switch", err)
+	}
+	if result.Success || result.DropIn != "" {
+		t.Errorf("result = %+v, want failure without a drop-in", result)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sysupdate.d", "testfeature.feature.d")); !os.IsNotExist(err) {
+		t.Errorf("drop-in written for a failed switch: %v", err)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+}
+
+// TestSwitchFeatureChannel_Refused covers channels that are rejected before
+// anything is written, and a disabled feature, which only gets its drop-in.
+func TestSwitchFeatureChannel_Refused(t *testing.T) {
+	for _, tt := range []struct {
+		channel string
+		wantErr string
+	}{
+		{channel: "../beta", wantErr: "invalid channel"},
+		{channel: "nightly", wantErr: "failed to list versions of testext on channel nightly"},
+	} {
+		t.Run(tt.channel, func(t *testing.T) {
+			client, root, _, _ := channelFixture(t)
+			result, err := client.SwitchFeatureChannel(t.Context(), "testfeature", tt.channel, SwitchFeatureChannelOptions{NoRefresh: true})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("SwitchFeatureChannel error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if result.Success || result.Error == "" {
+				t.Errorf("result = %+v, want failure with Error set", result)
+			}
+			if _, err := os.Stat(filepath.Join(root, "sysupdate.d", "testfeature.feature.d")); !os.IsNotExist(err) {
+				t.Errorf("drop-in written for a refused channel: %v", err)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		client, _, targetDir, _ := channelFixture(t)
+		if _, err := client.DisableFeature(t.Context(), "testfeature", DisableFeatureOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		result, err := client.SwitchFeatureChannel(t.Context(), "testfeature", "nightly", SwitchFeatureChannelOptions{})
+		if err != nil {
+			t.Fatalf("SwitchFeatureChannel failed: %v", err)
+		}
+		if !result.Success || result.DropIn == "" || len(result.Results) != 0 {
+			t.Errorf("result = %+v, want only the drop-in written", result)
+		}
+		if entries, _ := os.ReadDir(targetDir); len(entries) != 0 {
+			t.Errorf("disabled feature downloaded %d file(s)", len(entries))
+		}
+	})
+}
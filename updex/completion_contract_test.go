@@ -26,7 +26,7 @@ func TestShellCompletionsNameEveryCommand(t *testing.T) {
 	// package updex cannot import cmd/updex (import cycle), so this is the
 	// literal set, plus the two cobra adds. Guarded against a vacuous pass
 	// below.
-	expected := []string{"catalog", "components", "daemon", "features", "completion", "help"}
+	expected := []string{"bundle", "catalog", "components", "daemon", "features", "status", "completion", "help"}
 	if len(expected) == 0 {
 		t.Fatal("expected command list is empty; the test would pass vacuously")
 	}
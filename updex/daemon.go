@@ -3,41 +3,218 @@ package updex
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/frostyard/updex/systemd"
 )
 
 const (
 	daemonUnitName = "updex-update"
-	daemonSchedule = "daily"
+	// daemonExecStart is the service command, before any per-install
+	// options such as the download rate limit.
+	daemonExecStart = "/usr/bin/updex features update --no-refresh"
+	// applyUnitName is the early-boot service EnableDaemon installs when
+	// EnableDaemonOptions.ApplyAtBoot is set.
+	applyUnitName = "updex-apply"
 )
 
-// EnableDaemon installs, enables, and starts the automatic update timer.
-func (c *Client) EnableDaemon(ctx context.Context, _ EnableDaemonOptions) (*DaemonActionResult, error) {
-	if err := ctx.Err(); err != nil {
-		return nil, fmt.Errorf("enable daemon: %w", err)
+// DefaultDaemonSchedule is the timer's OnCalendar= expression when
+// EnableDaemonOptions leaves Schedule empty.
+const DefaultDaemonSchedule = "daily"
+
+// DefaultDaemonRandomizedDelay is how widely scheduled runs are spread when
+// EnableDaemonOptions leaves RandomizedDelay at zero.
+const DefaultDaemonRandomizedDelay = time.Hour
+
+// ioSchedulingClasses are the IOSchedulingClass= values EnableDaemon accepts.
+var ioSchedulingClasses = []string{"realtime", "best-effort", "idle"}
+
+// daemonUnits returns the timer and service EnableDaemon installs for opts,
+// or an error naming the first invalid option.
+func daemonUnits(opts EnableDaemonOptions) (*systemd.TimerConfig, *systemd.ServiceConfig, error) {
+	if opts.DownloadRateLimit < 0 {
+		return nil, nil, fmt.Errorf("download rate limit must not be negative")
 	}
-	if c.systemd.Exists(daemonUnitName) {
-		return nil, fmt.Errorf("timer already installed; run 'updex daemon disable' first to reinstall")
+	schedule := opts.Schedule
+	if schedule == "" {
+		schedule = DefaultDaemonSchedule
+	}
+	if strings.TrimSpace(schedule) != schedule || strings.ContainsAny(schedule, "\n\r") {
+		return nil, nil, fmt.Errorf("invalid schedule %q", opts.Schedule)
+	}
+	delay := opts.RandomizedDelay
+	switch {
+	case delay == 0:
+		delay = DefaultDaemonRandomizedDelay
+	case delay < 0:
+		delay = 0
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{{"randomized delay", delay}, {"on-boot delay", opts.OnBoot}, {"accuracy", opts.Accuracy}} {
+		if d.value < 0 || d.value%time.Second != 0 {
+			return nil, nil, fmt.Errorf("%s must be a non-negative whole number of seconds, got %s", d.name, d.value)
+		}
+	}
+	if opts.Nice < -20 || opts.Nice > 19 {
+		return nil, nil, fmt.Errorf("nice must be between -20 and 19, got %d", opts.Nice)
+	}
+	if opts.IOSchedulingClass != "" && !slices.Contains(ioSchedulingClasses, opts.IOSchedulingClass) {
+		return nil, nil, fmt.Errorf("invalid I/O scheduling class %q (want one of %s)", opts.IOSchedulingClass, strings.Join(ioSchedulingClasses, ", "))
+	}
+	if opts.CPUQuota < 0 {
+		return nil, nil, fmt.Errorf("CPU quota must not be negative")
+	}
+	// The path is one word of ExecStart=, where systemd would split it at
+	// whitespace and expand % specifiers.
+	if opts.MetricsFile != "" && (!filepath.IsAbs(opts.MetricsFile) || strings.ContainsAny(opts.MetricsFile, " \t\n\r\"'\\%")) {
+		return nil, nil, fmt.Errorf("invalid metrics file %q: want an absolute path without whitespace, quotes, backslashes or %%", opts.MetricsFile)
+	}
+
+	execStart := daemonExecStart
+	if opts.ApplyAtBoot {
+		execStart += " --stage"
+	}
+	if opts.DownloadRateLimit > 0 {
+		execStart += fmt.Sprintf(" --limit-rate=%d", opts.DownloadRateLimit)
+	}
+	if opts.MetricsFile != "" {
+		execStart += " --metrics-file=" + opts.MetricsFile
 	}
 
 	timer := &systemd.TimerConfig{
 		Name:           daemonUnitName,
 		Description:    "Automatic sysext updates",
-		OnCalendar:     daemonSchedule,
+		OnCalendar:     schedule,
 		Persistent:     true,
-		RandomDelaySec: 3600,
+		RandomDelaySec: int(delay / time.Second),
+		OnBootSec:      int(opts.OnBoot / time.Second),
+		AccuracySec:    int(opts.Accuracy / time.Second),
 	}
 	service := &systemd.ServiceConfig{
 		Name:        daemonUnitName,
 		Description: "Automatic sysext update service",
-		ExecStart:   "/usr/bin/updex features update --no-refresh",
+		ExecStart:   execStart,
 		Type:        "oneshot",
 		// Sandbox the root oneshot: read-only /usr and /etc, no new
 		// privileges, and restricted syscalls/address families.
-		Sandbox: true,
+		Sandbox:           true,
+		Nice:              opts.Nice,
+		IOSchedulingClass: opts.IOSchedulingClass,
+		CPUQuota:          opts.CPUQuota,
+	}
+	return timer, service, nil
+}
+
+// applyUnit returns the early-boot service that applies staged updates. It
+// is ordered after the local file systems are mounted and before
+// systemd-sysext merges, so the images it links are the ones merged. It is
+// not sandboxed: it runs before most of what the sandboxing directives
+// need is set up, and it only renames and links files.
+func applyUnit() *systemd.ServiceConfig {
+	return &systemd.ServiceConfig{
+		Name:                  applyUnitName,
+		Description:           "Apply staged sysext updates",
+		ExecStart:             "/usr/bin/updex apply --no-refresh",
+		Type:                  "oneshot",
+		NoDefaultDependencies: true,
+		After:                 "local-fs.target",
+		Before:                "systemd-sysext.service sysinit.target",
+		WantedBy:              "sysinit.target",
+	}
+}
+
+// applyUnitState reports whether the apply-at-boot unit is installed, and
+// whether it is exactly the unit applyUnit describes.
+func (c *Client) applyUnitState() (installed, ours bool) {
+	if !c.systemd.ServiceExists(applyUnitName) {
+		return false, false
+	}
+	cfg, generated, err := c.systemd.ReadService(applyUnitName)
+	if err != nil {
+		c.debug("cannot read %s unit: %v", applyUnitName, err)
+		return true, false
+	}
+	return true, generated && *cfg == *applyUnit()
+}
+
+// EnableDaemon installs, enables, and starts the automatic update timer.
+//
+// When the units are already installed and unedited, it rewrites them from
+// opts in place and restarts the timer so the new schedule takes effect.
+// Units edited outside updex are never replaced: reinstalling them takes
+// an explicit DisableDaemon first.
+//
+// With ApplyAtBoot the early-boot apply unit is installed and enabled, but
+// not started, before the timer switches to staging; without it, an apply
+// unit installed earlier is removed once the timer no longer stages.
+func (c *Client) EnableDaemon(ctx context.Context, opts EnableDaemonOptions) (*DaemonActionResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("enable daemon: %w", err)
+	}
+	_, unlock, err := c.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	timer, service, err := daemonUnits(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check that every installed unit is ours before changing any of them.
+	var installed *systemd.Units
+	if c.systemd.Exists(daemonUnitName) {
+		installed, err = c.systemd.Read(daemonUnitName)
+		if err != nil {
+			return nil, fmt.Errorf("timer already installed but unreadable (%w); run 'updex daemon disable' first to reinstall", err)
+		}
+		if _, ok := installedDaemonOptions(installed); !ok {
+			return nil, fmt.Errorf("timer already installed and modified outside updex; run 'updex daemon disable' first to reinstall")
+		}
+	}
+	applyInstalled, applyOurs := c.applyUnitState()
+	if applyInstalled && !applyOurs {
+		return nil, fmt.Errorf("%s unit already installed and modified outside updex; run 'updex daemon disable' first to reinstall", applyUnitName)
+	}
+
+	if opts.ApplyAtBoot {
+		if !applyInstalled {
+			if err := c.systemd.WriteService(applyUnit()); err != nil {
+				return nil, fmt.Errorf("failed to install %s unit: %w", applyUnitName, err)
+			}
+		}
+		if err := c.systemd.Enable(applyUnitName + ".service"); err != nil {
+			return nil, fmt.Errorf("failed to enable %s unit: %w", applyUnitName, err)
+		}
 	}
 
+	var result *DaemonActionResult
+	if installed != nil {
+		result, err = c.reconfigureDaemon(installed, timer, service)
+	} else {
+		result, err = c.installDaemon(timer, service)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.ApplyAtBoot && applyInstalled {
+		if err := c.systemd.RemoveService(applyUnitName); err != nil {
+			return nil, fmt.Errorf("failed to remove %s unit: %w", applyUnitName, err)
+		}
+	}
+	return result, nil
+}
+
+// installDaemon installs, enables and starts a fresh timer and service.
+func (c *Client) installDaemon(timer *systemd.TimerConfig, service *systemd.ServiceConfig) (*DaemonActionResult, error) {
 	if err := c.systemd.Install(timer, service); err != nil {
 		return nil, fmt.Errorf("failed to install timer: %w", err)
 	}
@@ -54,16 +231,61 @@ func (c *Client) EnableDaemon(ctx context.Context, _ EnableDaemonOptions) (*Daem
 	}, nil
 }
 
-// DisableDaemon stops, disables, and removes the automatic update timer.
+// reconfigureDaemon brings installed, unedited units in line with timer and
+// service. Units that already match are left alone, but the timer is still
+// enabled and started, so enabling again repairs a timer stopped by hand.
+func (c *Client) reconfigureDaemon(installed *systemd.Units, timer *systemd.TimerConfig, service *systemd.ServiceConfig) (*DaemonActionResult, error) {
+	changed := *installed.Timer != *timer || *installed.Service != *service
+	if changed {
+		if err := c.systemd.Update(timer, service); err != nil {
+			return nil, fmt.Errorf("failed to update timer: %w", err)
+		}
+	}
+	if err := c.systemd.Enable(daemonUnitName + ".timer"); err != nil {
+		return nil, fmt.Errorf("failed to enable timer: %w", err)
+	}
+	start := c.systemd.Start
+	if changed {
+		start = c.systemd.Restart
+	}
+	if err := start(daemonUnitName + ".timer"); err != nil {
+		return nil, fmt.Errorf("failed to start timer: %w", err)
+	}
+
+	message := "Auto-update daemon enabled"
+	if changed {
+		message = "Auto-update daemon reconfigured"
+	}
+	return &DaemonActionResult{Success: true, Message: message}, nil
+}
+
+// DisableDaemon stops, disables, and removes the automatic update timer,
+// and the apply-at-boot unit if one is installed, edited or not. Staged
+// updates are left for 'updex apply'.
 func (c *Client) DisableDaemon(ctx context.Context, _ DisableDaemonOptions) (*DaemonActionResult, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, fmt.Errorf("disable daemon: %w", err)
 	}
-	if !c.systemd.Exists(daemonUnitName) {
+	_, unlock, err := c.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	timerInstalled := c.systemd.Exists(daemonUnitName)
+	applyInstalled := c.systemd.ServiceExists(applyUnitName)
+	if !timerInstalled && !applyInstalled {
 		return nil, fmt.Errorf("timer not installed; nothing to disable")
 	}
-	if err := c.systemd.Remove(daemonUnitName); err != nil {
-		return nil, fmt.Errorf("failed to remove timer: %w", err)
+	if timerInstalled {
+		if err := c.systemd.Remove(daemonUnitName); err != nil {
+			return nil, fmt.Errorf("failed to remove timer: %w", err)
+		}
+	}
+	if applyInstalled {
+		if err := c.systemd.RemoveService(applyUnitName); err != nil {
+			return nil, fmt.Errorf("failed to remove %s unit: %w", applyUnitName, err)
+		}
 	}
 
 	return &DaemonActionResult{
@@ -73,12 +295,18 @@ func (c *Client) DisableDaemon(ctx context.Context, _ DisableDaemonOptions) (*Da
 }
 
 // DaemonStatus reports whether the automatic update timer is installed,
-// enabled, and active.
+// enabled, and active, and the settings its unit files hold.
 func (c *Client) DaemonStatus(ctx context.Context, _ DaemonStatusOptions) (*DaemonStatusResult, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, fmt.Errorf("get daemon status: %w", err)
 	}
 
+	ctx, unlock, err := c.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	status := &DaemonStatusResult{
 		Installed: c.systemd.Exists(daemonUnitName),
 	}
@@ -93,7 +321,100 @@ func (c *Client) DaemonStatus(ctx context.Context, _ DaemonStatusOptions) (*Daem
 		}
 		status.Enabled = enabled
 		status.Active = active
-		status.Schedule = daemonSchedule
+		c.readDaemonSettings(status)
+		// Reported when systemd can tell; older systemctl versions print
+		// no Unix timestamps, which leaves it unknown rather than failing.
+		next, err := c.systemd.NextElapse(daemonUnitName + ".timer")
+		if err != nil {
+			c.debug("cannot query next trigger: %v", err)
+		}
+		status.NextTrigger = next
 	}
+	c.readRunStatus(ctx, status)
 	return status, nil
 }
+
+// readRunStatus fills status with the last recorded run and the last
+// successful one. Recorded runs include interactive ones, so they are read
+// whether or not the daemon is installed.
+func (c *Client) readRunStatus(ctx context.Context, status *DaemonStatusResult) {
+	history, err := c.RunHistory(ctx, RunHistoryOptions{})
+	if err != nil {
+		c.debug("cannot read run history: %v", err)
+		return
+	}
+	if len(history) > 0 {
+		status.LastRun = &history[0]
+	}
+	for _, record := range history {
+		if record.Success {
+			status.LastSuccess = record.FinishedAt
+			break
+		}
+	}
+}
+
+// readDaemonSettings fills status with the settings of the installed units.
+// Units that cannot be read, or that are not what EnableDaemon writes, are
+// reported as Modified with whatever could be parsed.
+func (c *Client) readDaemonSettings(status *DaemonStatusResult) {
+	installed, err := c.systemd.Read(daemonUnitName)
+	if err != nil {
+		c.debug("cannot read daemon units: %v", err)
+		status.Modified = true
+		return
+	}
+	opts, ok := installedDaemonOptions(installed)
+	timer, service := installed.Timer, installed.Service
+	status.Schedule = timer.OnCalendar
+	status.RandomizedDelaySec = timer.RandomDelaySec
+	status.OnBootSec = timer.OnBootSec
+	status.AccuracySec = timer.AccuracySec
+	status.Nice = service.Nice
+	status.IOSchedulingClass = service.IOSchedulingClass
+	status.CPUQuota = service.CPUQuota
+	status.DownloadRateLimit = opts.DownloadRateLimit
+	status.ApplyAtBoot = opts.ApplyAtBoot
+	status.MetricsFile = opts.MetricsFile
+	applyInstalled, applyOurs := c.applyUnitState()
+	status.Modified = !ok || applyInstalled != opts.ApplyAtBoot || (applyInstalled && !applyOurs)
+}
+
+// installedDaemonOptions recovers the EnableDaemonOptions installed units
+// were written from. ok is false unless EnableDaemon, given the result,
+// would write exactly these units: anything else was edited outside updex.
+func installedDaemonOptions(installed *systemd.Units) (opts EnableDaemonOptions, ok bool) {
+	timer, service := installed.Timer, installed.Service
+	opts = EnableDaemonOptions{
+		Schedule:          timer.OnCalendar,
+		RandomizedDelay:   time.Duration(timer.RandomDelaySec) * time.Second,
+		OnBoot:            time.Duration(timer.OnBootSec) * time.Second,
+		Accuracy:          time.Duration(timer.AccuracySec) * time.Second,
+		Nice:              service.Nice,
+		IOSchedulingClass: service.IOSchedulingClass,
+		CPUQuota:          service.CPUQuota,
+	}
+	if opts.RandomizedDelay == 0 {
+		opts.RandomizedDelay = -1
+	}
+	if args, found := strings.CutPrefix(service.ExecStart, daemonExecStart); found {
+		for _, arg := range strings.Fields(args) {
+			if arg == "--stage" {
+				opts.ApplyAtBoot = true
+			} else if limit, ok := strings.CutPrefix(arg, "--limit-rate="); ok {
+				opts.DownloadRateLimit, _ = strconv.ParseInt(limit, 10, 64)
+			} else if path, ok := strings.CutPrefix(arg, "--metrics-file="); ok {
+				opts.MetricsFile = path
+			}
+		}
+	}
+
+	if !installed.Generated || opts.Schedule == "" {
+		return opts, false
+	}
+	wantTimer, wantService, err := daemonUnits(opts)
+	if err != nil {
+		return opts, false
+	}
+	return opts, *wantTimer == *timer && *wantService == *service
+}
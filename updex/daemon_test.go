@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/frostyard/updex/systemd"
 )
@@ -16,12 +17,26 @@ func newDaemonTestClient(t *testing.T, runner systemd.SystemctlRunner) (*Client,
 	t.Helper()
 	unitPath := t.TempDir()
 	client := NewClient(ClientConfig{
+		Paths:          RuntimePaths{StateDir: t.TempDir()},
 		SystemdManager: systemd.NewTestManager(unitPath, runner),
 	})
 	return client, unitPath
 }
 
+// seedDaemonUnits installs the default daemon units into unitPath through a
+// separate client, so the runner under test records no calls.
 func seedDaemonUnits(t *testing.T, unitPath string) {
+	t.Helper()
+	seeder := NewClient(ClientConfig{
+		SystemdManager: systemd.NewTestManager(unitPath, &systemd.MockSystemctlRunner{}),
+	})
+	if _, err := seeder.EnableDaemon(t.Context(), EnableDaemonOptions{}); err != nil {
+		t.Fatalf("seed daemon units: %v", err)
+	}
+}
+
+// seedEditedDaemonUnits writes unit files updex did not generate.
+func seedEditedDaemonUnits(t *testing.T, unitPath string) {
 	t.Helper()
 	for _, suffix := range []string{".timer", ".service"} {
 		if err := os.WriteFile(filepath.Join(unitPath, daemonUnitName+suffix), []byte("stub"), 0644); err != nil {
@@ -81,11 +96,33 @@ func TestEnableDaemon(t *testing.T) {
 	}
 }
 
+// TestEnableDaemonDownloadRateLimit pins that the daemon's rate limit is
+// baked into the service command, so scheduled runs are capped independently
+// of whatever interactive runs use.
+func TestEnableDaemonDownloadRateLimit(t *testing.T) {
+	client, unitPath := newDaemonTestClient(t, &systemd.MockSystemctlRunner{})
+
+	if _, err := client.EnableDaemon(t.Context(), EnableDaemonOptions{DownloadRateLimit: 1 << 20}); err != nil {
+		t.Fatalf("EnableDaemon() error = %v", err)
+	}
+	service, err := os.ReadFile(filepath.Join(unitPath, daemonUnitName+".service"))
+	if err != nil {
+		t.Fatalf("read service unit: %v", err)
+	}
+	if want := "ExecStart=/usr/bin/updex features update --no-refresh --limit-rate=1048576\n"; !strings.Contains(string(service), want) {
+		t.Errorf("service unit missing %q:\n%s", want, service)
+	}
+
+	if _, err := client.EnableDaemon(t.Context(), EnableDaemonOptions{DownloadRateLimit: -1}); err == nil || !strings.Contains(err.Error(), "must not be negative") {
+		t.Errorf("EnableDaemon(-1) error = %v, want negative rate error", err)
+	}
+}
+
 func TestEnableDaemonFailures(t *testing.T) {
-	t.Run("already installed", func(t *testing.T) {
+	t.Run("already installed and edited", func(t *testing.T) {
 		runner := &systemd.MockSystemctlRunner{}
 		client, unitPath := newDaemonTestClient(t, runner)
-		seedDaemonUnits(t, unitPath)
+		seedEditedDaemonUnits(t, unitPath)
 
 		_, err := client.EnableDaemon(t.Context(), EnableDaemonOptions{})
 		if err == nil || !strings.Contains(err.Error(), "timer already installed") {
@@ -94,6 +131,9 @@ func TestEnableDaemonFailures(t *testing.T) {
 		if runner.DaemonReloadCalled || runner.EnableCalled || runner.StartCalled {
 			t.Fatal("EnableDaemon() touched systemd for an existing installation")
 		}
+		if content, _ := os.ReadFile(filepath.Join(unitPath, daemonUnitName+".timer")); string(content) != "stub" {
+			t.Fatalf("EnableDaemon() replaced an edited timer: %q", content)
+		}
 	})
 
 	t.Run("install", func(t *testing.T) {
@@ -134,6 +174,217 @@ func TestEnableDaemonFailures(t *testing.T) {
 	})
 }
 
+// TestEnableDaemonOptions pins how each option lands in the unit files.
+func TestEnableDaemonOptions(t *testing.T) {
+	client, unitPath := newDaemonTestClient(t, &systemd.MockSystemctlRunner{})
+
+	_, err := client.EnableDaemon(t.Context(), EnableDaemonOptions{
+		Schedule:          "Sun *-*-* 03:00:00",
+		RandomizedDelay:   -1,
+		OnBoot:            15 * time.Minute,
+		Accuracy:          time.Hour,
+		Nice:              10,
+		IOSchedulingClass: "idle",
+		CPUQuota:          50,
+	})
+	if err != nil {
+		t.Fatalf("EnableDaemon() error = %v", err)
+	}
+
+	timer, err := os.ReadFile(filepath.Join(unitPath, daemonUnitName+".timer"))
+	if err != nil {
+		t.Fatalf("read timer unit: %v", err)
+	}
+	for _, required := range []string{"OnCalendar=Sun *-*-* 03:00:00\n", "OnBootSec=900s\n", "AccuracySec=3600s\n"} {
+		if !strings.Contains(string(timer), required) {
+			t.Errorf("timer unit missing %q:\n%s", required, timer)
+		}
+	}
+	if strings.Contains(string(timer), "RandomizedDelaySec=") {
+		t.Errorf("negative RandomizedDelay still wrote a delay:\n%s", timer)
+	}
+
+	service, err := os.ReadFile(filepath.Join(unitPath, daemonUnitName+".service"))
+	if err != nil {
+		t.Fatalf("read service unit: %v", err)
+	}
+	for _, required := range []string{"Nice=10\n", "IOSchedulingClass=idle\n", "CPUQuota=50%\n", "NoNewPrivileges=yes\n"} {
+		if !strings.Contains(string(service), required) {
+			t.Errorf("service unit missing %q:\n%s", required, service)
+		}
+	}
+}
+
+func TestEnableDaemonRejectsInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    EnableDaemonOptions
+		wantErr string
+	}{
+		{name: "multi-line schedule", opts: EnableDaemonOptions{Schedule: "daily\nExecStart=/bin/sh"}, wantErr: "invalid schedule"},
+		{name: "sub-second delay", opts: EnableDaemonOptions{RandomizedDelay: 1500 * time.Millisecond}, wantErr: "randomized delay"},
+		{name: "negative on-boot", opts: EnableDaemonOptions{OnBoot: -time.Second}, wantErr: "on-boot delay"},
+		{name: "nice out of range", opts: EnableDaemonOptions{Nice: 20}, wantErr: "nice must be between"},
+		{name: "unknown I/O class", opts: EnableDaemonOptions{IOSchedulingClass: "fast"}, wantErr: "invalid I/O scheduling class"},
+		{name: "negative CPU quota", opts: EnableDaemonOptions{CPUQuota: -1}, wantErr: "CPU quota"},
+		{name: "relative metrics file", opts: EnableDaemonOptions{MetricsFile: "updex.prom"}, wantErr: "invalid metrics file"},
+		{name: "metrics file with a space", opts: EnableDaemonOptions{MetricsFile: "/var/lib/node exporter/updex.prom"}, wantErr: "invalid metrics file"},
+		{name: "metrics file with a specifier", opts: EnableDaemonOptions{MetricsFile: "/var/lib/%H.prom"}, wantErr: "invalid metrics file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &systemd.MockSystemctlRunner{}
+			client, unitPath := newDaemonTestClient(t, runner)
+
+			_, err := client.EnableDaemon(t.Context(), tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("EnableDaemon() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if runner.DaemonReloadCalled {
+				t.Error("EnableDaemon() touched systemd for invalid options")
+			}
+			if entries, _ := os.ReadDir(unitPath); len(entries) != 0 {
+				t.Errorf("EnableDaemon() wrote %d files for invalid options", len(entries))
+			}
+		})
+	}
+}
+
+// TestEnableDaemonReconfiguresInPlace verifies that enabling an installed,
+// unedited daemon with other options rewrites the units and restarts the
+// timer, and that enabling it with the same options rewrites nothing.
+func TestEnableDaemonReconfiguresInPlace(t *testing.T) {
+	runner := &systemd.MockSystemctlRunner{}
+	client, unitPath := newDaemonTestClient(t, runner)
+	seedDaemonUnits(t, unitPath)
+
+	opts := EnableDaemonOptions{Schedule: "weekly", DownloadRateLimit: 1 << 20}
+	result, err := client.EnableDaemon(t.Context(), opts)
+	if err != nil {
+		t.Fatalf("EnableDaemon() error = %v", err)
+	}
+	if result.Message != "Auto-update daemon reconfigured" {
+		t.Errorf("EnableDaemon() message = %q, want reconfigured", result.Message)
+	}
+	if !runner.DaemonReloadCalled || !runner.EnableCalled || !runner.StopCalled || !runner.StartCalled {
+		t.Errorf("EnableDaemon() calls = reload:%v enable:%v stop:%v start:%v, want all true",
+			runner.DaemonReloadCalled, runner.EnableCalled, runner.StopCalled, runner.StartCalled)
+	}
+	timer, err := os.ReadFile(filepath.Join(unitPath, daemonUnitName+".timer"))
+	if err != nil {
+		t.Fatalf("read timer unit: %v", err)
+	}
+	if !strings.Contains(string(timer), "OnCalendar=weekly\n") {
+		t.Errorf("timer unit not rewritten:\n%s", timer)
+	}
+
+	runner = &systemd.MockSystemctlRunner{}
+	client = NewClient(ClientConfig{SystemdManager: systemd.NewTestManager(unitPath, runner)})
+	result, err = client.EnableDaemon(t.Context(), opts)
+	if err != nil {
+		t.Fatalf("EnableDaemon() again error = %v", err)
+	}
+	if result.Message != "Auto-update daemon enabled" {
+		t.Errorf("EnableDaemon() again message = %q, want enabled", result.Message)
+	}
+	if runner.DaemonReloadCalled || runner.StopCalled {
+		t.Error("EnableDaemon() with unchanged options rewrote units or restarted the timer")
+	}
+	if !runner.EnableCalled || !runner.StartCalled {
+		t.Error("EnableDaemon() with unchanged options did not ensure the timer is enabled and started")
+	}
+}
+
+// TestEnableDaemonApplyAtBoot verifies that ApplyAtBoot makes the timer
+// stage, installs the early-boot apply unit enabled but not started, shows
+// in the status, and that turning it off or disabling removes the unit.
+func TestEnableDaemonApplyAtBoot(t *testing.T) {
+	runner := &systemd.MockSystemctlRunner{}
+	client, unitPath := newDaemonTestClient(t, runner)
+	applyPath := filepath.Join(unitPath, applyUnitName+".service")
+
+	if _, err := client.EnableDaemon(t.Context(), EnableDaemonOptions{ApplyAtBoot: true}); err != nil {
+		t.Fatalf("EnableDaemon(ApplyAtBoot) error = %v", err)
+	}
+	service, err := os.ReadFile(filepath.Join(unitPath, daemonUnitName+".service"))
+	if err != nil {
+		t.Fatalf("read service unit: %v", err)
+	}
+	if !strings.Contains(string(service), "ExecStart="+daemonExecStart+" --stage\n") {
+		t.Errorf("service unit does not stage:\n%s", service)
+	}
+	apply, err := os.ReadFile(applyPath)
+	if err != nil {
+		t.Fatalf("read apply unit: %v", err)
+	}
+	for _, want := range []string{"DefaultDependencies=no\n", "Before=systemd-sysext.service sysinit.target\n", "WantedBy=sysinit.target\n"} {
+		if !strings.Contains(string(apply), want) {
+			t.Errorf("apply unit missing %q:\n%s", want, apply)
+		}
+	}
+	if runner.StartUnit == applyUnitName+".service" {
+		t.Error("EnableDaemon(ApplyAtBoot) started the apply unit")
+	}
+
+	status, err := client.DaemonStatus(t.Context(), DaemonStatusOptions{})
+	if err != nil {
+		t.Fatalf("DaemonStatus() error = %v", err)
+	}
+	if !status.ApplyAtBoot || status.Modified {
+		t.Errorf("DaemonStatus() = %+v, want ApplyAtBoot and not Modified", status)
+	}
+
+	if _, err := client.EnableDaemon(t.Context(), EnableDaemonOptions{}); err != nil {
+		t.Fatalf("EnableDaemon() without ApplyAtBoot error = %v", err)
+	}
+	if _, err := os.Lstat(applyPath); !os.IsNotExist(err) {
+		t.Errorf("apply unit kept after turning ApplyAtBoot off: %v", err)
+	}
+
+	if _, err := client.EnableDaemon(t.Context(), EnableDaemonOptions{ApplyAtBoot: true}); err != nil {
+		t.Fatalf("EnableDaemon(ApplyAtBoot) again error = %v", err)
+	}
+	if _, err := client.DisableDaemon(t.Context(), DisableDaemonOptions{}); err != nil {
+		t.Fatalf("DisableDaemon() error = %v", err)
+	}
+	if _, err := os.Lstat(applyPath); !os.IsNotExist(err) {
+		t.Errorf("apply unit kept after DisableDaemon: %v", err)
+	}
+}
+
+// TestEnableDaemonRefusesEditedApplyUnit verifies that an apply unit edited
+// outside updex stops EnableDaemon before it changes anything, and is
+// reported as Modified.
+func TestEnableDaemonRefusesEditedApplyUnit(t *testing.T) {
+	runner := &systemd.MockSystemctlRunner{}
+	client, unitPath := newDaemonTestClient(t, runner)
+	seedDaemonUnits(t, unitPath)
+	if err := os.WriteFile(filepath.Join(unitPath, applyUnitName+".service"), []byte("stub"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := client.DaemonStatus(t.Context(), DaemonStatusOptions{})
+	if err != nil {
+		t.Fatalf("DaemonStatus() error = %v", err)
+	}
+	if !status.Modified {
+		t.Error("DaemonStatus() with an edited apply unit is not Modified")
+	}
+
+	for _, opts := range []EnableDaemonOptions{{ApplyAtBoot: true}, {Schedule: "weekly"}} {
+		_, err := client.EnableDaemon(t.Context(), opts)
+		if err == nil || !strings.Contains(err.Error(), "modified outside updex") {
+			t.Errorf("EnableDaemon(%+v) error = %v, want modified outside updex", opts, err)
+		}
+	}
+	if runner.DaemonReloadCalled || runner.EnableCalled {
+		t.Error("EnableDaemon() changed units despite the edited apply unit")
+	}
+	if content, _ := os.ReadFile(filepath.Join(unitPath, applyUnitName+".service")); string(content) != "stub" {
+		t.Errorf("edited apply unit rewritten: %q", content)
+	}
+}
+
 func TestDisableDaemon(t *testing.T) {
 	runner := &systemd.MockSystemctlRunner{}
 	client, unitPath := newDaemonTestClient(t, runner)
@@ -263,9 +514,11 @@ func TestDaemonStatus(t *testing.T) {
 	})
 
 	t.Run("installed", func(t *testing.T) {
+		next := time.Unix(1760601600, 0)
 		runner := &systemd.MockSystemctlRunner{
-			IsEnabledResult: true,
-			IsActiveResult:  true,
+			IsEnabledResult:  true,
+			IsActiveResult:   true,
+			NextElapseResult: next,
 		}
 		client, unitPath := newDaemonTestClient(t, runner)
 		seedDaemonUnits(t, unitPath)
@@ -274,13 +527,16 @@ func TestDaemonStatus(t *testing.T) {
 		if err != nil {
 			t.Fatalf("DaemonStatus() error = %v", err)
 		}
-		want := DaemonStatusResult{Installed: true, Enabled: true, Active: true, Schedule: "daily"}
+		want := DaemonStatusResult{Installed: true, Enabled: true, Active: true, Schedule: "daily", RandomizedDelaySec: 3600, NextTrigger: next}
 		if *status != want {
 			t.Fatalf("DaemonStatus() = %+v, want %+v", status, want)
 		}
 		if !runner.IsEnabledCalled || !runner.IsActiveCalled {
 			t.Fatal("DaemonStatus() did not query enabled and active state")
 		}
+		if runner.NextElapseUnit != daemonUnitName+".timer" {
+			t.Errorf("DaemonStatus() queried the next trigger of %q", runner.NextElapseUnit)
+		}
 	})
 
 	t.Run("enabled query error", func(t *testing.T) {
@@ -320,6 +576,63 @@ func TestDaemonStatus(t *testing.T) {
 	})
 }
 
+// TestDaemonStatusReportsInstalledSettings verifies that status reads the
+// settings back from the unit files, and flags units edited outside updex.
+func TestDaemonStatusReportsInstalledSettings(t *testing.T) {
+	client, unitPath := newDaemonTestClient(t, &systemd.MockSystemctlRunner{})
+	_, err := client.EnableDaemon(t.Context(), EnableDaemonOptions{
+		Schedule:          "hourly",
+		OnBoot:            time.Minute,
+		Nice:              5,
+		IOSchedulingClass: "best-effort",
+		CPUQuota:          25,
+		DownloadRateLimit: 4096,
+		MetricsFile:       "/var/lib/node_exporter/updex.prom",
+	})
+	if err != nil {
+		t.Fatalf("EnableDaemon() error = %v", err)
+	}
+
+	status, err := client.DaemonStatus(t.Context(), DaemonStatusOptions{})
+	if err != nil {
+		t.Fatalf("DaemonStatus() error = %v", err)
+	}
+	want := DaemonStatusResult{
+		Installed:          true,
+		Schedule:           "hourly",
+		RandomizedDelaySec: 3600,
+		OnBootSec:          60,
+		Nice:               5,
+		IOSchedulingClass:  "best-effort",
+		CPUQuota:           25,
+		DownloadRateLimit:  4096,
+		MetricsFile:        "/var/lib/node_exporter/updex.prom",
+	}
+	if *status != want {
+		t.Fatalf("DaemonStatus() = %+v, want %+v", status, want)
+	}
+
+	servicePath := filepath.Join(unitPath, daemonUnitName+".service")
+	service, err := os.ReadFile(servicePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(service), "ProtectHome=yes\n", "", 1)
+	if err := os.WriteFile(servicePath, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, err = client.DaemonStatus(t.Context(), DaemonStatusOptions{})
+	if err != nil {
+		t.Fatalf("DaemonStatus() error = %v", err)
+	}
+	if !status.Modified || status.Schedule != "hourly" {
+		t.Errorf("DaemonStatus() after edit = %+v, want modified with the schedule still read", status)
+	}
+	if _, err := client.EnableDaemon(t.Context(), EnableDaemonOptions{}); err == nil || !strings.Contains(err.Error(), "modified outside updex") {
+		t.Errorf("EnableDaemon() over edited units error = %v, want a modified-outside-updex refusal", err)
+	}
+}
+
 func TestDaemonMethodsRespectCanceledContext(t *testing.T) {
 	ctx, cancel := context.WithCancel(t.Context())
 	cancel()
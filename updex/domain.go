@@ -30,9 +30,38 @@ type FeaturesOptions struct {
 //     collisions encountered while building the union are logged as
 //     warnings through the client's reporter.
 //
+// Each enabled feature's pin, every feature's rolled-back versions, and the
+// release channel are then applied to its transfers (see applyFeatureState).
+//
 // The client's immutable paths (captured at NewClient) are used throughout;
 // mutable package variables are never consulted after construction.
 func (c *Client) loadDomain(component string) ([]*config.Feature, []*config.Transfer, error) {
+	features, transfers, err := c.loadDefinitions(component)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.applyFeatureState(features, transfers)
+	return features, transfers, nil
+}
+
+// applyFeatureState copies the state features keep in their drop-ins onto
+// their transfers: pins, rolled-back versions and release channels (see
+// config.ApplyFeaturePins, config.ApplyFeatureSkips and
+// config.ApplyFeatureChannels). Conflicting pins and channels are logged as
+// warnings.
+func (c *Client) applyFeatureState(features []*config.Feature, transfers []*config.Transfer) {
+	for _, w := range config.ApplyFeaturePins(features, transfers) {
+		c.warn("%s", w)
+	}
+	config.ApplyFeatureSkips(features, transfers)
+	for _, w := range config.ApplyFeatureChannels(features, transfers) {
+		c.warn("%s", w)
+	}
+}
+
+// loadDefinitions loads the features and transfers loadDomain resolves,
+// before the feature state is applied.
+func (c *Client) loadDefinitions(component string) ([]*config.Feature, []*config.Transfer, error) {
 	if c.config.Definitions != "" {
 		if component != "" {
 			return nil, nil, fmt.Errorf("cannot combine --definitions with --component")
@@ -98,6 +127,12 @@ type ComponentInfo struct {
 // default (empty) Component to see the full union domain, including
 // anything still defined there.
 func (c *Client) Components(ctx context.Context) ([]ComponentInfo, error) {
+	_, unlock, err := c.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	c.msg("Discovering components")
 
 	components, err := config.DiscoverComponentsIn(c.paths.definitionRoots)
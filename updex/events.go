@@ -0,0 +1,61 @@
+package updex
+
+import "github.com/frostyard/std/reporter"
+
+// EventType names a step of an update or apply that is reported as an
+// Event.
+type EventType string
+
+const (
+	// EventInstalled: a new version was downloaded, installed and linked.
+	EventInstalled EventType = "installed"
+	// EventSwitched: the link was switched to a version already on disk.
+	EventSwitched EventType = "switched"
+	// EventStaged: a new version was downloaded and staged for Apply.
+	EventStaged EventType = "staged"
+	// EventApplied: a staged version was installed and linked by Apply.
+	EventApplied EventType = "applied"
+	// EventUpdateFailed: a transfer failed to update.
+	EventUpdateFailed EventType = "update-failed"
+	// EventApplyFailed: a staged version failed to apply.
+	EventApplyFailed EventType = "apply-failed"
+	// EventRefreshFailed: systemd-sysext refresh failed after linking.
+	EventRefreshFailed EventType = "refresh-failed"
+	// EventReverted: a transfer was linked back to its previous version
+	// because its feature failed its health checks.
+	EventReverted EventType = "reverted"
+)
+
+// Event is one message of an operation with its subject kept apart, for
+// reporters that store structured fields (see EventReporter). Type is empty
+// for a plain message that was reported while working on a transfer.
+type Event struct {
+	Type     EventType
+	Warning  bool
+	Feature  string
+	Transfer string // the transfer's component
+	Version  string
+	Message  string // as Message or Warning would have printed it
+}
+
+// EventReporter optionally lets a Progress reporter receive Events instead
+// of their formatted messages. Reporters without it get the message through
+// Message or Warning, so existing implementations print exactly what they
+// did before.
+type EventReporter interface {
+	reporter.Reporter
+	Event(e Event)
+}
+
+// event reports e through the client's reporter.
+func (c *Client) event(e Event) {
+	if r, ok := c.reporter.(EventReporter); ok {
+		r.Event(e)
+		return
+	}
+	if e.Warning {
+		c.reporter.Warning("%s", e.Message)
+	} else {
+		c.reporter.Message("%s", e.Message)
+	}
+}
@@ -0,0 +1,78 @@
+package updex
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// eventRecorder is an EventReporter that records every event, including
+// the plain messages it receives as events.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) Message(format string, a ...any) {
+	r.Event(Event{Message: fmt.Sprintf(format, a...)})
+}
+
+func (r *eventRecorder) Warning(format string, a ...any) {
+	r.Event(Event{Warning: true, Message: fmt.Sprintf(format, a...)})
+}
+
+func (r *eventRecorder) Event(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// TestUpdateFeaturesReportsEvents verifies that an EventReporter receives
+// each install and apply as a typed Event naming its subject, and the
+// messages of a transfer's job with the job's feature and transfer.
+func TestUpdateFeaturesReportsEvents(t *testing.T) {
+	client, _, _, _ := stagingFixture(t)
+	rec := &eventRecorder{}
+	client.reporter = rec
+
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{Stage: true}); err != nil {
+		t.Fatalf("UpdateFeatures(Stage) failed: %v", err)
+	}
+	if _, err := client.Apply(t.Context(), ApplyOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	want := []Event{
+		{Type: EventStaged, Feature: "testfeature", Transfer: "testext", Version: "1.1.0", Message: "Staged version 1.1.0"},
+		{Type: EventApplied, Feature: "testfeature", Transfer: "testext", Version: "1.1.0", Message: "Applied testext 1.1.0"},
+	}
+	var got []Event
+	var processing bool
+	for _, e := range rec.events {
+		if e.Type != "" {
+			got = append(got, e)
+		}
+		if e.Message == "Processing testfeature/testext" {
+			processing = e.Feature == "testfeature" && e.Transfer == "testext"
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+	if !processing {
+		t.Errorf("job message not reported with its feature and transfer: %+v", rec.events)
+	}
+}
+
+func TestEventFallsBackToMessages(t *testing.T) {
+	rec := &recordingReporter{}
+	client := NewClient(ClientConfig{Progress: rec})
+
+	client.event(Event{Type: EventInstalled, Version: "1.0", Message: "Installed version 1.0"})
+	client.event(Event{Type: EventUpdateFailed, Warning: true, Message: "download failed"})
+
+	want := []string{"Installed version 1.0", "warning: download failed"}
+	if fmt.Sprint(rec.lines) != fmt.Sprint(want) {
+		t.Errorf("lines = %q, want %q", rec.lines, want)
+	}
+}
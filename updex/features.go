@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/frostyard/updex/catalog"
 	"github.com/frostyard/updex/config"
-	"github.com/frostyard/updex/manifest"
 	"github.com/frostyard/updex/sysext"
 	"github.com/frostyard/updex/version"
+	"github.com/frostyard/updex/webhook"
 )
 
 // Features returns all configured features with their status.
@@ -20,6 +24,12 @@ import (
 // provided; additional elements are ignored. Callers with no options may
 // omit it entirely.
 func (c *Client) Features(ctx context.Context, opts ...FeaturesOptions) ([]FeatureInfo, error) {
+	_, unlock, err := c.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	var opt FeaturesOptions
 	if len(opts) > 0 {
 		opt = opts[0]
@@ -62,6 +72,8 @@ func (c *Client) Features(ctx context.Context, opts ...FeaturesOptions) ([]Featu
 			Origin:        origin,
 			OriginName:    originName,
 			Transfers:     transferNames,
+			PinnedVersion: f.PinVersion,
+			Channel:       f.Channel,
 		}
 		featureInfos = append(featureInfos, info)
 	}
@@ -110,11 +122,16 @@ func featureOrigin(path, imageName string, definitionRoots []string, definitions
 	}
 }
 
-// updexDropInName is the feature drop-in file updex owns. Everything else
-// in a <feature>.feature.d directory belongs to the administrator and must
-// be left alone (see CatalogRemove).
+// updexDropInName is the only feature drop-in updex owns (ADR-0004): it
+// holds both the Enabled= written by enable/disable and the pin written by
+// PinFeature. Everything else in a <feature>.feature.d directory belongs to
+// the administrator and must be left alone (see CatalogRemove).
 const updexDropInName = "00-updex.conf"
 
+// pinVersionPattern is what a pinned version may contain: the characters
+// the @v placeholder matches.
+var pinVersionPattern = regexp.MustCompile(`^[a-zA-Z0-9._+:~-]+$`)
+
 // lookupFeature returns the feature matching name from an already-loaded
 // feature set. It returns an error if the feature is not found or is
 // masked. The action parameter (e.g. "enabled", "disabled") is used in the
@@ -132,18 +149,32 @@ func lookupFeature(features []*config.Feature, name, action string) (*config.Fea
 	return nil, fmt.Errorf("feature '%s' not found", name)
 }
 
+// featureDropInPath returns the path of the updex-owned drop-in for f.
+// The drop-in lives under the same systemd-sysupdate component scope the
+// feature file itself was discovered under (see config.ComponentOfPath):
+// component-scoped features get /etc/sysupdate.<name>.d/..., legacy default
+// and --definitions-loaded features keep the legacy /etc/sysupdate.d/...
+// path.
+func (c *Client) featureDropInPath(f *config.Feature) string {
+	component, _ := config.ComponentOfPath(f.FilePath) // "" for the legacy default or a --definitions override
+	return filepath.Join(config.EtcComponentDirIn(component, c.paths.definitionRoots), f.Name+".feature.d", updexDropInName)
+}
+
 // writeFeatureDropIn creates a drop-in configuration file that sets a
-// feature's enabled state. The drop-in is written under the same
-// systemd-sysupdate component scope the feature file itself was discovered
-// under (see config.ComponentOfPath): component-scoped features get
-// /etc/sysupdate.<name>.d/..., legacy default and --definitions-loaded
-// features keep the legacy /etc/sysupdate.d/... path. In dry-run mode it
-// only logs what would happen and returns the path without writing
+// feature's enabled state, keeping any pin already in it. In dry-run mode
+// it only logs what would happen and returns the path without writing
 // anything.
 func (c *Client) writeFeatureDropIn(f *config.Feature, enabled bool, dryRun bool) (string, error) {
-	component, _ := config.ComponentOfPath(f.FilePath) // "" for the legacy default or a --definitions override
-	dropInDir := filepath.Join(config.EtcComponentDirIn(component, c.paths.definitionRoots), f.Name+".feature.d")
-	dropInFile := filepath.Join(dropInDir, updexDropInName)
+	return c.updateFeatureDropIn(f, dryRun, func(d *config.FeatureDropIn) { d.Enabled = &enabled })
+}
+
+// updateFeatureDropIn rewrites the updex-owned drop-in for f with set
+// applied to its current state, creating the file and its directory as
+// needed. In dry-run mode it only logs what would happen and returns the
+// path without writing anything.
+func (c *Client) updateFeatureDropIn(f *config.Feature, dryRun bool, set func(*config.FeatureDropIn)) (string, error) {
+	dropInFile := c.featureDropInPath(f)
+	dropInDir := filepath.Dir(dropInFile)
 
 	if dryRun {
 		c.msg("Would create drop-in: %s", dropInFile)
@@ -172,12 +203,20 @@ func (c *Client) writeFeatureDropIn(f *config.Feature, enabled bool, dryRun bool
 	default:
 		return "", fmt.Errorf("failed to check drop-in directory: %w", err)
 	}
-	if _, err := managedFileExists(dropInFile); err != nil {
+	exists, err := managedFileExists(dropInFile)
+	if err != nil {
 		return "", fmt.Errorf("failed to check drop-in file: %w", err)
 	}
 
-	content := fmt.Sprintf("[Feature]\nEnabled=%v\n", enabled)
-	if err := writeManagedFile(dropInFile, content); err != nil {
+	var state config.FeatureDropIn
+	if exists {
+		if state, err = config.ParseFeatureDropIn(dropInFile); err != nil {
+			return "", err
+		}
+	}
+	set(&state)
+
+	if err := writeManagedFile(dropInFile, state.String()); err != nil {
 		return "", fmt.Errorf("failed to write drop-in file: %w", err)
 	}
 
@@ -185,6 +224,156 @@ func (c *Client) writeFeatureDropIn(f *config.Feature, enabled bool, dryRun bool
 	return dropInFile, nil
 }
 
+// PinFeature holds a feature's transfers at version by writing PinVersion=
+// into the updex-owned drop-in. UpdateFeatures then installs and links that
+// version instead of the newest, CheckFeatures compares against it, and
+// vacuum never removes it. A version RollbackFeature or a failed health
+// check skipped is offered again while pinned, and its SkipVersions= entry
+// in the feature's drop-in is removed, so unpinning afterwards does not
+// skip it again. Pinning does not download anything.
+func (c *Client) PinFeature(ctx context.Context, name, version string, opts PinFeatureOptions) (*FeatureActionResult, error) {
+	c.msg("Pinning %s to %s", name, version)
+
+	result := &FeatureActionResult{
+		Feature: name,
+		Action:  "pin",
+		DryRun:  opts.DryRun,
+	}
+
+	if !pinVersionPattern.MatchString(version) {
+		err := fmt.Errorf("invalid version %q", version)
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+
+	_, unlock, err := c.lock(ctx, !opts.DryRun)
+	if err != nil {
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+	defer unlock()
+
+	features, _, err := c.loadDomain(opts.Component)
+	if err != nil {
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+
+	f, err := lookupFeature(features, name, "pinned")
+	if err != nil {
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+
+	dropInFile, err := c.updateFeatureDropIn(f, opts.DryRun, func(d *config.FeatureDropIn) {
+		d.PinVersion = version
+		// Pinning a version rolled back from is the way to take it back.
+		d.SkipVersions = slices.DeleteFunc(d.SkipVersions, func(entry string) bool {
+			_, v, _ := strings.Cut(entry, "/")
+			return v == version
+		})
+	})
+	if err != nil {
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+
+	result.Success = true
+	if opts.DryRun {
+		result.NextActionMessage = fmt.Sprintf("Dry run complete. Would pin feature '%s' to version %s", name, version)
+	} else {
+		result.DropIn = dropInFile
+		result.NextActionMessage = fmt.Sprintf("Feature '%s' pinned to version %s. Run 'updex features update' to install it.", name, version)
+	}
+	return result, nil
+}
+
+// UnpinFeature removes the pin PinFeature wrote, so the feature's transfers
+// follow the newest version again. A feature without an updex pin is left
+// as it is. A pin set by the administrator in another drop-in is not
+// removed.
+func (c *Client) UnpinFeature(ctx context.Context, name string, opts UnpinFeatureOptions) (*FeatureActionResult, error) {
+	c.msg("Unpinning %s", name)
+
+	result := &FeatureActionResult{
+		Feature: name,
+		Action:  "unpin",
+		DryRun:  opts.DryRun,
+	}
+
+	_, unlock, err := c.lock(ctx, !opts.DryRun)
+	if err != nil {
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+	defer unlock()
+
+	features, _, err := c.loadDomain(opts.Component)
+	if err != nil {
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+
+	f, err := lookupFeature(features, name, "unpinned")
+	if err != nil {
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+
+	dropInFile := c.featureDropInPath(f)
+	var state config.FeatureDropIn
+	exists, err := managedFileExists(dropInFile)
+	if err == nil && exists {
+		state, err = config.ParseFeatureDropIn(dropInFile)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to check drop-in file: %w", err)
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+
+	result.Success = true
+	switch {
+	case state.PinVersion == "":
+		result.NextActionMessage = fmt.Sprintf("Feature '%s' is not pinned by updex", name)
+		return result, nil
+	case opts.DryRun:
+		c.msg("Would remove pin from drop-in: %s", dropInFile)
+		result.NextActionMessage = fmt.Sprintf("Dry run complete. Would unpin feature '%s'", name)
+		return result, nil
+	case state.Enabled == nil:
+		// The drop-in held only the pin: remove it rather than leave an
+		// empty file behind.
+		err = os.Remove(dropInFile)
+		if err == nil {
+			c.msg("Removed drop-in: %s", dropInFile)
+			result.RemovedFiles = []string{dropInFile}
+		}
+	default:
+		_, err = c.updateFeatureDropIn(f, false, func(d *config.FeatureDropIn) { d.PinVersion = "" })
+		if err == nil {
+			result.DropIn = dropInFile
+		}
+	}
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+	result.NextActionMessage = fmt.Sprintf("Feature '%s' unpinned. Run 'updex features update' to install the newest version.", name)
+	return result, nil
+}
+
 // EnableFeature enables a feature by creating a drop-in configuration file.
 func (c *Client) EnableFeature(ctx context.Context, name string, opts EnableFeatureOptions) (*FeatureActionResult, error) {
 	c.msg("Enabling %s", name)
@@ -195,6 +384,14 @@ func (c *Client) EnableFeature(ctx context.Context, name string, opts EnableFeat
 		DryRun:  opts.DryRun,
 	}
 
+	ctx, unlock, err := c.lock(ctx, !opts.DryRun)
+	if err != nil {
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+	defer unlock()
+
 	features, transfers, err := c.loadDomain(opts.Component)
 	if err != nil {
 		result.Error = err.Error()
@@ -209,6 +406,12 @@ func (c *Client) EnableFeature(ctx context.Context, name string, opts EnableFeat
 		c.warn("%s", result.Error)
 		return result, err
 	}
+	if opts.Version != "" && !opts.Now {
+		err := fmt.Errorf("installing version %s requires Now", opts.Version)
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
 
 	// Create drop-in directory and file
 	dropInFile, err := c.writeFeatureDropIn(f, true, opts.DryRun)
@@ -230,26 +433,39 @@ func (c *Client) EnableFeature(ctx context.Context, name string, opts EnableFeat
 		if len(featureTransfers) == 0 {
 			c.msg("No transfers associated with this feature")
 		} else {
+			var changed []activation
 			for _, transfer := range featureTransfers {
 				c.msg("Processing %s", transfer.Component)
 
 				if opts.DryRun {
 					c.msg("Would download: %s", transfer.Component)
-					result.DownloadedFiles = append(result.DownloadedFiles, transfer.Component+" (would download)")
+					entry := transfer.Component
+					if opts.Version != "" {
+						entry += "@" + opts.Version
+					}
+					result.DownloadedFiles = append(result.DownloadedFiles, entry+" (would download)")
 				} else {
 					// Use installTransfer which handles all the download logic
-					version, _, downloaded, err := c.installTransfer(ctx, transfer, installTransferOptions{
+					outcome, err := c.installTransfer(ctx, transfer, installTransferOptions{
 						NoRefresh: true, // refresh is batched at the end
+						Version:   opts.Version,
+						Feature:   name,
 					})
+					version, downloaded := outcome.Version, outcome.Downloaded
 					if err != nil {
 						err = fmt.Errorf("failed to download %s: %w", transfer.Component, err)
 						result.Error = err.Error()
 						c.warn("%s", result.Error)
 						return result, err
 					}
+					if (downloaded || outcome.Relinked) && outcome.Previous != version {
+						changed = append(changed, activation{transfer, hookEnv{feature: name, transfer: transfer.Component, oldVersion: outcome.Previous, newVersion: version}})
+					}
 					if downloaded {
 						result.DownloadedFiles = append(result.DownloadedFiles, fmt.Sprintf("%s@%s", transfer.Component, version))
 						c.msg("Downloaded %s version %s", transfer.Component, version)
+					} else if outcome.Relinked {
+						c.msg("Switched %s to installed version %s", transfer.Component, version)
 					} else {
 						c.msg("Version %s already installed and current for %s", version, transfer.Component)
 					}
@@ -270,6 +486,14 @@ func (c *Client) EnableFeature(ctx context.Context, name string, opts EnableFeat
 					result.NextActionMessage = fmt.Sprintf("Feature '%s' enabled and %d extension(s) downloaded, but systemd-sysext refresh failed; run 'systemd-sysext refresh' (or reboot) to activate them", name, len(result.DownloadedFiles))
 					return result, err
 				}
+				for _, a := range changed {
+					_ = c.runHooks(ctx, HookPostRefresh, a.env)
+				}
+				if len(changed) > 0 && hasHealthChecks(f) {
+					if err := c.checkEnabledFeature(ctx, f, changed, result); err != nil {
+						return result, err
+					}
+				}
 			}
 		}
 	}
@@ -301,6 +525,14 @@ func (c *Client) DisableFeature(ctx context.Context, name string, opts DisableFe
 		DryRun:  opts.DryRun,
 	}
 
+	ctx, unlock, err := c.lock(ctx, !opts.DryRun)
+	if err != nil {
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+	defer unlock()
+
 	features, transfers, err := c.loadDomain(opts.Component)
 	if err != nil {
 		result.Error = err.Error()
@@ -367,6 +599,19 @@ func (c *Client) DisableFeature(ctx context.Context, name string, opts DisableFe
 		result.DropIn = dropInFile
 	}
 
+	// Post-disable hooks are told the version that was current, before
+	// --now removes it.
+	var disabled []hookEnv
+	if !opts.DryRun {
+		for _, t := range featureTransfers {
+			_, current, err := sysext.GetInstalledVersionsAt(t, c.paths.sysextLinkDir)
+			if err != nil {
+				c.warn("could not inspect installed versions of %s: %v", t.Component, err)
+			}
+			disabled = append(disabled, hookEnv{feature: name, transfer: t.Component, oldVersion: current})
+		}
+	}
+
 	// Handle --now (or --remove for backward compat): remove files and unmerge
 	if willRemoveFiles && len(featureTransfers) > 0 {
 		// If --now is specified, unmerge first (unless dry-run)
@@ -430,6 +675,9 @@ func (c *Client) DisableFeature(ctx context.Context, name string, opts DisableFe
 	}
 
 	result.Success = true
+	for _, hook := range disabled {
+		_ = c.runHooks(ctx, HookPostDisable, hook)
+	}
 
 	// Set the next action message based on what was done
 	if opts.DryRun {
@@ -449,221 +697,436 @@ func (c *Client) DisableFeature(ctx context.Context, name string, opts DisableFe
 }
 
 // UpdateFeatures downloads and installs new versions for all enabled features.
-func (c *Client) UpdateFeatures(ctx context.Context, opts UpdateFeaturesOptions) ([]UpdateFeaturesResult, error) {
-	features, transfers, err := c.loadDomain(opts.Component)
+// With opts.Record the run is added to the run history, and with
+// opts.MetricsFile its metrics are written, whatever its outcome. Unless
+// opts.DryRun, the webhook targets are notified of it.
+func (c *Client) UpdateFeatures(ctx context.Context, opts UpdateFeaturesOptions) (results []UpdateFeaturesResult, err error) {
+	ctx, unlock, err := c.lock(ctx, !opts.DryRun)
 	if err != nil {
 		return nil, err
 	}
+	defer unlock()
 
-	// Initialize as a non-nil slice so empty results serialize as JSON `[]`
-	// rather than `null`. Consumers (pilothouse, snosi scripts) that parse
-	// the CLI's `--json` output depend on an array being present.
-	allResults := make([]UpdateFeaturesResult, 0)
-	var hasErrors bool
-
-	// Cache manifests by source URL to avoid redundant HTTP requests
-	// when multiple transfers share the same source. getAvailableVersions
-	// refetches (with verification) when a Verify=true transfer meets an
-	// unverified entry; the verified manifest then replaces it here.
-	manifestCache := make(map[string]*manifest.Manifest)
-
-	for _, f := range features {
-		if !f.Enabled || f.Masked {
-			continue
-		}
-
-		featureTransfers := config.GetTransfersForFeature(transfers, f.Name)
-		if len(featureTransfers) == 0 {
-			continue
-		}
-
-		featureResult := UpdateFeaturesResult{
-			Feature: f.Name,
-			// Non-nil so a feature with no per-transfer result serializes
-			// its `results` as `[]` rather than `null`.
-			Results: make([]UpdateResult, 0),
-		}
-
-		for _, transfer := range featureTransfers {
-			c.msg("Processing %s/%s", f.Name, transfer.Component)
-
-			result := UpdateResult{
-				Component: transfer.Component,
-				DryRun:    opts.DryRun,
-			}
-
-			v, m, downloaded, err := c.installTransfer(ctx, transfer, installTransferOptions{
-				DryRun:         opts.DryRun,
-				NoVacuum:       opts.NoVacuum,
-				NoRefresh:      true, // refresh is batched at the end
-				CachedManifest: manifestCache[transfer.Source.Path],
-			})
-			if m != nil {
-				manifestCache[transfer.Source.Path] = m
+	var jobs []transferJob
+	if !opts.DryRun {
+		started := time.Now()
+		defer func() {
+			if opts.Record {
+				c.recordRun(started, opts, results, err)
 			}
-			if err != nil {
-				result.Error = err.Error()
-				c.warn("%s", result.Error)
-				featureResult.Results = append(featureResult.Results, result)
-				hasErrors = true
-				continue
+			if opts.MetricsFile != "" {
+				c.writeMetrics(ctx, opts.MetricsFile, metricsOpUpdate, c.updateMetrics(jobs, results), results, err)
 			}
-
-			result.Version = v
-			if downloaded {
-				result.Downloaded = true
-				if opts.DryRun {
-					result.NextActionMessage = "Would download and install version " + v
-					if !opts.NoVacuum {
-						removed, _, err := sysext.PlanVacuumAfterInstallAt(transfer, v, c.paths.sysextLinkDir)
-						if err != nil {
-							c.warn("failed to plan vacuum for %s: %v", transfer.Component, err)
-						}
-						result.RemovedVersions = removed
-						if len(removed) > 0 {
-							result.NextActionMessage += fmt.Sprintf("; would remove old versions: %v", removed)
-						}
-					}
-					c.msg("Would install version %s", v)
-				} else {
-					result.Installed = true
-					result.NextActionMessage = "Reboot required to activate changes"
-					c.msg("Installed version %s", v)
-				}
-			} else {
-				result.Installed = true
-				c.msg("Version %s already installed and current", v)
+			// Deliveries can take minutes against a dead endpoint; other
+			// updex operations need not wait for them.
+			unlock()
+			sent := results
+			if sent == nil {
+				sent = make([]UpdateFeaturesResult, 0)
 			}
+			c.notifyWebhooks(ctx, webhook.EventUpdate, opts.Component, sent, err)
+		}()
+	}
+	features, transfers, err := c.loadDomain(opts.Component)
+	if err != nil {
+		return nil, err
+	}
+	jobs = enabledTransferJobs(features, transfers)
+	return c.updateJobs(ctx, jobs, opts)
+}
 
-			featureResult.Results = append(featureResult.Results, result)
+// updateJobs installs the newest version of every job's transfer on the
+// worker pool, then runs the batched refresh and the health checks of the
+// features it activated new versions of. Results are grouped by feature in
+// job order.
+func (c *Client) updateJobs(ctx context.Context, jobs []transferJob, opts UpdateFeaturesOptions) ([]UpdateFeaturesResult, error) {
+	// Cache manifests by source URL to avoid redundant HTTP requests
+	// when multiple transfers share the same source. getAvailableVersions
+	// refetches (with verification) when a Verify=true transfer meets an
+	// unverified entry; the verified manifest then replaces it in the cache.
+	manifests := newManifestCache()
+
+	// A transfer owned by several enabled features is updated once, by
+	// its first job, so two workers never install into the same target;
+	// the jobs of the other features share that job's result.
+	first := firstJobs(jobs)
+	var runs []int
+	for i := range jobs {
+		if first[i] == i {
+			runs = append(runs, i)
 		}
+	}
 
-		allResults = append(allResults, featureResult)
+	results := make([]UpdateResult, len(jobs))
+	failed := make([]bool, len(jobs))
+	log := newJobLog(c.reporter, len(runs))
+	runJobs(workerCount(opts.Workers), len(runs), func(k int) {
+		defer log.finish(k)
+		i := runs[k]
+		jc := c.forJob(log, k, jobs[i])
+		results[i], failed[i] = jc.updateTransfer(ctx, jobs[i], opts, manifests)
+		results[i].DownloadBytes, results[i].DownloadSeconds = jc.stats.downloadBytes, jc.stats.downloadTime.Seconds()
+		results[i].Retries, results[i].VerificationFailures = jc.stats.retries, jc.stats.verificationFailures
+	})
+	for i, f := range first {
+		results[i], failed[i] = results[f], failed[f]
 	}
 
 	var refreshErr error
 	if opts.DryRun {
 		c.msg("Dry run: skipping sysext refresh")
+	} else if opts.Stage {
+		c.msg("Staged only: nothing to refresh until 'updex apply'")
 	} else if !opts.NoRefresh {
 		if err := c.runner.Refresh(); err != nil {
 			// Installs and links are on disk but not activated. Results stay
 			// populated (Installed=true is accurate); the error tells the
 			// caller activation did not happen and the CLI exits non-zero.
 			refreshErr = fmt.Errorf("sysext refresh failed: %w", err)
-			c.warn("%s", refreshErr)
+			c.event(Event{Type: EventRefreshFailed, Warning: true, Message: refreshErr.Error()})
+		} else {
+			for i, r := range results {
+				if first[i] == i && activatedUpdate(r, failed[i]) {
+					_ = c.runHooks(ctx, HookPostRefresh, hookEnv{feature: jobs[i].feature, transfer: r.Component, oldVersion: r.FromVersion, newVersion: r.Version})
+				}
+			}
+			// A feature failing its health checks is reverted, which fails
+			// its results; they are grouped below.
+			refreshErr = c.checkUpdatedFeatures(ctx, jobs, results, failed)
 		}
 	} else {
 		c.msg("Skipping sysext refresh (--no-refresh)")
 	}
 
+	// Initialize as a non-nil slice so empty results serialize as JSON `[]`
+	// rather than `null`. Consumers (pilothouse, snosi scripts) that parse
+	// the CLI's `--json` output depend on an array being present.
+	allResults := make([]UpdateFeaturesResult, 0)
+	var hasErrors bool
+	for i, job := range jobs {
+		if i == 0 || jobs[i-1].feature != job.feature {
+			allResults = append(allResults, UpdateFeaturesResult{
+				Feature: job.feature,
+				// Non-nil so a feature with no per-transfer result serializes
+				// its `results` as `[]` rather than `null`.
+				Results: make([]UpdateResult, 0),
+			})
+		}
+		last := &allResults[len(allResults)-1]
+		last.Results = append(last.Results, results[i])
+		hasErrors = hasErrors || failed[i]
+	}
+
 	if hasErrors {
 		return allResults, errors.Join(fmt.Errorf("one or more components failed to update"), refreshErr)
 	}
 	return allResults, refreshErr
 }
 
+// updateTransfer runs one UpdateFeatures job, reporting whether it failed.
+func (c *Client) updateTransfer(ctx context.Context, job transferJob, opts UpdateFeaturesOptions, manifests *manifestCache) (UpdateResult, bool) {
+	transfer := job.transfer
+	c.msg("Processing %s/%s", job.feature, transfer.Component)
+
+	result := UpdateResult{
+		Component: transfer.Component,
+		DryRun:    opts.DryRun,
+	}
+
+	outcome, err := c.installTransfer(ctx, transfer, installTransferOptions{
+		DryRun:        opts.DryRun,
+		NoVacuum:      opts.NoVacuum,
+		NoRefresh:     true, // refresh is batched at the end
+		Version:       opts.Version,
+		IgnorePhasing: opts.IgnorePhasing,
+		Stage:         opts.Stage,
+		Manifests:     manifests,
+		Feature:       job.feature,
+	})
+	v, downloaded := outcome.Version, outcome.Downloaded
+	result.FromVersion = outcome.Previous
+	if err != nil {
+		result.Error = err.Error()
+		c.event(Event{Type: EventUpdateFailed, Warning: true, Feature: job.feature, Transfer: transfer.Component, Version: v, Message: result.Error})
+		return result, true
+	}
+	report := func(typ EventType, format string) {
+		c.event(Event{Type: typ, Feature: job.feature, Transfer: transfer.Component, Version: v, Message: fmt.Sprintf(format, v)})
+	}
+
+	result.Version = v
+	result.SourceURL = outcome.SourceURL
+	result.Relinked = outcome.Relinked
+	result.Staged = outcome.Staged
+	if outcome.Staged {
+		result.Downloaded = downloaded
+		switch {
+		case opts.DryRun:
+			result.NextActionMessage = "Would stage version " + v
+			c.msg("Would stage version %s", v)
+		case downloaded:
+			result.NextActionMessage = "Staged; run 'updex apply' to activate"
+			report(EventStaged, "Staged version %s")
+		default:
+			result.NextActionMessage = "Already staged; run 'updex apply' to activate"
+			c.msg("Version %s already staged", v)
+		}
+	} else if downloaded {
+		result.Downloaded = true
+		if opts.DryRun {
+			result.NextActionMessage = "Would download and install version " + v
+			if !opts.NoVacuum {
+				removed, _, err := sysext.PlanVacuumAfterInstallAt(transfer, v, c.paths.sysextLinkDir)
+				if err != nil {
+					c.warn("failed to plan vacuum for %s: %v", transfer.Component, err)
+				}
+				result.RemovedVersions = removed
+				if len(removed) > 0 {
+					result.NextActionMessage += fmt.Sprintf("; would remove old versions: %v", removed)
+				}
+			}
+			c.msg("Would install version %s", v)
+		} else {
+			result.Installed = true
+			result.NextActionMessage = "Reboot required to activate changes"
+			report(EventInstalled, "Installed version %s")
+		}
+	} else if outcome.Relinked && opts.DryRun {
+		result.NextActionMessage = "Would switch to installed version " + v
+		c.msg("Would switch to installed version %s", v)
+	} else {
+		result.Installed = true
+		if outcome.Relinked {
+			result.NextActionMessage = "Reboot required to activate changes"
+			report(EventSwitched, "Switched to installed version %s")
+		} else {
+			c.msg("Version %s already installed and current", v)
+		}
+	}
+	return result, false
+}
+
 // CheckFeatures checks if newer versions are available for all enabled features.
-func (c *Client) CheckFeatures(ctx context.Context, opts CheckFeaturesOptions) ([]CheckFeaturesResult, error) {
+// With opts.MetricsFile its metrics are written, and unless opts.NoWebhooks
+// the webhook targets are notified of it, whatever its outcome.
+func (c *Client) CheckFeatures(ctx context.Context, opts CheckFeaturesOptions) (allResults []CheckFeaturesResult, err error) {
+	ctx, unlock, err := c.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	defer func() {
+		if opts.MetricsFile != "" {
+			c.writeMetrics(ctx, opts.MetricsFile, metricsOpCheck, checkMetrics(allResults), nil, err)
+		}
+		if opts.NoWebhooks {
+			return
+		}
+		unlock() // as in UpdateFeatures
+		sent := allResults
+		if sent == nil {
+			sent = make([]CheckFeaturesResult, 0)
+		}
+		c.notifyWebhooks(ctx, webhook.EventCheck, opts.Component, sent, err)
+	}()
 	features, transfers, err := c.loadDomain(opts.Component)
 	if err != nil {
 		return nil, err
 	}
 
+	// Cache manifests by source URL to avoid redundant HTTP requests
+	// when multiple transfers share the same source (see UpdateFeatures).
+	manifests := newManifestCache()
+
+	jobs := enabledTransferJobs(features, transfers)
+	results := make([]*CheckResult, len(jobs))
+	failed := make([]bool, len(jobs))
+	log := newJobLog(c.reporter, len(jobs))
+	runJobs(workerCount(opts.Workers), len(jobs), func(i int) {
+		defer log.finish(i)
+		jc := c.forJob(log, i, jobs[i])
+		results[i], failed[i] = jc.checkTransfer(ctx, jobs[i], manifests)
+		if results[i] != nil {
+			results[i].Retries, results[i].VerificationFailures = jc.stats.retries, jc.stats.verificationFailures
+		}
+	})
+
 	// Initialize as a non-nil slice so empty results serialize as JSON `[]`
 	// rather than `null` (see UpdateFeatures for the same rationale).
-	allResults := make([]CheckFeaturesResult, 0)
-
-	// Cache manifests by source URL to avoid redundant HTTP requests
-	// when multiple transfers share the same source. getAvailableVersions
-	// refetches (with verification) when a Verify=true transfer meets an
-	// unverified entry; the verified manifest then replaces it here.
-	manifestCache := make(map[string]*manifest.Manifest)
+	allResults = make([]CheckFeaturesResult, 0)
 	var hasErrors bool
-
-	for _, f := range features {
-		if !f.Enabled || f.Masked {
-			continue
+	for i, job := range jobs {
+		if i == 0 || jobs[i-1].feature != job.feature {
+			allResults = append(allResults, CheckFeaturesResult{
+				Feature: job.feature,
+				// Non-nil so a feature with no per-transfer result serializes
+				// its `results` as `[]` rather than `null`.
+				Results: make([]CheckResult, 0),
+			})
 		}
-
-		featureTransfers := config.GetTransfersForFeature(transfers, f.Name)
-		if len(featureTransfers) == 0 {
-			continue
+		if results[i] != nil {
+			last := &allResults[len(allResults)-1]
+			last.Results = append(last.Results, *results[i])
 		}
+		hasErrors = hasErrors || failed[i]
+	}
 
-		featureResult := CheckFeaturesResult{
-			Feature: f.Name,
-			// Non-nil so a feature with no per-transfer result serializes
-			// its `results` as `[]` rather than `null`.
-			Results: make([]CheckResult, 0),
-		}
+	if hasErrors {
+		return allResults, fmt.Errorf("one or more components failed to check")
+	}
+	return allResults, nil
+}
 
-		for _, transfer := range featureTransfers {
-			c.msg("Checking %s/%s", f.Name, transfer.Component)
+// checkTransfer runs one CheckFeatures job, reporting whether it failed. A
+// nil result means the source offers no matching version, which is not
+// reported.
+func (c *Client) checkTransfer(ctx context.Context, job transferJob, manifests *manifestCache) (*CheckResult, bool) {
+	transfer := job.transfer
+	c.msg("Checking %s/%s", job.feature, transfer.Component)
 
-			available, m, _, err := c.getAvailableVersions(ctx, transfer, manifestCache[transfer.Source.Path])
-			if m != nil {
-				manifestCache[transfer.Source.Path] = m
-			}
-			if err != nil {
-				// A component that cannot be checked is reported as such
-				// rather than dropped: consumers must be able to tell
-				// "could not check" from "no update" (mirrors UpdateFeatures).
-				err = fmt.Errorf("failed to get available versions: %w", err)
-				c.warn("%s", err)
-				featureResult.Results = append(featureResult.Results, CheckResult{
-					Component: transfer.Component,
-					Error:     err.Error(),
-				})
-				hasErrors = true
-				continue
-			}
+	available, m, patterns, err := c.cachedAvailableVersions(ctx, transfer, manifests)
+	if err != nil {
+		// A component that cannot be checked is reported as such
+		// rather than dropped: consumers must be able to tell
+		// "could not check" from "no update" (mirrors UpdateFeatures).
+		err = fmt.Errorf("failed to get available versions: %w", err)
+		c.warn("%s", err)
+		return &CheckResult{
+			Component: transfer.Component,
+			Error:     err.Error(),
+		}, true
+	}
 
-			if len(available) == 0 {
-				continue
-			}
+	if len(available) == 0 {
+		return nil, false
+	}
 
-			version.Sort(available)
-			newest := available[0]
+	version.Sort(available)
+	newest := available[0]
+	want := newest
+	if pin := transfer.Transfer.PinVersion; pin != "" {
+		if !slices.Contains(available, pin) {
+			err := fmt.Errorf("pinned version %s is not available", pin)
+			c.warn("%s", err)
+			return &CheckResult{
+				Component:     transfer.Component,
+				NewestVersion: newest,
+				PinnedVersion: pin,
+				Error:         err.Error(),
+			}, true
+		}
+		want = pin
+	}
 
-			installed, current, err := sysext.GetInstalledVersionsAt(transfer, c.paths.sysextLinkDir)
-			if err != nil {
-				// Without the installed set the comparison would report a
-				// spurious "update available"; report the failure instead.
-				err = fmt.Errorf("failed to get installed versions: %w", err)
-				c.warn("%s", err)
-				featureResult.Results = append(featureResult.Results, CheckResult{
-					Component:     transfer.Component,
-					NewestVersion: newest,
-					Error:         err.Error(),
-				})
-				hasErrors = true
-				continue
-			}
+	installed, current, err := sysext.GetInstalledVersionsAt(transfer, c.paths.sysextLinkDir)
+	if err != nil {
+		// Without the installed set the comparison would report a
+		// spurious "update available"; report the failure instead.
+		err = fmt.Errorf("failed to get installed versions: %w", err)
+		c.warn("%s", err)
+		return &CheckResult{
+			Component:     transfer.Component,
+			NewestVersion: newest,
+			Error:         err.Error(),
+		}, true
+	}
 
-			result := CheckResult{
-				Component:      transfer.Component,
-				CurrentVersion: current,
-				NewestVersion:  newest,
-			}
+	// A pin is never held back; otherwise newest is the newest version
+	// this host accepts, and a newer one phasing holds back is reported
+	// apart from it.
+	var heldBack string
+	if transfer.Transfer.PinVersion == "" {
+		var accepted []string
+		accepted, heldBack = c.phase(transfer, m, patterns, available, installed)
+		newest = ""
+		if len(accepted) > 0 {
+			newest = accepted[0]
+		}
+		want = newest
+	}
 
-			if len(installed) == 0 {
-				result.UpdateAvailable = true
-				c.msg("New version available: %s", newest)
-			} else if version.Compare(newest, current) > 0 {
-				result.UpdateAvailable = true
-				c.msg("Update available: %s → %s", current, newest)
-			} else {
-				c.msg("Up to date: %s", current)
-			}
+	result := &CheckResult{
+		Component:       transfer.Component,
+		CurrentVersion:  current,
+		NewestVersion:   newest,
+		PinnedVersion:   transfer.Transfer.PinVersion,
+		HeldBackVersion: heldBack,
+	}
+	// A staged image is reported but does not count as installed: the
+	// update is still available until it is applied.
+	if staged, _, err := sysext.StagedVersionAt(transfer, c.paths.sysextLinkDir); err == nil {
+		result.StagedVersion = staged
+	}
 
-			featureResult.Results = append(featureResult.Results, result)
+	// A pinned transfer is out of date whenever it is not at its pin, even
+	// if the pin is older than what is installed.
+	switch {
+	case want == "":
+		c.msg("Held back by phasing: %s", heldBack)
+	case len(installed) == 0:
+		result.UpdateAvailable = true
+		c.msg("New version available: %s", want)
+	case result.PinnedVersion != "" && current != want:
+		result.UpdateAvailable = true
+		c.msg("Pinned version differs: %s → %s", current, want)
+	case result.PinnedVersion == "" && version.Compare(newest, current) > 0:
+		result.UpdateAvailable = true
+		c.msg("Update available: %s → %s", current, newest)
+	case heldBack != "":
+		c.msg("Held back by phasing: %s → %s", current, heldBack)
+	default:
+		c.msg("Up to date: %s", current)
+	}
+	return result, false
+}
+
+// transferJob is one transfer of an enabled feature, as UpdateFeatures and
+// CheckFeatures hand it to runJobs.
+type transferJob struct {
+	feature  string
+	transfer *config.Transfer
+	def      *config.Feature // the feature's definition, for its health checks
+}
+
+// enabledTransferJobs lists the transfers of every enabled, unmasked feature,
+// in feature order and then transfer order. Results are assembled in this
+// order whatever order the jobs finish in.
+func enabledTransferJobs(features []*config.Feature, transfers []*config.Transfer) []transferJob {
+	var jobs []transferJob
+	for _, f := range features {
+		if !f.Enabled || f.Masked {
+			continue
+		}
+		for _, t := range config.GetTransfersForFeature(transfers, f.Name) {
+			jobs = append(jobs, transferJob{feature: f.Name, transfer: t, def: f})
 		}
+	}
+	return jobs
+}
 
-		allResults = append(allResults, featureResult)
+// firstJobs maps each job to the index of the first job updating the same
+// transfer, its own index for a transfer no earlier job updates.
+func firstJobs(jobs []transferJob) []int {
+	type key struct{ path, component string }
+	seen := make(map[key]int, len(jobs))
+	first := make([]int, len(jobs))
+	for i, job := range jobs {
+		k := key{job.transfer.FilePath, job.transfer.Component}
+		if f, ok := seen[k]; ok {
+			first[i] = f
+			continue
+		}
+		seen[k] = i
+		first[i] = i
 	}
+	return first
+}
 
-	if hasErrors {
-		return allResults, fmt.Errorf("one or more components failed to check")
+// workerCount resolves an options Workers value: zero means DefaultWorkers.
+func workerCount(workers int) int {
+	if workers == 0 {
+		return DefaultWorkers
 	}
-	return allResults, nil
+	return workers
 }
@@ -10,6 +10,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -1479,6 +1480,117 @@ func TestDisableFeature_Now_RefreshFailure_ReportsError(t *testing.T) {
 	}
 }
 
+// TestUpdateFeatures_MaxVersion_Downgrades verifies MaxVersion is applied
+// like MinVersion: the newest version at or below it is installed and
+// linked even when a newer image is already staged, and checks stop
+// offering the newer one.
+func TestUpdateFeatures_MaxVersion_Downgrades(t *testing.T) {
+	client, root, _, linkDir := pinFixture(t)
+	linkPath := filepath.Join(linkDir, "testext.raw")
+
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	assertLinkedTo(t, linkPath, "testext_2.0.0.raw")
+
+	transferPath := filepath.Join(root, "sysupdate.d", "testext.transfer")
+	content, err := os.ReadFile(transferPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content = []byte(strings.Replace(string(content), "[Transfer]\n", "[Transfer]\nMaxVersion=1.0.0\n", 1))
+	if err := os.WriteFile(transferPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Version != "1.0.0" || !r.Downloaded {
+		t.Errorf("update under MaxVersion = %+v, want 1.0.0 downloaded", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+
+	checks, err := client.CheckFeatures(t.Context(), CheckFeaturesOptions{})
+	if err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	if c := checks[0].Results[0]; c.CurrentVersion != "1.0.0" || c.NewestVersion != "1.0.0" || c.UpdateAvailable {
+		t.Errorf("CheckFeatures under MaxVersion = %+v, want 1.0.0 current and newest", c)
+	}
+}
+
+// TestUpdateFeatures_TargetVersion verifies that UpdateFeaturesOptions.Version
+// installs exactly that version, previews it in dry-run, switches back to a
+// staged version without downloading, and fails a source that lacks it.
+func TestUpdateFeatures_TargetVersion(t *testing.T) {
+	client, _, _, linkDir := pinFixture(t)
+	linkPath := filepath.Join(linkDir, "testext.raw")
+	update := func(opts UpdateFeaturesOptions) UpdateResult {
+		t.Helper()
+		opts.NoRefresh = true
+		results, err := client.UpdateFeatures(t.Context(), opts)
+		if err != nil {
+			t.Fatalf("UpdateFeatures(%+v) failed: %v", opts, err)
+		}
+		return results[0].Results[0]
+	}
+
+	update(UpdateFeaturesOptions{})
+	assertLinkedTo(t, linkPath, "testext_2.0.0.raw")
+
+	if r := update(UpdateFeaturesOptions{Version: "1.0.0", DryRun: true}); r.Version != "1.0.0" || !r.Downloaded || r.Installed {
+		t.Errorf("dry-run = %+v, want 1.0.0 would download", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_2.0.0.raw")
+
+	if r := update(UpdateFeaturesOptions{Version: "1.0.0"}); r.Version != "1.0.0" || !r.Downloaded {
+		t.Errorf("update to 1.0.0 = %+v, want it downloaded", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+
+	if r := update(UpdateFeaturesOptions{Version: "2.0.0", DryRun: true}); r.Version != "2.0.0" || r.Downloaded || !r.Relinked {
+		t.Errorf("dry-run back to 2.0.0 = %+v, want a relink without download", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+
+	if r := update(UpdateFeaturesOptions{Version: "2.0.0"}); r.Version != "2.0.0" || r.Downloaded || !r.Relinked || !r.Installed {
+		t.Errorf("update back to 2.0.0 = %+v, want a relink without download", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_2.0.0.raw")
+
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{Version: "3.0.0", NoRefresh: true})
+	if err == nil {
+		t.Fatal("expected an error for a version the source does not offer")
+	}
+	if msg := results[0].Results[0].Error; msg != "version 3.0.0 is not available" {
+		t.Errorf("component error = %q, want the unavailable version reported", msg)
+	}
+	assertLinkedTo(t, linkPath, "testext_2.0.0.raw")
+}
+
+// TestEnableFeature_VersionRequiresNow verifies that a target version is
+// refused without Now, before the drop-in is written.
+func TestEnableFeature_VersionRequiresNow(t *testing.T) {
+	client, root, _, _ := pinFixture(t)
+
+	if _, err := client.EnableFeature(t.Context(), "testfeature", EnableFeatureOptions{Version: "1.0.0"}); err == nil {
+		t.Fatal("expected an error for Version without Now")
+	}
+	if _, err := os.Stat(filepath.Join(root, "sysupdate.d", "testfeature.feature.d")); !os.IsNotExist(err) {
+		t.Errorf("drop-in directory created: %v", err)
+	}
+
+	result, err := client.EnableFeature(t.Context(), "testfeature", EnableFeatureOptions{Now: true, NoRefresh: true, Version: "1.0.0"})
+	if err != nil {
+		t.Fatalf("EnableFeature failed: %v", err)
+	}
+	if !slices.Equal(result.DownloadedFiles, []string{"testext@1.0.0"}) {
+		t.Errorf("DownloadedFiles = %v, want [testext@1.0.0]", result.DownloadedFiles)
+	}
+}
+
 // TestUpdateFeatures_MinVersion_FiltersVersions verifies MinVersion is applied during UpdateFeatures
 func TestUpdateFeatures_MinVersion_FiltersVersions(t *testing.T) {
 	configDir := t.TempDir()
@@ -2306,3 +2418,242 @@ func TestCheckFeatures_SharedSource_FetchesManifestOnce(t *testing.T) {
 		t.Fatalf("SHA256SUMS requested %d time(s) for two transfers sharing one source, want exactly 1", got)
 	}
 }
+
+// pinFixture serves testext 1.0.0 and 2.0.0 to an enabled feature defined
+// under a definition root, so pin drop-ins land beside it, and returns a
+// client with the real DefaultRunner and an instance SysextLinkDir.
+func pinFixture(t *testing.T) (client *Client, root, targetDir, linkDir string) {
+	t.Helper()
+	root = t.TempDir()
+	defDir := filepath.Join(root, "sysupdate.d")
+	targetDir = t.TempDir()
+	linkDir = t.TempDir()
+
+	v1, v2 := []byte("ext v1.0.0"), []byte("ext v2.0.0")
+	server := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Files: map[string]string{
+			"testext_1.0.0.raw": hashContent(v1),
+			"testext_2.0.0.raw": hashContent(v2),
+		},
+		Content: map[string][]byte{
+			"testext_1.0.0.raw": v1,
+			"testext_2.0.0.raw": v2,
+		},
+	})
+	t.Cleanup(server.Close)
+
+	writeComponentFeature(t, defDir, "testfeature", true)
+	createFeatureTransferFileWithoutCurrentSymlink(t, defDir, "testext", "testfeature", server.URL, targetDir)
+
+	client = NewClient(ClientConfig{
+		Paths:        RuntimePaths{DefinitionRoots: []string{root}, SysextLinkDir: linkDir},
+		SysextRunner: &sysext.DefaultRunner{},
+	})
+	return client, root, targetDir, linkDir
+}
+
+// TestPinFeature_HoldsVersion verifies that a pin written by PinFeature
+// downgrades the next update to the pinned version and links it even though
+// a newer image stays staged, that CheckFeatures and Features report it,
+// and that UnpinFeature lets the feature follow the newest version again.
+func TestPinFeature_HoldsVersion(t *testing.T) {
+	client, root, targetDir, linkDir := pinFixture(t)
+	linkPath := filepath.Join(linkDir, "testext.raw")
+
+	update := func() UpdateResult {
+		t.Helper()
+		results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true})
+		if err != nil {
+			t.Fatalf("UpdateFeatures failed: %v", err)
+		}
+		if len(results) != 1 || len(results[0].Results) != 1 {
+			t.Fatalf("expected 1 feature result with 1 component, got %+v", results)
+		}
+		return results[0].Results[0]
+	}
+	linked := func() string {
+		t.Helper()
+		target, err := os.Readlink(linkPath)
+		if err != nil {
+			t.Fatalf("expected %s to be a symlink: %v", linkPath, err)
+		}
+		return filepath.Base(target)
+	}
+
+	if r := update(); r.Version != "2.0.0" {
+		t.Fatalf("unpinned update installed %q, want 2.0.0", r.Version)
+	}
+
+	result, err := client.PinFeature(t.Context(), "testfeature", "1.0.0", PinFeatureOptions{})
+	if err != nil {
+		t.Fatalf("PinFeature failed: %v", err)
+	}
+	wantDropIn := filepath.Join(root, "sysupdate.d", "testfeature.feature.d", updexDropInName)
+	if !result.Success || result.DropIn != wantDropIn {
+		t.Fatalf("PinFeature result = %+v, want success with drop-in %s", result, wantDropIn)
+	}
+
+	checks, err := client.CheckFeatures(t.Context(), CheckFeaturesOptions{})
+	if err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	if c := checks[0].Results[0]; c.PinnedVersion != "1.0.0" || c.CurrentVersion != "2.0.0" || !c.UpdateAvailable {
+		t.Errorf("CheckFeatures before the pinned update = %+v, want current 2.0.0 pinned to 1.0.0 with an update available", c)
+	}
+
+	if r := update(); r.Version != "1.0.0" || !r.Downloaded {
+		t.Fatalf("pinned update = %+v, want 1.0.0 downloaded", r)
+	}
+	if got := linked(); got != "testext_1.0.0.raw" {
+		t.Errorf("link points at %s, want the pinned testext_1.0.0.raw", got)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "testext_2.0.0.raw")); err != nil {
+		t.Errorf("newer image removed while pinned: %v", err)
+	}
+	if r := update(); r.Version != "1.0.0" || r.Downloaded {
+		t.Errorf("second pinned update = %+v, want 1.0.0 already current", r)
+	}
+
+	checks, err = client.CheckFeatures(t.Context(), CheckFeaturesOptions{})
+	if err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	if c := checks[0].Results[0]; c.CurrentVersion != "1.0.0" || c.NewestVersion != "2.0.0" || c.UpdateAvailable {
+		t.Errorf("CheckFeatures at the pin = %+v, want current 1.0.0, newest 2.0.0, no update", c)
+	}
+
+	infos, err := client.Features(t.Context())
+	if err != nil {
+		t.Fatalf("Features failed: %v", err)
+	}
+	if len(infos) != 1 || infos[0].PinnedVersion != "1.0.0" {
+		t.Errorf("Features = %+v, want testfeature pinned to 1.0.0", infos)
+	}
+
+	if _, err := client.UnpinFeature(t.Context(), "testfeature", UnpinFeatureOptions{}); err != nil {
+		t.Fatalf("UnpinFeature failed: %v", err)
+	}
+	if _, err := os.Stat(wantDropIn); !os.IsNotExist(err) {
+		t.Errorf("pin drop-in still present after unpin: %v", err)
+	}
+	if r := update(); r.Version != "2.0.0" {
+		t.Errorf("update after unpin installed %q, want 2.0.0", r.Version)
+	}
+	if got := linked(); got != "testext_2.0.0.raw" {
+		t.Errorf("link points at %s after unpin, want testext_2.0.0.raw", got)
+	}
+}
+
+// pinTransferFile adds PinVersion=v to the [Transfer] section of the
+// transfer file at path.
+func pinTransferFile(t *testing.T, path, v string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := strings.Replace(string(data), "[Transfer]\n", "[Transfer]\nPinVersion="+v+"\n", 1)
+	if err := os.WriteFile(path, []byte(pinned), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPinFeature_TransferFilePin verifies that a PinVersion= in the
+// transfer file holds updates at that version, and that a feature pin
+// overrides it.
+func TestPinFeature_TransferFilePin(t *testing.T) {
+	client, root, _, linkDir := pinFixture(t)
+	pinTransferFile(t, filepath.Join(root, "sysupdate.d", "testext.transfer"), "1.0.0")
+	linkPath := filepath.Join(linkDir, "testext.raw")
+
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+
+	if _, err := client.PinFeature(t.Context(), "testfeature", "2.0.0", PinFeatureOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	assertLinkedTo(t, linkPath, "testext_2.0.0.raw")
+}
+
+// TestPinFeature_UnavailableVersion verifies that a pin the source does not
+// offer fails the component rather than installing something else.
+func TestPinFeature_UnavailableVersion(t *testing.T) {
+	client, _, targetDir, _ := pinFixture(t)
+
+	if _, err := client.PinFeature(t.Context(), "testfeature", "3.0.0", PinFeatureOptions{}); err != nil {
+		t.Fatalf("PinFeature failed: %v", err)
+	}
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true})
+	if err == nil {
+		t.Fatal("expected an error for a pin the source does not offer")
+	}
+	if msg := results[0].Results[0].Error; !strings.Contains(msg, "pinned version 3.0.0 is not available") {
+		t.Errorf("component error = %q, want the unavailable pin reported", msg)
+	}
+	assertOnlyEntries(t, targetDir)
+}
+
+// TestPinFeature_RejectsInvalidVersion verifies that a version the @v
+// placeholder could never match is refused before anything is written.
+func TestPinFeature_RejectsInvalidVersion(t *testing.T) {
+	client, root, _, _ := pinFixture(t)
+
+	if _, err := client.PinFeature(t.Context(), "testfeature", "1.0\nEnabled=false", PinFeatureOptions{}); err == nil {
+		t.Fatal("expected an error for an invalid version")
+	}
+	if _, err := os.Stat(filepath.Join(root, "sysupdate.d", "testfeature.feature.d")); !os.IsNotExist(err) {
+		t.Errorf("drop-in directory created for an invalid pin: %v", err)
+	}
+}
+
+// TestPinFeature_SharesDropIn verifies that the pin and Enabled= live in the
+// one 00-updex.conf (ADR-0004) and that each writer keeps the other's key.
+func TestPinFeature_SharesDropIn(t *testing.T) {
+	client, root, _, _ := pinFixture(t)
+	dropIn := filepath.Join(root, "sysupdate.d", "testfeature.feature.d", updexDropInName)
+	assertDropIn := func(step, want string) {
+		t.Helper()
+		got, err := os.ReadFile(dropIn)
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: drop-in = %q, want %q", step, got, want)
+		}
+	}
+
+	if _, err := client.EnableFeature(t.Context(), "testfeature", EnableFeatureOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.PinFeature(t.Context(), "testfeature", "1.0.0", PinFeatureOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assertDropIn("pin", "[Feature]\nEnabled=true\n\n[X-Updex]\nPinVersion=1.0.0\n")
+
+	if _, err := client.DisableFeature(t.Context(), "testfeature", DisableFeatureOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assertDropIn("disable", "[Feature]\nEnabled=false\n\n[X-Updex]\nPinVersion=1.0.0\n")
+
+	result, err := client.UnpinFeature(t.Context(), "testfeature", UnpinFeatureOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DropIn != dropIn || len(result.RemovedFiles) != 0 {
+		t.Errorf("UnpinFeature result = %+v, want the drop-in rewritten, not removed", result)
+	}
+	assertDropIn("unpin", "[Feature]\nEnabled=false\n")
+
+	result, err = client.UnpinFeature(t.Context(), "testfeature", UnpinFeatureOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.NextActionMessage, "not pinned") {
+		t.Errorf("second UnpinFeature message = %q, want 'not pinned'", result.NextActionMessage)
+	}
+}
@@ -0,0 +1,277 @@
+package updex
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/frostyard/updex/config"
+	"github.com/frostyard/updex/sysext"
+)
+
+// activation is a transfer that had a new version activated by a refresh,
+// with the versions it went between.
+type activation struct {
+	transfer *config.Transfer
+	env      hookEnv
+}
+
+// hasHealthChecks reports whether f configures any health check.
+func hasHealthChecks(f *config.Feature) bool {
+	return f != nil && (f.HealthCheck != "" || len(f.HealthCheckUnits) > 0)
+}
+
+// checkHealth runs f's health checks: each of its HealthCheckUnits must be
+// active, then its HealthCheck command, run by /bin/sh, must exit zero
+// within the client's hook timeout.
+func (c *Client) checkHealth(ctx context.Context, f *config.Feature) error {
+	for _, unit := range f.HealthCheckUnits {
+		active, err := c.systemd.IsActive(unit)
+		if err != nil {
+			return fmt.Errorf("cannot tell whether %s is active: %w", unit, err)
+		}
+		if !active {
+			return fmt.Errorf("%s is not active", unit)
+		}
+	}
+	if f.HealthCheck == "" {
+		return nil
+	}
+
+	timeout := c.config.HookTimeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(checkCtx, "/bin/sh", "-c", f.HealthCheck)
+	cmd.Env = append(os.Environ(), "UPDEX_FEATURE="+f.Name)
+	cmd.WaitDelay = hookWaitDelay
+	c.debug("running health check of %s: %s", f.Name, f.HealthCheck)
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if output != "" {
+		c.debug("health check of %s: %s", f.Name, output)
+	}
+	if err == nil {
+		return nil
+	}
+	if errors.Is(checkCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	if output != "" {
+		err = fmt.Errorf("%w: %s", err, output[strings.LastIndexByte(output, '\n')+1:])
+	}
+	return fmt.Errorf("%q failed: %w", f.HealthCheck, err)
+}
+
+// revertActivations points each of f's activated transfers back at the
+// version it was updated from, or unlinks a transfer that had none. The
+// versions reverted from are recorded in the feature's updex-owned drop-in
+// first, as RollbackFeature does, so the next update neither reinstalls
+// nor relinks them; a newer release is installed as usual. The caller
+// refreshes. The errors are per transfer, nil for one that was reverted.
+func (c *Client) revertActivations(f *config.Feature, activated []activation) []error {
+	errs := make([]error, len(activated))
+	_, err := c.updateFeatureDropIn(f, false, func(d *config.FeatureDropIn) {
+		for _, a := range activated {
+			if entry := config.SkipVersionEntry(a.env.transfer, a.env.newVersion); !slices.Contains(d.SkipVersions, entry) {
+				d.SkipVersions = append(d.SkipVersions, entry)
+			}
+		}
+	})
+	if err != nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("failed to revert %s: %w", activated[i].env.transfer, err)
+		}
+		return errs
+	}
+
+	for i, a := range activated {
+		// A copy, as the transfer may be shared with other features' jobs.
+		t := *a.transfer
+		t.Transfer.SkipVersions = append(slices.Clone(t.Transfer.SkipVersions), a.env.newVersion)
+		if err := c.revertLink(&t, a.env.oldVersion); err != nil {
+			errs[i] = fmt.Errorf("failed to revert %s: %w", t.Component, err)
+			c.warn("%s", errs[i])
+			continue
+		}
+		c.event(Event{Type: EventReverted, Warning: true, Feature: f.Name, Transfer: t.Component, Version: a.env.oldVersion,
+			Message: fmt.Sprintf("Reverted %s from %s to %s", t.Component, a.env.newVersion, cmp.Or(a.env.oldVersion, "no version"))})
+	}
+	return errs
+}
+
+// revertLink points t's sysext link at version, which must still be
+// installed, or removes the link when version is empty.
+func (c *Client) revertLink(t *config.Transfer, version string) error {
+	if version == "" {
+		return sysext.UnlinkFromSysextAt(t, c.paths.sysextLinkDir)
+	}
+	installed, _, err := sysext.GetInstalledVersionsAt(t, c.paths.sysextLinkDir)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(installed, version) {
+		return fmt.Errorf("version %s is no longer installed", version)
+	}
+	if t.Target.CurrentSymlink != "" {
+		if err := sysext.RemoveLegacyCurrentSymlinkAt(t, c.paths.sysextLinkDir); err != nil {
+			return fmt.Errorf("failed to remove legacy symlink: %w", err)
+		}
+	}
+	// Link exactly the previous version, whatever pin or one-run version
+	// selected the one that failed.
+	previous := *t
+	previous.Transfer.PinVersion = version
+	return c.linkToSysext(&previous)
+}
+
+// refreshReverted refreshes systemd-sysext to activate reverted transfers,
+// then runs their post-refresh hooks with the versions swapped.
+func (c *Client) refreshReverted(ctx context.Context, reverted []activation) error {
+	c.msg("Refreshing sysext")
+	if err := c.runner.Refresh(); err != nil {
+		err = fmt.Errorf("sysext refresh failed after reverting: %w", err)
+		c.event(Event{Type: EventRefreshFailed, Warning: true, Message: err.Error()})
+		return err
+	}
+	for _, a := range reverted {
+		env := a.env
+		env.oldVersion, env.newVersion = env.newVersion, env.oldVersion
+		_ = c.runHooks(ctx, HookPostRefresh, env)
+	}
+	return nil
+}
+
+// checkUpdatedFeatures runs the health checks of every feature the jobs
+// activated a new version of (see checkUpdatedFeature), then refreshes
+// once more if any was reverted. A transfer shared by several features is
+// reverted once, by the first whose checks failed, and every owning
+// feature reports that revert. The error is that of this refresh.
+func (c *Client) checkUpdatedFeatures(ctx context.Context, jobs []transferJob, results []UpdateResult, failed []bool) error {
+	var reverted []activation
+	done := make(map[string]bool)
+	for start := 0; start < len(jobs); {
+		end := start + 1
+		for end < len(jobs) && jobs[end].feature == jobs[start].feature {
+			end++
+		}
+		for _, a := range c.checkUpdatedFeature(ctx, jobs[start:end], results[start:end], failed[start:end], done) {
+			done[a.env.transfer] = true
+			reverted = append(reverted, a)
+		}
+		start = end
+	}
+	if len(reverted) == 0 {
+		return nil
+	}
+
+	first := firstJobs(jobs)
+	revertedBy := make(map[int]int)
+	for i, r := range results {
+		if _, ok := revertedBy[first[i]]; !ok && r.Reverted {
+			revertedBy[first[i]] = i
+		}
+	}
+	for i := range results {
+		if j, ok := revertedBy[first[i]]; ok {
+			results[i], failed[i] = results[j], failed[j]
+		}
+	}
+	return c.refreshReverted(ctx, reverted)
+}
+
+// checkUpdatedFeature runs the health checks of the feature of jobs, all
+// of one feature, if they activated a new version of it, and reverts the
+// activated transfers when the checks fail (see revertActivations).
+// Transfers whose component is in done, already reverted for another
+// feature, no longer count as activated. Their results report the failed
+// check and the revert, and are marked failed. It returns the transfers
+// reverted.
+func (c *Client) checkUpdatedFeature(ctx context.Context, jobs []transferJob, results []UpdateResult, failed []bool, done map[string]bool) []activation {
+	f := jobs[0].def
+	if !hasHealthChecks(f) {
+		return nil
+	}
+	var activated []activation
+	var indexes []int
+	for i, r := range results {
+		if activatedUpdate(r, failed[i]) && !done[r.Component] {
+			activated = append(activated, activation{jobs[i].transfer, hookEnv{feature: f.Name, transfer: r.Component, oldVersion: r.FromVersion, newVersion: r.Version}})
+			indexes = append(indexes, i)
+		}
+	}
+	if len(activated) == 0 {
+		return nil
+	}
+
+	checkErr := c.checkHealth(ctx, f)
+	if checkErr == nil {
+		c.msg("Health checks of %s passed", f.Name)
+		return nil
+	}
+	c.warn("health check of %s failed: %v", f.Name, checkErr)
+	var reverted []activation
+	for j, revertErr := range c.revertActivations(f, activated) {
+		r := &results[indexes[j]]
+		failed[indexes[j]] = true
+		r.HealthCheckError = checkErr.Error()
+		r.Error = "health check failed: " + checkErr.Error()
+		if revertErr != nil {
+			r.Error += "; " + revertErr.Error()
+			r.NextActionMessage = fmt.Sprintf("Health check failed and the revert did not complete; run 'updex features rollback %s'", f.Name)
+			continue
+		}
+		r.Reverted = true
+		r.NextActionMessage = "Health check failed; reverted to " + cmp.Or(r.FromVersion, "no version")
+		reverted = append(reverted, activated[j])
+	}
+	return reverted
+}
+
+// activatedUpdate reports whether r, an UpdateFeatures result, made a new
+// version current.
+func activatedUpdate(r UpdateResult, failed bool) bool {
+	return !failed && r.Installed && (r.Downloaded || r.Relinked) && r.FromVersion != r.Version
+}
+
+// checkEnabledFeature runs the health checks of f after EnableFeature with
+// Now activated changed, reverting them when the checks fail and
+// refreshing once more. It fills in result for a failure and returns its
+// error.
+func (c *Client) checkEnabledFeature(ctx context.Context, f *config.Feature, changed []activation, result *FeatureActionResult) error {
+	checkErr := c.checkHealth(ctx, f)
+	if checkErr == nil {
+		c.msg("Health checks of %s passed", f.Name)
+		return nil
+	}
+	c.warn("health check of %s failed: %v", f.Name, checkErr)
+
+	err := fmt.Errorf("health check failed: %w", checkErr)
+	var reverted []activation
+	for i, revertErr := range c.revertActivations(f, changed) {
+		if revertErr != nil {
+			err = errors.Join(err, revertErr)
+			continue
+		}
+		reverted = append(reverted, changed[i])
+	}
+	if len(reverted) > 0 {
+		err = errors.Join(err, c.refreshReverted(ctx, reverted))
+	}
+	result.Reverted = len(reverted) == len(changed)
+	result.Error = err.Error()
+	if result.Reverted {
+		result.NextActionMessage = fmt.Sprintf("Feature '%s' enabled, but it failed its health check and its extensions were reverted to their previous versions", f.Name)
+	} else {
+		result.NextActionMessage = fmt.Sprintf("Feature '%s' enabled, but it failed its health check and the revert did not complete; run 'updex features rollback %s'", f.Name, f.Name)
+	}
+	return err
+}
@@ -0,0 +1,202 @@
+package updex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/updex/systemd"
+)
+
+// healthFixture is stagingFixture with testfeature's health checks set by
+// an admin drop-in holding the [X-Updex] keys in checks, and units reported
+// active by runner. It returns the feature's drop-in directory after the
+// client.
+func healthFixture(t *testing.T, checks string, runner *systemd.MockSystemctlRunner) (client *Client, dropInDir, linkPath string, refreshes *int) {
+	t.Helper()
+	client, linkPath, _, refreshes = stagingFixture(t)
+	dropInDir = filepath.Join(client.paths.definitionRoots[0], "sysupdate.d", "testfeature.feature.d")
+	if err := os.MkdirAll(dropInDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dropInDir, "50-health.conf"), []byte("[X-Updex]\n"+checks), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client.systemd = systemd.NewTestManager(t.TempDir(), runner)
+	return client, dropInDir, linkPath, refreshes
+}
+
+// TestHealthCheck_RevertsFailedUpdate verifies that an update whose feature
+// fails its health check (a command quoted so INI keeps its semicolons) is
+// linked back to the previous version and refreshed again, that the result
+// reports it, and that the version reverted from is not installed again.
+func TestHealthCheck_RevertsFailedUpdate(t *testing.T) {
+	client, dropInDir, linkPath, refreshes := healthFixture(t, "HealthCheck=`echo starting; echo 'database unreachable'; exit 1`\n", &systemd.MockSystemctlRunner{})
+	rec := &eventRecorder{}
+	client.reporter = rec
+
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{})
+	if err == nil {
+		t.Fatal("UpdateFeatures succeeded despite the failed health check")
+	}
+	r := results[0].Results[0]
+	if !r.Reverted || r.FromVersion != "1.0.0" || r.Version != "1.1.0" || !strings.HasSuffix(r.HealthCheckError, "exit status 1: database unreachable") {
+		t.Errorf("result = %+v, want 1.1.0 reverted to 1.0.0 with the check's last line", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+	if *refreshes != 2 {
+		t.Errorf("refreshed %d times, want 2: the update and the revert", *refreshes)
+	}
+	var reverted bool
+	for _, e := range rec.events {
+		reverted = reverted || e.Type == EventReverted && e.Transfer == "testext" && e.Version == "1.0.0"
+	}
+	if !reverted {
+		t.Errorf("no reverted event among %+v", rec.events)
+	}
+	data, err := os.ReadFile(filepath.Join(dropInDir, updexDropInName))
+	if err != nil || !strings.Contains(string(data), "SkipVersions=testext/1.1.0") {
+		t.Errorf("drop-in = %q, %v, want 1.1.0 skipped", data, err)
+	}
+
+	// The next update leaves the previous version current, so nothing is
+	// activated and checked.
+	results, err = client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{})
+	if err != nil {
+		t.Fatalf("second UpdateFeatures failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Reverted || r.Version != "1.0.0" {
+		t.Errorf("second result = %+v, want 1.0.0 left current", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+}
+
+// TestHealthCheck_RevertsFailedRelink verifies that pinning an installed
+// older version, which only relinks it, is health checked like a download
+// and linked back to the version it replaced when the check fails.
+func TestHealthCheck_RevertsFailedRelink(t *testing.T) {
+	flag := filepath.Join(t.TempDir(), "broken")
+	client, dropInDir, linkPath, refreshes := healthFixture(t, "HealthCheck=test ! -e "+flag+"\n", &systemd.MockSystemctlRunner{})
+	ctx := t.Context()
+
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.1.0.raw")
+	if _, err := client.PinFeature(ctx, "testfeature", "1.0.0", PinFeatureOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(flag, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{})
+	if err == nil {
+		t.Fatal("UpdateFeatures succeeded despite the failed health check")
+	}
+	r := results[0].Results[0]
+	if !r.Relinked || !r.Reverted || r.FromVersion != "1.1.0" || r.Version != "1.0.0" {
+		t.Errorf("result = %+v, want the relink to 1.0.0 reverted to 1.1.0", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.1.0.raw")
+	if *refreshes != 3 {
+		t.Errorf("refreshed %d times, want 3: two updates and the revert", *refreshes)
+	}
+	data, err := os.ReadFile(filepath.Join(dropInDir, updexDropInName))
+	if err != nil || !strings.Contains(string(data), "SkipVersions=testext/1.0.0") {
+		t.Errorf("drop-in = %q, %v, want 1.0.0 skipped", data, err)
+	}
+}
+
+// TestHealthCheck_SharedTransferRevertedOnce verifies that a transfer owned
+// by two features that both fail their health checks is reverted, and
+// reported as reverted by each, only once.
+func TestHealthCheck_SharedTransferRevertedOnce(t *testing.T) {
+	client, dropInDir, linkPath, refreshes := healthFixture(t, "HealthCheck=false\n", &systemd.MockSystemctlRunner{})
+	defDir := filepath.Dir(dropInDir)
+	writeComponentFeature(t, defDir, "other", true)
+	if err := os.MkdirAll(filepath.Join(defDir, "other.feature.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(defDir, "other.feature.d", "50-health.conf"), []byte("[X-Updex]\nHealthCheck=false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	transferPath := filepath.Join(defDir, "testext.transfer")
+	data, err := os.ReadFile(transferPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(transferPath, []byte(strings.Replace(string(data), "Features=testfeature", "Features=testfeature other", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rec := &eventRecorder{}
+	client.reporter = rec
+
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{})
+	if err == nil {
+		t.Fatal("UpdateFeatures succeeded despite the failed health checks")
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d feature results, want other and testfeature", len(results))
+	}
+	for _, fr := range results {
+		if r := fr.Results[0]; !r.Reverted || r.FromVersion != "1.0.0" || r.Version != "1.1.0" {
+			t.Errorf("%s result = %+v, want 1.1.0 reverted to 1.0.0", fr.Feature, r)
+		}
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+	var reverts int
+	for _, e := range rec.events {
+		if e.Type == EventReverted {
+			reverts++
+		}
+	}
+	if reverts != 1 {
+		t.Errorf("%d reverted events, want 1", reverts)
+	}
+	if *refreshes != 2 {
+		t.Errorf("refreshed %d times, want 2: the update and the revert", *refreshes)
+	}
+}
+
+// TestHealthCheck_PassingUpdate verifies that an update whose feature's
+// units are active and whose command succeeds stays in place.
+func TestHealthCheck_PassingUpdate(t *testing.T) {
+	runner := &systemd.MockSystemctlRunner{IsActiveResult: true}
+	client, _, linkPath, refreshes := healthFixture(t, "HealthCheck=test \"$UPDEX_FEATURE\" = testfeature\nHealthCheckUnits=nginx.service\n", runner)
+
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Reverted || r.HealthCheckError != "" || r.Version != "1.1.0" {
+		t.Errorf("result = %+v, want 1.1.0 kept", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.1.0.raw")
+	if *refreshes != 1 {
+		t.Errorf("refreshed %d times, want 1", *refreshes)
+	}
+	if runner.IsActiveUnit != "nginx.service" {
+		t.Errorf("checked unit %q, want nginx.service", runner.IsActiveUnit)
+	}
+}
+
+// TestHealthCheck_EnableNowRevertsInactiveUnit verifies that EnableFeature
+// with Now reverts the versions it activated when a health check unit is
+// not active.
+func TestHealthCheck_EnableNowRevertsInactiveUnit(t *testing.T) {
+	client, _, linkPath, refreshes := healthFixture(t, "HealthCheckUnits=nginx.service\n", &systemd.MockSystemctlRunner{IsActiveResult: false})
+
+	result, err := client.EnableFeature(t.Context(), "testfeature", EnableFeatureOptions{Now: true})
+	if err == nil || !strings.Contains(err.Error(), "health check failed: nginx.service is not active") {
+		t.Fatalf("EnableFeature error = %v, want the inactive unit", err)
+	}
+	if result.Success || !result.Reverted {
+		t.Errorf("result = %+v, want a failed, reverted enable", result)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+	if *refreshes != 2 {
+		t.Errorf("refreshed %d times, want 2: the enable and the revert", *refreshes)
+	}
+}
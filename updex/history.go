@@ -0,0 +1,169 @@
+package updex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultStateDir is the directory updex keeps its own state in when
+// RuntimePaths.StateDir is zero.
+const DefaultStateDir = "/var/lib/updex"
+
+// runsDirName is the StateDir subdirectory holding one JSON file per
+// recorded run, named after its ID so that names sort oldest first.
+const runsDirName = "runs"
+
+// keptRuns is how many run records are kept. The newest successful run is
+// kept beyond it, so LastSuccess survives a long streak of failures.
+const keptRuns = 100
+
+// runIDLayout formats a run's start time, in UTC, as its ID.
+const runIDLayout = "20060102T150405.000000000Z"
+
+// RunHistory returns the recorded UpdateFeatures runs (see
+// UpdateFeaturesOptions.Record), newest first. The last 100 runs are kept,
+// plus the most recent successful one. No history is an empty slice, not an
+// error; a record that cannot be read is skipped with a warning.
+func (c *Client) RunHistory(ctx context.Context, opts RunHistoryOptions) ([]RunRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("read run history: %w", err)
+	}
+	_, unlock, err := c.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	dir := c.runsDir()
+	names, err := runFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read run history: %w", err)
+	}
+
+	// Non-nil so that no history serializes as JSON `[]`.
+	records := make([]RunRecord, 0)
+	for i := len(names) - 1; i >= 0; i-- {
+		if opts.Limit > 0 && len(records) == opts.Limit {
+			break
+		}
+		record, err := readRun(filepath.Join(dir, names[i]))
+		if err != nil {
+			c.warn("skipping run record %s: %v", names[i], err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// recordRun writes the record of an UpdateFeatures run that started at
+// started and returned results and runErr. Failing to record is a warning:
+// the update itself has already happened.
+func (c *Client) recordRun(started time.Time, opts UpdateFeaturesOptions, results []UpdateFeaturesResult, runErr error) {
+	record := RunRecord{
+		ID:         started.UTC().Format(runIDLayout),
+		StartedAt:  started,
+		FinishedAt: time.Now(),
+		Component:  opts.Component,
+		Success:    runErr == nil,
+		Results:    results,
+	}
+	if record.Results == nil {
+		record.Results = make([]UpdateFeaturesResult, 0)
+	}
+	if runErr != nil {
+		record.Error = runErr.Error()
+	}
+	if err := c.writeRun(record); err != nil {
+		c.warn("cannot record update run: %v", err)
+	}
+}
+
+// writeRun stores record in the runs directory and prunes old records.
+func (c *Client) writeRun(record RunRecord) error {
+	dir := c.runsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeManagedFileWithMode(filepath.Join(dir, record.ID+".json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return pruneRuns(dir, keptRuns)
+}
+
+// pruneRuns removes all but the newest keep records in dir, sparing the
+// newest successful record when none of those kept succeeded.
+func pruneRuns(dir string, keep int) error {
+	names, err := runFiles(dir)
+	if err != nil || len(names) <= keep {
+		return err
+	}
+	excess, kept := names[:len(names)-keep], names[len(names)-keep:]
+	if !slices.ContainsFunc(kept, func(name string) bool { return runSucceeded(filepath.Join(dir, name)) }) {
+		for i := len(excess) - 1; i >= 0; i-- {
+			if runSucceeded(filepath.Join(dir, excess[i])) {
+				excess = slices.Delete(excess, i, i+1)
+				break
+			}
+		}
+	}
+	var errs []error
+	for _, name := range excess {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Client) runsDir() string {
+	return filepath.Join(c.paths.stateDir, runsDirName)
+}
+
+// runFiles lists the run records in dir, oldest first (os.ReadDir sorts by
+// name). A missing directory holds none.
+func runFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		// Skips the dot-prefixed temporary files of an interrupted write.
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".json") && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func readRun(path string) (RunRecord, error) {
+	var record RunRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return record, err
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, err
+	}
+	return record, nil
+}
+
+func runSucceeded(path string) bool {
+	record, err := readRun(path)
+	return err == nil && record.Success
+}
@@ -0,0 +1,104 @@
+package updex
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/frostyard/updex/systemd"
+)
+
+// TestUpdateFeaturesRecordsRuns verifies that a recorded run is kept with
+// its results whether it succeeds or fails, that dry runs and unrecorded
+// runs leave no record, and that DaemonStatus reports the history.
+func TestUpdateFeaturesRecordsRuns(t *testing.T) {
+	client, _, _, _ := stagingFixture(t)
+	ctx := t.Context()
+
+	// stagingFixture's own install was not recorded.
+	history, err := client.RunHistory(ctx, RunHistoryOptions{})
+	if err != nil || len(history) != 0 || history == nil {
+		t.Fatalf("RunHistory() before any recorded run = %#v, %v, want an empty non-nil slice", history, err)
+	}
+
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true, Record: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true, Version: "9.9.9", Record: true}); err == nil {
+		t.Fatal("UpdateFeatures to a version the source lacks succeeded")
+	}
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{DryRun: true, Record: true}); err != nil {
+		t.Fatalf("UpdateFeatures(DryRun) failed: %v", err)
+	}
+
+	history, err = client.RunHistory(ctx, RunHistoryOptions{})
+	if err != nil {
+		t.Fatalf("RunHistory() error = %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("RunHistory() = %d records, want the two recorded non-dry runs", len(history))
+	}
+	failed, succeeded := history[0], history[1]
+	if failed.Success || failed.Error == "" || failed.Results[0].Results[0].Error == "" {
+		t.Errorf("newest record = %+v, want the failed run with its error", failed)
+	}
+	if !succeeded.Success || succeeded.Error != "" || succeeded.Results[0].Results[0].Version != "1.1.0" {
+		t.Errorf("oldest record = %+v, want the successful update to 1.1.0", succeeded)
+	}
+	if succeeded.FinishedAt.Before(succeeded.StartedAt) || !failed.StartedAt.After(succeeded.StartedAt) {
+		t.Errorf("record times out of order: %+v, %+v", succeeded, failed)
+	}
+
+	limited, err := client.RunHistory(ctx, RunHistoryOptions{Limit: 1})
+	if err != nil || len(limited) != 1 || limited[0].ID != failed.ID {
+		t.Errorf("RunHistory(Limit: 1) = %+v, %v, want the newest record only", limited, err)
+	}
+
+	client.systemd = systemd.NewTestManager(t.TempDir(), &systemd.MockSystemctlRunner{})
+	status, err := client.DaemonStatus(ctx, DaemonStatusOptions{})
+	if err != nil {
+		t.Fatalf("DaemonStatus() error = %v", err)
+	}
+	if status.LastRun == nil || status.LastRun.ID != failed.ID || !status.LastSuccess.Equal(succeeded.FinishedAt) {
+		t.Errorf("DaemonStatus() = %+v, want the failed run last and the successful one's finish as last success", status)
+	}
+}
+
+func TestPruneRunsKeepsLastSuccess(t *testing.T) {
+	dir := t.TempDir()
+	writeRecord := func(id string, success bool) {
+		t.Helper()
+		data, err := json.Marshal(RunRecord{ID: id, Success: success})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, id+".json"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 5 {
+		writeRecord(fmt.Sprintf("run%d", i), i <= 1)
+	}
+
+	if err := pruneRuns(dir, 2); err != nil {
+		t.Fatalf("pruneRuns() error = %v", err)
+	}
+	names, err := runFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"run1.json", "run3.json", "run4.json"}; !slices.Equal(names, want) {
+		t.Errorf("records after pruning = %v, want %v", names, want)
+	}
+
+	writeRecord("run5", true)
+	if err := pruneRuns(dir, 2); err != nil {
+		t.Fatalf("pruneRuns() error = %v", err)
+	}
+	if names, _ := runFiles(dir); !slices.Equal(names, []string{"run4.json", "run5.json"}) {
+		t.Errorf("records after a newer success = %v, want only the newest two", names)
+	}
+}
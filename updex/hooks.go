@@ -0,0 +1,138 @@
+package updex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The stages hooks run at. Each is a subdirectory of RuntimePaths.HooksDir
+// whose executables run one at a time, in name order, once per transfer.
+const (
+	// HookPreUpdate runs before a new version of a transfer is installed
+	// or applied. A hook that fails vetoes it: the transfer fails and the
+	// remaining hooks do not run.
+	HookPreUpdate = "pre-update"
+	// HookPostInstall runs after a new version is installed and linked.
+	HookPostInstall = "post-install"
+	// HookPostRefresh runs after systemd-sysext refreshed with a new
+	// version installed or applied.
+	HookPostRefresh = "post-refresh"
+	// HookPostDisable runs after DisableFeature disabled the feature, for
+	// each of its transfers.
+	HookPostDisable = "post-disable"
+)
+
+// DefaultHooksDir is the directory holding the hook stage directories when
+// RuntimePaths.HooksDir is zero.
+const DefaultHooksDir = "/etc/updex/hooks.d"
+
+// DefaultHookTimeout bounds one hook when ClientConfig.HookTimeout is zero.
+const DefaultHookTimeout = 5 * time.Minute
+
+// hookWaitDelay is how long a hook killed at its timeout, or a process it
+// started, may keep its output open before updex stops waiting for it.
+const hookWaitDelay = 5 * time.Second
+
+// hookEnv is what a hook is told about the transfer it runs for. Versions
+// are empty where there is none: no old version on a first install, no new
+// one on disable.
+type hookEnv struct {
+	feature    string
+	transfer   string
+	oldVersion string
+	newVersion string
+}
+
+// environ returns the variables a hook of stage receives on top of updex's
+// own environment.
+func (e hookEnv) environ(stage string) []string {
+	return []string{
+		"UPDEX_HOOK=" + stage,
+		"UPDEX_FEATURE=" + e.feature,
+		"UPDEX_TRANSFER=" + e.transfer,
+		"UPDEX_OLD_VERSION=" + e.oldVersion,
+		"UPDEX_NEW_VERSION=" + e.newVersion,
+	}
+}
+
+// runHooks runs the hooks of stage for env. Files that are hidden or not
+// executable are skipped, and a missing stage directory has no hooks.
+// A failing pre-update hook is returned and stops the stage; a failing
+// post hook cannot undo what already happened, so it is a warning and the
+// other hooks still run.
+func (c *Client) runHooks(ctx context.Context, stage string, env hookEnv) error {
+	dir := filepath.Join(c.paths.hooksDir, stage)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to read %s hooks: %w", stage, err)
+		if stage == HookPreUpdate {
+			return err
+		}
+		c.warn("%s", err)
+		return nil
+	}
+
+	// Hooks of concurrent transfer jobs run one at a time.
+	c.hookMu.Lock()
+	defer c.hookMu.Unlock()
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			c.debug("skipping %s hook %s: not an executable file", stage, entry.Name())
+			continue
+		}
+		if err := c.runHook(ctx, stage, path, env); err != nil {
+			if stage == HookPreUpdate {
+				return err
+			}
+			c.warn("%s", err)
+		}
+	}
+	return nil
+}
+
+// runHook runs the hook at path, killing it after the client's hook
+// timeout. Its output is reported as debug output, and its last line is
+// added to the error of a hook that fails.
+func (c *Client) runHook(ctx context.Context, stage, path string, env hookEnv) error {
+	timeout := c.config.HookTimeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	hookCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(hookCtx, path)
+	cmd.Env = append(os.Environ(), env.environ(stage)...)
+	cmd.WaitDelay = hookWaitDelay
+	c.debug("running %s hook %s for %s", stage, path, env.transfer)
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if output != "" {
+		c.debug("%s hook %s: %s", stage, filepath.Base(path), output)
+	}
+	if err == nil {
+		return nil
+	}
+	if errors.Is(hookCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	if output != "" {
+		err = fmt.Errorf("%w: %s", err, output[strings.LastIndexByte(output, '\n')+1:])
+	}
+	return fmt.Errorf("%s hook %s failed for %s: %w", stage, filepath.Base(path), env.transfer, err)
+}
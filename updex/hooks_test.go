@@ -0,0 +1,214 @@
+package updex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hookFixture is stagingFixture with a hooks directory, returned after the
+// client, whose hooks log to the returned file.
+func hookFixture(t *testing.T) (client *Client, hooksDir, logPath, linkPath string) {
+	t.Helper()
+	client, linkPath, _, _ = stagingFixture(t)
+	hooksDir = t.TempDir()
+	client.paths.hooksDir = hooksDir
+	logPath = filepath.Join(t.TempDir(), "hooks.log")
+	return client, hooksDir, logPath, linkPath
+}
+
+// writeHook writes an executable shell script hook for stage.
+func writeHook(t *testing.T, hooksDir, stage, name, script string) {
+	t.Helper()
+	dir := filepath.Join(hooksDir, stage)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// logHook is a hook script appending its environment to logPath.
+func logHook(logPath string) string {
+	return `echo "$UPDEX_HOOK $UPDEX_FEATURE $UPDEX_TRANSFER $UPDEX_OLD_VERSION $UPDEX_NEW_VERSION" >> ` + logPath
+}
+
+// hookLog returns the lines hooks logged.
+func hookLog(t *testing.T, logPath string) []string {
+	t.Helper()
+	data, err := os.ReadFile(logPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// TestHooks_UpdateRunsStages verifies that an update runs the pre-update,
+// post-install and post-refresh hooks, in that order, with the feature,
+// transfer and versions in their environment, and skips hidden and
+// non-executable files.
+func TestHooks_UpdateRunsStages(t *testing.T) {
+	client, hooksDir, logPath, linkPath := hookFixture(t)
+	for _, stage := range []string{HookPreUpdate, HookPostInstall, HookPostRefresh} {
+		writeHook(t, hooksDir, stage, "10-log", logHook(logPath))
+	}
+	writeHook(t, hooksDir, HookPreUpdate, ".hidden", "exit 1")
+	if err := os.WriteFile(filepath.Join(hooksDir, HookPreUpdate, "20-plain"), []byte("#!/bin/sh\nexit 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.FromVersion != "1.0.0" || r.Version != "1.1.0" {
+		t.Errorf("result = %+v, want 1.0.0 updated to 1.1.0", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.1.0.raw")
+
+	want := []string{
+		"pre-update testfeature testext 1.0.0 1.1.0",
+		"post-install testfeature testext 1.0.0 1.1.0",
+		"post-refresh testfeature testext 1.0.0 1.1.0",
+	}
+	if got := hookLog(t, logPath); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("hooks ran %q, want %q", got, want)
+	}
+
+	// Nothing changes on a second update, so no hook runs.
+	if err := os.Remove(logPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{}); err != nil {
+		t.Fatalf("second UpdateFeatures failed: %v", err)
+	}
+	if got := hookLog(t, logPath); got != nil {
+		t.Errorf("hooks ran without a change: %q", got)
+	}
+}
+
+// TestHooks_PreUpdateVetoes verifies that a failing pre-update hook stops
+// an update, and an Apply, before anything is installed, reporting the
+// hook's last line of output.
+func TestHooks_PreUpdateVetoes(t *testing.T) {
+	client, hooksDir, logPath, linkPath := hookFixture(t)
+	writeHook(t, hooksDir, HookPreUpdate, "10-veto", "echo checking\necho 'not during business hours'\nexit 1")
+	writeHook(t, hooksDir, HookPreUpdate, "20-log", logHook(logPath))
+	writeHook(t, hooksDir, HookPostInstall, "10-log", logHook(logPath))
+
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{})
+	if err == nil {
+		t.Fatal("UpdateFeatures succeeded despite the veto")
+	}
+	if r := results[0].Results[0]; r.Installed || !strings.Contains(r.Error, "pre-update hook 10-veto failed for testext: exit status 1: not during business hours") {
+		t.Errorf("result = %+v, want the veto reported", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+
+	// Staging runs no hook; applying is vetoed and keeps the image staged.
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{Stage: true}); err != nil {
+		t.Fatalf("UpdateFeatures(Stage) failed: %v", err)
+	}
+	if _, err := client.Apply(t.Context(), ApplyOptions{}); err == nil {
+		t.Fatal("Apply succeeded despite the veto")
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+	checks, err := client.CheckFeatures(t.Context(), CheckFeaturesOptions{})
+	if err != nil || checks[0].Results[0].StagedVersion != "1.1.0" {
+		t.Errorf("CheckFeatures after vetoed Apply = %+v, %v, want 1.1.0 still staged", checks, err)
+	}
+	if got := hookLog(t, logPath); got != nil {
+		t.Errorf("hooks ran after the veto: %q", got)
+	}
+}
+
+// TestHooks_RelinkToInstalledVersion verifies that pinning an already
+// installed older version relinks it only after the pre-update hook
+// allowed it, and that hooks and the result see the version the link
+// pointed at before, not the pinned one.
+func TestHooks_RelinkToInstalledVersion(t *testing.T) {
+	client, _, _, linkPath := rollbackFixture(t)
+	hooksDir := t.TempDir()
+	client.paths.hooksDir = hooksDir
+	logPath := filepath.Join(t.TempDir(), "hooks.log")
+	writeHook(t, hooksDir, HookPreUpdate, "10-veto", "exit 1")
+	writeHook(t, hooksDir, HookPreUpdate, "20-log", logHook(logPath))
+	writeHook(t, hooksDir, HookPostInstall, "10-log", logHook(logPath))
+
+	if _, err := client.PinFeature(t.Context(), "testfeature", "1.0.0", PinFeatureOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true})
+	if err == nil {
+		t.Fatal("UpdateFeatures succeeded despite the veto")
+	}
+	if r := results[0].Results[0]; r.Installed || !strings.Contains(r.Error, "pre-update hook 10-veto failed for testext") {
+		t.Errorf("vetoed result = %+v, want the veto reported", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_2.0.0.raw")
+
+	if err := os.Remove(filepath.Join(hooksDir, HookPreUpdate, "10-veto")); err != nil {
+		t.Fatal(err)
+	}
+	results, err = client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.FromVersion != "2.0.0" || r.Version != "1.0.0" || !r.Relinked || r.Downloaded {
+		t.Errorf("result = %+v, want 2.0.0 relinked to 1.0.0 without a download", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+	want := []string{
+		"pre-update testfeature testext 2.0.0 1.0.0",
+		"post-install testfeature testext 2.0.0 1.0.0",
+	}
+	if got := hookLog(t, logPath); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("hooks ran %q, want %q", got, want)
+	}
+}
+
+// TestHooks_Timeout verifies that a hook running past the client's hook
+// timeout is killed and fails.
+func TestHooks_Timeout(t *testing.T) {
+	client, hooksDir, _, linkPath := hookFixture(t)
+	client.config.HookTimeout = 100 * time.Millisecond
+	writeHook(t, hooksDir, HookPreUpdate, "10-slow", "exec sleep 30")
+
+	start := time.Now()
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{})
+	if err == nil {
+		t.Fatal("UpdateFeatures succeeded despite the hook timing out")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("UpdateFeatures took %s, the hook was not killed", elapsed)
+	}
+	if r := results[0].Results[0]; !strings.Contains(r.Error, "timed out after 100ms") {
+		t.Errorf("result error = %q, want a timeout", r.Error)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+}
+
+// TestHooks_PostDisable verifies that disabling a feature runs the
+// post-disable hooks with the version that was current, and that a failing
+// one does not fail the disable.
+func TestHooks_PostDisable(t *testing.T) {
+	client, hooksDir, logPath, _ := hookFixture(t)
+	writeHook(t, hooksDir, HookPostDisable, "10-fail", "exit 3")
+	writeHook(t, hooksDir, HookPostDisable, "20-log", logHook(logPath))
+
+	result, err := client.DisableFeature(t.Context(), "testfeature", DisableFeatureOptions{Now: true, Force: true})
+	if err != nil || !result.Success {
+		t.Fatalf("DisableFeature = %+v, %v, want success", result, err)
+	}
+	// No new version: the log line ends in a space, trimmed by hookLog.
+	want := "post-disable testfeature testext 1.0.0"
+	if got := hookLog(t, logPath); len(got) != 1 || got[0] != want {
+		t.Errorf("hooks ran %q, want %q", got, want)
+	}
+}
@@ -3,109 +3,303 @@ package updex
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/frostyard/updex/config"
 	"github.com/frostyard/updex/download"
 	"github.com/frostyard/updex/manifest"
+	"github.com/frostyard/updex/oci"
 	"github.com/frostyard/updex/sysext"
 	"github.com/frostyard/updex/version"
 )
 
 // installTransfer performs the update/install logic for a single transfer.
-// It returns the version selected, the resolved manifest, whether a download occurred, and any error.
-// If opts.CachedManifest is non-nil, it is used instead of fetching the manifest over HTTP.
-func (c *Client) installTransfer(ctx context.Context, transfer *config.Transfer, opts installTransferOptions) (string, *manifest.Manifest, bool, error) {
-	// Get available versions (applies MinVersion filter)
-	available, m, patterns, err := c.getAvailableVersions(ctx, transfer, opts.CachedManifest)
+// It returns the version selected, whether a download occurred, and the URL
+// that served it, alongside any error.
+// If opts.Manifests is non-nil, the manifest is looked up there (and stored
+// there once fetched) instead of always being fetched over HTTP.
+func (c *Client) installTransfer(ctx context.Context, transfer *config.Transfer, opts installTransferOptions) (installOutcome, error) {
+	// An explicit version is a pin for this run only: the copy carries it
+	// through linking and vacuum, the loaded transfer keeps its own.
+	wanted := "pinned version"
+	if opts.Version != "" {
+		pinned := *transfer
+		pinned.Transfer.PinVersion = opts.Version
+		transfer = &pinned
+		wanted = "version"
+	}
+
+	// Get available versions (applies MinVersion and MaxVersion filters)
+	available, m, patterns, err := c.cachedAvailableVersions(ctx, transfer, opts.Manifests)
 	if err != nil {
-		return "", nil, false, fmt.Errorf("failed to get available versions: %w", err)
+		return installOutcome{}, fmt.Errorf("failed to get available versions: %w", err)
 	}
 
 	if len(available) == 0 {
-		return "", nil, false, fmt.Errorf("no versions available")
+		return installOutcome{}, fmt.Errorf("no versions available")
+	}
+
+	installed, current, err := sysext.GetInstalledVersionsAt(transfer, c.paths.sysextLinkDir)
+	if err != nil {
+		return installOutcome{}, fmt.Errorf("failed to inspect installed versions: %w", err)
 	}
 
-	// Sort and get newest
+	// Sort and get newest, or the pinned version
 	version.Sort(available)
+	if pin := transfer.Transfer.PinVersion; pin == "" && !opts.IgnorePhasing {
+		accepted, heldBack := c.phase(transfer, m, patterns, available, installed)
+		if heldBack != "" {
+			c.msg("%s %s is held back by phasing", transfer.Component, heldBack)
+		}
+		if len(accepted) == 0 {
+			if current != "" {
+				return installOutcome{Version: current, Previous: current}, nil
+			}
+			return installOutcome{}, fmt.Errorf("no versions available: %s is held back by phasing", heldBack)
+		}
+		available = accepted
+	}
 	versionToInstall := available[0]
-	c.debug("selected version %s (from %d available)", versionToInstall, len(available))
+	if pin := transfer.Transfer.PinVersion; pin != "" {
+		if !slices.Contains(available, pin) {
+			return installOutcome{}, fmt.Errorf("%s %s is not available", wanted, pin)
+		}
+		versionToInstall = pin
+		c.debug("selected pinned version %s (from %d available)", versionToInstall, len(available))
+	} else {
+		c.debug("selected version %s (from %d available)", versionToInstall, len(available))
+	}
 
 	// Check if already installed and current
-	installed, current, err := sysext.GetInstalledVersionsAt(transfer, c.paths.sysextLinkDir)
-	if err != nil {
-		return "", nil, false, fmt.Errorf("failed to inspect installed versions: %w", err)
-	}
 	if !opts.DryRun && transfer.Target.CurrentSymlink != "" {
 		if err := sysext.RemoveLegacyCurrentSymlinkAt(transfer, c.paths.sysextLinkDir); err != nil {
 			c.warn("failed to remove legacy symlink for %s: %v", transfer.Component, err)
 		}
 	}
-	for _, v := range installed {
-		if v == versionToInstall && v == current {
-			// The image is staged and current, but the systemd-sysext link
-			// may be missing, dangling, or pointing at another image (a
-			// crashed earlier run, a hand-edited link dir). Restore it
-			// without re-downloading; a correct link is left untouched.
-			if !opts.DryRun {
-				linked, err := sysext.LinkIsCurrentAt(transfer, c.paths.sysextLinkDir)
-				if err != nil {
-					return "", nil, false, fmt.Errorf("failed to inspect sysext link: %w", err)
-				}
-				if !linked {
-					if err := c.linkToSysext(transfer); err != nil {
-						return "", nil, false, err
-					}
-					c.msg("restored sysext link for %s", transfer.Component)
+	staged, _, err := sysext.StagedVersionAt(transfer, c.paths.sysextLinkDir)
+	if err != nil {
+		return installOutcome{}, fmt.Errorf("failed to inspect staged versions: %w", err)
+	}
+	// The installed version the sysext link should point at; current is
+	// the one it does.
+	preferred := sysext.PreferredVersion(transfer, installed)
+	if opts.Stage {
+		// Staging never touches the link: an installed version is left as
+		// it is, and anything staged for it is no longer wanted.
+		if versionToInstall == preferred {
+			if staged != "" && !opts.DryRun {
+				if err := sysext.DiscardStagedAt(transfer, c.paths.sysextLinkDir); err != nil {
+					c.warn("failed to discard staged %s %s: %v", transfer.Component, staged, err)
 				}
 			}
-			return versionToInstall, m, false, nil
+			return installOutcome{Version: preferred, Previous: current}, nil
 		}
+		if staged == versionToInstall {
+			return installOutcome{Version: versionToInstall, Staged: true, Previous: current}, nil
+		}
+	} else if staged != "" && version.Compare(staged, versionToInstall) < 0 && !opts.DryRun {
+		// Installing past a staged version leaves nothing to apply.
+		if err := sysext.DiscardStagedAt(transfer, c.paths.sysextLinkDir); err != nil {
+			c.warn("failed to discard staged %s %s: %v", transfer.Component, staged, err)
+		}
+	}
+	if versionToInstall == preferred && (transfer.Target.CurrentSymlink == "" || versionToInstall == current) {
+		// The image is installed and preferred, but the systemd-sysext
+		// link may be missing, dangling, or pointing at another image (a
+		// crashed earlier run, a hand-edited link dir), or the version
+		// is an installed older one being returned to. Restore it
+		// without re-downloading; a correct link is left untouched. A
+		// legacy CurrentSymlink at another version still has the image
+		// installed again. Hooks see a relink as they see an install.
+		linked, err := sysext.LinkIsCurrentAt(transfer, c.paths.sysextLinkDir)
+		if err != nil {
+			return installOutcome{}, fmt.Errorf("failed to inspect sysext link: %w", err)
+		}
+		if !linked && !opts.DryRun {
+			hook := hookEnv{feature: opts.Feature, transfer: transfer.Component, oldVersion: current, newVersion: versionToInstall}
+			if err := c.runHooks(ctx, HookPreUpdate, hook); err != nil {
+				return installOutcome{Previous: current}, err
+			}
+			if err := c.linkToSysext(transfer); err != nil {
+				return installOutcome{}, err
+			}
+			c.msg("restored sysext link for %s", transfer.Component)
+			_ = c.runHooks(ctx, HookPostInstall, hook)
+		}
+		return installOutcome{Version: versionToInstall, Relinked: !linked, Previous: current}, nil
 	}
 
 	// Find the file for this version using patterns already parsed by getAvailableVersions
-	var sourceFile string
-	var expectedHash string
-	for filename, hash := range m.Files {
-		if v, _, ok := version.ExtractVersionParsed(filename, patterns); ok && v == versionToInstall {
-			sourceFile = filename
-			expectedHash = hash
-			break
-		}
+	sourceFile, expectedHash, err := sourceFileFor(m, patterns, versionToInstall)
+	if err != nil {
+		return installOutcome{}, err
 	}
 
-	if sourceFile == "" {
-		return "", nil, false, fmt.Errorf("no file found for version %s", versionToInstall)
+	// The @t, @m, @r and @s values in the source name describe the image
+	// and carry over to the installed file, as with systemd-sysupdate.
+	fields, _ := version.ExtractFieldsParsed(sourceFile, patterns)
+	mode, readOnly := transfer.Target.Mode, transfer.Target.ReadOnly
+	if fields.HasMode {
+		mode = fields.Mode
+	}
+	if fields.HasReadOnly {
+		readOnly = fields.ReadOnly
 	}
 
-	targetFile, err := buildTargetFilename(transfer.Target.Patterns(), versionToInstall)
+	targetFile, err := buildTargetFilename(transfer.Target.Patterns(), fields)
 	if err != nil {
-		return "", nil, false, err
+		return installOutcome{}, err
 	}
 	targetPath := filepath.Join(transfer.Target.Path, targetFile)
+	if opts.Stage {
+		targetPath = filepath.Join(sysext.StagedDirAt(transfer, c.paths.sysextLinkDir), targetFile)
+	}
+
+	// Hooks see the change before anything is installed, and may veto it.
+	// Staging installs nothing; Apply runs them.
+	hook := hookEnv{feature: opts.Feature, transfer: transfer.Component, oldVersion: current, newVersion: versionToInstall}
+	if !opts.DryRun && !opts.Stage {
+		if err := c.runHooks(ctx, HookPreUpdate, hook); err != nil {
+			return installOutcome{Previous: current}, err
+		}
+	}
+
+	// An image staged earlier is installed by moving it into place; it was
+	// verified when it was downloaded.
+	if staged == versionToInstall {
+		return c.installStaged(ctx, transfer, readOnly, opts, hook)
+	}
 
 	// Download
-	downloadURL := transfer.Source.Path + "/" + sourceFile
+	urls := m.FileURLs(sourceFile)
+	downloadURL := urls[0]
 	if opts.DryRun {
 		c.debug("would download %s → %s", downloadURL, targetPath)
-		return versionToInstall, m, true, nil
+		return installOutcome{Version: versionToInstall, Downloaded: true, Staged: opts.Stage, Previous: current}, nil
+	}
+	if opts.Stage && staged != "" {
+		if err := sysext.DiscardStagedAt(transfer, c.paths.sysextLinkDir); err != nil {
+			return installOutcome{}, err
+		}
 	}
 
 	c.debug("downloading %s → %s", downloadURL, targetPath)
-	err = download.Download(ctx, c.httpClient, downloadURL, targetPath, expectedHash, transfer.Target.Mode, c.config.OnDownloadProgress, download.WithRetryNotify(c.retryNotify("download")))
+	// A read-only copy of this version left by an earlier install would
+	// refuse the rename into place.
+	if err := sysext.ClearReadOnly(targetPath); err != nil {
+		return installOutcome{}, err
+	}
+	httpClient := c.httpClient
+	if transfer.Source.Type == "oci" {
+		httpClient = oci.NewClient(httpClient)
+	}
+	// The source file name, not the URL, decides decompression: OCI blob
+	// URLs end in a digest.
+	// Any mirror's bytes are checked against the manifest hash, so the
+	// manifest (and its signature) stays the only source of trust.
+	sourceURL := downloadURL
+	dlOpts := []download.Option{
+		download.WithRetryNotify(c.retryNotify("download")),
+		download.WithFilename(sourceFile),
+		download.WithMirrors(urls[1:]...),
+		download.WithFailoverNotify(c.failoverNotify("download")),
+		download.WithServedNotify(func(url string) { sourceURL = url }),
+		download.WithRateLimit(c.limiter),
+		download.WithReceivedNotify(c.stats.received),
+	}
+	if fields.HasSize {
+		dlOpts = append(dlOpts, download.WithExpectedSize(fields.Size))
+	}
+	started := time.Now()
+	if config.IsDirectoryTarget(transfer) {
+		// The tarball's own member modes apply; Target.Mode and @m are for
+		// image files.
+		err = download.DownloadTar(ctx, httpClient, downloadURL, targetPath, expectedHash, c.config.OnDownloadProgress, dlOpts...)
+	} else {
+		err = download.Download(ctx, httpClient, downloadURL, targetPath, expectedHash, mode, c.config.OnDownloadProgress, dlOpts...)
+	}
+	c.stats.downloaded(time.Since(started), err)
 	if err != nil {
-		return "", nil, false, fmt.Errorf("download failed: %w", err)
+		return installOutcome{}, fmt.Errorf("download failed: %w", err)
+	}
+
+	if sourceURL != downloadURL {
+		c.msg("downloaded %s from mirror %s", transfer.Component, sourceURL)
+	}
+
+	// The mtime is set before the image is made read-only: an immutable
+	// file refuses it.
+	if !fields.ModTime.IsZero() {
+		if err := os.Chtimes(targetPath, fields.ModTime, fields.ModTime); err != nil {
+			return installOutcome{}, fmt.Errorf("failed to set modification time: %w", err)
+		}
+	}
+
+	// A staged image is made read-only when it is installed: an immutable
+	// file could not be renamed into place.
+	if opts.Stage {
+		c.debug("staged %s %s in %s", transfer.Component, versionToInstall, filepath.Dir(targetPath))
+		return installOutcome{Version: versionToInstall, Downloaded: true, Staged: true, SourceURL: sourceURL, Previous: current}, nil
+	}
+
+	refreshErr, err := c.activateInstalled(ctx, transfer, targetPath, readOnly, opts, hook)
+	if err != nil {
+		return installOutcome{Previous: current}, err
+	}
+	return installOutcome{Version: versionToInstall, Downloaded: true, SourceURL: sourceURL, Previous: current}, refreshErr
+}
+
+// installStaged installs the image staged for transfer, which holds
+// version hook.newVersion, in place of a download: it is moved into the
+// target directory and activated as a freshly downloaded one would be. It
+// is reported as Relinked, an already downloaded version the link was
+// switched to.
+func (c *Client) installStaged(ctx context.Context, transfer *config.Transfer, readOnly bool, opts installTransferOptions, hook hookEnv) (installOutcome, error) {
+	v := hook.newVersion
+	if opts.DryRun {
+		c.debug("would install staged %s %s", transfer.Component, v)
+		return installOutcome{Version: v, Relinked: true, Previous: hook.oldVersion}, nil
+	}
+	_, path, err := sysext.PromoteStagedAt(transfer, c.paths.sysextLinkDir)
+	if err != nil {
+		return installOutcome{Previous: hook.oldVersion}, err
+	}
+	c.debug("installed staged %s %s", transfer.Component, v)
+	refreshErr, err := c.activateInstalled(ctx, transfer, path, readOnly, opts, hook)
+	if err != nil {
+		return installOutcome{Previous: hook.oldVersion}, err
+	}
+	return installOutcome{Version: v, Relinked: true, Previous: hook.oldVersion}, refreshErr
+}
+
+// activateInstalled finishes installing the image at path: it marks it
+// read-only if asked, points the sysext link at it, refreshes and vacuums
+// as opts allow, and runs the post-install hooks, and the post-refresh
+// hooks after a refresh, for hook. The first error is fatal; refreshErr
+// reports a failed refresh of an image that is installed and linked all
+// the same.
+func (c *Client) activateInstalled(ctx context.Context, transfer *config.Transfer, path string, readOnly bool, opts installTransferOptions, hook hookEnv) (refreshErr, err error) {
+	if readOnly {
+		immutable, err := sysext.MarkReadOnly(path)
+		if err != nil {
+			return nil, err
+		}
+		if !immutable {
+			c.debug("immutable attribute unavailable for %s; removed write permission instead", path)
+		}
 	}
 
 	if err := c.linkToSysext(transfer); err != nil {
-		return "", nil, false, err
+		return nil, err
 	}
 
 	// Refresh systemd-sysext. Both SDK callers batch this with NoRefresh:
 	// true; when a caller does ask for it, a failure is returned (the image
-	// is installed and linked, so versionToInstall is still reported) rather
+	// is installed and linked, so the version is still reported) rather
 	// than swallowed, matching the batched refresh in UpdateFeatures.
-	var refreshErr error
 	if !opts.NoRefresh {
 		if err := c.runner.Refresh(); err != nil {
 			refreshErr = fmt.Errorf("sysext refresh failed: %w", err)
@@ -120,13 +314,29 @@ func (c *Client) installTransfer(ctx context.Context, transfer *config.Transfer,
 		}
 	}
 
-	return versionToInstall, m, true, refreshErr
+	_ = c.runHooks(ctx, HookPostInstall, hook)
+	if !opts.NoRefresh && refreshErr == nil {
+		_ = c.runHooks(ctx, HookPostRefresh, hook)
+	}
+	return refreshErr, nil
+}
+
+// sourceFileFor returns the manifest file holding version v, and its hash.
+func sourceFileFor(m *manifest.Manifest, patterns []*version.Pattern, v string) (string, string, error) {
+	for filename, hash := range m.Files {
+		if fv, _, ok := version.ExtractVersionParsed(filename, patterns); ok && fv == v {
+			return filename, hash, nil
+		}
+	}
+	return "", "", fmt.Errorf("no file found for version %s", v)
 }
 
 // linkToSysext points the systemd-sysext link for transfer at its newest
 // staged image through the client's runner, in the client's link directory
 // when the runner supports one.
 func (c *Client) linkToSysext(transfer *config.Transfer) error {
+	c.runnerMu.Lock()
+	defer c.runnerMu.Unlock()
 	var linkErr error
 	if runner, ok := c.runner.(sysext.PathSysextRunner); ok {
 		linkErr = runner.LinkToSysextAt(transfer, c.sysextLinkDirForRunner())
@@ -151,12 +361,13 @@ func (c *Client) sysextLinkDirForRunner() string {
 	return sysext.SysextDir
 }
 
-// buildTargetFilename derives the installed filename for a version from the
-// target match patterns. Downloads are always stored decompressed, so it
-// prefers the first pattern whose name carries no compression suffix; if every
-// pattern is a compressed variant, it strips the suffix from the first one so
-// the on-disk name matches the actual content.
-func buildTargetFilename(targetPatterns []string, ver string) (string, error) {
+// buildTargetFilename derives the installed filename for the version and the
+// @t, @m, @r and @s values in fields from the target match patterns.
+// Downloads are always stored decompressed, so it prefers the first pattern
+// whose name carries no compression suffix; if every pattern is a compressed
+// variant, it strips the suffix from the first one so the on-disk name
+// matches the actual content.
+func buildTargetFilename(targetPatterns []string, fields version.Fields) (string, error) {
 	var fallback string
 	var firstErr error
 	for _, patternStr := range targetPatterns {
@@ -167,7 +378,7 @@ func buildTargetFilename(targetPatterns []string, ver string) (string, error) {
 			}
 			continue
 		}
-		name := p.BuildFilename(ver)
+		name := p.BuildFilenameWith(fields)
 		if stripped := download.StripCompressionSuffix(name); stripped == name {
 			return name, nil
 		} else if fallback == "" {
@@ -1,12 +1,15 @@
 package updex
 
 import (
+	"archive/tar"
 	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/frostyard/updex/internal/testutil"
 	"github.com/frostyard/updex/sysext"
@@ -74,7 +77,7 @@ func TestBuildTargetFilename(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := buildTargetFilename(tt.patterns, "1.2.3")
+			got, err := buildTargetFilename(tt.patterns, version.Fields{Version: "1.2.3"})
 			if got != tt.want {
 				t.Errorf("buildTargetFilename() = %q, want %q", got, tt.want)
 			}
@@ -206,6 +209,370 @@ func TestUpdateFeatures_TargetFilename_CompressedSource(t *testing.T) {
 	}
 }
 
+// TestUpdateFeatures_SourcePlaceholders verifies that the @t, @m and @s
+// values in a source file name carry over to the installed image: its mtime
+// and mode are set from them, the target name is filled from them, and an
+// image whose size disagrees with @s is rejected.
+func TestUpdateFeatures_SourcePlaceholders(t *testing.T) {
+	content := []byte("raw ddi payload")
+	mtime := time.UnixMicro(1700000000123456)
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{name: "size matches", size: len(content)},
+		{name: "size mismatch", size: len(content) + 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configDir := t.TempDir()
+			targetDir := t.TempDir()
+			source := fmt.Sprintf("testext_1.0.0_%d_0600_%d.raw", mtime.UnixMicro(), tt.size)
+			server := testutil.NewTestServer(t, testutil.TestServerFiles{
+				Files:   map[string]string{source: hashContent(content)},
+				Content: map[string][]byte{source: content},
+			})
+			defer server.Close()
+
+			createFeatureFile(t, configDir, "testfeature", true)
+			createTransferFileWithPatterns(t, configDir, "testext", "testfeature", server.URL,
+				"testext_@v_@t_@m_@s.raw", "testext_@v_@s.raw")
+			updateTransferTargetPath(t, configDir, targetDir)
+
+			client := NewClient(ClientConfig{Definitions: configDir, SysextRunner: &sysext.MockRunner{}})
+			results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateFeatures error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(results) != 1 || len(results[0].Results) != 1 {
+				t.Fatalf("expected 1 feature result with 1 component, got %+v", results)
+			}
+			target := filepath.Join(targetDir, fmt.Sprintf("testext_1.0.0_%d.raw", tt.size))
+			if tt.wantErr {
+				if msg := results[0].Results[0].Error; !strings.Contains(msg, "expected size") {
+					t.Errorf("component error = %q, want a size mismatch", msg)
+				}
+				if _, err := os.Stat(target); !os.IsNotExist(err) {
+					t.Errorf("image installed despite a size mismatch: %v", err)
+				}
+				return
+			}
+			if msg := results[0].Results[0].Error; msg != "" {
+				t.Fatalf("component update failed: %s", msg)
+			}
+			info, err := os.Stat(target)
+			if err != nil {
+				t.Fatalf("expected %s to exist: %v", target, err)
+			}
+			if got := info.Mode().Perm(); got != 0600 {
+				t.Errorf("installed mode = %04o, want 0600", got)
+			}
+			if !info.ModTime().Equal(mtime) {
+				t.Errorf("installed mtime = %v, want %v", info.ModTime(), mtime)
+			}
+		})
+	}
+}
+
+// TestUpdateFeatures_URLTar_ExtractsDirectory verifies that a url-tar
+// transfer into a directory target is extracted to a versioned directory and
+// linked under the extension's bare name.
+func TestUpdateFeatures_URLTar_ExtractsDirectory(t *testing.T) {
+	configDir := t.TempDir()
+	targetDir := t.TempDir()
+	linkDir := t.TempDir()
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	release := []byte("ID=_any\n")
+	if err := tw.WriteHeader(&tar.Header{Name: "usr/lib/extension-release.d/extension-release.testext", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(release))}); err != nil {
+		t.Fatalf("failed to write tar header: %v", err)
+	}
+	if _, err := tw.Write(release); err != nil {
+		t.Fatalf("failed to write tar body: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("failed to create zstd writer: %v", err)
+	}
+	if _, err := zw.Write(tarBuf.Bytes()); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zstd writer: %v", err)
+	}
+	archive := buf.Bytes()
+
+	server := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Files:   map[string]string{"testext_1.0.0.tar.zst": hashContent(archive)},
+		Content: map[string][]byte{"testext_1.0.0.tar.zst": archive},
+	})
+	defer server.Close()
+
+	createFeatureFile(t, configDir, "testfeature", true)
+	transfer := `[Transfer]
+Features=testfeature
+Verify=false
+
+[Source]
+Type=url-tar
+Path=` + server.URL + `
+MatchPattern=testext_@v.tar.zst
+
+[Target]
+Type=directory
+Path=` + targetDir + `
+MatchPattern=testext_@v
+`
+	if err := os.WriteFile(filepath.Join(configDir, "testext.transfer"), []byte(transfer), 0644); err != nil {
+		t.Fatalf("failed to create transfer file: %v", err)
+	}
+
+	client := NewClient(ClientConfig{Definitions: configDir, Paths: RuntimePaths{SysextLinkDir: linkDir}})
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if len(results) != 1 || len(results[0].Results) != 1 {
+		t.Fatalf("expected 1 feature result with 1 component, got %+v", results)
+	}
+	if r := results[0].Results[0]; r.Error != "" || !r.Downloaded || r.Version != "1.0.0" {
+		t.Fatalf("component result = %+v, want downloaded 1.0.0", r)
+	}
+
+	got, err := os.ReadFile(filepath.Join(targetDir, "testext_1.0.0", "usr/lib/extension-release.d/extension-release.testext"))
+	if err != nil {
+		t.Fatalf("expected extracted extension-release: %v", err)
+	}
+	if !bytes.Equal(got, release) {
+		t.Errorf("extracted content = %q, want %q", got, release)
+	}
+	link, err := os.Readlink(filepath.Join(linkDir, "testext"))
+	if err != nil {
+		t.Fatalf("expected sysext link: %v", err)
+	}
+	if link != filepath.Join(targetDir, "testext_1.0.0") {
+		t.Errorf("sysext link = %q, want %q", link, filepath.Join(targetDir, "testext_1.0.0"))
+	}
+}
+
+// TestUpdateFeatures_LocalSource covers air-gapped hosts: a regular-file
+// source reads SHA256SUMS and images from a local directory and still
+// enforces the manifest hash.
+func TestUpdateFeatures_LocalSource(t *testing.T) {
+	content := []byte("local raw ddi content")
+	mirror := t.TempDir()
+	if err := os.WriteFile(filepath.Join(mirror, "testext_1.0.0.raw"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		hash      string
+		wantError bool
+	}{
+		{name: "matching hash installs", hash: hashContent(content)},
+		{name: "hash mismatch is refused", hash: hashContent([]byte("other")), wantError: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(mirror, "SHA256SUMS"), []byte(tc.hash+"  testext_1.0.0.raw\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			configDir := t.TempDir()
+			targetDir := t.TempDir()
+			createFeatureFile(t, configDir, "testfeature", true)
+			transfer := `[Transfer]
+Features=testfeature
+Verify=false
+
+[Source]
+Type=regular-file
+Path=` + mirror + `
+MatchPattern=testext_@v.raw
+
+[Target]
+Type=regular-file
+Path=` + targetDir + `
+MatchPattern=testext_@v.raw
+`
+			if err := os.WriteFile(filepath.Join(configDir, "testext.transfer"), []byte(transfer), 0644); err != nil {
+				t.Fatalf("failed to create transfer file: %v", err)
+			}
+
+			client := NewClient(ClientConfig{Definitions: configDir, SysextRunner: &sysext.MockRunner{}})
+			results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true})
+			if len(results) != 1 || len(results[0].Results) != 1 {
+				t.Fatalf("expected 1 feature result with 1 component, got %+v (err %v)", results, err)
+			}
+			r := results[0].Results[0]
+			_, statErr := os.Stat(filepath.Join(targetDir, "testext_1.0.0.raw"))
+			if tc.wantError {
+				if err == nil || !strings.Contains(r.Error, "hash mismatch") {
+					t.Fatalf("UpdateFeatures() err = %v, result error = %q; want hash mismatch", err, r.Error)
+				}
+				if !os.IsNotExist(statErr) {
+					t.Errorf("image installed despite hash mismatch, stat err = %v", statErr)
+				}
+				return
+			}
+			if err != nil || r.Error != "" {
+				t.Fatalf("UpdateFeatures() err = %v, result error = %q", err, r.Error)
+			}
+			if statErr != nil {
+				t.Errorf("expected testext_1.0.0.raw to be installed: %v", statErr)
+			}
+		})
+	}
+}
+
+// writeOCITransfer writes a .transfer for an oci source at registry/repo.
+func writeOCITransfer(t *testing.T, configDir, targetDir, path, verify string) {
+	t.Helper()
+	content := `[Transfer]
+Features=testfeature
+Verify=` + verify + `
+
+[Source]
+Type=oci
+Path=` + path + `
+MatchPattern=testext_@v.raw.zst testext_@v.raw
+
+[Target]
+Path=` + targetDir + `
+MatchPattern=testext_@v.raw
+`
+	if err := os.WriteFile(filepath.Join(configDir, "testext.transfer"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create transfer file: %v", err)
+	}
+}
+
+// TestUpdateFeatures_OCISource installs the newest titled layer from a
+// token-protected registry stand-in, decompressing by the layer title since
+// the blob URL ends in a digest.
+func TestUpdateFeatures_OCISource(t *testing.T) {
+	raw := []byte("oci raw ddi payload")
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("failed to create zstd writer: %v", err)
+	}
+	if _, err := zw.Write(raw); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zstd writer: %v", err)
+	}
+
+	server := testutil.NewTestRegistry(t, testutil.TestRegistry{
+		Repository: "sysexts/testext",
+		Images: []testutil.TestRegistryImage{
+			{Tag: "1.0.0", Title: "testext_1.0.0.raw", Content: []byte("old")},
+			{Tag: "2.0.0", Title: "testext_2.0.0.raw.zst", Content: buf.Bytes()},
+		},
+		RequireToken: true,
+	})
+	defer server.Close()
+
+	configDir := t.TempDir()
+	targetDir := t.TempDir()
+	createFeatureFile(t, configDir, "testfeature", true)
+	writeOCITransfer(t, configDir, targetDir, server.URL+"/sysexts/testext", "false")
+
+	client := NewClient(ClientConfig{Definitions: configDir, SysextRunner: &sysext.MockRunner{}})
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if len(results) != 1 || len(results[0].Results) != 1 {
+		t.Fatalf("expected 1 feature result with 1 component, got %+v", results)
+	}
+	if r := results[0].Results[0]; r.Error != "" || r.Version != "2.0.0" || !r.Downloaded {
+		t.Fatalf("component result = %+v, want downloaded 2.0.0", r)
+	}
+	got, err := os.ReadFile(filepath.Join(targetDir, "testext_2.0.0.raw"))
+	if err != nil {
+		t.Fatalf("expected testext_2.0.0.raw to exist: %v", err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Errorf("installed file should be decompressed: got %q, want %q", got, raw)
+	}
+}
+
+// TestCheckFeatures_OCISourceRefusesVerify pins the fail-closed rule: an oci
+// transfer that requires GPG verification errors instead of silently
+// trusting unsigned registry digests.
+func TestCheckFeatures_OCISourceRefusesVerify(t *testing.T) {
+	server := testutil.NewTestRegistry(t, testutil.TestRegistry{
+		Repository: "testext",
+		Images:     []testutil.TestRegistryImage{{Tag: "1.0.0", Title: "testext_1.0.0.raw", Content: []byte("x")}},
+	})
+	defer server.Close()
+
+	configDir := t.TempDir()
+	createFeatureFile(t, configDir, "testfeature", true)
+	writeOCITransfer(t, configDir, t.TempDir(), server.URL+"/testext", "true")
+
+	client := NewClient(ClientConfig{Definitions: configDir, SysextRunner: &sysext.MockRunner{}})
+	results, _ := client.CheckFeatures(t.Context(), CheckFeaturesOptions{})
+	if len(results) != 1 || len(results[0].Results) != 1 {
+		t.Fatalf("expected 1 feature result with 1 component, got %+v", results)
+	}
+	if r := results[0].Results[0]; !strings.Contains(r.Error, "cannot be GPG-verified") {
+		t.Errorf("component error = %q, want GPG refusal", r.Error)
+	}
+}
+
+// TestUpdateFeatures_MirrorServesImage covers a primary whose SHA256SUMS is
+// current but which lacks the image itself: the download fails over to the
+// mirror listed in Mirrors=, and the result reports where the image came from.
+func TestUpdateFeatures_MirrorServesImage(t *testing.T) {
+	content := []byte("mirrored raw ddi content")
+	files := map[string]string{"testext_1.0.0.raw": hashContent(content)}
+	primary := testutil.NewTestServer(t, testutil.TestServerFiles{Files: files})
+	defer primary.Close()
+	mirror := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Files:   files,
+		Content: map[string][]byte{"testext_1.0.0.raw": content},
+	})
+	defer mirror.Close()
+
+	configDir := t.TempDir()
+	targetDir := t.TempDir()
+	createFeatureFile(t, configDir, "testfeature", true)
+	createTransferFileWithPatterns(t, configDir, "testext", "testfeature", primary.URL+"\nMirrors="+mirror.URL,
+		"testext_@v.raw", "testext_@v.raw")
+	updateTransferTargetPath(t, configDir, targetDir)
+
+	client := NewClient(ClientConfig{Definitions: configDir, SysextRunner: &sysext.MockRunner{}})
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if len(results) != 1 || len(results[0].Results) != 1 {
+		t.Fatalf("expected 1 feature result with 1 component, got %+v", results)
+	}
+	r := results[0].Results[0]
+	if r.Error != "" || !r.Downloaded {
+		t.Fatalf("component result = %+v, want downloaded", r)
+	}
+	if want := mirror.URL + "/testext_1.0.0.raw"; r.SourceURL != want {
+		t.Errorf("SourceURL = %q, want %q", r.SourceURL, want)
+	}
+	got, err := os.ReadFile(filepath.Join(targetDir, "testext_1.0.0.raw"))
+	if err != nil {
+		t.Fatalf("expected testext_1.0.0.raw to exist: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("installed file content mismatch: got %q, want %q", got, content)
+	}
+}
+
 // TestInstallTransfer_RefreshFailure_ReturnsErrorAfterInstall pins the
 // direct-caller contract of installTransfer's own refresh path (both SDK
 // callers batch with NoRefresh: true): the image is installed and linked,
@@ -221,13 +588,13 @@ func TestInstallTransfer_RefreshFailure_ReturnsErrorAfterInstall(t *testing.T) {
 		t.Fatalf("expected 1 transfer, got %d", len(transfers))
 	}
 
-	version, _, downloaded, err := client.installTransfer(t.Context(), transfers[0], installTransferOptions{NoVacuum: true})
+	outcome, err := client.installTransfer(t.Context(), transfers[0], installTransferOptions{NoVacuum: true})
 
 	if err == nil || !strings.Contains(err.Error(), "sysext refresh failed") {
 		t.Fatalf("expected refresh error, got %v", err)
 	}
-	if version != "1.0.0" || !downloaded {
-		t.Errorf("install outcome must still be reported: version=%q downloaded=%v", version, downloaded)
+	if outcome.Version != "1.0.0" || !outcome.Downloaded {
+		t.Errorf("install outcome must still be reported: version=%q downloaded=%v", outcome.Version, outcome.Downloaded)
 	}
 	if !mockRunner.RefreshCalled {
 		t.Error("expected Refresh to be called")
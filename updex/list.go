@@ -4,13 +4,42 @@ import (
 	"context"
 	"fmt"
 	"maps"
+	"path/filepath"
 	"slices"
+	"strings"
 
 	"github.com/frostyard/updex/config"
+	"github.com/frostyard/updex/internal/fileurl"
 	"github.com/frostyard/updex/manifest"
+	"github.com/frostyard/updex/oci"
 	"github.com/frostyard/updex/version"
 )
 
+// manifestCacheKey identifies the manifest a transfer resolves to: its
+// Source.Path and, when set, its Mirrors, which decide where its files can be
+// downloaded from.
+func manifestCacheKey(transfer *config.Transfer) string {
+	return strings.Join(append([]string{transfer.Source.Path}, transfer.Source.Mirrors...), " ")
+}
+
+// cachedAvailableVersions is getAvailableVersions through cache, which may be
+// nil. The cache entry for the transfer's manifestCacheKey is held while the
+// versions resolve, so transfers sharing a source wait for the first fetch
+// instead of repeating it.
+func (c *Client) cachedAvailableVersions(ctx context.Context, transfer *config.Transfer, cache *manifestCache) ([]string, *manifest.Manifest, []*version.Pattern, error) {
+	if cache == nil {
+		return c.getAvailableVersions(ctx, transfer, nil)
+	}
+	e := cache.entry(manifestCacheKey(transfer))
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	available, m, patterns, err := c.getAvailableVersions(ctx, transfer, e.m)
+	if m != nil {
+		e.m = m
+	}
+	return available, m, patterns, err
+}
+
 // getAvailableVersions retrieves available versions for a transfer from remote manifest.
 // It returns the fetched manifest and the parsed source patterns alongside the versions
 // so callers can reuse both without redundant HTTP requests or pattern parsing.
@@ -21,23 +50,64 @@ import (
 // a successful signature check; it fetches (with verification) as if no cache
 // entry existed. A verified manifest may serve unverified transfers, never the
 // reverse, so verification is a property of the transfer rather than of which
-// transfer sharing a Source.Path happened to load first.
+// transfer sharing a Source.Path happened to load first. A Phased=
+// transfer likewise refetches a cached manifest read without its ROLLOUT
+// sidecar.
 func (c *Client) getAvailableVersions(ctx context.Context, transfer *config.Transfer, cachedManifest *manifest.Manifest) ([]string, *manifest.Manifest, []*version.Pattern, error) {
-	if transfer.Source.Type != "url-file" {
+	needVerify := c.config.Verify || transfer.Transfer.Verify
+
+	switch transfer.Source.Type {
+	case "url-file", "url-tar":
+	case "oci":
+		// Registries publish no detached signature over the tag set; the
+		// layer digests are only as trustworthy as the TLS connection.
+		if needVerify {
+			return nil, nil, nil, fmt.Errorf("oci sources cannot be GPG-verified; set Verify=no on the transfer")
+		}
+		if len(transfer.Source.Mirrors) > 0 {
+			return nil, nil, nil, fmt.Errorf("oci sources do not support Mirrors")
+		}
+		if transfer.Transfer.Phased {
+			return nil, nil, nil, fmt.Errorf("oci sources do not support Phased")
+		}
+	case "regular-file", "directory":
+		for _, path := range append([]string{transfer.Source.Path}, transfer.Source.Mirrors...) {
+			if !fileurl.IsFileURL(path) && !filepath.IsAbs(path) {
+				return nil, nil, nil, fmt.Errorf("local source path must be absolute: %s", path)
+			}
+		}
+	default:
 		return nil, nil, nil, fmt.Errorf("unsupported source type: %s", transfer.Source.Type)
 	}
+	baseURL := transfer.Source.BaseURL()
 
-	needVerify := c.config.Verify || transfer.Transfer.Verify
 	m := cachedManifest
 	if m != nil && needVerify && !m.Verified {
 		c.debug("cached manifest for %s was not signature-verified; refetching with verification", transfer.Source.Path)
 		m = nil
 	}
+	if m != nil && transfer.Transfer.Phased && !m.RolloutChecked {
+		c.debug("cached manifest for %s was fetched without its rollout; refetching", transfer.Source.Path)
+		m = nil
+	}
 	if m == nil {
 		// Fetch manifest
 		c.debug("fetching manifest from %s", transfer.Source.Path)
 		var err error
-		m, err = manifest.Fetch(ctx, c.httpClient, transfer.Source.Path, needVerify, manifest.WithRetryNotify(c.retryNotify("manifest fetch")))
+		if transfer.Source.Type == "oci" {
+			m, err = oci.Fetch(ctx, c.httpClient, transfer.Source.Path, oci.WithRetryNotify(c.retryNotify("registry fetch")))
+		} else {
+			opts := []manifest.Option{
+				manifest.WithRetryNotify(c.retryNotify("manifest fetch")),
+				manifest.WithMirrors(transfer.Source.MirrorURLs()...),
+				manifest.WithFailoverNotify(c.failoverNotify("manifest fetch")),
+			}
+			if transfer.Transfer.Phased {
+				opts = append(opts, manifest.WithRollout())
+			}
+			m, err = manifest.Fetch(ctx, c.httpClient, baseURL, needVerify, opts...)
+		}
+		c.stats.settle(err)
 		if err != nil {
 			return nil, nil, nil, err
 		}
@@ -57,12 +127,21 @@ func (c *Client) getAvailableVersions(ctx context.Context, transfer *config.Tran
 	versionSet := make(map[string]bool)
 	for filename := range m.Files {
 		if v, _, ok := version.ExtractVersionParsed(filename, patterns); ok {
-			// Apply MinVersion filter
+			// Apply MinVersion and MaxVersion filters
 			if transfer.Transfer.MinVersion != "" {
 				if version.Compare(v, transfer.Transfer.MinVersion) < 0 {
 					continue
 				}
 			}
+			if transfer.Transfer.MaxVersion != "" {
+				if version.Compare(v, transfer.Transfer.MaxVersion) > 0 {
+					continue
+				}
+			}
+			// A version rolled back from is not offered again unless pinned
+			if v != transfer.Transfer.PinVersion && slices.Contains(transfer.Transfer.SkipVersions, v) {
+				continue
+			}
 			versionSet[v] = true
 		}
 	}
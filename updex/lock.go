@@ -0,0 +1,66 @@
+package updex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"syscall"
+
+	"github.com/frostyard/updex/internal/lock"
+)
+
+// DefaultLockPath is the lock file that serializes updex operations when
+// RuntimePaths.LockPath is zero.
+const DefaultLockPath = "/run/updex/lock"
+
+// defaultLockPath is the lock file used when RuntimePaths.LockPath is zero.
+// Tests point it at a temporary directory so they need not create
+// /run/updex.
+var defaultLockPath = DefaultLockPath
+
+// ErrLocked is returned, wrapped with the processes holding the lock, when
+// ClientConfig.NoLockWait is set and another updex operation holds the lock
+// an operation needs.
+var ErrLocked = errors.New("another updex operation is running")
+
+// lockKey marks a context whose operation already holds the lock, so the
+// operations it calls in turn do not take it again.
+type lockKey struct{}
+
+// lock takes the updex lock for an operation: exclusive for one that
+// changes the system, shared for one that only reads it. Unless
+// ClientConfig.NoLockWait is set, it waits for other processes to release
+// it until ctx is done. The returned context marks the lock as held; pass
+// it to the operation's work and call the returned function when done; it
+// may be called more than once.
+//
+// A lock file the process cannot create or open, as for an unprivileged
+// caller, fails an exclusive lock: an operation that changes the system
+// must not run beside another one. A shared lock proceeds without it, so
+// unprivileged callers can still read the system.
+func (c *Client) lock(ctx context.Context, exclusive bool) (context.Context, func(), error) {
+	if ctx.Value(lockKey{}) != nil {
+		return ctx, func() {}, nil
+	}
+
+	l, err := lock.Acquire(ctx, c.paths.lockPath, lock.Options{
+		Exclusive: exclusive,
+		Wait:      !c.config.NoLockWait,
+		OnWait: func(busy *lock.BusyError) {
+			c.msg("Waiting for another updex operation: %s", busy)
+		},
+	})
+	var busy *lock.BusyError
+	switch {
+	case errors.As(err, &busy):
+		return ctx, nil, fmt.Errorf("%w: %s", ErrLocked, busy)
+	case !exclusive && (errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.EROFS)):
+		c.debug("proceeding without the updex lock: %v", err)
+		return context.WithValue(ctx, lockKey{}, true), func() {}, nil
+	case err != nil:
+		return ctx, nil, err
+	}
+	return context.WithValue(ctx, lockKey{}, true), sync.OnceFunc(func() { _ = l.Release() }), nil
+}
@@ -0,0 +1,149 @@
+package updex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frostyard/updex/internal/lock"
+)
+
+// TestMain gives the package's tests a lock file they can always take,
+// running as root or not.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "updex-lock-")
+	if err != nil {
+		panic(err)
+	}
+	defaultLockPath = filepath.Join(dir, "lock")
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// lockFixture returns a client with a disabled testfeature and its own lock
+// file, and holds that lock, exclusively or shared, until the test ends.
+func lockFixture(t *testing.T, cfg ClientConfig, exclusive bool) *Client {
+	t.Helper()
+	configDir := t.TempDir()
+	createFeatureFile(t, configDir, "testfeature", false)
+	lockPath := filepath.Join(t.TempDir(), "lock")
+
+	held, err := lock.Acquire(t.Context(), lockPath, lock.Options{Exclusive: exclusive})
+	if err != nil {
+		t.Fatalf("failed to hold the lock: %v", err)
+	}
+	t.Cleanup(func() { _ = held.Release() })
+
+	cfg.Definitions = configDir
+	cfg.Paths.LockPath = lockPath
+	return NewClient(cfg)
+}
+
+// TestLock_NoWaitNamesHolder verifies that with NoLockWait an operation
+// fails at once with ErrLocked while another process holds the lock, and
+// that the error names the holder.
+func TestLock_NoWaitNamesHolder(t *testing.T) {
+	client := lockFixture(t, ClientConfig{NoLockWait: true}, true)
+
+	result, err := client.EnableFeature(t.Context(), "testfeature", EnableFeatureOptions{})
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("EnableFeature error = %v, want ErrLocked", err)
+	}
+	if holder := fmt.Sprintf("PID %d", os.Getpid()); !strings.Contains(err.Error(), holder) {
+		t.Errorf("error %q does not name %s", err, holder)
+	}
+	if result.Success || result.Error != err.Error() {
+		t.Errorf("result = %+v, want the lock error", result)
+	}
+
+	// A reader is kept out too.
+	if _, err := client.Features(t.Context()); !errors.Is(err, ErrLocked) {
+		t.Errorf("Features error = %v, want ErrLocked", err)
+	}
+}
+
+// TestLock_SharedAdmitsReaders verifies that read-only operations run
+// beside other readers while mutating ones are kept out.
+func TestLock_SharedAdmitsReaders(t *testing.T) {
+	client := lockFixture(t, ClientConfig{NoLockWait: true}, false)
+
+	if _, err := client.Features(t.Context()); err != nil {
+		t.Errorf("Features failed beside a reader: %v", err)
+	}
+	if _, err := client.EnableFeature(t.Context(), "testfeature", EnableFeatureOptions{DryRun: true}); err != nil {
+		t.Errorf("dry-run EnableFeature failed beside a reader: %v", err)
+	}
+	if _, err := client.EnableFeature(t.Context(), "testfeature", EnableFeatureOptions{}); !errors.Is(err, ErrLocked) {
+		t.Errorf("EnableFeature error = %v, want ErrLocked", err)
+	}
+}
+
+// TestLock_WaitHonoursContext verifies that an operation waiting for the
+// lock gives up when its context is done.
+func TestLock_WaitHonoursContext(t *testing.T) {
+	client := lockFixture(t, ClientConfig{}, true)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.EnableFeature(ctx, "testfeature", EnableFeatureOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("EnableFeature error = %v, want the deadline", err)
+	}
+}
+
+// TestLock_HeldByCaller verifies that an operation called with a context
+// already holding the lock, as CatalogAdd calls EnableFeature, does not
+// take it again.
+func TestLock_HeldByCaller(t *testing.T) {
+	configDir := t.TempDir()
+	createFeatureFile(t, configDir, "testfeature", false)
+	client := NewClient(ClientConfig{
+		Definitions: configDir,
+		NoLockWait:  true,
+		Paths: RuntimePaths{
+			DefinitionRoots: []string{t.TempDir()},
+			LockPath:        filepath.Join(t.TempDir(), "lock"),
+		},
+	})
+
+	ctx, unlock, err := client.lock(t.Context(), true)
+	if err != nil {
+		t.Fatalf("lock failed: %v", err)
+	}
+	defer unlock()
+	if _, err := client.EnableFeature(ctx, "testfeature", EnableFeatureOptions{}); err != nil {
+		t.Errorf("EnableFeature under the caller's lock failed: %v", err)
+	}
+}
+
+// TestLock_UnavailableFile verifies that a lock file that cannot be created
+// fails an exclusive lock but lets a shared one proceed without it.
+func TestLock_UnavailableFile(t *testing.T) {
+	configDir := t.TempDir()
+	createFeatureFile(t, configDir, "testfeature", false)
+	client := NewClient(ClientConfig{
+		Definitions: configDir,
+		Paths: RuntimePaths{
+			DefinitionRoots: []string{t.TempDir()},
+			// Nothing, not even root, can create a directory in /proc.
+			LockPath: "/proc/updex-test/lock",
+		},
+	})
+
+	if _, err := client.Features(t.Context()); err != nil {
+		t.Errorf("Features failed without the lock: %v", err)
+	}
+	if _, err := client.EnableFeature(t.Context(), "testfeature", EnableFeatureOptions{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("EnableFeature error = %v, want the missing lock file", err)
+	}
+	dropIn := filepath.Join(configDir, "testfeature.feature.d", updexDropInName)
+	if _, err := os.Stat(dropIn); !os.IsNotExist(err) {
+		t.Errorf("EnableFeature wrote %s without the lock: %v", dropIn, err)
+	}
+}
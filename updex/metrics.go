@@ -0,0 +1,360 @@
+package updex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frostyard/updex/download"
+	"github.com/frostyard/updex/manifest"
+	"github.com/frostyard/updex/sysext"
+)
+
+// The operations a metrics file reports runs of, as its operation label.
+const (
+	metricsOpCheck  = "check"
+	metricsOpUpdate = "update"
+)
+
+// metricsFileMode lets node_exporter, which need not run as root, read the
+// metrics file.
+const metricsFileMode = 0644
+
+// transferStats counts the work of one transfer job. Only the job's
+// goroutine uses it, and every method is a no-op on a nil receiver, so code
+// that also runs outside a job need not check.
+type transferStats struct {
+	downloadBytes        int64
+	downloadTime         time.Duration
+	retries              int
+	verificationFailures int
+
+	// failedVerification is set once an attempt or mirror of the fetch in
+	// progress has failed verification.
+	failedVerification bool
+}
+
+// received counts n bytes read from a download source.
+func (s *transferStats) received(n int64) {
+	if s != nil {
+		s.downloadBytes += n
+	}
+}
+
+// retried counts a request retried after it failed with reason.
+func (s *transferStats) retried(reason error) {
+	if s == nil {
+		return
+	}
+	s.retries++
+	s.observe(reason)
+}
+
+// observe notes a failed attempt of the fetch in progress.
+func (s *transferStats) observe(err error) {
+	if s != nil && isVerificationFailure(err) {
+		s.failedVerification = true
+	}
+}
+
+// settle ends a manifest fetch or download that returned err. It counts
+// one verification failure if the fetch, or any attempt or mirror it tried
+// first, failed verification.
+func (s *transferStats) settle(err error) {
+	if s == nil {
+		return
+	}
+	s.observe(err)
+	if s.failedVerification {
+		s.verificationFailures++
+		s.failedVerification = false
+	}
+}
+
+// downloaded ends a download that took d and returned err.
+func (s *transferStats) downloaded(d time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.downloadTime += d
+	s.settle(err)
+}
+
+// isVerificationFailure reports whether err is a signature, hash or size
+// check failing, as opposed to the source being unreachable.
+func isVerificationFailure(err error) bool {
+	return errors.Is(err, manifest.ErrInvalidSignature) ||
+		errors.Is(err, download.ErrHashMismatch) ||
+		errors.Is(err, download.ErrSizeMismatch)
+}
+
+// transferMetrics is what a metrics file reports about one transfer.
+type transferMetrics struct {
+	feature, transfer    string
+	installed, newest    string
+	updateAvailable      bool
+	failed               bool
+	retries              int
+	verificationFailures int
+}
+
+// checkMetrics returns the transfer metrics of a CheckFeatures run.
+func checkMetrics(results []CheckFeaturesResult) []transferMetrics {
+	var transfers []transferMetrics
+	for _, fr := range results {
+		for _, r := range fr.Results {
+			transfers = append(transfers, transferMetrics{
+				feature:              fr.Feature,
+				transfer:             r.Component,
+				installed:            r.CurrentVersion,
+				newest:               r.NewestVersion,
+				updateAvailable:      r.UpdateAvailable,
+				failed:               r.Error != "",
+				retries:              r.Retries,
+				verificationFailures: r.VerificationFailures,
+			})
+		}
+	}
+	return transfers
+}
+
+// updateMetrics returns the transfer metrics of an UpdateFeatures run of
+// jobs. The installed version is read back from disk; the newest is the
+// version the run selected. A version left staged is still an update.
+func (c *Client) updateMetrics(jobs []transferJob, results []UpdateFeaturesResult) []transferMetrics {
+	var transfers []transferMetrics
+	i := 0
+	for _, fr := range results {
+		for _, r := range fr.Results {
+			if i >= len(jobs) {
+				return transfers
+			}
+			_, current, err := sysext.GetInstalledVersionsAt(jobs[i].transfer, c.paths.sysextLinkDir)
+			if err != nil {
+				c.debug("cannot read installed version of %s: %v", r.Component, err)
+			}
+			m := transferMetrics{
+				feature:              fr.Feature,
+				transfer:             r.Component,
+				installed:            current,
+				failed:               r.Error != "",
+				retries:              r.Retries,
+				verificationFailures: r.VerificationFailures,
+			}
+			if !m.failed {
+				m.newest = r.Version
+				m.updateAvailable = !r.Installed
+			}
+			transfers = append(transfers, m)
+			i++
+		}
+	}
+	return transfers
+}
+
+// metricsRun is the last run of an operation a metrics file reports.
+type metricsRun struct {
+	op       string
+	finished time.Time
+	success  bool
+}
+
+// writeMetrics writes the metrics of a run of op that has just finished
+// with runErr to path, in the Prometheus text format node_exporter's
+// textfile collector reads. updates are the results of an update run; a
+// check run reports the downloads of the last recorded one instead. The
+// last runs of other operations, and the last successful update, are kept
+// from the file being replaced when they are later than the history's. The
+// file is replaced atomically, and failing to write it is a warning.
+func (c *Client) writeMetrics(ctx context.Context, path, op string, transfers []transferMetrics, updates []UpdateFeaturesResult, runErr error) {
+	finished := time.Now()
+	history, err := c.RunHistory(context.WithoutCancel(ctx), RunHistoryOptions{})
+	if err != nil {
+		c.debug("cannot read run history: %v", err)
+	}
+
+	runs := []metricsRun{{op, finished, runErr == nil}}
+	var lastSuccess time.Time
+	if op == metricsOpUpdate && runErr == nil {
+		lastSuccess = finished
+	}
+	for _, record := range history {
+		if record.Success {
+			if lastSuccess.IsZero() {
+				lastSuccess = record.FinishedAt
+			}
+			break
+		}
+	}
+	if op == metricsOpCheck && len(history) > 0 {
+		runs = append(runs, metricsRun{metricsOpUpdate, history[0].FinishedAt, history[0].Success})
+		updates = history[0].Results
+	}
+
+	// Checks, and updates run without Record, are in no history: their
+	// last runs are only in the file being replaced.
+	previous, previousSuccess := readMetricsRuns(path)
+	for _, p := range previous {
+		i := slices.IndexFunc(runs, func(r metricsRun) bool { return r.op == p.op })
+		switch {
+		case i < 0:
+			runs = append(runs, p)
+		case p.finished.After(runs[i].finished):
+			runs[i] = p
+		}
+	}
+	if previousSuccess.After(lastSuccess) {
+		lastSuccess = previousSuccess
+	}
+
+	info := &metricFamily{name: "updex_transfer_info", help: "Installed and newest version of a transfer; always 1."}
+	available := &metricFamily{name: "updex_update_available", help: "Whether a newer version of a transfer is available or staged."}
+	failed := &metricFamily{name: "updex_transfer_failed", help: "Whether the last run failed to check or update a transfer."}
+	retries := &metricFamily{name: "updex_retries", help: "Requests retried for a transfer in the last run."}
+	verification := &metricFamily{name: "updex_verification_failures", help: "Manifests and images of a transfer that failed signature, hash or size verification in the last run."}
+	for _, t := range transfers {
+		info.add(1, "feature", t.feature, "transfer", t.transfer, "installed", t.installed, "newest", t.newest)
+		available.add(gaugeBool(t.updateAvailable), "feature", t.feature, "transfer", t.transfer)
+		failed.add(gaugeBool(t.failed), "feature", t.feature, "transfer", t.transfer)
+		retries.add(float64(t.retries), "feature", t.feature, "transfer", t.transfer)
+		verification.add(float64(t.verificationFailures), "feature", t.feature, "transfer", t.transfer)
+	}
+
+	downloadBytes := &metricFamily{name: "updex_download_bytes", help: "Bytes downloaded for a transfer by the last update run, failed attempts included."}
+	downloadTime := &metricFamily{name: "updex_download_duration_seconds", help: "Time spent downloading a transfer in the last update run."}
+	for _, fr := range updates {
+		for _, r := range fr.Results {
+			downloadBytes.add(float64(r.DownloadBytes), "feature", fr.Feature, "transfer", r.Component)
+			downloadTime.add(r.DownloadSeconds, "feature", fr.Feature, "transfer", r.Component)
+		}
+	}
+
+	lastRun := &metricFamily{name: "updex_last_run_timestamp_seconds", help: "When the last run of an operation finished."}
+	lastRunSuccess := &metricFamily{name: "updex_last_run_success", help: "Whether the last run of an operation succeeded."}
+	for _, r := range runs {
+		lastRun.add(gaugeTime(r.finished), "operation", r.op)
+		lastRunSuccess.add(gaugeBool(r.success), "operation", r.op)
+	}
+	successTime := &metricFamily{name: "updex_last_success_timestamp_seconds", help: "When the last successful update run finished."}
+	if !lastSuccess.IsZero() {
+		successTime.add(gaugeTime(lastSuccess))
+	}
+
+	var b strings.Builder
+	for _, f := range []*metricFamily{info, available, failed, retries, verification, downloadBytes, downloadTime, lastRun, lastRunSuccess, successTime} {
+		f.writeTo(&b)
+	}
+	if err := writeManagedFileWithMode(path, []byte(b.String()), metricsFileMode); err != nil {
+		c.warn("cannot write metrics to %s: %v", path, err)
+	}
+}
+
+// readMetricsRuns reads the last runs, and the last successful update, that
+// the metrics file at path reports. A file that is missing or not one
+// writeMetrics wrote reports none.
+func readMetricsRuns(path string) ([]metricsRun, time.Time) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}
+	}
+
+	var runs []metricsRun
+	var lastSuccess time.Time
+	run := func(op string) *metricsRun {
+		if i := slices.IndexFunc(runs, func(r metricsRun) bool { return r.op == op }); i >= 0 {
+			return &runs[i]
+		}
+		runs = append(runs, metricsRun{op: op})
+		return &runs[len(runs)-1]
+	}
+	for line := range strings.Lines(string(data)) {
+		sample, text, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			continue
+		}
+		if op, ok := metricsOperation(sample, "updex_last_run_timestamp_seconds"); ok {
+			run(op).finished = metricsTime(value)
+		} else if op, ok := metricsOperation(sample, "updex_last_run_success"); ok {
+			run(op).success = value == 1
+		} else if sample == "updex_last_success_timestamp_seconds" {
+			lastSuccess = metricsTime(value)
+		}
+	}
+	// A run without its timestamp cannot be compared with another.
+	runs = slices.DeleteFunc(runs, func(r metricsRun) bool { return r.finished.IsZero() })
+	return runs, lastSuccess
+}
+
+// metricsOperation returns the operation label of sample, a sample of the
+// gauge name labelled by operation alone.
+func metricsOperation(sample, name string) (string, bool) {
+	rest, ok := strings.CutPrefix(sample, name+`{operation="`)
+	if !ok {
+		return "", false
+	}
+	return strings.CutSuffix(rest, `"}`)
+}
+
+func metricsTime(v float64) time.Time {
+	return time.UnixMilli(int64(math.Round(v * 1000)))
+}
+
+// metricFamily collects the samples of one gauge.
+type metricFamily struct {
+	name, help string
+	samples    []string
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// add appends a sample with the given label names and values, alternating.
+func (f *metricFamily) add(value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(f.name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	f.samples = append(f.samples, b.String())
+}
+
+// writeTo writes the family to b, unless it has no samples.
+func (f *metricFamily) writeTo(b *strings.Builder) {
+	if len(f.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", f.name, f.help, f.name)
+	for _, sample := range f.samples {
+		b.WriteString(sample)
+		b.WriteByte('\n')
+	}
+}
+
+func gaugeBool(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func gaugeTime(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
@@ -0,0 +1,183 @@
+package updex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/updex/download"
+	"github.com/frostyard/updex/internal/retry"
+)
+
+// TestMetricsFile verifies the metrics written after check and update runs:
+// versions and available updates from the run itself, downloads from the
+// last update, and the last run of each operation.
+func TestMetricsFile(t *testing.T) {
+	client, _, _, _ := stagingFixture(t)
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "updex.prom")
+	read := func() string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read metrics: %v", err)
+		}
+		return string(data)
+	}
+	const labels = `feature="testfeature",transfer="testext"`
+
+	if _, err := client.CheckFeatures(ctx, CheckFeaturesOptions{MetricsFile: path}); err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	metrics := read()
+	for _, want := range []string{
+		"# TYPE updex_transfer_info gauge\n",
+		`updex_transfer_info{` + labels + `,installed="1.0.0",newest="1.1.0"} 1` + "\n",
+		`updex_update_available{` + labels + `} 1` + "\n",
+		`updex_transfer_failed{` + labels + `} 0` + "\n",
+		`updex_retries{` + labels + `} 0` + "\n",
+		`updex_last_run_success{operation="check"} 1` + "\n",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics after check missing %q:\n%s", want, metrics)
+		}
+	}
+	if strings.Contains(metrics, "updex_download_bytes") || strings.Contains(metrics, "updex_last_success_timestamp_seconds") {
+		t.Errorf("metrics report an update before any was recorded:\n%s", metrics)
+	}
+
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true, Record: true, MetricsFile: path}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	metrics = read()
+	for _, want := range []string{
+		`updex_transfer_info{` + labels + `,installed="1.1.0",newest="1.1.0"} 1` + "\n",
+		`updex_update_available{` + labels + `} 0` + "\n",
+		fmt.Sprintf("updex_download_bytes{%s} %d\n", labels, len("ext v1.1.0")),
+		`updex_download_duration_seconds{` + labels + `} `,
+		`updex_last_run_success{operation="update"} 1` + "\n",
+		"updex_last_success_timestamp_seconds ",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics after update missing %q:\n%s", want, metrics)
+		}
+	}
+
+	// A later check keeps reporting the recorded update's downloads.
+	if _, err := client.CheckFeatures(ctx, CheckFeaturesOptions{MetricsFile: path}); err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	metrics = read()
+	for _, want := range []string{
+		fmt.Sprintf("updex_download_bytes{%s} %d\n", labels, len("ext v1.1.0")),
+		`updex_last_run_success{operation="check"} 1` + "\n",
+		`updex_last_run_success{operation="update"} 1` + "\n",
+		"updex_last_success_timestamp_seconds ",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics after a check following an update missing %q:\n%s", want, metrics)
+		}
+	}
+
+	// A dry run writes nothing.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{DryRun: true, MetricsFile: path}); err != nil {
+		t.Fatalf("UpdateFeatures(DryRun) failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote metrics: %v", err)
+	}
+}
+
+// TestMetricsFile_KeepsOtherOperation verifies that a run of one operation
+// keeps the last run of the other in the metrics file, even when no update
+// was recorded.
+func TestMetricsFile_KeepsOtherOperation(t *testing.T) {
+	client, _, _, _ := stagingFixture(t)
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "updex.prom")
+	read := func() string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read metrics: %v", err)
+		}
+		return string(data)
+	}
+
+	if _, err := client.CheckFeatures(ctx, CheckFeaturesOptions{MetricsFile: path}); err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	checked := read()
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true, MetricsFile: path}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	metrics := read()
+	for _, want := range []string{
+		`updex_last_run_success{operation="check"} 1` + "\n",
+		`updex_last_run_success{operation="update"} 1` + "\n",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics after update missing %q:\n%s", want, metrics)
+		}
+	}
+	// The check's timestamp is carried over as it was.
+	for line := range strings.Lines(checked) {
+		if strings.HasPrefix(line, `updex_last_run_timestamp_seconds{operation="check"}`) && !strings.Contains(metrics, line) {
+			t.Errorf("metrics after update changed %q:\n%s", line, metrics)
+		}
+	}
+
+	if _, err := client.CheckFeatures(ctx, CheckFeaturesOptions{MetricsFile: path}); err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	metrics = read()
+	for _, want := range []string{
+		`updex_last_run_success{operation="check"} 1` + "\n",
+		`updex_last_run_success{operation="update"} 1` + "\n",
+		"updex_last_success_timestamp_seconds ",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics after a check following an unrecorded update missing %q:\n%s", want, metrics)
+		}
+	}
+}
+
+func TestTransferStatsCountsVerificationFailures(t *testing.T) {
+	mismatch := fmt.Errorf("%w: expected a, got b", download.ErrHashMismatch)
+
+	var s transferStats
+	s.retried(retry.Transient(mismatch))
+	s.settle(nil)
+	s.retried(errors.New("connection reset"))
+	s.settle(errors.New("not found"))
+	s.observe(mismatch)
+	s.settle(fmt.Errorf("all 2 mirrors failed: %w", errors.Join(mismatch, mismatch)))
+	if s.retries != 2 || s.verificationFailures != 2 {
+		t.Errorf("stats = %+v, want 2 retries and 2 fetches that failed verification", s)
+	}
+
+	// Outside a job there are no stats to count in.
+	var none *transferStats
+	none.retried(mismatch)
+	none.received(1)
+	none.downloaded(0, mismatch)
+}
+
+func TestMetricFamilyEscapesLabels(t *testing.T) {
+	f := &metricFamily{name: "updex_transfer_info", help: "help"}
+	f.add(1, "feature", `a"b\c`+"\n")
+	f.add(0.5)
+	var b strings.Builder
+	f.writeTo(&b)
+	want := "# HELP updex_transfer_info help\n# TYPE updex_transfer_info gauge\n" +
+		`updex_transfer_info{feature="a\"b\\c\n"} 1` + "\nupdex_transfer_info 0.5\n"
+	if b.String() != want {
+		t.Errorf("family = %q, want %q", b.String(), want)
+	}
+}
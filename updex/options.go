@@ -1,9 +1,54 @@
 package updex
 
-import "github.com/frostyard/updex/manifest"
-
-// EnableDaemonOptions configures the EnableDaemon operation.
-type EnableDaemonOptions struct{}
+import "time"
+
+// EnableDaemonOptions configures the EnableDaemon operation. It describes
+// the whole installation: enabling again with other options reconfigures
+// the units in place, and a setting left zero returns to its default.
+type EnableDaemonOptions struct {
+	// DownloadRateLimit caps, in bytes per second, how fast the scheduled
+	// update downloads, independently of interactive runs. Zero means no
+	// limit.
+	DownloadRateLimit int64
+
+	// Schedule is the timer's OnCalendar= expression. Empty uses
+	// DefaultDaemonSchedule.
+	Schedule string
+
+	// RandomizedDelay spreads each run over this window, in whole seconds.
+	// Zero uses DefaultDaemonRandomizedDelay; a negative value disables it.
+	RandomizedDelay time.Duration
+
+	// OnBoot also runs an update this long after boot. Zero runs only on
+	// Schedule.
+	OnBoot time.Duration
+
+	// Accuracy is how far systemd may shift a run to coalesce wakeups.
+	// Zero keeps systemd's default of one minute.
+	Accuracy time.Duration
+
+	// Nice is the update service's CPU priority, -20 to 19. Zero leaves it
+	// unchanged.
+	Nice int
+
+	// IOSchedulingClass is the update service's I/O scheduling class:
+	// "realtime", "best-effort" or "idle". Empty leaves it unchanged.
+	IOSchedulingClass string
+
+	// CPUQuota caps the update service's CPU time as a percentage of one
+	// CPU. Zero means no cap.
+	CPUQuota int
+
+	// ApplyAtBoot makes scheduled updates only stage new versions, and
+	// installs an early-boot unit that applies them before systemd-sysext
+	// merges, so an update takes effect only across a reboot.
+	ApplyAtBoot bool
+
+	// MetricsFile makes scheduled updates write Prometheus metrics to this
+	// absolute path (see UpdateFeaturesOptions.MetricsFile). Empty writes
+	// none.
+	MetricsFile string
+}
 
 // DisableDaemonOptions configures the DisableDaemon operation.
 type DisableDaemonOptions struct{}
@@ -11,6 +56,13 @@ type DisableDaemonOptions struct{}
 // DaemonStatusOptions configures the DaemonStatus operation.
 type DaemonStatusOptions struct{}
 
+// RunHistoryOptions configures the RunHistory operation.
+type RunHistoryOptions struct {
+	// Limit returns at most this many runs, newest first. Zero returns
+	// every kept run.
+	Limit int
+}
+
 // UpdateFeaturesOptions configures the UpdateFeatures operation.
 type UpdateFeaturesOptions struct {
 	// DryRun previews changes without modifying filesystem.
@@ -26,6 +78,53 @@ type UpdateFeaturesOptions struct {
 	// component. Empty operates on the default domain: the union of the
 	// legacy default sysupdate.d directory and every discovered component.
 	Component string
+
+	// Workers bounds how many transfers are fetched and downloaded at once.
+	// Zero uses DefaultWorkers; 1 processes transfers one at a time.
+	Workers int
+
+	// Version installs exactly this version of every transfer in scope
+	// instead of the newest, downgrading if need be. A transfer whose
+	// source does not offer it fails. It applies to this run only: the
+	// next update without it moves to the newest version again (use
+	// PinFeature or MaxVersion= to hold a version).
+	Version string
+
+	// IgnorePhasing installs the newest version of every Phased= transfer
+	// even when its rollout has not reached this host yet. A Version or a
+	// pin is never held back by phasing.
+	IgnorePhasing bool
+
+	// Stage downloads and verifies new versions without installing them:
+	// the images wait, unlinked, until Apply. Nothing is refreshed or
+	// vacuumed.
+	Stage bool
+
+	// Record writes the run, its results and its error to the run history
+	// (see RunHistory) when it finishes. Dry runs are never recorded.
+	Record bool
+
+	// MetricsFile, if set, is replaced with Prometheus metrics for
+	// node_exporter's textfile collector when the run finishes. Dry runs
+	// write none.
+	MetricsFile string
+}
+
+// ApplyOptions configures the Apply operation.
+type ApplyOptions struct {
+	// DryRun reports what would be applied without changing anything.
+	DryRun bool
+
+	// NoRefresh skips running systemd-sysext refresh after applying, as
+	// the early-boot unit does: systemd-sysext merges after it.
+	NoRefresh bool
+
+	// NoVacuum skips removing old versions after applying.
+	NoVacuum bool
+
+	// Component scopes the operation to a single named systemd-sysupdate
+	// component (see UpdateFeaturesOptions.Component).
+	Component string
 }
 
 // CheckFeaturesOptions configures the CheckFeatures operation.
@@ -34,6 +133,57 @@ type CheckFeaturesOptions struct {
 	// component. Empty operates on the default domain: the union of the
 	// legacy default sysupdate.d directory and every discovered component.
 	Component string
+
+	// Workers bounds how many transfers are checked at once. Zero uses
+	// DefaultWorkers; 1 checks transfers one at a time.
+	Workers int
+
+	// MetricsFile, if set, is replaced with Prometheus metrics for
+	// node_exporter's textfile collector when the check finishes (see
+	// UpdateFeaturesOptions.MetricsFile).
+	MetricsFile string
+
+	// NoWebhooks skips notifying the webhook targets of the check, for
+	// callers that check on behalf of someone who may not send them.
+	NoWebhooks bool
+}
+
+// BundleExportOptions configures the BundleExport operation.
+type BundleExportOptions struct {
+	// Features names the features to bundle. Empty bundles every enabled
+	// feature.
+	Features []string
+
+	// Component scopes the operation to a single named systemd-sysupdate
+	// component. Empty operates on the default domain: the union of the
+	// legacy default sysupdate.d directory and every discovered component.
+	Component string
+}
+
+// BundleImportOptions configures the BundleImport operation.
+type BundleImportOptions struct {
+	// DryRun verifies the bundle and previews changes without modifying
+	// filesystem.
+	DryRun bool
+
+	// NoRefresh skips running systemd-sysext refresh after import.
+	NoRefresh bool
+
+	// NoVacuum skips removing old versions after import.
+	NoVacuum bool
+
+	// Component scopes the operation to a single named systemd-sysupdate
+	// component. Empty operates on the default domain: the union of the
+	// legacy default sysupdate.d directory and every discovered component.
+	Component string
+}
+
+// StatusOptions configures the Status operation.
+type StatusOptions struct {
+	// Component scopes the operation to a single named systemd-sysupdate
+	// component. Empty operates on the default domain: the union of the
+	// legacy default sysupdate.d directory and every discovered component.
+	Component string
 }
 
 // EnableFeatureOptions configures the EnableFeature operation.
@@ -51,6 +201,85 @@ type EnableFeatureOptions struct {
 	// component. Empty operates on the default domain: the union of the
 	// legacy default sysupdate.d directory and every discovered component.
 	Component string
+
+	// Version installs exactly this version instead of the newest, as
+	// UpdateFeaturesOptions.Version does. It requires Now.
+	Version string
+}
+
+// PinFeatureOptions configures the PinFeature operation.
+type PinFeatureOptions struct {
+	// DryRun previews changes without modifying filesystem.
+	DryRun bool
+
+	// Component scopes the operation to a single named systemd-sysupdate
+	// component. Empty operates on the default domain: the union of the
+	// legacy default sysupdate.d directory and every discovered component.
+	Component string
+}
+
+// RollbackFeatureOptions configures the RollbackFeature operation.
+type RollbackFeatureOptions struct {
+	// DryRun previews changes without modifying filesystem.
+	DryRun bool
+
+	// NoRefresh skips systemd-sysext refresh after relinking.
+	NoRefresh bool
+
+	// Component scopes the operation to a single named systemd-sysupdate
+	// component. Empty operates on the default domain: the union of the
+	// legacy default sysupdate.d directory and every discovered component.
+	Component string
+}
+
+// SwitchFeatureChannelOptions configures the SwitchFeatureChannel operation.
+type SwitchFeatureChannelOptions struct {
+	// DryRun previews changes without modifying filesystem.
+	DryRun bool
+
+	// NoRefresh skips systemd-sysext refresh after reconciling.
+	NoRefresh bool
+
+	// NoVacuum skips removing old versions after a download. Images newer
+	// than the new channel's version that it does not offer are removed
+	// regardless.
+	NoVacuum bool
+
+	// Component scopes the operation to a single named systemd-sysupdate
+	// component. Empty operates on the default domain: the union of the
+	// legacy default sysupdate.d directory and every discovered component.
+	Component string
+}
+
+// UnpinFeatureOptions configures the UnpinFeature operation.
+type UnpinFeatureOptions struct {
+	// DryRun previews changes without modifying filesystem.
+	DryRun bool
+
+	// Component scopes the operation to a single named systemd-sysupdate
+	// component. Empty operates on the default domain: the union of the
+	// legacy default sysupdate.d directory and every discovered component.
+	Component string
+}
+
+// installOutcome is what installTransfer reports about a transfer.
+type installOutcome struct {
+	// Version is the version selected for install.
+	Version string
+	// Downloaded reports whether an image was (or, in dry-run, would be)
+	// downloaded.
+	Downloaded bool
+	// SourceURL is the URL whose bytes were installed; empty when nothing
+	// was downloaded.
+	SourceURL string
+	// Relinked reports whether the version was already installed but the
+	// sysext link was (or, in dry-run, would be) pointed at it.
+	Relinked bool
+	// Staged reports whether the version was (or, in dry-run, would be)
+	// left staged for Apply rather than installed.
+	Staged bool
+	// Previous is the version that was current before, if any.
+	Previous string
 }
 
 // installTransferOptions configures the installTransfer operation.
@@ -64,8 +293,25 @@ type installTransferOptions struct {
 	// NoRefresh skips running systemd-sysext refresh after install.
 	NoRefresh bool
 
-	// CachedManifest, if non-nil, is used instead of fetching the manifest over HTTP.
-	CachedManifest *manifest.Manifest
+	// Version, if set, is installed and linked instead of the newest
+	// version, as if the transfer were pinned to it for this run.
+	Version string
+
+	// IgnorePhasing installs the newest version even when a phased
+	// rollout has not reached this host yet.
+	IgnorePhasing bool
+
+	// Stage downloads the selected version into the transfer's staging
+	// directory instead of installing and linking it.
+	Stage bool
+
+	// Manifests, if non-nil, shares fetched manifests with the other
+	// transfers of the same operation (see cachedAvailableVersions).
+	Manifests *manifestCache
+
+	// Feature is the feature the transfer is installed for, as hooks are
+	// told.
+	Feature string
 }
 
 // CatalogListOptions configures the CatalogList operation.
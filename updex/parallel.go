@@ -0,0 +1,203 @@
+package updex
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/frostyard/std/reporter"
+	"github.com/frostyard/updex/manifest"
+)
+
+// DefaultWorkers is how many transfers UpdateFeatures and CheckFeatures
+// process at once when their options leave Workers at zero.
+const DefaultWorkers = 4
+
+// runJobs calls fn for every index in [0, n) on at most workers goroutines
+// and returns once all calls have returned. workers below 1 means 1.
+func runJobs(workers, n int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers == 1 {
+		for i := range n {
+			fn(i)
+		}
+		return
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := range n {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			fn(i)
+		})
+	}
+	wg.Wait()
+}
+
+// jobLog keeps the output of concurrent jobs in job order, so a parallel run
+// reads like a sequential one. The earliest unfinished job (the head) writes
+// through to the client's reporter as it goes; later jobs are buffered and
+// replayed when every job before them has finished.
+type jobLog struct {
+	mu   sync.Mutex
+	out  reporter.Reporter
+	head int
+	jobs []jobBuffer
+}
+
+type jobBuffer struct {
+	entries []jobEntry
+	done    bool
+}
+
+type jobEntry struct {
+	warning bool
+	format  string
+	args    []any
+	event   *Event // set instead of the fields above for an Event
+}
+
+func newJobLog(out reporter.Reporter, n int) *jobLog {
+	return &jobLog{out: out, jobs: make([]jobBuffer, n)}
+}
+
+func (l *jobLog) write(i int, e jobEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i == l.head {
+		l.emit(e)
+		return
+	}
+	l.jobs[i].entries = append(l.jobs[i].entries, e)
+}
+
+func (l *jobLog) emit(e jobEntry) {
+	if e.event != nil {
+		if out, ok := l.out.(EventReporter); ok {
+			out.Event(*e.event)
+		} else if e.event.Warning {
+			l.out.Warning("%s", e.event.Message)
+		} else {
+			l.out.Message("%s", e.event.Message)
+		}
+		return
+	}
+	if e.warning {
+		l.out.Warning(e.format, e.args...)
+	} else {
+		l.out.Message(e.format, e.args...)
+	}
+}
+
+// finish marks job i done and replays the buffered output of every job that
+// thereby becomes the head.
+func (l *jobLog) finish(i int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.jobs[i].done = true
+	for l.head < len(l.jobs) && l.jobs[l.head].done {
+		l.head++
+		if l.head < len(l.jobs) {
+			for _, e := range l.jobs[l.head].entries {
+				l.emit(e)
+			}
+			l.jobs[l.head].entries = nil
+		}
+	}
+}
+
+func (l *jobLog) isHead(i int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return i == l.head
+}
+
+// jobReporter is the reporter one job writes through. Methods other than
+// Message, Warning and Event go straight to the client's reporter. When
+// that reporter takes Events, the job's messages reach it as Events naming
+// the job's feature and transfer.
+type jobReporter struct {
+	reporter.Reporter
+	log *jobLog
+	i   int
+	job transferJob
+}
+
+func (r jobReporter) Message(format string, args ...any) {
+	r.write(jobEntry{format: format, args: args})
+}
+
+func (r jobReporter) Warning(format string, args ...any) {
+	r.write(jobEntry{warning: true, format: format, args: args})
+}
+
+func (r jobReporter) Event(e Event) {
+	r.write(jobEntry{event: &e})
+}
+
+func (r jobReporter) write(e jobEntry) {
+	if _, ok := r.log.out.(EventReporter); ok {
+		if e.event == nil {
+			e.event = &Event{Warning: e.warning, Message: fmt.Sprintf(e.format, e.args...)}
+		}
+		if e.event.Feature == "" {
+			e.event.Feature = r.job.feature
+		}
+		if e.event.Transfer == "" {
+			e.event.Transfer = r.job.transfer.Component
+		}
+	}
+	r.log.write(r.i, e)
+}
+
+// forJob returns a copy of c for job i of log, working on job: its messages
+// go through the job's reporter, its work is counted in fresh stats, and its
+// downloads report progress only while the job is the head, so at most one
+// progress writer is active at a time.
+func (c *Client) forJob(log *jobLog, i int, job transferJob) *Client {
+	jc := *c
+	jc.reporter = jobReporter{Reporter: c.reporter, log: log, i: i, job: job}
+	jc.stats = &transferStats{}
+	if progress := c.config.OnDownloadProgress; progress != nil {
+		jc.config.OnDownloadProgress = func(total int64) io.Writer {
+			if !log.isHead(i) {
+				return nil
+			}
+			return progress(total)
+		}
+	}
+	return &jc
+}
+
+// manifestCache shares fetched manifests between the transfers of one
+// UpdateFeatures or CheckFeatures call, keyed by manifestCacheKey. Transfers
+// with the same key resolve one at a time, so concurrent workers still make a
+// single request per source and a transfer that requires verification still
+// refetches over an unverified entry (see getAvailableVersions).
+type manifestCache struct {
+	mu      sync.Mutex
+	entries map[string]*manifestCacheEntry
+}
+
+type manifestCacheEntry struct {
+	mu sync.Mutex
+	m  *manifest.Manifest
+}
+
+func newManifestCache() *manifestCache {
+	return &manifestCache{entries: make(map[string]*manifestCacheEntry)}
+}
+
+func (mc *manifestCache) entry(key string) *manifestCacheEntry {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	e, ok := mc.entries[key]
+	if !ok {
+		e = &manifestCacheEntry{}
+		mc.entries[key] = e
+	}
+	return e
+}
@@ -0,0 +1,245 @@
+package updex
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/frostyard/updex/sysext"
+)
+
+// recordingReporter records every message and warning, in the order the
+// client's reporter received them.
+type recordingReporter struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *recordingReporter) Message(format string, a ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, fmt.Sprintf(format, a...))
+}
+
+func (r *recordingReporter) Warning(format string, a ...any) {
+	r.Message("warning: "+format, a...)
+}
+
+// concurrentImageServer serves SHA256SUMS for components and, for each image,
+// holds the response until want downloads are in flight at once (or half a second
+// has passed), so a test can observe that downloads overlap. It counts
+// SHA256SUMS requests and records the most downloads seen in flight.
+func concurrentImageServer(t *testing.T, components []string, want int32) (server *httptest.Server, manifestRequests, maxInFlight *atomic.Int32) {
+	t.Helper()
+	content := map[string][]byte{}
+	for _, c := range components {
+		content[c+"_1.0.0.raw"] = []byte(c + " extension content")
+	}
+	manifestRequests, maxInFlight = &atomic.Int32{}, &atomic.Int32{}
+	var inFlight atomic.Int32
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		if path == "SHA256SUMS" {
+			manifestRequests.Add(1)
+			for name, data := range content {
+				_, _ = fmt.Fprintf(w, "%s  %s\n", hashContent(data), name)
+			}
+			return
+		}
+		data, ok := content[path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			if peak := maxInFlight.Load(); n <= peak || maxInFlight.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		deadline := time.Now().Add(500 * time.Millisecond)
+		for maxInFlight.Load() < want && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server, manifestRequests, maxInFlight
+}
+
+// TestUpdateFeatures_ParallelKeepsOrder pins the concurrency contract: with
+// Workers > 1 downloads overlap, yet results and reporter output follow
+// feature and transfer order exactly as a sequential run would, transfers
+// sharing a source still fetch SHA256SUMS once, and refresh stays a single
+// batched call at the end.
+func TestUpdateFeatures_ParallelKeepsOrder(t *testing.T) {
+	components := map[string][]string{"alpha": {"a1", "a2"}, "beta": {"b1"}, "gamma": {"c1"}}
+	server, manifestRequests, maxInFlight := concurrentImageServer(t, []string{"a1", "a2", "b1", "c1"}, 3)
+
+	configDir := t.TempDir()
+	targetDir := t.TempDir()
+	for feature, comps := range components {
+		createFeatureFile(t, configDir, feature, true)
+		for _, c := range comps {
+			writeCheckTransfer(t, configDir, c, feature, server.URL, targetDir, false)
+		}
+	}
+
+	rec := &recordingReporter{}
+	runner := &sysext.MockRunner{}
+	client := NewClient(ClientConfig{
+		Definitions:  configDir,
+		Progress:     rec,
+		SysextRunner: runner,
+		Paths: RuntimePaths{
+			DefinitionRoots:  []string{t.TempDir()},
+			SysextLinkDir:    t.TempDir(),
+			RunExtensionsDir: t.TempDir(),
+		},
+	})
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{Workers: 3})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+
+	var got []string
+	for _, fr := range results {
+		for _, r := range fr.Results {
+			if r.Error != "" || !r.Downloaded {
+				t.Errorf("%s/%s: result = %+v, want downloaded", fr.Feature, r.Component, r)
+			}
+			got = append(got, fr.Feature+"/"+r.Component)
+		}
+	}
+	want := []string{"alpha/a1", "alpha/a2", "beta/b1", "gamma/c1"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("result order = %v, want %v", got, want)
+	}
+
+	var processing []string
+	for _, line := range rec.lines {
+		if name, ok := strings.CutPrefix(line, "Processing "); ok {
+			processing = append(processing, name)
+		}
+	}
+	if fmt.Sprint(processing) != fmt.Sprint(want) {
+		t.Errorf("reported order = %v, want %v", processing, want)
+	}
+
+	if peak := maxInFlight.Load(); peak < 2 {
+		t.Errorf("at most %d download(s) in flight, want overlapping downloads", peak)
+	}
+	if n := manifestRequests.Load(); n != 1 {
+		t.Errorf("SHA256SUMS requested %d times for one shared source, want 1", n)
+	}
+	if !runner.RefreshCalled {
+		t.Error("expected the batched refresh to run after all jobs")
+	}
+}
+
+func TestUpdateFeatures_SingleWorkerIsSequential(t *testing.T) {
+	server, _, maxInFlight := concurrentImageServer(t, []string{"a1", "a2"}, 2)
+
+	configDir := t.TempDir()
+	targetDir := t.TempDir()
+	createFeatureFile(t, configDir, "alpha", true)
+	writeCheckTransfer(t, configDir, "a1", "alpha", server.URL, targetDir, false)
+	writeCheckTransfer(t, configDir, "a2", "alpha", server.URL, targetDir, false)
+
+	client := NewClient(ClientConfig{
+		Definitions:  configDir,
+		SysextRunner: &sysext.MockRunner{},
+		Paths:        RuntimePaths{DefinitionRoots: []string{t.TempDir()}, SysextLinkDir: t.TempDir()},
+	})
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true, Workers: 1}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if peak := maxInFlight.Load(); peak != 1 {
+		t.Errorf("%d downloads in flight with Workers=1, want 1", peak)
+	}
+}
+
+// TestUpdateFeatures_SharedTransferUpdatedOnce verifies that a transfer
+// owned by two enabled features is downloaded and installed by one job even
+// with several workers, and that both features report its result.
+func TestUpdateFeatures_SharedTransferUpdatedOnce(t *testing.T) {
+	data := []byte("shared extension content")
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/") {
+		case "SHA256SUMS":
+			_, _ = fmt.Fprintf(w, "%s  shared_1.0.0.raw\n", hashContent(data))
+		case "shared_1.0.0.raw":
+			downloads.Add(1)
+			time.Sleep(50 * time.Millisecond) // let a second job overlap
+			_, _ = w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	configDir := t.TempDir()
+	createFeatureFile(t, configDir, "alpha", true)
+	createFeatureFile(t, configDir, "beta", true)
+	writeCheckTransfer(t, configDir, "shared", "alpha beta", server.URL, t.TempDir(), false)
+
+	runner := &sysext.MockRunner{}
+	client := NewClient(ClientConfig{
+		Definitions:  configDir,
+		SysextRunner: runner,
+		Paths:        RuntimePaths{DefinitionRoots: []string{t.TempDir()}, SysextLinkDir: t.TempDir()},
+	})
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{Workers: 2})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if n := downloads.Load(); n != 1 {
+		t.Errorf("image downloaded %d times, want 1", n)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d feature results, want alpha and beta", len(results))
+	}
+	for _, fr := range results {
+		if len(fr.Results) != 1 || !fr.Results[0].Downloaded || fr.Results[0].Version != "1.0.0" {
+			t.Errorf("%s results = %+v, want shared 1.0.0 downloaded", fr.Feature, fr.Results)
+		}
+	}
+}
+
+// TestJobLogKeepsJobOrder covers output from jobs that finish out of order:
+// the head writes through, later jobs are replayed once their predecessors
+// finish, and only the head may report download progress.
+func TestJobLogKeepsJobOrder(t *testing.T) {
+	rec := &recordingReporter{}
+	log := newJobLog(rec, 3)
+
+	log.write(2, jobEntry{format: "two"})
+	log.write(0, jobEntry{format: "zero"})
+	log.write(1, jobEntry{warning: true, format: "one"})
+	if !log.isHead(0) || log.isHead(1) {
+		t.Fatal("job 0 must be the head until it finishes")
+	}
+	if fmt.Sprint(rec.lines) != "[zero]" {
+		t.Fatalf("lines before any job finished = %q, want only the head's", rec.lines)
+	}
+
+	log.finish(2)
+	log.finish(0)
+	if !log.isHead(1) {
+		t.Error("job 1 must be the head once job 0 finished")
+	}
+	log.write(1, jobEntry{format: "one again"})
+	log.finish(1)
+
+	want := []string{"zero", "warning: one", "one again", "two"}
+	if fmt.Sprint(rec.lines) != fmt.Sprint(want) {
+		t.Errorf("lines = %q, want %q", rec.lines, want)
+	}
+}
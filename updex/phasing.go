@@ -0,0 +1,43 @@
+package updex
+
+import (
+	"slices"
+
+	"github.com/frostyard/updex/config"
+	"github.com/frostyard/updex/manifest"
+	"github.com/frostyard/updex/version"
+)
+
+// phase splits available, sorted newest first, into the versions this host
+// accepts and the newest version phasing holds back from it, if that is
+// newer than every accepted one. Only a Phased= transfer is phased, and
+// never a version already installed: a host keeps what it has.
+//
+// Callers skip phasing when a version is asked for explicitly, by a pin or
+// UpdateFeaturesOptions.Version.
+func (c *Client) phase(t *config.Transfer, m *manifest.Manifest, patterns []*version.Pattern, available, installed []string) (accepted []string, heldBack string) {
+	if !t.Transfer.Phased || len(m.Rollout) == 0 {
+		return available, ""
+	}
+
+	machineID := config.MachineIDFrom(c.paths.machineIDPath)
+	if machineID == "" {
+		c.debug("no machine ID in %s; only fully rolled out versions are accepted", c.paths.machineIDPath)
+	}
+	for _, v := range available {
+		if slices.Contains(installed, v) {
+			accepted = append(accepted, v)
+			continue
+		}
+		filename, _, err := sourceFileFor(m, patterns, v)
+		if err == nil && !m.RolloutCovers(machineID, filename) {
+			c.debug("%s %s is rolled out to %d%% of hosts, not yet this one", t.Component, v, m.RolloutPercent(filename))
+			if heldBack == "" && len(accepted) == 0 {
+				heldBack = v
+			}
+			continue
+		}
+		accepted = append(accepted, v)
+	}
+	return accepted, heldBack
+}
@@ -0,0 +1,145 @@
+package updex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/updex/internal/testutil"
+	"github.com/frostyard/updex/sysext"
+)
+
+// phasingFixture serves testext 1.0.0 and 1.1.0 with a ROLLOUT sidecar
+// holding 1.1.0 at rollout percent, and defines testfeature (enabled) with
+// a Phased=yes transfer. The client reads its machine ID from machineID
+// written to a temp file. It returns the client and the sysext link path.
+func phasingFixture(t *testing.T, rollout, machineID string) (client *Client, linkPath string) {
+	t.Helper()
+	root := t.TempDir()
+	defDir := filepath.Join(root, "sysupdate.d")
+	targetDir := t.TempDir()
+	linkDir := t.TempDir()
+
+	v1, v11 := []byte("ext v1.0.0"), []byte("ext v1.1.0")
+	server := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Files: map[string]string{"testext_1.0.0.raw": hashContent(v1), "testext_1.1.0.raw": hashContent(v11)},
+		Content: map[string][]byte{
+			"testext_1.0.0.raw": v1,
+			"testext_1.1.0.raw": v11,
+			"ROLLOUT":           []byte(rollout + "  testext_1.1.0.raw\n"),
+		},
+	})
+	t.Cleanup(server.Close)
+
+	writeComponentFeature(t, defDir, "testfeature", true)
+	createFeatureTransferFileWithoutCurrentSymlink(t, defDir, "testext", "testfeature", server.URL, targetDir)
+	transferPath := filepath.Join(defDir, "testext.transfer")
+	data, err := os.ReadFile(transferPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phased := strings.Replace(string(data), "[Transfer]\n", "[Transfer]\nPhased=yes\n", 1)
+	if err := os.WriteFile(transferPath, []byte(phased), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	machineIDPath := filepath.Join(t.TempDir(), "machine-id")
+	if err := os.WriteFile(machineIDPath, []byte(machineID+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client = NewClient(ClientConfig{
+		Paths: RuntimePaths{
+			DefinitionRoots: []string{root},
+			SysextLinkDir:   linkDir,
+			MachineIDPath:   machineIDPath,
+		},
+		SysextRunner: &sysext.DefaultRunner{},
+	})
+	return client, filepath.Join(linkDir, "testext.raw")
+}
+
+// TestPhasing_HoldsBackUntilCovered verifies that a version whose rollout
+// does not cover the host is neither installed nor reported as an update,
+// but as held back, and that IgnorePhasing installs it anyway.
+func TestPhasing_HoldsBackUntilCovered(t *testing.T) {
+	client, linkPath := phasingFixture(t, "0", "0123456789abcdef0123456789abcdef")
+	ctx := t.Context()
+
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+
+	checks, err := client.CheckFeatures(ctx, CheckFeaturesOptions{})
+	if err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	want := CheckResult{Component: "testext", CurrentVersion: "1.0.0", NewestVersion: "1.0.0", HeldBackVersion: "1.1.0"}
+	if c := checks[0].Results[0]; c != want {
+		t.Errorf("CheckFeatures = %+v, want %+v", c, want)
+	}
+
+	results, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true, IgnorePhasing: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures(IgnorePhasing) failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Version != "1.1.0" || !r.Downloaded {
+		t.Errorf("IgnorePhasing result = %+v, want 1.1.0 downloaded", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.1.0.raw")
+
+	// Once installed, a held-back version is kept rather than downgraded.
+	results, err = client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Version != "1.1.0" || r.Downloaded || r.Relinked {
+		t.Errorf("update after IgnorePhasing = %+v, want 1.1.0 kept", r)
+	}
+	checks, err = client.CheckFeatures(ctx, CheckFeaturesOptions{})
+	if err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	if c := checks[0].Results[0]; c.NewestVersion != "1.1.0" || c.HeldBackVersion != "" || c.UpdateAvailable {
+		t.Errorf("CheckFeatures after IgnorePhasing = %+v, want 1.1.0 current and nothing held back", c)
+	}
+}
+
+// TestPhasing_Rollout covers how the rollout percentage and the machine ID
+// decide whether 1.1.0 is installed.
+func TestPhasing_Rollout(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		rollout   string
+		machineID string
+		want      string
+	}{
+		{name: "fully rolled out", rollout: "100", machineID: "0123456789abcdef0123456789abcdef", want: "1.1.0"},
+		{name: "no machine ID", rollout: "99", machineID: "", want: "1.0.0"},
+		{name: "no machine ID, fully rolled out", rollout: "100", machineID: "", want: "1.1.0"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, linkPath := phasingFixture(t, tt.rollout, tt.machineID)
+			if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+				t.Fatalf("UpdateFeatures failed: %v", err)
+			}
+			assertLinkedTo(t, linkPath, "testext_"+tt.want+".raw")
+		})
+	}
+}
+
+// TestPhasing_PinIsNotHeldBack verifies that an explicit version bypasses
+// phasing.
+func TestPhasing_PinIsNotHeldBack(t *testing.T) {
+	client, linkPath := phasingFixture(t, "0", "0123456789abcdef0123456789abcdef")
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true, Version: "1.1.0"})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Version != "1.1.0" {
+		t.Errorf("result = %+v, want 1.1.0", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.1.0.raw")
+}
@@ -1,5 +1,7 @@
 package updex
 
+import "time"
+
 // DaemonActionResult represents the result of enabling or disabling the
 // automatic update daemon.
 type DaemonActionResult struct {
@@ -8,29 +10,114 @@ type DaemonActionResult struct {
 }
 
 // DaemonStatusResult represents the automatic update daemon's current state.
+// The settings are read from the installed unit files; durations are in
+// seconds.
 type DaemonStatusResult struct {
-	Installed bool   `json:"installed"`
-	Enabled   bool   `json:"enabled"`
-	Active    bool   `json:"active"`
-	Schedule  string `json:"schedule,omitempty"`
+	Installed          bool   `json:"installed"`
+	Enabled            bool   `json:"enabled"`
+	Active             bool   `json:"active"`
+	Schedule           string `json:"schedule,omitempty"`
+	RandomizedDelaySec int    `json:"randomized_delay_sec,omitempty"`
+	OnBootSec          int    `json:"on_boot_sec,omitempty"`
+	AccuracySec        int    `json:"accuracy_sec,omitempty"`
+	Nice               int    `json:"nice,omitempty"`
+	IOSchedulingClass  string `json:"io_scheduling_class,omitempty"`
+	CPUQuota           int    `json:"cpu_quota,omitempty"`
+	DownloadRateLimit  int64  `json:"download_rate_limit,omitempty"`
+	ApplyAtBoot        bool   `json:"apply_at_boot,omitempty"`
+	MetricsFile        string `json:"metrics_file,omitempty"`
+	// NextTrigger is when the timer next starts an update; zero when it
+	// is not scheduled or systemd cannot tell.
+	NextTrigger time.Time `json:"next_trigger,omitzero"`
+	// LastRun is the most recent recorded update (see RunHistory),
+	// scheduled or not; LastSuccess is when the most recent successful
+	// one finished.
+	LastRun     *RunRecord `json:"last_run,omitempty"`
+	LastSuccess time.Time  `json:"last_success,omitzero"`
+	// Modified reports that the unit files, including the apply-at-boot
+	// unit, are not what EnableDaemon writes: they were edited outside
+	// updex, so the settings above may be incomplete and EnableDaemon
+	// refuses to reconfigure them.
+	Modified bool `json:"modified,omitempty"`
+}
+
+// RunRecord is one recorded UpdateFeatures run (see
+// UpdateFeaturesOptions.Record). Success is false when the run returned an
+// error, which Error then holds; Results are what it returned, so a failed
+// run still lists the transfers it did update.
+type RunRecord struct {
+	ID         string                 `json:"id"`
+	StartedAt  time.Time              `json:"started_at"`
+	FinishedAt time.Time              `json:"finished_at"`
+	Component  string                 `json:"component,omitempty"`
+	Success    bool                   `json:"success"`
+	Error      string                 `json:"error,omitempty"`
+	Results    []UpdateFeaturesResult `json:"results"`
+}
+
+// WebhookPayload is the JSON body POSTed to webhook targets after an
+// UpdateFeatures or CheckFeatures run. Event is webhook.EventUpdate or
+// webhook.EventCheck, and Results the []UpdateFeaturesResult or
+// []CheckFeaturesResult the run returned. Success is false when the run
+// returned an error, which Error then holds.
+type WebhookPayload struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	Host      HostInfo  `json:"host"`
+	Component string    `json:"component,omitempty"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+	Results   any       `json:"results"`
+}
+
+// HostInfo identifies the host a webhook payload comes from: its hostname,
+// machine ID, and the os-release fields naming the OS and image it runs.
+// Fields the host does not provide are empty.
+type HostInfo struct {
+	Hostname     string `json:"hostname,omitempty"`
+	MachineID    string `json:"machine_id,omitempty"`
+	OSID         string `json:"os_id,omitempty"`
+	OSVersionID  string `json:"os_version_id,omitempty"`
+	VariantID    string `json:"variant_id,omitempty"`
+	ImageID      string `json:"image_id,omitempty"`
+	ImageVersion string `json:"image_version,omitempty"`
 }
 
 // CheckResult represents the result of a check operation for a single component.
 type CheckResult struct {
-	Component       string `json:"component"`
-	CurrentVersion  string `json:"current_version,omitempty"`
-	NewestVersion   string `json:"newest_version"`
+	Component      string `json:"component"`
+	CurrentVersion string `json:"current_version,omitempty"`
+	NewestVersion  string `json:"newest_version"`
+	// PinnedVersion is the version the component is pinned to (see
+	// PinFeature). UpdateAvailable then reports whether the installed
+	// version differs from it, rather than whether a newer one exists.
+	PinnedVersion   string `json:"pinned_version,omitempty"`
 	UpdateAvailable bool   `json:"update_available"`
+	// HeldBackVersion is the newest version a phased rollout (see the
+	// Phased= transfer key) has not reached this host with yet, when it is
+	// newer than NewestVersion, the newest one the host accepts. It does
+	// not count as an update: UpdateAvailable only considers NewestVersion.
+	HeldBackVersion string `json:"held_back_version,omitempty"`
+	// StagedVersion is the version a staged update left waiting for
+	// Apply, if any.
+	StagedVersion string `json:"staged_version,omitempty"`
 	// Error is set when the component could not be checked (manifest fetch,
 	// signature verification, pattern failure, or installed-version listing).
 	// UpdateAvailable is always false in that case; other fields may be empty,
 	// except NewestVersion may be set if the failure happens after reading the manifest.
 	Error string `json:"error,omitempty"`
+	// Retries counts the requests for this component that were retried.
+	// VerificationFailures counts its manifests that failed signature
+	// verification from any source or mirror.
+	Retries              int `json:"retries,omitempty"`
+	VerificationFailures int `json:"verification_failures,omitempty"`
 }
 
 // UpdateResult represents the result of an update operation for a single component.
 type UpdateResult struct {
-	Component         string   `json:"component"`
+	Component string `json:"component"`
+	// FromVersion is the version that was current before the update.
+	FromVersion       string   `json:"from_version,omitempty"`
 	Version           string   `json:"version"`
 	Downloaded        bool     `json:"downloaded"`
 	Installed         bool     `json:"installed"`
@@ -38,6 +125,49 @@ type UpdateResult struct {
 	Error             string   `json:"error,omitempty"`
 	NextActionMessage string   `json:"next_action_message,omitempty"`
 	RemovedVersions   []string `json:"removed_versions,omitzero"`
+	// SourceURL is the URL the installed image was downloaded from: the
+	// source itself or, after a failover, the mirror that served it. Empty
+	// when nothing was downloaded.
+	SourceURL string `json:"source_url,omitempty"`
+	// Relinked is set when the version was already staged and the sysext
+	// link was (or, in dry-run, would be) switched to it without a
+	// download, e.g. returning to an older version.
+	Relinked bool `json:"relinked,omitempty"`
+	// Staged is set when the version was downloaded and verified, or
+	// already was, but left staged: it becomes current only after Apply.
+	// Installed is false then.
+	Staged bool `json:"staged,omitempty"`
+	// DownloadBytes and DownloadSeconds are the bytes read and the time
+	// spent downloading the image, failed attempts and mirrors included.
+	DownloadBytes   int64   `json:"download_bytes,omitempty"`
+	DownloadSeconds float64 `json:"download_seconds,omitempty"`
+	// Retries counts the requests for this component that were retried.
+	// VerificationFailures counts its manifests and images that failed
+	// signature, hash or size verification from any source or mirror.
+	Retries              int `json:"retries,omitempty"`
+	VerificationFailures int `json:"verification_failures,omitempty"`
+	// HealthCheckError is set when the version was activated but its
+	// feature then failed its health checks. Error carries it too.
+	HealthCheckError string `json:"health_check_error,omitempty"`
+	// Reverted is set when, after a failed health check, the link was
+	// pointed back at FromVersion (or removed when empty) and systemd-sysext
+	// refreshed again. Version stays installed but is skipped from then on.
+	Reverted bool `json:"reverted,omitempty"`
+}
+
+// ApplyResult represents the result of applying one component's staged
+// version.
+type ApplyResult struct {
+	Feature   string `json:"feature"`
+	Component string `json:"component"`
+	// FromVersion is the version that was current before applying.
+	FromVersion string `json:"from_version,omitempty"`
+	// Version is the staged version applied. The link follows the usual
+	// rules, so a version since pinned away from or rolled back from is
+	// installed but not made current.
+	Version string `json:"version"`
+	DryRun  bool   `json:"dry_run,omitempty"`
+	Error   string `json:"error,omitempty"`
 }
 
 // UpdateFeaturesResult represents the result of updating all enabled features.
@@ -52,6 +182,37 @@ type CheckFeaturesResult struct {
 	Results []CheckResult `json:"results"`
 }
 
+// BundleExportResult represents the result of exporting an offline bundle.
+type BundleExportResult struct {
+	Path     string        `json:"path"`
+	Features []string      `json:"features"`
+	Images   []BundleImage `json:"images"`
+}
+
+// BundleImage is one image carried by a bundle.
+type BundleImage struct {
+	Component string `json:"component"`
+	Version   string `json:"version"`
+	File      string `json:"file"`
+}
+
+// ImageStatus represents one installed image and whether its mode and
+// read-only state still match its transfer's Target.Mode and ReadOnly.
+type ImageStatus struct {
+	Component string `json:"component"`
+	Version   string `json:"version"`
+	Path      string `json:"path"`
+	Current   bool   `json:"current"`
+	// Mode is the image's permission bits in octal, e.g. "0644".
+	Mode string `json:"mode"`
+	// ReadOnly reports whether the image is immutable or has no write
+	// permission bits.
+	ReadOnly bool `json:"read_only"`
+	// Drift lists each way the image differs from its transfer; it is
+	// empty when the image matches.
+	Drift []string `json:"drift,omitzero"`
+}
+
 // Feature origin kinds reported in FeatureInfo.Origin. Kind and name are
 // kept separate so consumers can match on the kind without having to
 // disambiguate a catalog legitimately named "image" or "local".
@@ -81,6 +242,13 @@ type FeatureInfo struct {
 	Origin        string   `json:"origin"`
 	OriginName    string   `json:"origin_name,omitempty"`
 	Transfers     []string `json:"transfers,omitzero"`
+	// PinnedVersion is the version the feature's transfers are held at
+	// (see PinFeature); empty when the feature is not pinned.
+	PinnedVersion string `json:"pinned_version,omitempty"`
+	// Channel is the release channel the feature selects (see
+	// SwitchFeatureChannel); empty when it selects none, in which case its
+	// transfers follow config.DefaultChannel.
+	Channel string `json:"channel,omitempty"`
 }
 
 // CatalogEntry represents one sysext available from a configured catalog repo.
@@ -112,6 +280,49 @@ type CatalogRemoveResult struct {
 	Disable      *FeatureActionResult `json:"disable,omitempty"`
 }
 
+// RollbackFeatureResult represents the result of a feature rollback.
+type RollbackFeatureResult struct {
+	Feature           string           `json:"feature"`
+	Success           bool             `json:"success"`
+	DropIn            string           `json:"drop_in,omitempty"`
+	Error             string           `json:"error,omitempty"`
+	NextActionMessage string           `json:"next_action_message,omitempty"`
+	DryRun            bool             `json:"dry_run,omitempty"`
+	Results           []RollbackResult `json:"results,omitzero"`
+	// RefreshError is set when every link was switched but the final
+	// `systemd-sysext refresh` failed; Success is false and Error carries
+	// the same message.
+	RefreshError string `json:"refresh_error,omitempty"`
+}
+
+// RollbackResult is the rollback of a single transfer.
+type RollbackResult struct {
+	Component   string `json:"component"`
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+}
+
+// SwitchFeatureChannelResult represents the result of switching a feature's
+// release channel.
+type SwitchFeatureChannelResult struct {
+	Feature           string `json:"feature"`
+	Channel           string `json:"channel"`
+	PreviousChannel   string `json:"previous_channel,omitempty"`
+	Success           bool   `json:"success"`
+	DropIn            string `json:"drop_in,omitempty"`
+	Error             string `json:"error,omitempty"`
+	NextActionMessage string `json:"next_action_message,omitempty"`
+	DryRun            bool   `json:"dry_run,omitempty"`
+	// Results holds the reconciliation of each transfer of an enabled
+	// feature; RemovedVersions includes the images of the previous channel
+	// that were removed.
+	Results []UpdateResult `json:"results,omitzero"`
+	// RefreshError is set when every transfer was reconciled but the final
+	// `systemd-sysext refresh` failed; Success is false and Error carries
+	// the same message.
+	RefreshError string `json:"refresh_error,omitempty"`
+}
+
 // FeatureActionResult represents the result of a feature enable/disable action.
 type FeatureActionResult struct {
 	Feature           string   `json:"feature"`
@@ -131,4 +342,8 @@ type FeatureActionResult struct {
 	// preceding unmerge already ran, so until that refresh happens every
 	// extension on the host stays unmerged.
 	RefreshError string `json:"refresh_error,omitempty"`
+	// Reverted is set when Now activated the feature's transfers but the
+	// feature failed its health checks, so they were pointed back at their
+	// previous versions. Success is false and Error says why.
+	Reverted bool `json:"reverted,omitempty"`
 }
@@ -0,0 +1,153 @@
+package updex
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/frostyard/updex/config"
+	"github.com/frostyard/updex/sysext"
+	"github.com/frostyard/updex/version"
+)
+
+// RollbackFeature points each of a feature's transfers back at the newest
+// version older than the current one that is still installed, then
+// refreshes systemd-sysext. The versions rolled back from are recorded in
+// the feature's updex-owned drop-in (SkipVersions= in [X-Updex]) so that
+// UpdateFeatures neither reinstalls nor relinks them; a newer release is
+// installed as usual.
+//
+// Nothing is changed unless every transfer has an older version to return
+// to. A pinned feature is refused: its pin already decides the version.
+func (c *Client) RollbackFeature(ctx context.Context, name string, opts RollbackFeatureOptions) (*RollbackFeatureResult, error) {
+	c.msg("Rolling back %s", name)
+
+	result := &RollbackFeatureResult{
+		Feature: name,
+		DryRun:  opts.DryRun,
+	}
+	fail := func(err error) (*RollbackFeatureResult, error) {
+		result.Error = err.Error()
+		c.warn("%s", result.Error)
+		return result, err
+	}
+
+	_, unlock, err := c.lock(ctx, !opts.DryRun)
+	if err != nil {
+		return fail(err)
+	}
+	defer unlock()
+
+	features, transfers, err := c.loadDomain(opts.Component)
+	if err != nil {
+		return fail(err)
+	}
+
+	f, err := lookupFeature(features, name, "rolled back")
+	if err != nil {
+		return fail(err)
+	}
+	if !f.Enabled {
+		return fail(fmt.Errorf("feature '%s' is not enabled", name))
+	}
+	if f.PinVersion != "" {
+		return fail(fmt.Errorf("feature '%s' is pinned to %s; unpin it or pin another version instead", name, f.PinVersion))
+	}
+
+	featureTransfers := config.GetTransfersForFeature(transfers, name)
+	if len(featureTransfers) == 0 {
+		return fail(fmt.Errorf("feature '%s' has no transfers", name))
+	}
+
+	// Plan every transfer before touching anything, so a feature is never
+	// left half rolled back because one component has nothing to return to.
+	for _, t := range featureTransfers {
+		if pin := t.Transfer.PinVersion; pin != "" {
+			return fail(fmt.Errorf("%s is pinned to %s by its transfer file", t.Component, pin))
+		}
+		installed, current, err := sysext.GetInstalledVersionsAt(t, c.paths.sysextLinkDir)
+		if err != nil {
+			return fail(fmt.Errorf("failed to inspect installed versions of %s: %w", t.Component, err))
+		}
+		if current == "" {
+			return fail(fmt.Errorf("%s is not installed", t.Component))
+		}
+		previous := previousVersion(t, installed, current)
+		if previous == "" {
+			return fail(fmt.Errorf("no version of %s older than %s is installed", t.Component, current))
+		}
+		result.Results = append(result.Results, RollbackResult{
+			Component:   t.Component,
+			FromVersion: current,
+			ToVersion:   previous,
+		})
+	}
+
+	if opts.DryRun {
+		for _, r := range result.Results {
+			c.msg("Would roll back %s from %s to %s", r.Component, r.FromVersion, r.ToVersion)
+		}
+		result.Success = true
+		result.NextActionMessage = fmt.Sprintf("Dry run complete. Would roll back feature '%s'", name)
+		return result, nil
+	}
+
+	// Record the bad versions first: should linking fail part-way, the next
+	// update still links the previous versions rather than the bad ones.
+	dropInFile, err := c.updateFeatureDropIn(f, false, func(d *config.FeatureDropIn) {
+		for _, r := range result.Results {
+			if entry := config.SkipVersionEntry(r.Component, r.FromVersion); !slices.Contains(d.SkipVersions, entry) {
+				d.SkipVersions = append(d.SkipVersions, entry)
+			}
+		}
+	})
+	if err != nil {
+		return fail(err)
+	}
+	result.DropIn = dropInFile
+
+	for i, shared := range featureTransfers {
+		r := result.Results[i]
+		// A copy, so the skip does not outlive the rollback in memory.
+		t := *shared
+		t.Transfer.SkipVersions = append(slices.Clone(t.Transfer.SkipVersions), r.FromVersion)
+		if t.Target.CurrentSymlink != "" {
+			if err := sysext.RemoveLegacyCurrentSymlinkAt(&t, c.paths.sysextLinkDir); err != nil {
+				return fail(fmt.Errorf("failed to remove legacy symlink for %s: %w", t.Component, err))
+			}
+		}
+		if err := c.linkToSysext(&t); err != nil {
+			return fail(err)
+		}
+		c.msg("Rolled back %s from %s to %s", r.Component, r.FromVersion, r.ToVersion)
+	}
+
+	if !opts.NoRefresh {
+		c.msg("Refreshing sysext")
+		if err := c.runner.Refresh(); err != nil {
+			err = fmt.Errorf("sysext refresh failed: %w", err)
+			c.warn("%s", err)
+			result.RefreshError = err.Error()
+			result.Error = err.Error()
+			result.NextActionMessage = fmt.Sprintf("Feature '%s' rolled back, but systemd-sysext refresh failed; run 'systemd-sysext refresh' (or reboot) to activate the previous versions", name)
+			return result, err
+		}
+	}
+
+	result.Success = true
+	result.NextActionMessage = fmt.Sprintf("Feature '%s' rolled back. The versions rolled back from will not be reinstalled.", name)
+	return result, nil
+}
+
+// previousVersion returns the newest of installed that is older than
+// current and not itself rolled back from, or "" when there is none.
+func previousVersion(t *config.Transfer, installed []string, current string) string {
+	candidates := slices.Clone(installed)
+	version.Sort(candidates)
+	for _, v := range candidates {
+		if version.Compare(v, current) < 0 && !slices.Contains(t.Transfer.SkipVersions, v) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,213 @@
+package updex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rollbackFixture stages testext 1.0.0 and 2.0.0 through pinFixture, with
+// 2.0.0 linked and current, and returns what pinFixture returns plus the
+// sysext link path.
+func rollbackFixture(t *testing.T) (client *Client, root, targetDir, linkPath string) {
+	t.Helper()
+	client, root, targetDir, linkDir := pinFixture(t)
+	ctx := t.Context()
+	if _, err := client.PinFeature(ctx, "testfeature", "1.0.0", PinFeatureOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UnpinFeature(ctx, "testfeature", UnpinFeatureOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatal(err)
+	}
+	linkPath = filepath.Join(linkDir, "testext.raw")
+	assertLinkedTo(t, linkPath, "testext_2.0.0.raw")
+	return client, root, targetDir, linkPath
+}
+
+func assertLinkedTo(t *testing.T, linkPath, want string) {
+	t.Helper()
+	target, err := os.Readlink(linkPath)
+	if err != nil {
+		t.Fatalf("expected %s to be a symlink: %v", linkPath, err)
+	}
+	if got := filepath.Base(target); got != want {
+		t.Errorf("link points at %s, want %s", got, want)
+	}
+}
+
+// TestRollbackFeature_RelinksAndSkips verifies that a rollback relinks the
+// previous installed version without deleting the newer one, records the
+// version rolled back from, and that later updates and checks honour it.
+func TestRollbackFeature_RelinksAndSkips(t *testing.T) {
+	client, root, targetDir, linkPath := rollbackFixture(t)
+
+	result, err := client.RollbackFeature(t.Context(), "testfeature", RollbackFeatureOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("RollbackFeature failed: %v", err)
+	}
+	want := RollbackResult{Component: "testext", FromVersion: "2.0.0", ToVersion: "1.0.0"}
+	if !result.Success || len(result.Results) != 1 || result.Results[0] != want {
+		t.Fatalf("RollbackFeature result = %+v, want success with %+v", result, want)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+	if _, err := os.Stat(filepath.Join(targetDir, "testext_2.0.0.raw")); err != nil {
+		t.Errorf("image rolled back from was removed: %v", err)
+	}
+
+	dropIn := filepath.Join(root, "sysupdate.d", "testfeature.feature.d", updexDropInName)
+	if result.DropIn != dropIn {
+		t.Errorf("DropIn = %q, want %q", result.DropIn, dropIn)
+	}
+	got, err := os.ReadFile(dropIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[X-Updex]\nSkipVersions=testext/2.0.0\n"; string(got) != want {
+		t.Errorf("drop-in = %q, want %q", got, want)
+	}
+
+	results, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true})
+	if err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Version != "1.0.0" || r.Downloaded {
+		t.Errorf("update after rollback = %+v, want 1.0.0 kept without a download", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+
+	checks, err := client.CheckFeatures(t.Context(), CheckFeaturesOptions{})
+	if err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	if c := checks[0].Results[0]; c.CurrentVersion != "1.0.0" || c.NewestVersion != "1.0.0" || c.UpdateAvailable {
+		t.Errorf("CheckFeatures after rollback = %+v, want 1.0.0 current and newest", c)
+	}
+
+	// Nothing older than 1.0.0 is installed: a second rollback must fail
+	// without touching the link.
+	if _, err := client.RollbackFeature(t.Context(), "testfeature", RollbackFeatureOptions{NoRefresh: true}); err == nil ||
+		!strings.Contains(err.Error(), "no version of testext older than 1.0.0") {
+		t.Errorf("second RollbackFeature error = %v, want no older version", err)
+	}
+	assertLinkedTo(t, linkPath, "testext_1.0.0.raw")
+}
+
+// TestRollbackFeature_PinOverridesSkip verifies that an explicit version
+// and a pin select a version rolled back from, and that pinning clears its
+// skip so the feature follows the newest version again once unpinned.
+func TestRollbackFeature_PinOverridesSkip(t *testing.T) {
+	client, root, _, linkPath := rollbackFixture(t)
+	ctx := t.Context()
+	if _, err := client.RollbackFeature(ctx, "testfeature", RollbackFeatureOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("RollbackFeature failed: %v", err)
+	}
+
+	results, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true, Version: "2.0.0"})
+	if err != nil {
+		t.Fatalf("UpdateFeatures with Version failed: %v", err)
+	}
+	if r := results[0].Results[0]; r.Version != "2.0.0" || !r.Relinked {
+		t.Errorf("update to the skipped version = %+v, want 2.0.0 relinked", r)
+	}
+	assertLinkedTo(t, linkPath, "testext_2.0.0.raw")
+
+	if _, err := client.PinFeature(ctx, "testfeature", "2.0.0", PinFeatureOptions{}); err != nil {
+		t.Fatalf("PinFeature failed: %v", err)
+	}
+	dropIn := filepath.Join(root, "sysupdate.d", "testfeature.feature.d", updexDropInName)
+	got, err := os.ReadFile(dropIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[X-Updex]\nPinVersion=2.0.0\n"; string(got) != want {
+		t.Errorf("drop-in after pin = %q, want %q", got, want)
+	}
+
+	if _, err := client.UnpinFeature(ctx, "testfeature", UnpinFeatureOptions{}); err != nil {
+		t.Fatalf("UnpinFeature failed: %v", err)
+	}
+	if _, err := client.UpdateFeatures(ctx, UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	assertLinkedTo(t, linkPath, "testext_2.0.0.raw")
+}
+
+// TestRollbackFeature_DryRun verifies that a dry run reports the plan and
+// changes neither the link nor the drop-in.
+func TestRollbackFeature_DryRun(t *testing.T) {
+	client, root, _, linkPath := rollbackFixture(t)
+
+	result, err := client.RollbackFeature(t.Context(), "testfeature", RollbackFeatureOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("RollbackFeature failed: %v", err)
+	}
+	if !result.Success || !result.DryRun || len(result.Results) != 1 || result.Results[0].ToVersion != "1.0.0" {
+		t.Errorf("dry-run result = %+v, want a plan to 1.0.0", result)
+	}
+	assertLinkedTo(t, linkPath, "testext_2.0.0.raw")
+	if _, err := os.Stat(filepath.Join(root, "sysupdate.d", "testfeature.feature.d", updexDropInName)); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote the drop-in: %v", err)
+	}
+}
+
+// TestRollbackFeature_Refused covers the features RollbackFeature refuses
+// without changing anything.
+func TestRollbackFeature_Refused(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, client *Client)
+		wantErr string
+	}{
+		{
+			name: "pinned",
+			setup: func(t *testing.T, client *Client) {
+				if _, err := client.PinFeature(t.Context(), "testfeature", "1.0.0", PinFeatureOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "is pinned to 1.0.0",
+		},
+		{
+			name: "pinned by the transfer",
+			setup: func(t *testing.T, client *Client) {
+				pinTransferFile(t, filepath.Join(client.paths.definitionRoots[0], "sysupdate.d", "testext.transfer"), "1.0.0")
+			},
+			wantErr: "testext is pinned to 1.0.0 by its transfer file",
+		},
+		{
+			name: "disabled",
+			setup: func(t *testing.T, client *Client) {
+				if _, err := client.DisableFeature(t.Context(), "testfeature", DisableFeatureOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "is not enabled",
+		},
+		{
+			name:    "not installed",
+			setup:   func(t *testing.T, client *Client) {},
+			wantErr: "testext is not installed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _, _, _ := pinFixture(t)
+			tt.setup(t, client)
+			result, err := client.RollbackFeature(t.Context(), "testfeature", RollbackFeatureOptions{NoRefresh: true})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("RollbackFeature error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if result.Success || result.Error == "" {
+				t.Errorf("result = %+v, want failure with Error set", result)
+			}
+		})
+	}
+}
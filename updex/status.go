@@ -0,0 +1,57 @@
+package updex
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/frostyard/updex/sysext"
+)
+
+// Status reports every installed image of every transfer in the domain,
+// enabled or not, newest first per transfer, and flags images whose mode or
+// read-only state has drifted from the transfer's Target.Mode and
+// Target.ReadOnly. Drift is reported in each ImageStatus, not as an error.
+func (c *Client) Status(ctx context.Context, opts StatusOptions) ([]ImageStatus, error) {
+	_, unlock, err := c.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	_, transfers, err := c.loadDomain(opts.Component)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]ImageStatus, 0)
+	var drifted int
+	for _, t := range transfers {
+		states, err := sysext.InspectInstancesAt(t, c.paths.sysextLinkDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s: %w", t.Component, err)
+		}
+		_, current, err := sysext.GetInstalledVersionsAt(t, c.paths.sysextLinkDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s: %w", t.Component, err)
+		}
+		for _, s := range states {
+			statuses = append(statuses, ImageStatus{
+				Component: t.Component,
+				Version:   s.Version,
+				Path:      s.Path,
+				Current:   s.Version == current,
+				Mode:      fmt.Sprintf("%04o", s.Mode),
+				ReadOnly:  s.ReadOnly,
+				Drift:     s.Drift,
+			})
+			if len(s.Drift) > 0 {
+				drifted++
+				c.warn("%s: %s has drifted: %v", t.Component, s.Path, s.Drift)
+			}
+		}
+	}
+
+	c.msg("Found %d installed image(s), %d drifted", len(statuses), drifted)
+
+	return statuses, nil
+}
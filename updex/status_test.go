@@ -0,0 +1,78 @@
+package updex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/updex/internal/testutil"
+	"github.com/frostyard/updex/sysext"
+)
+
+// TestStatus_ReportsReadOnlyDrift pins that an install honours Target.Mode
+// and Target.ReadOnly, and that Status flags an image once that marking is
+// undone behind updex's back.
+func TestStatus_ReportsReadOnlyDrift(t *testing.T) {
+	content := []byte("read-only extension")
+	server := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Files:   map[string]string{"tools_1.0.0.raw": hashContent(content)},
+		Content: map[string][]byte{"tools_1.0.0.raw": content},
+	})
+	defer server.Close()
+
+	configDir := t.TempDir()
+	targetDir := t.TempDir()
+	createFeatureFile(t, configDir, "devel", true)
+	writeCheckTransfer(t, configDir, "tools", "devel", server.URL, targetDir, false)
+	transferPath := filepath.Join(configDir, "tools.transfer")
+	data, err := os.ReadFile(transferPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(transferPath, append(data, "Mode=0640\nReadOnly=yes\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	image := filepath.Join(targetDir, "tools_1.0.0.raw")
+	t.Cleanup(func() { _ = sysext.ClearReadOnly(image) })
+
+	client := NewClient(ClientConfig{
+		Definitions:  configDir,
+		SysextRunner: &sysext.MockRunner{},
+		Paths:        RuntimePaths{DefinitionRoots: []string{t.TempDir()}, SysextLinkDir: t.TempDir()},
+	})
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures() error = %v", err)
+	}
+
+	statuses, err := client.Status(t.Context(), StatusOptions{})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("Status() = %+v, want one image", statuses)
+	}
+	if s := statuses[0]; s.Component != "tools" || s.Version != "1.0.0" || s.Path != image || !s.ReadOnly || len(s.Drift) != 0 {
+		t.Errorf("Status() = %+v, want a read-only tools 1.0.0 without drift", s)
+	}
+
+	// Undo the marking the way an administrator might.
+	if err := sysext.ClearReadOnly(image); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err = client.Status(t.Context(), StatusOptions{})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].ReadOnly {
+		t.Fatalf("Status() = %+v, want one writable image", statuses)
+	}
+	drift := strings.Join(statuses[0].Drift, "; ")
+	if !strings.Contains(drift, "not read-only") || !strings.Contains(drift, "mode 0644, want 0440") {
+		t.Errorf("Drift = %q, want the lost read-only marking and mode", drift)
+	}
+}
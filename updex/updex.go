@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/frostyard/std/reporter"
@@ -29,6 +30,7 @@ import (
 	"github.com/frostyard/updex/download"
 	"github.com/frostyard/updex/sysext"
 	"github.com/frostyard/updex/systemd"
+	"github.com/frostyard/updex/webhook"
 )
 
 // RuntimePaths holds the filesystem paths an updex.Client consults at
@@ -78,6 +80,30 @@ type RuntimePaths struct {
 	// systemd-sysext. Zero value uses sysext.RunExtensionsDir
 	// (/run/extensions).
 	RunExtensionsDir string
+
+	// MachineIDPath is the machine-id file phased rollouts bucket this
+	// host by (see the Phased= transfer key). Zero value uses
+	// config.MachineIDPath (/etc/machine-id).
+	MachineIDPath string
+
+	// StateDir is the directory updex keeps its own state in, such as the
+	// run history (see RunHistory). Zero value uses DefaultStateDir
+	// (/var/lib/updex).
+	StateDir string
+
+	// HooksDir is the directory holding the hook stage directories, such
+	// as pre-update/ (see HookPreUpdate). Zero value uses DefaultHooksDir
+	// (/etc/updex/hooks.d).
+	HooksDir string
+
+	// WebhookConfigRoots are the directories scanned for *.webhook target
+	// definitions. Zero value uses webhook.ConfigRoots.
+	WebhookConfigRoots []string
+
+	// LockPath is the lock file that serializes updex operations across
+	// processes (see ErrLocked). Zero value uses DefaultLockPath
+	// (/run/updex/lock).
+	LockPath string
 }
 
 // DisableCatalogCache is a sentinel value for RuntimePaths.CatalogCacheDir
@@ -95,6 +121,11 @@ type runtimePaths struct {
 	catalogTargetPath  string
 	sysextLinkDir      string
 	runExtensionsDir   string
+	machineIDPath      string
+	stateDir           string
+	hooksDir           string
+	webhookConfigRoots []string
+	lockPath           string
 }
 
 // resolveRuntimePaths converts a RuntimePaths (zero = default) to a fully
@@ -149,6 +180,36 @@ func resolveRuntimePaths(rp RuntimePaths) runtimePaths {
 		p.runExtensionsDir = sysext.RunExtensionsDir
 	}
 
+	if rp.MachineIDPath != "" {
+		p.machineIDPath = rp.MachineIDPath
+	} else {
+		p.machineIDPath = config.MachineIDPath
+	}
+
+	if rp.StateDir != "" {
+		p.stateDir = rp.StateDir
+	} else {
+		p.stateDir = DefaultStateDir
+	}
+
+	if rp.HooksDir != "" {
+		p.hooksDir = rp.HooksDir
+	} else {
+		p.hooksDir = DefaultHooksDir
+	}
+
+	if len(rp.WebhookConfigRoots) > 0 {
+		p.webhookConfigRoots = slices.Clone(rp.WebhookConfigRoots)
+	} else {
+		p.webhookConfigRoots = slices.Clone(webhook.ConfigRoots)
+	}
+
+	if rp.LockPath != "" {
+		p.lockPath = rp.LockPath
+	} else {
+		p.lockPath = defaultLockPath
+	}
+
 	return p
 }
 
@@ -160,6 +221,20 @@ type Client struct {
 	reporter   reporter.Reporter
 	runner     sysext.SysextRunner
 	systemd    *systemd.Manager
+	limiter    *download.Limiter // shared by all of the client's downloads; nil = no limit
+
+	// runnerMu serializes runner calls from concurrent transfer jobs (see
+	// runJobs); injected runners need not be safe for concurrent use. It is
+	// a pointer so job copies of the client (forJob) share it.
+	runnerMu *sync.Mutex
+
+	// hookMu serializes hooks (see runHooks) from concurrent transfer
+	// jobs, shared by job copies as runnerMu is.
+	hookMu *sync.Mutex
+
+	// stats counts the work of the transfer job this client copy runs
+	// (see forJob); nil outside a job.
+	stats *transferStats
 }
 
 // ClientConfig holds configuration for the Client.
@@ -207,6 +282,22 @@ type ClientConfig struct {
 	// multiple downloads from the same host.
 	HTTPClient *http.Client
 
+	// DownloadRateLimit caps, in bytes per second, how fast this client
+	// downloads images. The cap is shared by every download the client
+	// makes, including concurrent transfers and retries. Zero means no limit.
+	// Local (file://) sources are not limited.
+	DownloadRateLimit int64
+
+	// HookTimeout bounds each hook (see RuntimePaths.HooksDir) and each
+	// feature's HealthCheck= command; one still running is killed and
+	// counts as failed. Zero uses DefaultHookTimeout.
+	HookTimeout time.Duration
+
+	// NoLockWait makes an operation fail with ErrLocked when another updex
+	// process holds the lock it needs, instead of waiting for it to be
+	// released or for the operation's context to be done.
+	NoLockWait bool
+
 	// Paths holds the filesystem paths this client consults at runtime.
 	// Zero values resolve to current production defaults at NewClient time.
 	// See RuntimePaths for field-by-field documentation.
@@ -245,6 +336,9 @@ func NewClient(cfg ClientConfig) *Client {
 		reporter:   r,
 		runner:     sr,
 		systemd:    sm,
+		limiter:    download.NewLimiter(cfg.DownloadRateLimit),
+		runnerMu:   &sync.Mutex{},
+		hookMu:     &sync.Mutex{},
 	}
 }
 
@@ -270,10 +364,19 @@ func (c *Client) warn(format string, a ...any) {
 
 func (c *Client) retryNotify(what string) func(attempt, maxAttempts int, reason error) {
 	return func(attempt, maxAttempts int, reason error) {
+		c.stats.retried(reason)
 		c.warn("retrying %s (attempt %d/%d): %v", what, attempt, maxAttempts, reason)
 	}
 }
 
+// failoverNotify returns a callback that reports moving past a failed mirror.
+func (c *Client) failoverNotify(what string) func(location string, reason error) {
+	return func(location string, reason error) {
+		c.stats.observe(reason)
+		c.warn("%s from %s failed, trying next mirror: %v", what, location, reason)
+	}
+}
+
 func (c *Client) debug(format string, a ...any) {
 	if c.config.Verbose {
 		c.reporter.Message("debug: "+format, a...)
@@ -0,0 +1,78 @@
+package updex
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/frostyard/updex/config"
+	"github.com/frostyard/updex/webhook"
+)
+
+// webhookBaseDelay is the backoff before the first retry of a webhook
+// delivery; a test seam.
+var webhookBaseDelay = time.Second
+
+// notifyWebhooks POSTs the results of a run of event, which returned
+// runErr, to every webhook target that wants it. Delivery failures are
+// warnings: the run itself is over.
+func (c *Client) notifyWebhooks(ctx context.Context, event, component string, results any, runErr error) {
+	targets, err := webhook.LoadTargetsFrom(c.paths.webhookConfigRoots)
+	if err != nil {
+		c.warn("cannot load webhooks: %v", err)
+		return
+	}
+	var wanted []webhook.Target
+	for _, t := range targets {
+		if t.Wants(event) {
+			wanted = append(wanted, t)
+		}
+	}
+	if len(wanted) == 0 {
+		return
+	}
+
+	payload := WebhookPayload{
+		Event:     event,
+		Time:      time.Now(),
+		Host:      c.hostInfo(),
+		Component: component,
+		Success:   runErr == nil,
+		Results:   results,
+	}
+	if runErr != nil {
+		payload.Error = runErr.Error()
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		c.warn("cannot encode webhook payload: %v", err)
+		return
+	}
+	for _, t := range wanted {
+		err := webhook.Send(ctx, c.httpClient, t, event, body,
+			webhook.WithRetryConfig(0, webhookBaseDelay), // zero attempts: the default
+			webhook.WithRetryNotify(c.retryNotify("webhook "+t.Name)))
+		if err != nil {
+			c.warn("%v", err)
+			continue
+		}
+		c.debug("notified webhook %s", t.Name)
+	}
+}
+
+// hostInfo identifies this host from its hostname, machine ID and
+// os-release.
+func (c *Client) hostInfo() HostInfo {
+	osRelease := config.OSReleaseFrom(c.paths.osReleasePaths)
+	hostname, _ := os.Hostname()
+	return HostInfo{
+		Hostname:     hostname,
+		MachineID:    config.MachineIDFrom(c.paths.machineIDPath),
+		OSID:         osRelease["ID"],
+		OSVersionID:  osRelease["VERSION_ID"],
+		VariantID:    osRelease["VARIANT_ID"],
+		ImageID:      osRelease["IMAGE_ID"],
+		ImageVersion: osRelease["IMAGE_VERSION"],
+	}
+}
@@ -0,0 +1,201 @@
+package updex
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frostyard/updex/internal/lock"
+	"github.com/frostyard/updex/webhook"
+)
+
+// webhookDelivery is one POST a test receiver got.
+type webhookDelivery struct {
+	event     string
+	signature string
+	body      []byte
+}
+
+// webhookFixture is stagingFixture with os-release, a machine ID and one
+// webhook target, configured by target (URL excluded), whose receiver
+// answers each POST with the next of statuses (then 204). It returns the
+// client and the deliveries received so far.
+func webhookFixture(t *testing.T, target string, statuses ...int) (*Client, func() []webhookDelivery) {
+	t.Helper()
+	var mu sync.Mutex
+	var deliveries []webhookDelivery
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		deliveries = append(deliveries, webhookDelivery{r.Header.Get(webhook.EventHeader), r.Header.Get(webhook.SignatureHeader), body})
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, _, _ := stagingFixture(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"os-release":               "ID=fedora\nVERSION_ID=43\nVARIANT_ID=coreos\nIMAGE_ID=snow\nIMAGE_VERSION=20261016\n",
+		"machine-id":               "0123456789abcdef0123456789abcdef\n",
+		"webhooks.d/fleet.webhook": "[Webhook]\nURL=" + server.URL + "\nAllowInsecure=yes\n" + target,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.paths.osReleasePaths = []string{filepath.Join(dir, "os-release")}
+	client.paths.machineIDPath = filepath.Join(dir, "machine-id")
+	client.paths.webhookConfigRoots = []string{filepath.Join(dir, "webhooks.d")}
+
+	return client, func() []webhookDelivery {
+		mu.Lock()
+		defer mu.Unlock()
+		return deliveries
+	}
+}
+
+// TestWebhooks_UpdateAndCheck verifies that update and check runs POST
+// their results with the host's identity, signed with the target's secret,
+// and that dry runs and checks with NoWebhooks notify nobody.
+func TestWebhooks_UpdateAndCheck(t *testing.T) {
+	client, received := webhookFixture(t, "Secret=s3cr3t\n")
+
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{DryRun: true}); err != nil {
+		t.Fatalf("UpdateFeatures(DryRun) failed: %v", err)
+	}
+	if _, err := client.CheckFeatures(t.Context(), CheckFeaturesOptions{NoWebhooks: true}); err != nil {
+		t.Fatalf("CheckFeatures(NoWebhooks) failed: %v", err)
+	}
+	if got := received(); len(got) != 0 {
+		t.Fatalf("dry run and NoWebhooks check notified %d times", len(got))
+	}
+
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if _, err := client.CheckFeatures(t.Context(), CheckFeaturesOptions{}); err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	got := received()
+	if len(got) != 2 {
+		t.Fatalf("received %d deliveries, want 2", len(got))
+	}
+
+	var update struct {
+		WebhookPayload
+		Results []UpdateFeaturesResult `json:"results"`
+	}
+	if err := json.Unmarshal(got[0].body, &update); err != nil {
+		t.Fatalf("decode update payload %s: %v", got[0].body, err)
+	}
+	wantHost := HostInfo{
+		MachineID: "0123456789abcdef0123456789abcdef", OSID: "fedora", OSVersionID: "43",
+		VariantID: "coreos", ImageID: "snow", ImageVersion: "20261016",
+	}
+	update.Host.Hostname = ""
+	if got[0].event != webhook.EventUpdate || update.Event != webhook.EventUpdate || !update.Success || update.Host != wantHost {
+		t.Errorf("update payload = %s (event header %q), want a successful update from %+v", got[0].body, got[0].event, wantHost)
+	}
+	if len(update.Results) != 1 || update.Results[0].Results[0].Version != "1.1.0" || update.Results[0].Results[0].FromVersion != "1.0.0" {
+		t.Errorf("update results = %+v, want testext updated to 1.1.0", update.Results)
+	}
+	if got[0].signature != webhook.Sign("s3cr3t", got[0].body) {
+		t.Errorf("signature = %q, want %q", got[0].signature, webhook.Sign("s3cr3t", got[0].body))
+	}
+
+	var check struct {
+		WebhookPayload
+		Results []CheckFeaturesResult `json:"results"`
+	}
+	if err := json.Unmarshal(got[1].body, &check); err != nil {
+		t.Fatalf("decode check payload %s: %v", got[1].body, err)
+	}
+	if check.Event != webhook.EventCheck || len(check.Results) != 1 || check.Results[0].Results[0].CurrentVersion != "1.1.0" {
+		t.Errorf("check payload = %s, want testext current at 1.1.0", got[1].body)
+	}
+}
+
+// TestWebhooks_RetriesAndFilters verifies that a failed delivery is
+// retried, and that a target only receives the events it asks for.
+func TestWebhooks_RetriesAndFilters(t *testing.T) {
+	orig := webhookBaseDelay
+	webhookBaseDelay = time.Millisecond
+	t.Cleanup(func() { webhookBaseDelay = orig })
+	client, received := webhookFixture(t, "Events=update\n", http.StatusServiceUnavailable)
+	rec := &eventRecorder{}
+	client.reporter = rec
+
+	if _, err := client.CheckFeatures(t.Context(), CheckFeaturesOptions{}); err != nil {
+		t.Fatalf("CheckFeatures failed: %v", err)
+	}
+	if got := received(); len(got) != 0 {
+		t.Fatalf("update-only target received %d check deliveries", len(got))
+	}
+
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{NoRefresh: true}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	if got := received(); len(got) != 1 || got[0].event != webhook.EventUpdate {
+		t.Fatalf("received %+v, want one update after the retry", got)
+	}
+	var retried bool
+	for _, e := range rec.events {
+		retried = retried || e.Warning && strings.HasPrefix(e.Message, "retrying webhook fleet (attempt 2/3)")
+	}
+	if !retried {
+		t.Errorf("no retry warning among %+v", rec.events)
+	}
+}
+
+// TestWebhooks_SentAfterUnlock verifies that an update notifies its
+// webhook targets only once it released the updex lock, so a slow target
+// does not hold up other operations.
+func TestWebhooks_SentAfterUnlock(t *testing.T) {
+	client, _ := webhookFixture(t, "")
+	client.paths.lockPath = filepath.Join(t.TempDir(), "lock")
+
+	lockErr := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l, err := lock.Acquire(r.Context(), client.paths.lockPath, lock.Options{Exclusive: true})
+		if err == nil {
+			_ = l.Release()
+		}
+		lockErr <- err
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	target := "[Webhook]\nURL=" + server.URL + "\nAllowInsecure=yes\n"
+	if err := os.WriteFile(filepath.Join(client.paths.webhookConfigRoots[0], "fleet.webhook"), []byte(target), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.UpdateFeatures(t.Context(), UpdateFeaturesOptions{}); err != nil {
+		t.Fatalf("UpdateFeatures failed: %v", err)
+	}
+	select {
+	case err := <-lockErr:
+		if err != nil {
+			t.Errorf("lock held while notifying: %v", err)
+		}
+	default:
+		t.Fatal("webhook target was not notified")
+	}
+}
@@ -0,0 +1,60 @@
+package varlink
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// listenFDsStart is the first file descriptor systemd passes to a
+// socket-activated service (SD_LISTEN_FDS_START).
+const listenFDsStart = 3
+
+// ActivationListener returns the listening socket systemd passed to the
+// process, as it does for updex-varlink.service, or nil when the process
+// was not socket-activated. It unsets the activation variables so child
+// processes do not take the socket for theirs.
+func ActivationListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	fds := os.Getenv("LISTEN_FDS")
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_ = os.Unsetenv(name)
+	}
+	if fds != "1" {
+		return nil, fmt.Errorf("socket activation passed %q sockets, want 1", fds)
+	}
+	f := os.NewFile(listenFDsStart, "varlink")
+	defer func() { _ = f.Close() }()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("activation socket: %w", err)
+	}
+	return l, nil
+}
+
+// Listen listens on a Unix socket at path, replacing a stale socket left
+// by an earlier server and creating the directory it is in. Any user may
+// connect; the server decides what each caller may do.
+func Listen(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() == os.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create socket directory: %w", err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0666); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("open socket to all users: %w", err)
+	}
+	return l, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package varlink
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUID fails outside Linux, where updex does not read peer credentials,
+// so no caller is trusted.
+var peerUID = func(net.Conn) (uint32, error) {
+	return 0, errors.New("peer credentials are not supported on this platform")
+}
@@ -0,0 +1,379 @@
+package varlink
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/frostyard/updex/updex"
+)
+
+// InterfaceDescription is the Varlink description of org.frostyard.Updex.
+const InterfaceDescription = `# Manage systemd-sysext images through updex features.
+#
+# Features, components, results and catalog entries are the JSON objects
+# ` + "`updex --json`" + ` prints for the same command. Features, Components,
+# CheckFeatures and CatalogList may be called by any user; the other
+# methods require root. Calls made with "more" receive the messages of
+# the call as progress notifications before the final reply.
+interface org.frostyard.Updex
+
+# A message reported while a call runs. event is set for installs,
+# switches, stages, applies and failures; feature, transfer and version
+# where they apply.
+type Progress (
+  message: string,
+  warning: bool,
+  event: ?string,
+  feature: ?string,
+  transfer: ?string,
+  version: ?string
+)
+
+# List the features with their status and transfers.
+method Features(component: ?string) -> (features: []object)
+
+# List the discovered systemd-sysupdate components.
+method Components() -> (components: []object)
+
+# Check the enabled features for newer versions.
+method CheckFeatures(component: ?string) -> (progress: ?Progress, results: ?[]object)
+
+# Download and install the newest versions of the enabled features.
+method UpdateFeatures(
+  component: ?string,
+  version: ?string,
+  stage: ?bool,
+  ignorePhasing: ?bool,
+  dryRun: ?bool,
+  noRefresh: ?bool,
+  noVacuum: ?bool
+) -> (progress: ?Progress, results: ?[]object)
+
+# Enable a feature, and with now download its extensions.
+method EnableFeature(
+  name: string,
+  component: ?string,
+  now: ?bool,
+  version: ?string,
+  dryRun: ?bool,
+  noRefresh: ?bool
+) -> (progress: ?Progress, result: ?object)
+
+# Disable a feature, and with now remove its extensions.
+method DisableFeature(
+  name: string,
+  component: ?string,
+  now: ?bool,
+  force: ?bool,
+  dryRun: ?bool,
+  noRefresh: ?bool
+) -> (progress: ?Progress, result: ?object)
+
+# List the sysexts available from the configured catalogs.
+method CatalogList(repo: ?string, search: ?string, noCache: ?bool) -> (entries: []object)
+
+# Install a sysext from a catalog.
+method CatalogAdd(
+  name: string,
+  repo: ?string,
+  dryRun: ?bool,
+  noRefresh: ?bool
+) -> (progress: ?Progress, result: ?object)
+
+# Remove a sysext added from a catalog.
+method CatalogRemove(
+  name: string,
+  repo: ?string,
+  force: ?bool,
+  dryRun: ?bool,
+  noRefresh: ?bool
+) -> (progress: ?Progress, result: ?object)
+
+# The call failed. results holds what CheckFeatures or UpdateFeatures
+# returned for each feature before it did.
+error Failed (message: string, results: ?[]object)
+`
+
+// serviceDescription is the Varlink description of org.varlink.service.
+const serviceDescription = `# The Varlink Service Interface is provided by every varlink service. It
+# describes the service and the interfaces it implements.
+interface org.varlink.service
+
+# Get a list of all the interfaces a service provides and information
+# about the implementation.
+method GetInfo() -> (
+  vendor: string,
+  product: string,
+  version: string,
+  url: string,
+  interfaces: []string
+)
+
+# Get the description of an interface that is implemented by this service.
+method GetInterfaceDescription(interface: string) -> (description: string)
+
+# The requested interface was not found.
+error InterfaceNotFound (interface: string)
+
+# The requested method was not found
+error MethodNotFound (method: string)
+
+# The interface defines the requested method, but the service does not
+# implement it.
+error MethodNotImplemented (method: string)
+
+# One of the passed parameters is invalid.
+error InvalidParameter (parameter: string)
+
+# Client is denied access
+error PermissionDenied ()
+
+# Method is expected to be called with 'more' set to true, but wasn't
+error ExpectedMore ()
+`
+
+// method is one method of org.frostyard.Updex.
+type method struct {
+	// privileged methods change system state and require a root caller.
+	privileged bool
+	// streams reports whether the method sends progress notifications.
+	streams bool
+	call    func(ctx context.Context, c *updex.Client, raw json.RawMessage) (any, error)
+}
+
+// methods are the methods of org.frostyard.Updex, by name.
+var methods = map[string]method{
+	"Features":       {call: features},
+	"Components":     {call: components},
+	"CheckFeatures":  {streams: true, call: checkFeatures},
+	"CatalogList":    {call: catalogList},
+	"UpdateFeatures": {privileged: true, streams: true, call: updateFeatures},
+	"EnableFeature":  {privileged: true, streams: true, call: enableFeature},
+	"DisableFeature": {privileged: true, streams: true, call: disableFeature},
+	"CatalogAdd":     {privileged: true, streams: true, call: catalogAdd},
+	"CatalogRemove":  {privileged: true, streams: true, call: catalogRemove},
+}
+
+// failedParams are the parameters of a Failed error.
+type failedParams struct {
+	Message string `json:"message"`
+	Results any    `json:"results,omitempty"`
+}
+
+func features(ctx context.Context, c *updex.Client, raw json.RawMessage) (any, error) {
+	var p struct {
+		Component string `json:"component"`
+	}
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	result, err := c.Features(ctx, updex.FeaturesOptions{Component: p.Component})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = []updex.FeatureInfo{}
+	}
+	return struct {
+		Features []updex.FeatureInfo `json:"features"`
+	}{result}, nil
+}
+
+func components(ctx context.Context, c *updex.Client, raw json.RawMessage) (any, error) {
+	if err := decodeParams(raw, &struct{}{}); err != nil {
+		return nil, err
+	}
+	result, err := c.Components(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = []updex.ComponentInfo{}
+	}
+	return struct {
+		Components []updex.ComponentInfo `json:"components"`
+	}{result}, nil
+}
+
+func checkFeatures(ctx context.Context, c *updex.Client, raw json.RawMessage) (any, error) {
+	var p struct {
+		Component string `json:"component"`
+	}
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	// Any user may check, so the check must not make root notify the
+	// webhook targets on their behalf.
+	result, err := c.CheckFeatures(ctx, updex.CheckFeaturesOptions{Component: p.Component, NoWebhooks: true})
+	if result == nil {
+		result = []updex.CheckFeaturesResult{}
+	}
+	if err != nil {
+		return nil, failed(err, result)
+	}
+	return struct {
+		Results []updex.CheckFeaturesResult `json:"results"`
+	}{result}, nil
+}
+
+func updateFeatures(ctx context.Context, c *updex.Client, raw json.RawMessage) (any, error) {
+	var p struct {
+		Component     string `json:"component"`
+		Version       string `json:"version"`
+		Stage         bool   `json:"stage"`
+		IgnorePhasing bool   `json:"ignorePhasing"`
+		DryRun        bool   `json:"dryRun"`
+		NoRefresh     bool   `json:"noRefresh"`
+		NoVacuum      bool   `json:"noVacuum"`
+	}
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	result, err := c.UpdateFeatures(ctx, updex.UpdateFeaturesOptions{
+		Component:     p.Component,
+		Version:       p.Version,
+		Stage:         p.Stage,
+		IgnorePhasing: p.IgnorePhasing,
+		DryRun:        p.DryRun,
+		NoRefresh:     p.NoRefresh,
+		NoVacuum:      p.NoVacuum,
+		Record:        true,
+	})
+	if result == nil {
+		result = []updex.UpdateFeaturesResult{}
+	}
+	if err != nil {
+		return nil, failed(err, result)
+	}
+	return struct {
+		Results []updex.UpdateFeaturesResult `json:"results"`
+	}{result}, nil
+}
+
+func enableFeature(ctx context.Context, c *updex.Client, raw json.RawMessage) (any, error) {
+	var p struct {
+		Name      string `json:"name"`
+		Component string `json:"component"`
+		Now       bool   `json:"now"`
+		Version   string `json:"version"`
+		DryRun    bool   `json:"dryRun"`
+		NoRefresh bool   `json:"noRefresh"`
+	}
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if p.Name == "" {
+		return nil, invalidParameter("name")
+	}
+	result, err := c.EnableFeature(ctx, p.Name, updex.EnableFeatureOptions{
+		Component: p.Component,
+		Now:       p.Now,
+		Version:   p.Version,
+		DryRun:    p.DryRun,
+		NoRefresh: p.NoRefresh,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resultReply{result}, nil
+}
+
+func disableFeature(ctx context.Context, c *updex.Client, raw json.RawMessage) (any, error) {
+	var p struct {
+		Name      string `json:"name"`
+		Component string `json:"component"`
+		Now       bool   `json:"now"`
+		Force     bool   `json:"force"`
+		DryRun    bool   `json:"dryRun"`
+		NoRefresh bool   `json:"noRefresh"`
+	}
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if p.Name == "" {
+		return nil, invalidParameter("name")
+	}
+	result, err := c.DisableFeature(ctx, p.Name, updex.DisableFeatureOptions{
+		Component: p.Component,
+		Now:       p.Now,
+		Force:     p.Force,
+		DryRun:    p.DryRun,
+		NoRefresh: p.NoRefresh,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resultReply{result}, nil
+}
+
+func catalogList(ctx context.Context, c *updex.Client, raw json.RawMessage) (any, error) {
+	var p struct {
+		Repo    string `json:"repo"`
+		Search  string `json:"search"`
+		NoCache bool   `json:"noCache"`
+	}
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	result, err := c.CatalogList(ctx, updex.CatalogListOptions{Repo: p.Repo, Search: p.Search, NoCache: p.NoCache})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = []updex.CatalogEntry{}
+	}
+	return struct {
+		Entries []updex.CatalogEntry `json:"entries"`
+	}{result}, nil
+}
+
+func catalogAdd(ctx context.Context, c *updex.Client, raw json.RawMessage) (any, error) {
+	var p struct {
+		Name      string `json:"name"`
+		Repo      string `json:"repo"`
+		DryRun    bool   `json:"dryRun"`
+		NoRefresh bool   `json:"noRefresh"`
+	}
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if p.Name == "" {
+		return nil, invalidParameter("name")
+	}
+	result, err := c.CatalogAdd(ctx, p.Name, updex.CatalogAddOptions{Repo: p.Repo, DryRun: p.DryRun, NoRefresh: p.NoRefresh})
+	if err != nil {
+		return nil, err
+	}
+	return resultReply{result}, nil
+}
+
+func catalogRemove(ctx context.Context, c *updex.Client, raw json.RawMessage) (any, error) {
+	var p struct {
+		Name      string `json:"name"`
+		Repo      string `json:"repo"`
+		Force     bool   `json:"force"`
+		DryRun    bool   `json:"dryRun"`
+		NoRefresh bool   `json:"noRefresh"`
+	}
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if p.Name == "" {
+		return nil, invalidParameter("name")
+	}
+	result, err := c.CatalogRemove(ctx, p.Name, updex.CatalogRemoveOptions{Repo: p.Repo, Force: p.Force, DryRun: p.DryRun, NoRefresh: p.NoRefresh})
+	if err != nil {
+		return nil, err
+	}
+	return resultReply{result}, nil
+}
+
+type resultReply struct {
+	Result any `json:"result"`
+}
+
+// failed returns the Failed error of a call whose SDK method returned err
+// along with the results it completed.
+func failed(err error, results any) error {
+	return &Error{Name: ErrFailed, Parameters: failedParams{Message: err.Error(), Results: results}}
+}
@@ -0,0 +1,390 @@
+// Package varlink serves the updex SDK over the Varlink protocol
+// (https://varlink.org), so that unprivileged programs such as desktop
+// frontends can list and check features without running updex as root.
+//
+// The server implements org.varlink.service and org.frostyard.Updex, whose
+// description is in InterfaceDescription. Each call gets its own
+// updex.Client; callers that set "more" receive the messages it reports
+// as Progress notifications before the final reply. Methods that only read
+// state may be called by any user; the rest require the caller, identified
+// by the socket's peer credentials, to be root.
+package varlink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/frostyard/std/reporter"
+	"github.com/frostyard/updex/updex"
+)
+
+// Interface is the name of the interface updex implements.
+const Interface = "org.frostyard.Updex"
+
+// SocketPath is where updex-varlink.socket listens.
+const SocketPath = "/run/updex/" + Interface
+
+// serviceInterface is the interface every Varlink service implements.
+const serviceInterface = "org.varlink.service"
+
+// Errors of org.varlink.service.
+const (
+	ErrInterfaceNotFound = serviceInterface + ".InterfaceNotFound"
+	ErrMethodNotFound    = serviceInterface + ".MethodNotFound"
+	ErrInvalidParameter  = serviceInterface + ".InvalidParameter"
+	ErrPermissionDenied  = serviceInterface + ".PermissionDenied"
+)
+
+// ErrFailed is the error of a call whose SDK method returned an error.
+const ErrFailed = Interface + ".Failed"
+
+// maxMessageSize bounds a call, so a client cannot make the server buffer
+// without limit. Real calls are a few hundred bytes.
+const maxMessageSize = 1 << 20
+
+// Config configures a Server.
+type Config struct {
+	// Client is the configuration of the updex.Client each call gets. Its
+	// Progress reporter receives the messages of every call, whether or not
+	// the caller asked for them.
+	Client updex.ClientConfig
+
+	// Version is the version GetInfo reports.
+	Version string
+}
+
+// Server answers Varlink calls on the connections of a listener.
+type Server struct {
+	cfg      Config
+	progress reporter.Reporter
+
+	// mu serializes the calls that change system state, so two callers
+	// cannot update the same transfers at once.
+	mu sync.Mutex
+}
+
+// NewServer returns a server making calls with cfg.
+func NewServer(cfg Config) *Server {
+	progress := cfg.Client.Progress
+	if progress == nil {
+		progress = reporter.NoopReporter{}
+	}
+	return &Server{cfg: cfg, progress: progress}
+}
+
+// Serve accepts connections on l, which must be a Unix socket listener,
+// and answers their calls until ctx is done. It then closes l and every
+// connection, waits for the calls in progress, which see ctx canceled, and
+// returns nil.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		conns = make(map[net.Conn]struct{})
+	)
+	stop := context.AfterFunc(ctx, func() {
+		_ = l.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+	})
+	defer stop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+		wg.Go(func() {
+			s.serveConn(ctx, conn)
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+			_ = conn.Close()
+		})
+	}
+}
+
+// call is a Varlink method call.
+type call struct {
+	Method     string          `json:"method"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	Oneway     bool            `json:"oneway,omitempty"`
+	More       bool            `json:"more,omitempty"`
+}
+
+// reply is a Varlink reply: a result, an error, or, with Continues set,
+// one of the notifications preceding the result.
+type reply struct {
+	Parameters any    `json:"parameters,omitempty"`
+	Continues  bool   `json:"continues,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Error is a Varlink error reply.
+type Error struct {
+	Name       string
+	Parameters any
+}
+
+func (e *Error) Error() string {
+	return e.Name
+}
+
+// serveConn answers the calls on conn one at a time, until the client
+// hangs up or sends something that is not a call.
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	uid, err := peerUID(conn)
+	if err != nil {
+		s.progress.Warning("varlink: cannot identify caller: %v", err)
+		return
+	}
+	w := &replyWriter{conn: conn}
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			return
+		}
+		var c call
+		if err := json.Unmarshal(msg, &c); err != nil || c.Method == "" {
+			return
+		}
+		out := w
+		if c.Oneway {
+			out = &replyWriter{discard: true}
+		}
+		s.handle(ctx, out, c, uid)
+	}
+}
+
+// readMessage reads one NUL-terminated message.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	var msg []byte
+	for {
+		chunk, err := r.ReadSlice(0)
+		if len(msg)+len(chunk) > maxMessageSize {
+			return nil, fmt.Errorf("message exceeds %d bytes", maxMessageSize)
+		}
+		msg = append(msg, chunk...)
+		if err == nil {
+			return msg[:len(msg)-1], nil
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+	}
+}
+
+// replyWriter sends the replies of one connection. Notifications may come
+// from several goroutines of a call at once.
+type replyWriter struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	discard bool
+}
+
+func (w *replyWriter) send(r reply) {
+	if w.discard {
+		return
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		data, _ = json.Marshal(reply{Error: ErrFailed, Parameters: failedParams{Message: err.Error()}})
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// A client that hung up loses the rest of its replies; the call still
+	// runs to completion.
+	_, _ = w.conn.Write(append(data, 0))
+}
+
+// handle answers one call.
+func (s *Server) handle(ctx context.Context, w *replyWriter, c call, uid uint32) {
+	result, err := s.dispatch(ctx, w, c, uid)
+	if err != nil {
+		var verr *Error
+		if !errors.As(err, &verr) {
+			verr = &Error{Name: ErrFailed, Parameters: failedParams{Message: err.Error()}}
+		}
+		w.send(reply{Error: verr.Name, Parameters: verr.Parameters})
+		return
+	}
+	w.send(reply{Parameters: result})
+}
+
+func (s *Server) dispatch(ctx context.Context, w *replyWriter, c call, uid uint32) (any, error) {
+	iface, name := splitMethod(c.Method)
+	switch iface {
+	case serviceInterface:
+		return s.serviceMethod(name, c.Parameters)
+	case Interface:
+	default:
+		return nil, &Error{Name: ErrInterfaceNotFound, Parameters: map[string]string{"interface": iface}}
+	}
+
+	m, ok := methods[name]
+	if !ok {
+		return nil, &Error{Name: ErrMethodNotFound, Parameters: map[string]string{"method": c.Method}}
+	}
+	if m.privileged {
+		if uid != 0 {
+			return nil, &Error{Name: ErrPermissionDenied}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.progress.Message("varlink: %s called by UID %d", name, uid)
+	}
+
+	cfg := s.cfg.Client
+	cfg.Progress = s.progress
+	if c.More && m.streams {
+		cfg.Progress = &notifier{w: w, next: s.progress}
+	}
+	return m.call(ctx, updex.NewClient(cfg), c.Parameters)
+}
+
+// splitMethod splits a qualified method name into its interface and name.
+func splitMethod(method string) (iface, name string) {
+	i := strings.LastIndexByte(method, '.')
+	if i < 0 {
+		return "", method
+	}
+	return method[:i], method[i+1:]
+}
+
+// serviceMethod answers a call of org.varlink.service.
+func (s *Server) serviceMethod(name string, raw json.RawMessage) (any, error) {
+	switch name {
+	case "GetInfo":
+		if err := decodeParams(raw, &struct{}{}); err != nil {
+			return nil, err
+		}
+		return getInfoReply{
+			Vendor:     "Frostyard",
+			Product:    "updex",
+			Version:    s.cfg.Version,
+			URL:        "https://github.com/frostyard/updex",
+			Interfaces: []string{serviceInterface, Interface},
+		}, nil
+	case "GetInterfaceDescription":
+		var p struct {
+			Interface string `json:"interface"`
+		}
+		if err := decodeParams(raw, &p); err != nil {
+			return nil, err
+		}
+		switch p.Interface {
+		case serviceInterface:
+			return descriptionReply{Description: serviceDescription}, nil
+		case Interface:
+			return descriptionReply{Description: InterfaceDescription}, nil
+		}
+		return nil, &Error{Name: ErrInterfaceNotFound, Parameters: map[string]string{"interface": p.Interface}}
+	}
+	return nil, &Error{Name: ErrMethodNotFound, Parameters: map[string]string{"method": serviceInterface + "." + name}}
+}
+
+type getInfoReply struct {
+	Vendor     string   `json:"vendor"`
+	Product    string   `json:"product"`
+	Version    string   `json:"version"`
+	URL        string   `json:"url"`
+	Interfaces []string `json:"interfaces"`
+}
+
+type descriptionReply struct {
+	Description string `json:"description"`
+}
+
+// decodeParams decodes a call's parameters into p, rejecting unknown and
+// mistyped ones with InvalidParameter.
+func decodeParams(raw json.RawMessage, p any) error {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p); err != nil {
+		parameter := "parameters"
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			parameter = typeErr.Field
+		} else if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			parameter = strings.Trim(field, `"`)
+		}
+		return invalidParameter(parameter)
+	}
+	return nil
+}
+
+func invalidParameter(name string) error {
+	return &Error{Name: ErrInvalidParameter, Parameters: map[string]string{"parameter": name}}
+}
+
+// notifier is the reporter of a call made with "more": it sends each
+// message to the caller as a Progress notification and passes it on to
+// the server's own reporter.
+type notifier struct {
+	w    *replyWriter
+	next reporter.Reporter
+}
+
+var _ updex.EventReporter = (*notifier)(nil)
+
+func (n *notifier) Message(format string, args ...any) {
+	n.Event(updex.Event{Message: fmt.Sprintf(format, args...)})
+}
+
+func (n *notifier) Warning(format string, args ...any) {
+	n.Event(updex.Event{Warning: true, Message: fmt.Sprintf(format, args...)})
+}
+
+func (n *notifier) Event(e updex.Event) {
+	n.w.send(reply{Parameters: progressReply{Progress: &Progress{
+		Message:  e.Message,
+		Warning:  e.Warning,
+		Event:    string(e.Type),
+		Feature:  e.Feature,
+		Transfer: e.Transfer,
+		Version:  e.Version,
+	}}, Continues: true})
+
+	if r, ok := n.next.(updex.EventReporter); ok {
+		r.Event(e)
+	} else if e.Warning {
+		n.next.Warning("%s", e.Message)
+	} else {
+		n.next.Message("%s", e.Message)
+	}
+}
+
+// Progress is a message reported while a call runs.
+type Progress struct {
+	Message  string `json:"message"`
+	Warning  bool   `json:"warning"`
+	Event    string `json:"event,omitempty"`
+	Feature  string `json:"feature,omitempty"`
+	Transfer string `json:"transfer,omitempty"`
+	Version  string `json:"version,omitempty"`
+}
+
+type progressReply struct {
+	Progress *Progress `json:"progress"`
+}
@@ -0,0 +1,240 @@
+package varlink
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frostyard/updex/internal/testutil"
+	"github.com/frostyard/updex/sysext"
+	"github.com/frostyard/updex/updex"
+	"github.com/frostyard/updex/webhook"
+)
+
+// serve starts a server for one enabled feature, testfeature, with a
+// transfer, testext, whose source offers version 1.0.0, and a webhook
+// target for checks that fails the test when notified. It returns the
+// server's socket path and the directory the transfer installs to.
+func serve(t *testing.T) (socket, targetDir string) {
+	t.Helper()
+	content := []byte("ext v1.0.0")
+	sum := sha256.Sum256(content)
+	source := testutil.NewTestServer(t, testutil.TestServerFiles{
+		Files:   map[string]string{"testext_1.0.0.raw": hex.EncodeToString(sum[:])},
+		Content: map[string][]byte{"testext_1.0.0.raw": content},
+	})
+	t.Cleanup(source.Close)
+
+	root := t.TempDir()
+	targetDir = t.TempDir()
+	defDir := filepath.Join(root, "sysupdate.d")
+	if err := os.MkdirAll(defDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"testfeature.feature": "[Feature]\nEnabled=true\n",
+		"testext.transfer": "[Transfer]\nFeatures=testfeature\nVerify=false\n\n" +
+			"[Source]\nType=url-file\nPath=" + source.URL + "\nMatchPattern=testext_@v.raw\n\n" +
+			"[Target]\nPath=" + targetDir + "\nMatchPattern=testext_@v.raw\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(defDir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("webhook notified of a %s", r.Header.Get(webhook.EventHeader))
+	}))
+	t.Cleanup(receiver.Close)
+	webhooks := t.TempDir()
+	target := "[Webhook]\nURL=" + receiver.URL + "\nAllowInsecure=yes\nEvents=check\n"
+	if err := os.WriteFile(filepath.Join(webhooks, "fleet.webhook"), []byte(target), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	socket = filepath.Join(t.TempDir(), "updex.socket")
+	l, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	srv := NewServer(Config{
+		Client: updex.ClientConfig{
+			Paths: updex.RuntimePaths{
+				DefinitionRoots:    []string{root},
+				SysextLinkDir:      t.TempDir(),
+				StateDir:           t.TempDir(),
+				WebhookConfigRoots: []string{webhooks},
+				LockPath:           filepath.Join(t.TempDir(), "lock"),
+			},
+			SysextRunner: &sysext.MockRunner{},
+		},
+		Version: "1.2.3",
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, l) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	})
+	return socket, targetDir
+}
+
+// actAs makes servers started later see every caller as uid.
+func actAs(t *testing.T, uid uint32) {
+	t.Helper()
+	orig := peerUID
+	peerUID = func(net.Conn) (uint32, error) { return uid, nil }
+	t.Cleanup(func() { peerUID = orig })
+}
+
+// testReply is a reply as a client decodes it.
+type testReply struct {
+	Parameters map[string]json.RawMessage `json:"parameters"`
+	Continues  bool                       `json:"continues"`
+	Error      string                     `json:"error"`
+}
+
+// invoke makes one call over a new connection and returns its replies,
+// the last being the final one.
+func invoke(t *testing.T, socket, method string, params any, more bool) []testReply {
+	t.Helper()
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	msg, err := json.Marshal(map[string]any{"method": method, "parameters": params, "more": more})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(append(msg, 0)); err != nil {
+		t.Fatalf("write call: %v", err)
+	}
+	r := bufio.NewReader(conn)
+	var replies []testReply
+	for {
+		data, err := r.ReadBytes(0)
+		if err != nil {
+			t.Fatalf("read reply to %s: %v", method, err)
+		}
+		var rep testReply
+		if err := json.Unmarshal(data[:len(data)-1], &rep); err != nil {
+			t.Fatalf("decode reply %q: %v", data, err)
+		}
+		replies = append(replies, rep)
+		if !rep.Continues {
+			return replies
+		}
+	}
+}
+
+func TestServiceInterface(t *testing.T) {
+	socket, _ := serve(t)
+
+	replies := invoke(t, socket, "org.varlink.service.GetInfo", nil, false)
+	var interfaces []string
+	if err := json.Unmarshal(replies[0].Parameters["interfaces"], &interfaces); err != nil || len(interfaces) != 2 || interfaces[1] != Interface {
+		t.Errorf("GetInfo interfaces = %s, want org.varlink.service and %s", replies[0].Parameters["interfaces"], Interface)
+	}
+	if version := string(replies[0].Parameters["version"]); version != `"1.2.3"` {
+		t.Errorf("GetInfo version = %s, want \"1.2.3\"", version)
+	}
+
+	replies = invoke(t, socket, "org.varlink.service.GetInterfaceDescription", map[string]string{"interface": Interface}, false)
+	var description string
+	if err := json.Unmarshal(replies[0].Parameters["description"], &description); err != nil || description != InterfaceDescription {
+		t.Errorf("GetInterfaceDescription = %q, want InterfaceDescription", description)
+	}
+
+	for _, tt := range []struct {
+		method string
+		params any
+		want   string
+	}{
+		{"org.example.Missing.Call", nil, ErrInterfaceNotFound},
+		{Interface + ".Missing", nil, ErrMethodNotFound},
+		{Interface + ".Features", map[string]string{"bogus": "x"}, ErrInvalidParameter},
+		{Interface + ".Features", map[string]int{"component": 1}, ErrInvalidParameter},
+		{Interface + ".EnableFeature", map[string]string{}, ErrInvalidParameter},
+	} {
+		if got := invoke(t, socket, tt.method, tt.params, false); got[0].Error != tt.want {
+			t.Errorf("%s(%v) error = %q, want %q", tt.method, tt.params, got[0].Error, tt.want)
+		}
+	}
+}
+
+// TestUnprivilegedCallers verifies that any user may list and check
+// features, with progress, but only root may change them.
+func TestUnprivilegedCallers(t *testing.T) {
+	actAs(t, 1000)
+	socket, targetDir := serve(t)
+
+	replies := invoke(t, socket, Interface+".Features", nil, false)
+	var features []updex.FeatureInfo
+	if err := json.Unmarshal(replies[0].Parameters["features"], &features); err != nil || len(features) != 1 || features[0].Name != "testfeature" {
+		t.Errorf("Features = %s, want testfeature", replies[0].Parameters["features"])
+	}
+
+	replies = invoke(t, socket, Interface+".CheckFeatures", nil, true)
+	var results []updex.CheckFeaturesResult
+	last := replies[len(replies)-1]
+	if err := json.Unmarshal(last.Parameters["results"], &results); err != nil || len(results) != 1 || !results[0].Results[0].UpdateAvailable {
+		t.Errorf("CheckFeatures results = %s, want testext with an update available", last.Parameters["results"])
+	}
+	if len(replies) < 2 {
+		t.Errorf("CheckFeatures with more sent no progress: %+v", replies)
+	}
+
+	for _, method := range []string{"UpdateFeatures", "EnableFeature", "DisableFeature", "CatalogAdd", "CatalogRemove"} {
+		if got := invoke(t, socket, Interface+"."+method, map[string]string{"name": "testfeature"}, false); got[0].Error != ErrPermissionDenied {
+			t.Errorf("%s by UID 1000 error = %q, want %q", method, got[0].Error, ErrPermissionDenied)
+		}
+	}
+	if entries, _ := os.ReadDir(targetDir); len(entries) != 0 {
+		t.Errorf("denied calls installed %d files", len(entries))
+	}
+}
+
+// TestUpdateFeaturesStreamsProgress verifies that a root caller's update
+// reports its messages and events before the results.
+func TestUpdateFeaturesStreamsProgress(t *testing.T) {
+	actAs(t, 0)
+	socket, targetDir := serve(t)
+
+	replies := invoke(t, socket, Interface+".UpdateFeatures", map[string]bool{"noRefresh": true}, true)
+	var installed bool
+	for _, rep := range replies[:len(replies)-1] {
+		var p Progress
+		if err := json.Unmarshal(rep.Parameters["progress"], &p); err != nil {
+			t.Fatalf("notification %v: %v", rep.Parameters, err)
+		}
+		if p.Event == string(updex.EventInstalled) {
+			installed = p.Feature == "testfeature" && p.Transfer == "testext" && p.Version == "1.0.0"
+		}
+	}
+	if !installed {
+		t.Errorf("no installed event for testext 1.0.0 among %+v", replies)
+	}
+
+	last := replies[len(replies)-1]
+	var results []updex.UpdateFeaturesResult
+	if err := json.Unmarshal(last.Parameters["results"], &results); err != nil || len(results) != 1 || !results[0].Results[0].Downloaded {
+		t.Errorf("UpdateFeatures results = %s (error %q), want testext downloaded", last.Parameters["results"], last.Error)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "testext_1.0.0.raw")); err != nil {
+		t.Errorf("update did not install testext: %v", err)
+	}
+}
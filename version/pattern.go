@@ -1,10 +1,12 @@
 package version
 
 import (
+	"fmt"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	goversion "github.com/hashicorp/go-version"
 )
@@ -18,18 +20,41 @@ type Pattern struct {
 
 // Placeholder definitions for pattern matching
 var placeholders = map[string]string{
-	"@v": `([a-zA-Z0-9._+:~-]+)`, // Version - required, captured (includes : for epoch, ~ for debian versions)
-	"@u": `[a-fA-F0-9-]+`,        // UUID
-	"@f": `[0-9]+`,               // Flags
-	"@a": `[01]`,                 // GPT NoAuto flag (0 or 1)
-	"@g": `[01]`,                 // GrowFileSystem flag
-	"@r": `[01]`,                 // Read-only flag
-	"@t": `[0-9]+`,               // Modification time
-	"@m": `[0-7]+`,               // File mode
-	"@s": `[0-9]+`,               // File size
-	"@d": `[0-9]+`,               // Tries done
-	"@l": `[0-9]+`,               // Tries left
-	"@h": `[a-fA-F0-9]+`,         // SHA256 hash
+	"@v": `[a-zA-Z0-9._+:~-]+`, // Version - required (includes : for epoch, ~ for debian versions)
+	"@u": `[a-fA-F0-9-]+`,      // UUID
+	"@f": `[0-9]+`,             // Flags
+	"@a": `[01]`,               // GPT NoAuto flag (0 or 1)
+	"@g": `[01]`,               // GrowFileSystem flag
+	"@r": `[01]`,               // Read-only flag
+	"@t": `[0-9]+`,             // Modification time
+	"@m": `[0-7]+`,             // File mode
+	"@s": `[0-9]+`,             // File size
+	"@d": `[0-9]+`,             // Tries done
+	"@l": `[0-9]+`,             // Tries left
+	"@h": `[a-fA-F0-9]+`,       // SHA256 hash
+}
+
+// captured maps the placeholders whose values are extracted from a match to
+// their regexp group names.
+var captured = map[string]string{
+	"@v": "v",
+	"@t": "t",
+	"@m": "m",
+	"@r": "r",
+	"@s": "s",
+}
+
+// Fields are the values a filename carries for the @v, @t, @m, @r and @s
+// placeholders. Has* and a zero ModTime mark placeholders the pattern lacks.
+type Fields struct {
+	Version     string
+	ModTime     time.Time // @t, microseconds since the epoch
+	Mode        uint32    // @m, octal
+	HasMode     bool
+	ReadOnly    bool // @r, 0 or 1
+	HasReadOnly bool
+	Size        int64 // @s, bytes after decompression
+	HasSize     bool
 }
 
 // ParsePattern parses a match pattern string into a Pattern struct
@@ -48,6 +73,9 @@ func ParsePattern(pattern string) (*Pattern, error) {
 
 	// Replace placeholders with regex patterns
 	for placeholder, regex := range placeholders {
+		if name, ok := captured[placeholder]; ok {
+			regex = "(?P<" + name + ">" + regex + ")"
+		}
 		quotedPlaceholder := regexp.QuoteMeta(placeholder)
 		regexStr = strings.ReplaceAll(regexStr, quotedPlaceholder, regex)
 	}
@@ -70,11 +98,46 @@ func ParsePattern(pattern string) (*Pattern, error) {
 // ExtractVersion extracts the version string from a filename using the pattern
 func (p *Pattern) ExtractVersion(filename string) (string, bool) {
 	matches := p.regex.FindStringSubmatch(filename)
-	if len(matches) < 2 {
+	if matches == nil {
 		return "", false
 	}
-	// First capture group is the version (@v)
-	return matches[1], true
+	return matches[p.regex.SubexpIndex("v")], true
+}
+
+// ExtractFields extracts the version and the @t, @m, @r and @s values from a
+// filename using the pattern. A filename whose values do not parse (an @m
+// beyond 07777, an @s beyond int64) does not match.
+func (p *Pattern) ExtractFields(filename string) (Fields, bool) {
+	matches := p.regex.FindStringSubmatch(filename)
+	if matches == nil {
+		return Fields{}, false
+	}
+	f := Fields{Version: matches[p.regex.SubexpIndex("v")]}
+	if i := p.regex.SubexpIndex("t"); i >= 0 {
+		usec, err := strconv.ParseInt(matches[i], 10, 64)
+		if err != nil {
+			return Fields{}, false
+		}
+		f.ModTime = time.UnixMicro(usec)
+	}
+	if i := p.regex.SubexpIndex("m"); i >= 0 {
+		mode, err := strconv.ParseUint(matches[i], 8, 32)
+		if err != nil || mode > 07777 {
+			return Fields{}, false
+		}
+		f.Mode, f.HasMode = uint32(mode), true
+	}
+	if i := p.regex.SubexpIndex("r"); i >= 0 {
+		f.ReadOnly, f.HasReadOnly = matches[i] == "1", true
+	}
+	if i := p.regex.SubexpIndex("s"); i >= 0 {
+		size, err := strconv.ParseInt(matches[i], 10, 64)
+		if err != nil {
+			return Fields{}, false
+		}
+		f.Size, f.HasSize = size, true
+	}
+	return f, true
 }
 
 // Matches checks if a filename matches the pattern
@@ -84,13 +147,32 @@ func (p *Pattern) Matches(filename string) bool {
 
 // BuildFilename builds a filename from the pattern template with the given version
 func (p *Pattern) BuildFilename(version string) string {
+	return p.BuildFilenameWith(Fields{Version: version})
+}
+
+// BuildFilenameWith builds a filename from the pattern template, filling
+// @v, @t, @m, @r and @s from f. Placeholders f has no value for are dropped.
+func (p *Pattern) BuildFilenameWith(f Fields) string {
+	values := map[string]string{"@v": f.Version}
+	if !f.ModTime.IsZero() {
+		values["@t"] = strconv.FormatInt(f.ModTime.UnixMicro(), 10)
+	}
+	if f.HasMode {
+		values["@m"] = fmt.Sprintf("%03o", f.Mode)
+	}
+	if f.HasReadOnly {
+		values["@r"] = "0"
+		if f.ReadOnly {
+			values["@r"] = "1"
+		}
+	}
+	if f.HasSize {
+		values["@s"] = strconv.FormatInt(f.Size, 10)
+	}
+
 	result := p.template
-	result = strings.ReplaceAll(result, "@v", version)
-	// Remove other placeholders (they're optional in output)
 	for placeholder := range placeholders {
-		if placeholder != "@v" {
-			result = strings.ReplaceAll(result, placeholder, "")
-		}
+		result = strings.ReplaceAll(result, placeholder, values[placeholder])
 	}
 	return result
 }
@@ -130,6 +212,17 @@ func ExtractVersionParsed(filename string, patterns []*Pattern) (version string,
 	return "", "", false
 }
 
+// ExtractFieldsParsed is ExtractVersionParsed returning every captured
+// placeholder value from the first pattern that matches.
+func ExtractFieldsParsed(filename string, patterns []*Pattern) (Fields, bool) {
+	for _, p := range patterns {
+		if f, ok := p.ExtractFields(filename); ok {
+			return f, true
+		}
+	}
+	return Fields{}, false
+}
+
 // Compare compares two version strings
 // Returns -1 if v1 < v2, 0 if v1 == v2, 1 if v1 > v2
 func Compare(v1, v2 string) int {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParsePattern(t *testing.T) {
@@ -240,6 +241,102 @@ func TestPattern_BuildFilename(t *testing.T) {
 	}
 }
 
+func TestPattern_ExtractFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		filename string
+		want     Fields
+		wantOK   bool
+	}{
+		{
+			name:     "version only",
+			pattern:  "myext_@v.raw",
+			filename: "myext_1.0.0.raw",
+			want:     Fields{Version: "1.0.0"},
+			wantOK:   true,
+		},
+		{
+			name:     "all metadata placeholders",
+			pattern:  "myext_@v_@t_@m_@r_@s.raw",
+			filename: "myext_1.0.0_1700000000123456_0640_1_4096.raw",
+			want: Fields{
+				Version:  "1.0.0",
+				ModTime:  time.UnixMicro(1700000000123456),
+				Mode:     0640,
+				HasMode:  true,
+				ReadOnly: true, HasReadOnly: true,
+				Size: 4096, HasSize: true,
+			},
+			wantOK: true,
+		},
+		{
+			name:     "version after a metadata placeholder",
+			pattern:  "@s-myext_@v.raw",
+			filename: "12-myext_2.0.raw",
+			want:     Fields{Version: "2.0", Size: 12, HasSize: true},
+			wantOK:   true,
+		},
+		{
+			name:     "mode out of range",
+			pattern:  "myext_@v_@m.raw",
+			filename: "myext_1.0.0_17777.raw",
+		},
+		{
+			name:     "no match",
+			pattern:  "myext_@v_@s.raw",
+			filename: "myext_1.0.0.raw",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("ParsePattern() error = %v", err)
+			}
+			got, ok := p.ExtractFields(tt.filename)
+			if ok != tt.wantOK {
+				t.Fatalf("ExtractFields() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !got.ModTime.Equal(tt.want.ModTime) {
+				t.Errorf("ExtractFields() ModTime = %v, want %v", got.ModTime, tt.want.ModTime)
+			}
+			got.ModTime, tt.want.ModTime = time.Time{}, time.Time{}
+			if got != tt.want {
+				t.Errorf("ExtractFields() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPattern_BuildFilenameWith(t *testing.T) {
+	p, err := ParsePattern("myext_@v_@t_@m_@r_@s.raw")
+	if err != nil {
+		t.Fatalf("ParsePattern() error = %v", err)
+	}
+
+	f := Fields{
+		Version:  "1.0.0",
+		ModTime:  time.UnixMicro(1700000000123456),
+		Mode:     0640,
+		HasMode:  true,
+		ReadOnly: true, HasReadOnly: true,
+		Size: 4096, HasSize: true,
+	}
+	want := "myext_1.0.0_1700000000123456_640_1_4096.raw"
+	if got := p.BuildFilenameWith(f); got != want {
+		t.Errorf("BuildFilenameWith() = %q, want %q", got, want)
+	}
+	if got, ok := p.ExtractFields(want); !ok || got.Size != f.Size || !got.ModTime.Equal(f.ModTime) || got.Mode != f.Mode || !got.ReadOnly {
+		t.Errorf("ExtractFields(BuildFilenameWith()) = %+v, %v; want the fields back", got, ok)
+	}
+
+	if got, want := p.BuildFilenameWith(Fields{Version: "1.0.0"}), "myext_1.0.0____.raw"; got != want {
+		t.Errorf("BuildFilenameWith() without values = %q, want %q", got, want)
+	}
+}
+
 func TestPattern_Raw(t *testing.T) {
 	pattern := "myext_@v.raw"
 	p, err := ParsePattern(pattern)
@@ -0,0 +1,277 @@
+// Package webhook delivers JSON notifications to HTTP webhook targets: it
+// loads the targets from *.webhook configuration files and POSTs a body to
+// one, signed with the target's secret when it has one, retrying transient
+// failures.
+//
+// The package knows nothing of what it sends; updex builds the body from
+// the results of a run.
+package webhook
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/frostyard/updex/internal/retry"
+	"gopkg.in/ini.v1"
+)
+
+const webhookSuffix = ".webhook"
+
+// ConfigRoots are the directories scanned for *.webhook target
+// definitions, in priority order (earlier roots win per filename). SDK
+// callers should inject roots via updex.RuntimePaths rather than mutating
+// this variable.
+var ConfigRoots = []string{
+	"/etc/updex/webhooks.d",
+	"/run/updex/webhooks.d",
+	"/usr/local/lib/updex/webhooks.d",
+	"/usr/lib/updex/webhooks.d",
+}
+
+// The events a target can receive, sent in EventHeader.
+const (
+	// EventUpdate is sent after an update run.
+	EventUpdate = "update"
+	// EventCheck is sent after a check for updates.
+	EventCheck = "check"
+)
+
+// EventHeader names the event a POST reports.
+const EventHeader = "X-Updex-Event"
+
+// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body,
+// keyed with the target's secret (see Sign). It is only sent to targets
+// with a Secret.
+const SignatureHeader = "X-Updex-Signature-256"
+
+// requestTimeout bounds one delivery attempt, so an unresponsive receiver
+// cannot hold up a run for the HTTP client's download-sized timeout.
+const requestTimeout = 30 * time.Second
+
+// Target describes one webhook target, loaded from a <name>.webhook INI
+// file:
+//
+//	[Webhook]
+//	URL=https://fleet.example.com/hooks/updex
+//	# Secret=s3cr3t           (optional; signs each POST, see SignatureHeader)
+//	# Events=update check     (optional; default both)
+//	# AllowInsecure=no        (optional; permits a non-HTTPS URL when yes)
+type Target struct {
+	// Name is the target name, derived from the .webhook filename stem.
+	Name string
+	// URL is where notifications are POSTed. Required, and HTTPS unless
+	// AllowInsecure is true.
+	URL string
+	// Secret, if set, is the HMAC key each POST is signed with.
+	Secret string
+	// Events lists the events the target receives; all of them when
+	// empty.
+	Events []string
+	// AllowInsecure permits a non-HTTPS URL. It is intended only for
+	// explicitly trusted development and test endpoints.
+	AllowInsecure bool
+}
+
+// Wants reports whether t receives event.
+func (t Target) Wants(event string) bool {
+	return len(t.Events) == 0 || slices.Contains(t.Events, event)
+}
+
+// targetNamePattern matches valid target names, as for catalog repos.
+var targetNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// LoadTargetsFrom loads the webhook targets defined in configRoots,
+// earlier roots winning per filename, sorted by name. No definitions is
+// not an error: webhooks are optional.
+func LoadTargetsFrom(configRoots []string) ([]Target, error) {
+	files := make(map[string]string) // name -> path, first root wins
+
+	for _, dir := range configRoots {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), webhookSuffix) {
+				continue
+			}
+			name := strings.TrimSuffix(entry.Name(), webhookSuffix)
+			if _, exists := files[name]; !exists {
+				files[name] = filepath.Join(dir, entry.Name())
+			}
+		}
+	}
+
+	targets := make([]Target, 0, len(files))
+	for name, path := range files {
+		target, err := parseTargetFile(name, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		targets = append(targets, target)
+	}
+
+	slices.SortFunc(targets, func(a, b Target) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return targets, nil
+}
+
+// LoadTargets loads the webhook targets defined in ConfigRoots.
+func LoadTargets() ([]Target, error) {
+	return LoadTargetsFrom(ConfigRoots)
+}
+
+func parseTargetFile(name, path string) (Target, error) {
+	if !targetNamePattern.MatchString(name) {
+		return Target{}, fmt.Errorf("invalid webhook name %q (allowed: [a-zA-Z0-9_-]+)", name)
+	}
+
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return Target{}, fmt.Errorf("failed to load INI file: %w", err)
+	}
+
+	sec, err := cfg.GetSection("Webhook")
+	if err != nil {
+		return Target{}, fmt.Errorf("missing [Webhook] section")
+	}
+
+	target := Target{Name: name}
+	if key, err := sec.GetKey("URL"); err == nil {
+		target.URL = key.String()
+	}
+	if key, err := sec.GetKey("Secret"); err == nil {
+		target.Secret = key.String()
+	}
+	if key, err := sec.GetKey("Events"); err == nil {
+		target.Events = strings.Fields(key.String())
+	}
+	if key, err := sec.GetKey("AllowInsecure"); err == nil {
+		target.AllowInsecure, err = key.Bool()
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid AllowInsecure value: %w", err)
+		}
+	}
+
+	if target.URL == "" {
+		return Target{}, fmt.Errorf("URL is required")
+	}
+	if err := validateURL(target.URL, target.AllowInsecure); err != nil {
+		return Target{}, err
+	}
+	for _, event := range target.Events {
+		if event != EventUpdate && event != EventCheck {
+			return Target{}, fmt.Errorf("unknown event %q in Events (allowed: %s, %s)", event, EventUpdate, EventCheck)
+		}
+	}
+
+	return target, nil
+}
+
+func validateURL(value string, allowInsecure bool) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("URL must be an absolute URL")
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme != "https" && scheme != "http" {
+		return fmt.Errorf("URL must use http or https")
+	}
+	if scheme != "https" && !allowInsecure {
+		return fmt.Errorf("URL must use https unless AllowInsecure=yes")
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value for body keyed with secret.
+// Receivers recompute it over the raw body and compare with hmac.Equal.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type sendSettings struct {
+	cfg    retry.Config
+	notify retry.Notify
+}
+
+// Option configures Send.
+type Option func(*sendSettings)
+
+// WithRetryConfig configures bounded retry attempts and base backoff delay.
+func WithRetryConfig(maxAttempts int, baseDelay time.Duration) Option {
+	return func(settings *sendSettings) {
+		settings.cfg = retry.Config{
+			MaxAttempts: maxAttempts,
+			BaseDelay:   baseDelay,
+		}
+	}
+}
+
+// WithRetryNotify configures a callback called before retry backoff sleeps.
+func WithRetryNotify(fn func(attempt, maxAttempts int, reason error)) Option {
+	return func(settings *sendSettings) {
+		settings.notify = retry.Notify(fn)
+	}
+}
+
+// Send POSTs body, a JSON document reporting event, to target. Network
+// failures and HTTP 5xx/429 responses are retried with exponential
+// backoff; any other status outside 2xx fails at once.
+func Send(ctx context.Context, httpClient *http.Client, target Target, event string, body []byte, opts ...Option) error {
+	settings := sendSettings{cfg: retry.DefaultConfig}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+
+	return retry.Do(ctx, settings.cfg, settings.notify, func() error {
+		reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, target.URL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(EventHeader, event)
+		if target.Secret != "" {
+			req.Header.Set(SignatureHeader, Sign(target.Secret, body))
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return retry.TransientIfNetwork(fmt.Errorf("webhook %s: %w", target.Name, err))
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			return retry.Transient(fmt.Errorf("webhook %s failed with status: %s", target.Name, resp.Status))
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("webhook %s failed with status: %s", target.Name, resp.Status)
+		}
+		return nil
+	})
+}
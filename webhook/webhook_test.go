@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeTargetFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".webhook"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadTargetsFrom(t *testing.T) {
+	etc, usr := t.TempDir(), t.TempDir()
+	writeTargetFile(t, etc, "fleet", "[Webhook]\nURL=https://fleet.example.com/hook\nSecret=s3cr3t\nEvents=update\n")
+	writeTargetFile(t, usr, "fleet", "[Webhook]\nURL=https://vendor.example.com/hook\n")
+	writeTargetFile(t, usr, "audit", "[Webhook]\nURL=http://localhost:9000/\nAllowInsecure=yes\n")
+
+	targets, err := LoadTargetsFrom([]string{etc, usr, filepath.Join(t.TempDir(), "missing")})
+	if err != nil {
+		t.Fatalf("LoadTargetsFrom() error = %v", err)
+	}
+	if len(targets) != 2 || targets[0].Name != "audit" || targets[1].Name != "fleet" {
+		t.Fatalf("targets = %+v, want audit and fleet", targets)
+	}
+	if fleet := targets[1]; fleet.URL != "https://fleet.example.com/hook" || fleet.Secret != "s3cr3t" || !slices.Equal(fleet.Events, []string{EventUpdate}) {
+		t.Errorf("fleet = %+v, want the /etc definition", fleet)
+	}
+	if !targets[0].Wants(EventCheck) || targets[1].Wants(EventCheck) {
+		t.Errorf("Wants(check) = %v, %v, want true, false", targets[0].Wants(EventCheck), targets[1].Wants(EventCheck))
+	}
+
+	if targets, err := LoadTargetsFrom([]string{t.TempDir()}); err != nil || len(targets) != 0 {
+		t.Errorf("LoadTargetsFrom(empty) = %+v, %v, want no targets", targets, err)
+	}
+}
+
+func TestLoadTargetsFromRejectsInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		content string
+		want    string
+	}{
+		{"[Other]\nURL=https://example.com/\n", "missing [Webhook] section"},
+		{"[Webhook]\nSecret=x\n", "URL is required"},
+		{"[Webhook]\nURL=http://example.com/\n", "must use https"},
+		{"[Webhook]\nURL=ftp://example.com/\nAllowInsecure=yes\n", "must use http or https"},
+		{"[Webhook]\nURL=https://example.com/\nEvents=update install\n", `unknown event "install"`},
+	} {
+		dir := t.TempDir()
+		writeTargetFile(t, dir, "bad", tt.content)
+		if _, err := LoadTargetsFrom([]string{dir}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("LoadTargetsFrom(%q) error = %v, want %q", tt.content, err, tt.want)
+		}
+	}
+}
+
+// TestSendSignsAndRetries verifies that Send retries a 5xx response and
+// delivers the body with its event and a signature the receiver can check.
+func TestSendSignsAndRetries(t *testing.T) {
+	var attempts atomic.Int32
+	var gotBody []byte
+	var gotEvent, gotSignature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		gotBody, _ = io.ReadAll(r.Body)
+		gotEvent, gotSignature = r.Header.Get(EventHeader), r.Header.Get(SignatureHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var retries int
+	body := []byte(`{"event":"update"}`)
+	target := Target{Name: "fleet", URL: server.URL, Secret: "s3cr3t", AllowInsecure: true}
+	err := Send(t.Context(), server.Client(), target, EventUpdate, body,
+		WithRetryConfig(3, time.Millisecond),
+		WithRetryNotify(func(int, int, error) { retries++ }))
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if attempts.Load() != 2 || retries != 1 {
+		t.Errorf("attempts = %d, retries = %d, want 2 and 1", attempts.Load(), retries)
+	}
+	if string(gotBody) != string(body) || gotEvent != EventUpdate {
+		t.Errorf("received %q for event %q, want %q for update", gotBody, gotEvent, body)
+	}
+	if !hmac.Equal([]byte(gotSignature), []byte(Sign("s3cr3t", body))) || !strings.HasPrefix(gotSignature, "sha256=") {
+		t.Errorf("signature = %q, want %q", gotSignature, Sign("s3cr3t", body))
+	}
+}
+
+// TestSendClientErrorIsFinal verifies that a 4xx response is not retried
+// and that an unsigned target sends no signature.
+func TestSendClientErrorIsFinal(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if r.Header.Get(SignatureHeader) != "" {
+			t.Errorf("unsigned target sent %s", SignatureHeader)
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	target := Target{Name: "fleet", URL: server.URL, AllowInsecure: true}
+	err := Send(t.Context(), server.Client(), target, EventCheck, []byte("{}"), WithRetryConfig(3, time.Millisecond))
+	if err == nil || !strings.Contains(err.Error(), "webhook fleet failed with status: 403 Forbidden") {
+		t.Errorf("Send() error = %v, want a 403 failure", err)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("attempts = %d, want 1", attempts.Load())
+	}
+}